@@ -100,6 +100,22 @@ func (f *Facility) Logger(logName string) bark.Logger {
 
 }
 
+// Enabled returns whether messages of level produced by the named logger
+// logName are logged by the underlying logger, which they are not when they
+// are silenced with SetLevel, when the underlying logger is NoLogger or when
+// it is not enabled for level itself, see Enabled.
+func (f *Facility) Enabled(logName string, level Level) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if setLevel, ok := f.levels[logName]; ok && setLevel < level {
+		return false
+	}
+	if _, silent := f.logger.(noLogger); silent {
+		return false
+	}
+	return Enabled(f.logger, level)
+}
+
 // Log logs messages with a severity level equal to or higher than the one set
 // with SetLevel. If that's not the case, the message is silenced.
 // If the logName was not previously configured with SetLevel, the messages are
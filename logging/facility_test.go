@@ -24,6 +24,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 	"github.com/uber-common/bark"
@@ -92,6 +94,44 @@ func (s *LogFacilityTestSuite) afterLevelIsSet() {
 	s.mockLogger.AssertNotCalled(s.T(), "Debugf", "format %s", msg)
 }
 
+func (s *LogFacilityTestSuite) TestEnabled() {
+	s.True(s.facility.Enabled("name", Debug), "Levels should be enabled by default.")
+	s.facility.SetLevel("name", Warn)
+	s.False(s.facility.Enabled("name", Info))
+	s.True(s.facility.Enabled("name", Warn))
+	s.True(s.facility.Enabled("other", Debug))
+
+	s.False(NewFacility(nil).Enabled("name", Error), "No level should be enabled without a logger.")
+
+	logger := s.facility.Logger("name")
+	s.False(Enabled(logger, Debug))
+	s.True(Enabled(logger.WithField("a", 1), Error))
+	s.True(Enabled(s.mockLogger, Debug), "Other loggers should log all levels.")
+}
+
+// leveledLogger is a logger that tells which levels it logs.
+type leveledLogger struct {
+	bark.Logger
+	level Level
+}
+
+func (l leveledLogger) Enabled(level Level) bool {
+	return l.level >= level
+}
+
+func TestEnabledLeveledLogger(t *testing.T) {
+	logger := leveledLogger{bark.NewLoggerFromLogrus(logrus.New()), Info}
+
+	assert.False(t, Enabled(logger, Debug), "Loggers should be asked for their level.")
+	assert.True(t, Enabled(logger, Info))
+	assert.True(t, Enabled(logger.Logger, Debug), "Loggers that do not tell should log all levels.")
+
+	logger.level = Warn
+	facility := NewFacility(logger)
+	assert.False(t, facility.Enabled("name", Info), "Facilities should ask their underlying logger.")
+	assert.True(t, Enabled(facility.Logger("name"), Warn))
+}
+
 func (s *LogFacilityTestSuite) TestSetLevelError() {
 	s.Error(s.facility.SetLevel("name", Panic), "Setting a severity level above Fatal should fail.")
 }
@@ -103,6 +103,30 @@ func (l *namedLogger) WithFields(fields bark.LogFields) bark.Logger {
 	}
 }
 
+// Enabled returns whether l logs messages of level, so callers can skip
+// building the fields of messages that would be silenced. Loggers tell by
+// implementing an Enabled(level Level) bool method, as the named loggers of a
+// Facility do by asking the Facility. Other loggers are assumed to log all
+// levels.
+func Enabled(l bark.Logger, level Level) bool {
+	if e, ok := l.(interface {
+		Enabled(level Level) bool
+	}); ok {
+		return e.Enabled(level)
+	}
+	return true
+}
+
+// Enabled returns whether messages of level are logged, see Facility.Enabled.
+func (l *namedLogger) Enabled(level Level) bool {
+	if e, ok := l.forwardTo.(interface {
+		Enabled(logName string, level Level) bool
+	}); ok {
+		return e.Enabled(l.name, level)
+	}
+	return true
+}
+
 // This is needed to fully implement the bark.Logger interface.
 func (l *namedLogger) Fields() bark.Fields {
 	return l.fields
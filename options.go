@@ -47,6 +47,10 @@ type configuration struct {
 
 	// StateTimeouts keeps the state transition timeouts for swim to use
 	StateTimeouts swim.StateTimeouts
+
+	// Namespace isolates the ring of this instance from the rings of other
+	// instances sharing the same TChannel. See the Namespace option.
+	Namespace string
 }
 
 // An Option is a modifier functions that configure/modify a real Ringpop
@@ -280,6 +284,28 @@ func TombstonePeriod(period time.Duration) Option {
 	}
 }
 
+// Namespace makes Ringpop join the ring of the given namespace, which allows
+// one process to participate in several logical rings over a single TChannel,
+// each with its own membership:
+//
+//     indexer, err := ringpop.New("my-app", ringpop.Channel(ch), ringpop.Namespace("indexer"))
+//     storage, err := ringpop.New("my-app", ringpop.Channel(ch), ringpop.Namespace("storage"))
+//
+// Members of a namespace talk over the "ringpop-<namespace>" service of
+// their TChannel instead of the "ringpop" service, so all members of a ring
+// must use the same namespace, and rings of different namespaces never see
+// each other. The namespace is also part of the prefix of the stats of the
+// instance. Routers created on each instance route over its ring only.
+func Namespace(name string) Option {
+	return func(r *Ringpop) error {
+		if name == "" {
+			return errors.New("namespace is empty")
+		}
+		r.config.Namespace = name
+		return nil
+	}
+}
+
 // Default options
 
 // defaultClock sets the ringpop clock interface to use the system clock
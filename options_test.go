@@ -272,6 +272,23 @@ func (s *RingpopOptionsTestSuite) TestCombinedPeriodConfig() {
 	s.Equal(rp.config.StateTimeouts.Tombstone, 3*time.Second)
 }
 
+func (s *RingpopOptionsTestSuite) TestNamespace() {
+	rp, err := New("test", Channel(s.channel))
+	s.Require().NoError(err)
+	s.Equal("ringpop", rp.serviceName())
+
+	rp, err = New("test", Channel(s.channel), Namespace("indexer"))
+	s.Require().NoError(err)
+	s.Equal("indexer", rp.config.Namespace)
+	s.Equal("ringpop-indexer", rp.serviceName())
+}
+
+func (s *RingpopOptionsTestSuite) TestNamespaceEmpty() {
+	rp, err := New("test", Channel(s.channel), Namespace(""))
+	s.Error(err)
+	s.Nil(rp)
+}
+
 func TestRingpopOptionsTestSuite(t *testing.T) {
 	suite.Run(t, new(RingpopOptionsTestSuite))
 }
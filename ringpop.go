@@ -160,7 +160,7 @@ func (rp *Ringpop) init() error {
 		return err
 	}
 
-	rp.subChannel = rp.channel.GetSubChannel("ringpop", tchannel.Isolated)
+	rp.subChannel = rp.channel.GetSubChannel(rp.serviceName(), tchannel.Isolated)
 	rp.registerHandlers()
 
 	rp.node = swim.NewNode(rp.config.App, address, rp.subChannel, &swim.Options{
@@ -174,6 +174,9 @@ func (rp *Ringpop) init() error {
 
 	rp.stats.hostport = genStatsHostport(address)
 	rp.stats.prefix = fmt.Sprintf("ringpop.%s", rp.stats.hostport)
+	if rp.config.Namespace != "" {
+		rp.stats.prefix = fmt.Sprintf("ringpop.%s.%s", rp.config.Namespace, rp.stats.hostport)
+	}
 	rp.stats.keys = make(map[string]string)
 
 	rp.forwarder = forward.NewForwarder(rp, rp.subChannel)
@@ -185,6 +188,15 @@ func (rp *Ringpop) init() error {
 	return nil
 }
 
+// serviceName returns the name of the TChannel service the members of the
+// ring of this instance talk over, see Namespace.
+func (rp *Ringpop) serviceName() string {
+	if rp.config.Namespace != "" {
+		return "ringpop-" + rp.config.Namespace
+	}
+	return "ringpop"
+}
+
 // Starts periodic timers in a single goroutine. Can be turned back off via
 // stopTimers. At present, only 1 timer exists, to emit ring.checksum-periodic.
 func (rp *Ringpop) startTimers() {
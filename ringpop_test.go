@@ -662,6 +662,44 @@ func (s *RingpopTestSuite) TestErrorOnChannelNotListening() {
 	s.Nil(nodesJoined)
 }
 
+func (s *RingpopTestSuite) TestNamespacesIsolateRings() {
+	newNamespaced := func(ch *tchannel.Channel, namespace string) *Ringpop {
+		rp, err := New("test", Channel(ch), Clock(s.mockClock), Namespace(namespace))
+		s.Require().NoError(err, "Ringpop must create successfully")
+		s.destroyables = append(s.destroyables, rp)
+		return rp
+	}
+
+	var channels []*tchannel.Channel
+	for i := 0; i < 2; i++ {
+		ch, err := tchannel.NewChannel("test", nil)
+		s.Require().NoError(err, "channel must create successfully")
+		s.Require().NoError(ch.ListenAndServe("127.0.0.1:0"), "channel must listen successfully")
+		s.destroyables = append(s.destroyables, &destroyableChannel{ch})
+		channels = append(channels, ch)
+	}
+
+	// the first process participates in both rings, the second in one
+	indexer := newNamespaced(channels[0], "indexer")
+	storage := newNamespaced(channels[0], "storage")
+	joiner := newNamespaced(channels[1], "indexer")
+
+	s.Require().NoError(createSingleNodeCluster(indexer))
+	s.Require().NoError(createSingleNodeCluster(storage))
+	_, err := joiner.Bootstrap(&swim.BootstrapOptions{
+		DiscoverProvider: statichosts.New(channels[0].PeerInfo().HostPort),
+	})
+	s.Require().NoError(err, "expected to join the ring of the namespace")
+
+	members, err := joiner.GetReachableMembers()
+	s.NoError(err)
+	s.Contains(members, channels[0].PeerInfo().HostPort)
+
+	count, err := storage.CountReachableMembers()
+	s.NoError(err)
+	s.Equal(1, count, "expected the ring of another namespace to be unaffected")
+}
+
 func TestRingpopTestSuite(t *testing.T) {
 	suite.Run(t, new(RingpopTestSuite))
 }
@@ -0,0 +1,195 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go"
+)
+
+// InvalidateDestination evicts the client of dest from the cache, so the
+// next call to dest creates a new client from a new Dial of the Transport,
+// and returns whether a client of dest was cached. Evicted clients are
+// closed when they implement io.Closer, like on any eviction.
+func (r *router) InvalidateDestination(dest string) bool {
+	_, ok := r.cache.get(r.cacheKey(dest))
+	if ok {
+		r.removeClient(dest)
+		r.logger.WithField("dest", dest).Info("router invalidated client")
+		r.statter.IncCounter("router.admin.invalidated", nil, 1)
+	}
+	return ok
+}
+
+// InvalidateAll evicts all clients of the router from the cache and returns
+// the number of clients evicted.
+func (r *router) InvalidateAll() int {
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+
+	evicted := 0
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		if entry, ok := r.cache.remove(cacheKey); ok {
+			r.evict([]*cacheEntry{entry})
+			evicted++
+		}
+	}
+	r.logger.WithField("evicted", evicted).Info("router invalidated all clients")
+	r.statter.IncCounter("router.admin.invalidated", nil, int64(evicted))
+	return evicted
+}
+
+// A ConnectionCloser is a Transport that can close its connections to a
+// destination, see Refresh.
+type ConnectionCloser interface {
+	CloseConnections(dest string) error
+}
+
+// CloseConnections closes the active connections of the channel to dest,
+// inbound ones included, and returns the first error closing them.
+func (t *TChannelTransport) CloseConnections(dest string) error {
+	state, ok := t.Channel.IntrospectState(&tchannel.IntrospectionOptions{}).RootPeers[dest]
+	if !ok {
+		return nil
+	}
+	active := 0
+	for _, conn := range append(state.OutboundConnections, state.InboundConnections...) {
+		if conn.ConnectionState == activeConnectionState {
+			active++
+		}
+	}
+	if active == 0 {
+		return nil
+	}
+
+	// the peer is only reachable through the peer list of the channel, which
+	// is left as it was
+	peers := t.Channel.Peers()
+	if _, listed := peers.Copy()[dest]; !listed {
+		defer peers.Remove(dest)
+	}
+	peer := peers.GetOrAdd(dest)
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	var first error
+	// every connection closed stops being active, so the next one is
+	// returned
+	for i := 0; i < active; i++ {
+		conn, err := peer.GetConnection(ctx)
+		if err == nil {
+			err = conn.Close()
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Refresh replaces the client of dest by a new one and, when the Transport
+// is a Pinger, opens its connection with a ping, eg. to reconnect to a peer
+// after network maintenance before the next call to dest. The connections of
+// a Transport that is a ConnectionCloser to dest are closed first, so the new
+// client does not reuse a connection that outlived the maintenance.
+func (r *router) Refresh(dest string) error {
+	r.InvalidateDestination(dest)
+	if c, ok := r.transport.(ConnectionCloser); ok {
+		if err := c.CloseConnections(r.dialAddress(dest)); err != nil {
+			r.logger.WithFields(bark.Fields{
+				"dest":  dest,
+				"error": err,
+			}).Warn("router failed to close connections")
+		}
+	}
+	if _, err := r.getClientForDest(dest); err != nil {
+		return err
+	}
+
+	if p, ok := r.transport.(Pinger); ok {
+		ctx, cancel := tchannel.NewContext(r.warmUpTimeout)
+		defer cancel()
+		if err := p.Ping(ctx, r.dialAddress(dest)); err != nil {
+			return wrapError(ErrClientCreation, err)
+		}
+	}
+	r.statter.IncCounter("router.admin.refreshed", nil, 1)
+	return nil
+}
+
+// adminResult is the response of the AdminHandler.
+type adminResult struct {
+	Evicted int    `json:"evicted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AdminHandler returns a http.Handler that lets operators control the client
+// cache of r with POST requests, for example after network maintenance. The
+// action query parameter selects the method of r to call: invalidate for
+// InvalidateDestination and refresh for Refresh, both of the destination of
+// the dest query parameter, and invalidate-all for InvalidateAll, eg.
+// POST /debug/router/admin?action=refresh&dest=10.0.0.1:3000. It renders the
+// number of clients invalidated as JSON. The handler changes the state of
+// the router, so it should only be exposed to operators.
+func AdminHandler(r Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dest := req.URL.Query().Get("dest")
+		var res adminResult
+		switch action := req.URL.Query().Get("action"); {
+		case action == "invalidate-all":
+			res.Evicted = r.InvalidateAll()
+		case dest == "" && (action == "invalidate" || action == "refresh"):
+			http.Error(w, "missing dest", http.StatusBadRequest)
+			return
+		case action == "invalidate":
+			if r.InvalidateDestination(dest) {
+				res.Evicted = 1
+			}
+		case action == "refresh":
+			if err := r.Refresh(dest); err != nil {
+				res.Error = err.Error()
+			}
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if res.Error != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+func newAdminTestRouter(t *testing.T) (*router, *memoryTransport) {
+	transport := &memoryTransport{conns: map[string]ClientConn{
+		"127.0.0.1:3002": "raw client",
+		"127.0.0.1:3003": "unknown client",
+	}}
+	return newTransportTestRouter(t, nil, WithTransport(transport)), transport
+}
+
+func decodeAdminResult(t *testing.T, w *httptest.ResponseRecorder) adminResult {
+	var res adminResult
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	return res
+}
+
+func TestInvalidateDestination(t *testing.T) {
+	r, transport := newAdminTestRouter(t)
+	for _, key := range []string{"raw", "unknown", "local"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+
+	assert.True(t, r.InvalidateDestination("127.0.0.1:3002"))
+	assert.False(t, r.InvalidateDestination("127.0.0.1:3002"), "expected no client to be cached")
+	assert.Equal(t, []string{"127.0.0.1:3000", "127.0.0.1:3003"}, r.cache.keys())
+
+	_, err := r.GetClient("raw")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3002"}, transport.dialed, "expected the destination to be dialed again")
+
+	assert.Equal(t, 3, r.InvalidateAll())
+	assert.Equal(t, 0, r.cache.len())
+}
+
+func TestRefresh(t *testing.T) {
+	r, transport := newAdminTestRouter(t)
+	_, err := r.GetClient("raw")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Refresh("127.0.0.1:3002"))
+	assert.Equal(t, []string{"127.0.0.1:3002", "127.0.0.1:3002"}, transport.dialed)
+	assert.Equal(t, []string{"127.0.0.1:3002"}, transport.pinged)
+	assert.Equal(t, []string{"127.0.0.1:3002"}, transport.closed, "expected the connections to be closed")
+	assert.Equal(t, []string{"127.0.0.1:3002"}, r.cache.keys())
+
+	transport.pingErr = errors.New("unreachable")
+	err = r.Refresh("127.0.0.1:3002")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+
+	err = r.Refresh("127.0.0.1:3009")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+}
+
+func TestTChannelTransportCloseConnections(t *testing.T) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+	hostPort := server.PeerInfo().HostPort
+
+	ch, err := tchannel.NewChannel("client", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	transport := &TChannelTransport{Channel: ch}
+	assert.NoError(t, transport.CloseConnections(hostPort), "expected unknown peers to be ignored")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	first, err := transport.Connect(ctx, hostPort)
+	assert.NoError(t, err)
+	second, err := transport.Connect(ctx, hostPort)
+	assert.NoError(t, err)
+
+	assert.NoError(t, transport.CloseConnections(hostPort))
+	assert.False(t, first.(*tchannel.Connection).IsActive(), "expected the connection to be closed")
+	assert.False(t, second.(*tchannel.Connection).IsActive(), "expected the connection to be closed")
+	assert.False(t, transport.Connected()[hostPort])
+}
+
+func TestAdminHandler(t *testing.T) {
+	r, _ := newAdminTestRouter(t)
+	handler := AdminHandler(r)
+	serve := func(method, query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/debug/router/admin?"+query, nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	for _, key := range []string{"raw", "unknown"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve("GET", "action=invalidate-all").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("POST", "action=invalidate").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("POST", "action=restart").Code)
+
+	w := serve("POST", "action=invalidate&dest=127.0.0.1:3002")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, adminResult{Evicted: 1}, decodeAdminResult(t, w))
+
+	w = serve("POST", "action=refresh&dest=127.0.0.1:3002")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, adminResult{Evicted: 0}, decodeAdminResult(t, w))
+	assert.Contains(t, r.cache.keys(), "127.0.0.1:3002", "expected the destination to be refreshed")
+
+	w = serve("POST", "action=refresh&dest=127.0.0.1:3009")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown destination")
+
+	w = serve("POST", "action=invalidate-all")
+	assert.Equal(t, adminResult{Evicted: 2}, decodeAdminResult(t, w))
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync/atomic"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go/hyperbahn"
+)
+
+// AdvertisementHandler returns the hyperbahn.Handler that pauses and resumes
+// the router as the advertisement of its channel to Hyperbahn succeeds and
+// fails, see WithAdvertisement. Pass it in the ClientOptions of the Hyperbahn
+// client of the channel. It has no effect on routers without
+// WithAdvertisement.
+func (r *router) AdvertisementHandler() hyperbahn.Handler {
+	return advertisementHandler{r}
+}
+
+// advertisementHandler resumes the router once the channel is advertised and
+// pauses it when Hyperbahn gives up advertising it.
+type advertisementHandler struct {
+	r *router
+}
+
+func (h advertisementHandler) On(event hyperbahn.Event) {
+	switch event {
+	case hyperbahn.Advertised, hyperbahn.Readvertised:
+		if atomic.CompareAndSwapInt32(&h.r.state.paused, 1, 0) {
+			h.r.logger.Info("router resumed after advertisement")
+		}
+	}
+}
+
+func (h advertisementHandler) OnError(err error) {
+	failed, ok := err.(hyperbahn.ErrAdvertiseFailed)
+	if !ok || failed.WillRetry || !h.r.advertisement {
+		// the advertisement is retried before the registration lapses
+		return
+	}
+	if atomic.CompareAndSwapInt32(&h.r.state.paused, 0, 1) {
+		h.r.logger.WithFields(bark.Fields{
+			"error": err,
+		}).Warn("router paused after advertisement failed")
+	}
+}
+
+// admit returns the error of getting the clients of keys, or of the members
+// of the ring when there is no key, when the router does not hand them out:
+// ErrNotReady while the router is paused and ErrQuotaExceeded when a key is
+// over the quota of its tenant, see WithTenantQuotas. Every way of getting
+// clients goes through admit first.
+func (r *router) admit(keys ...string) error {
+	if r.paused() {
+		r.statter.IncCounter("router.paused", nil, 1)
+		return ErrNotReady
+	}
+	for _, key := range keys {
+		if !r.allowTenant(key) {
+			return ErrQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// paused returns whether the router waits for its channel to be advertised.
+func (r *router) paused() bool {
+	return atomic.LoadInt32(&r.state.paused) == 1
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/hyperbahn"
+	"golang.org/x/net/context"
+)
+
+func TestWithAdvertisement(t *testing.T) {
+	r := newTestRouter(t, WithAdvertisement())
+	h := r.AdvertisementHandler()
+
+	_, err := r.GetClient("remote")
+	assert.Equal(t, ErrNotReady, err, "expected the router to wait for the advertisement")
+
+	h.On(hyperbahn.SendAdvertise)
+	_, err = r.GetClient("remote")
+	assert.Equal(t, ErrNotReady, err)
+
+	h.On(hyperbahn.Advertised)
+	_, err = r.GetClient("remote")
+	assert.NoError(t, err)
+
+	// retried failures keep the router routing
+	h.OnError(hyperbahn.ErrAdvertiseFailed{Cause: errors.New("timeout"), WillRetry: true})
+	h.OnError(errors.New("unrelated"))
+	_, err = r.GetClient("remote")
+	assert.NoError(t, err)
+
+	h.OnError(hyperbahn.ErrAdvertiseFailed{Cause: errors.New("timeout"), WillRetry: false})
+	_, err = r.GetClient("remote")
+	assert.Equal(t, ErrNotReady, err, "expected the router to pause once the registration is lost")
+
+	h.On(hyperbahn.Readvertised)
+	_, err = r.GetClient("local")
+	assert.NoError(t, err)
+}
+
+func TestWithoutAdvertisement(t *testing.T) {
+	r := newTestRouter(t)
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+
+	r.AdvertisementHandler().OnError(hyperbahn.ErrAdvertiseFailed{Cause: errors.New("timeout")})
+	_, err = r.GetClient("remote")
+	assert.NoError(t, err, "expected the handler to have no effect without WithAdvertisement")
+}
+
+func TestPausedRouterHandsOutNoClients(t *testing.T) {
+	r := newTestRouter(t, WithAdvertisement())
+
+	_, err := r.GetClientN("remote", 2)
+	assert.Equal(t, ErrNotReady, err)
+	_, err = r.GetClients([]string{"local", "remote"})
+	assert.Equal(t, ErrNotReady, err)
+	_, err = r.GetClientExcluding("remote", nil)
+	assert.Equal(t, ErrNotReady, err)
+	_, err = r.GetReadClient("remote")
+	assert.Equal(t, ErrNotReady, err)
+	_, err = r.GetWriteClient("remote")
+	assert.Equal(t, ErrNotReady, err)
+	_, err = NewCoordinator(r, 0).Begin([]string{"remote"})
+	assert.Equal(t, ErrNotReady, err)
+
+	results := r.Broadcast(context.Background(), func(dest string, client interface{}) error {
+		t.Error("expected no member to be called")
+		return nil
+	})
+	assert.Equal(t, []Result{{Err: ErrNotReady}}, results)
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "time"
+
+// An AuditRecord records a single lookup of a key, so the destinations a key
+// was routed to by the nodes of a cluster can be compared afterwards. Keys
+// are only recorded by their hash, like in traces, see TagKeyHash.
+type AuditRecord struct {
+	// KeyHash is the 32-bit farmhash fingerprint of the key that was
+	// resolved, after the KeyMapper of the router was applied.
+	KeyHash uint32
+
+	// Destination is the address of the node the key resolved to.
+	Destination string
+
+	// Checksum is the checksum of the ring the key was resolved against, or
+	// zero when ringpop failed to return it.
+	Checksum uint32
+
+	// Time is the time of the lookup according to the clock of the router.
+	Time time.Time
+}
+
+// An AuditFunc exports the records of the audit log of a router, see
+// WithAuditLog. It is called synchronously on the path of the lookup and may
+// be called concurrently, implementations should be cheap and thread safe,
+// eg. hand the record to a buffered channel.
+type AuditFunc func(record AuditRecord)
+
+// auditLog hands every period-th successful lookup to an AuditFunc.
+type auditLog struct {
+	periodSampler
+	export AuditFunc
+}
+
+func newAuditLog(fraction float64, export AuditFunc) *auditLog {
+	if export == nil || fraction <= 0 {
+		return nil
+	}
+	return &auditLog{periodSampler: newPeriodSampler(fraction), export: export}
+}
+
+// audit records the lookup of key to dest in the audit log of the router,
+// when enabled and the lookup is sampled.
+func (r *router) audit(key, dest string) {
+	if r.auditLog == nil || !r.auditLog.sample() {
+		return
+	}
+
+	// the checksum is best effort, a record without it still tells where the
+	// key was routed
+	checksum, _ := r.ringpop.Checksum()
+	r.auditLog.export(AuditRecord{
+		KeyHash:     keyHash(r.mapKey(key)),
+		Destination: dest,
+		Checksum:    checksum,
+		Time:        r.clock.Now(),
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []AuditRecord
+	)
+	export := func(record AuditRecord) {
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+	}
+
+	r, _, c := newCacheTestRouter(t, WithAuditLog(0.5, export))
+	for i := 0; i < 4; i++ {
+		_, err := r.GetClient(fmt.Sprintf("node%d", i))
+		assert.NoError(t, err)
+	}
+
+	if assert.Len(t, records, 2, "expected every second lookup to be recorded") {
+		assert.Equal(t, AuditRecord{
+			KeyHash:     keyHash("node1"),
+			Destination: "127.0.0.1:3001",
+			Checksum:    1,
+			Time:        c.Now(),
+		}, records[0])
+		assert.Equal(t, "127.0.0.1:3003", records[1].Destination)
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	assert.Nil(t, newAuditLog(0, func(AuditRecord) {}))
+	assert.Nil(t, newAuditLog(1, nil))
+
+	r, _, _ := newCacheTestRouter(t)
+	assert.Nil(t, r.auditLog)
+	_, err := r.GetClient("node1")
+	assert.NoError(t, err)
+}
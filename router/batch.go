@@ -0,0 +1,69 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "golang.org/x/net/context"
+
+// ClientKeys is the client of a destination together with the keys that
+// resolved to it, as returned by GetClients.
+type ClientKeys struct {
+	Client interface{}
+	Keys   []string
+}
+
+// GetClients resolves all keys and groups them by destination. The client of
+// every destination is retrieved from the cache, or created, once.
+func (r *router) GetClients(keys []string) (map[string]*ClientKeys, error) {
+	if err := r.admit(keys...); err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*ClientKeys)
+	for _, key := range keys {
+		dest, err := r.routeLookup(context.Background(), key)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.sampler != nil {
+			r.sampler.observe(RouteInfo{
+				Key:         key,
+				Destination: dest,
+			})
+		}
+
+		group, ok := groups[dest]
+		if !ok {
+			group = &ClientKeys{}
+			groups[dest] = group
+		}
+		group.Keys = append(group.Keys, key)
+	}
+
+	for dest, group := range groups {
+		client, err := r.getClientForDest(dest)
+		if err != nil {
+			return nil, err
+		}
+		group.Client = client
+	}
+	return groups, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// newBenchmarkRouter returns a router over a static ring whose keys "local"
+// and "remote" resolve to the local node and to a remote node, with their
+// cached clients.
+func newBenchmarkRouter(b *testing.B, opts ...Option) Router {
+	table := map[string]string{
+		"local":  "127.0.0.1:3000",
+		"remote": "127.0.0.1:3001",
+	}
+	ch, err := tchannel.NewChannel("remote", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := NewStatic("127.0.0.1:3000", table, "127.0.0.1:3000", tchanClientFactory{}, ch, opts...)
+	for key := range table {
+		if _, err := r.GetClient(key); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return r
+}
+
+func benchmarkGetClient(b *testing.B, key string, opts ...Option) {
+	r := newBenchmarkRouter(b, opts...)
+	defer r.Close(context.Background())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.GetClient(key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetClientLocal(b *testing.B) {
+	benchmarkGetClient(b, "local")
+}
+
+func BenchmarkGetClientRemote(b *testing.B) {
+	benchmarkGetClient(b, "remote")
+}
+
+// BenchmarkGetClientRemoteWithLogger routes through a logrus logger at info
+// level, of which the debug messages of the lookups are not even built.
+func BenchmarkGetClientRemoteWithLogger(b *testing.B) {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Level = logrus.InfoLevel
+	benchmarkGetClient(b, "remote", WithLogger(bark.NewLoggerFromLogrus(logger)))
+}
+
+func BenchmarkGetClientRemoteParallel(b *testing.B) {
+	r := newBenchmarkRouter(b)
+	defer r.Close(context.Background())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := r.GetClient("remote"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
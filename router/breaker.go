@@ -0,0 +1,178 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// circuitBreaker tracks consecutive failed calls to a destination. After
+// the configured number of failures the circuit opens and no calls are made
+// to the destination until the cool down has passed. The circuit is then
+// half-open: a single call, the probe, is let through and decides whether the
+// circuit closes again or stays open, the other calls are rejected until it
+// ends.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	probing  bool
+}
+
+// allow returns whether a call to the destination may be made at now,
+// without making it the probe of a half-open circuit.
+func (b *circuitBreaker) allow(now time.Time, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open || (!b.probing && now.Sub(b.openedAt) >= cooldown)
+}
+
+// acquire returns whether a call to the destination may be made at now. The
+// call let through a half-open circuit is its probe, which must be ended by
+// success, failure or endProbe.
+func (b *circuitBreaker) acquire(now time.Time, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || now.Sub(b.openedAt) < cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// endProbe ends the probe of a half-open circuit whose outcome tells nothing
+// about the destination, so the next call probes again.
+func (b *circuitBreaker) endProbe() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// success closes the circuit.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	b.failures = 0
+	b.open = false
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// failure records a failed call and returns whether it opened the circuit.
+func (b *circuitBreaker) failure(now time.Time, threshold int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	b.failures++
+	if b.failures < threshold {
+		return false
+	}
+
+	// a failure while half-open restarts the cool down
+	b.openedAt = now
+	opened := !b.open
+	b.open = true
+	return opened
+}
+
+// breakerFor returns the circuit breaker of dest, or nil when circuit
+// breaking is disabled.
+func (r *router) breakerFor(dest string) *circuitBreaker {
+	if r.breakerFailures <= 0 {
+		return nil
+	}
+
+	r.breakersMu.Lock()
+	defer r.breakersMu.Unlock()
+
+	b, ok := r.breakers[dest]
+	if !ok {
+		b = &circuitBreaker{}
+		r.breakers[dest] = b
+	}
+	return b
+}
+
+// circuitOpen returns whether the circuit of dest is open, or dest is over
+// the error budget of WithErrorBudget.
+func (r *router) circuitOpen(dest string) bool {
+	if r.overErrorBudget(dest) {
+		return true
+	}
+	b := r.breakerFor(dest)
+	return b != nil && !b.allow(r.clock.Now(), r.breakerCooldown)
+}
+
+// breakerClient is the TChanClient handed to the ClientFactory for remote
+// destinations when circuit breaking is enabled. It reports the outcome of
+// every call to the breaker of its destination.
+type breakerClient struct {
+	thrift.TChanClient
+
+	r       *router
+	breaker *circuitBreaker
+}
+
+func (c *breakerClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	if !c.breaker.acquire(c.r.clock.Now(), c.r.breakerCooldown) {
+		return false, ErrCircuitOpen
+	}
+
+	// a call that panics counts as a failure, so a panicking probe does not
+	// keep the circuit open
+	callErr := errCallPanicked
+	defer func() { c.record(callErr) }()
+
+	success, err := c.TChanClient.Call(ctx, serviceName, methodName, req, resp)
+	callErr = err
+	return success, err
+}
+
+// record records the outcome of a call that ended with err in the breaker.
+func (c *breakerClient) record(err error) {
+	switch {
+	case err == nil:
+		c.breaker.success()
+	case ClassifyError(err) == ClassBadRequest:
+		// application errors are reported with a nil err and, like bad
+		// requests, do not count
+		c.breaker.endProbe()
+	case c.breaker.failure(c.r.clock.Now(), c.r.breakerFailures):
+		c.r.statter.IncCounter("router.circuit.opened", nil, 1)
+	}
+}
+
+// getClientFallback returns the client of the first of the replicas of key
+// whose circuit is closed. It is used when the circuit of the owner of key is
+// open and fallback is enabled with WithCircuitFallback.
+func (r *router) getClientFallback(ctx context.Context, key string) (interface{}, string, error) {
+	return r.replicaClient(ctx, key, r.circuitFallback, r.circuitOpen, ErrCircuitOpen)
+}
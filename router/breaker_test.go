@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// stubTChanClient fails every call with err, reports an application error
+// when appErr is set or panics when panics is set.
+type stubTChanClient struct {
+	err    error
+	appErr bool
+	panics bool
+	calls  int
+}
+
+func (c *stubTChanClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	c.calls++
+	if c.panics {
+		panic("call panicked")
+	}
+	if c.err != nil {
+		return false, c.err
+	}
+	return !c.appErr, nil
+}
+
+// tchanClientFactory hands out the TChanClient the router passes it.
+type tchanClientFactory struct{}
+
+func (tchanClientFactory) GetLocalClient() interface{} {
+	return "local client"
+}
+
+func (tchanClientFactory) MakeRemoteClient(client thrift.TChanClient) interface{} {
+	return client
+}
+
+// newBreakerTestRouter creates a router on which "a" resolves to
+// 127.0.0.1:3001 and "b" to 127.0.0.1:3002, with 127.0.0.1:3002 being the
+// second replica of "a".
+func newBreakerTestRouter(t *testing.T, opts ...Option) (*router, *clock.Mock) {
+	rp := newTestRingpop(testLookups{
+		"a": "127.0.0.1:3001",
+		"b": "127.0.0.1:3002",
+	})
+	rp.On("LookupN", "a", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+
+	c := clock.NewMock()
+	opts = append([]Option{withFactory(tchanClientFactory{}), WithClock(c)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...), c
+}
+
+// stubClient replaces the TChanClient under the breaker of the client for
+// key with stub.
+func stubClient(t *testing.T, r *router, key string, stub *stubTChanClient) thrift.TChanClient {
+	client, err := r.GetClient(key)
+	assert.NoError(t, err)
+
+	bc, ok := client.(*breakerClient)
+	if assert.True(t, ok, "expected the remote client to be wrapped in a breaker") {
+		bc.TChanClient = stub
+	}
+	return bc
+}
+
+func call(client thrift.TChanClient) error {
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+	_, err := client.Call(ctx, "remote", "Ping", nil, nil)
+	return err
+}
+
+func TestCircuitOpensAfterFailures(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithCircuitBreaker(3, time.Minute))
+	stub := &stubTChanClient{err: errors.New("timeout")}
+	client := stubClient(t, r, "a", stub)
+
+	for i := 0; i < 3; i++ {
+		_, err := r.GetClient("a")
+		assert.NoError(t, err, "expected the circuit to be closed before the third failure")
+		assert.Equal(t, stub.err, call(client))
+	}
+
+	_, err := r.GetClient("a")
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, ErrCircuitOpen, call(client))
+	assert.Equal(t, 3, stub.calls, "expected no call to reach the destination while open")
+
+	_, err = r.GetClient("b")
+	assert.NoError(t, err, "expected other destinations to be unaffected")
+}
+
+func TestCircuitPanickingProbe(t *testing.T) {
+	r, c := newBreakerTestRouter(t, WithCircuitBreaker(1, time.Minute))
+	stub := &stubTChanClient{err: errors.New("timeout")}
+	client := stubClient(t, r, "a", stub)
+
+	assert.Error(t, call(client))
+
+	// the probe after the cool down panics, which opens the circuit again
+	c.Add(time.Minute)
+	stub.panics = true
+	assert.Panics(t, func() { call(client) })
+	_, err := r.GetClient("a")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// and does not prevent the next probe
+	c.Add(time.Minute)
+	stub.panics = false
+	stub.err = nil
+	assert.NoError(t, call(client))
+	_, err = r.GetClient("a")
+	assert.NoError(t, err)
+}
+
+func TestCircuitClosesAfterCooldown(t *testing.T) {
+	r, c := newBreakerTestRouter(t, WithCircuitBreaker(1, time.Minute))
+	stub := &stubTChanClient{err: errors.New("timeout")}
+	client := stubClient(t, r, "a", stub)
+
+	assert.Error(t, call(client))
+	_, err := r.GetClient("a")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// a failure after the cool down opens the circuit again
+	c.Add(time.Minute)
+	assert.Equal(t, stub.err, call(client))
+	_, err = r.GetClient("a")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	c.Add(time.Minute)
+	stub.err = nil
+	assert.NoError(t, call(client))
+	_, err = r.GetClient("a")
+	assert.NoError(t, err)
+}
+
+// probeTChanClient blocks every call until release is closed, after
+// signalling started.
+type probeTChanClient struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *probeTChanClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	c.started <- struct{}{}
+	<-c.release
+	return true, nil
+}
+
+func TestCircuitHalfOpenLetsOneProbeThrough(t *testing.T) {
+	r, c := newBreakerTestRouter(t, WithCircuitBreaker(1, time.Minute))
+	stub := &stubTChanClient{err: errors.New("timeout")}
+	client := stubClient(t, r, "a", stub)
+	assert.Error(t, call(client))
+
+	probe := &probeTChanClient{started: make(chan struct{}, 1), release: make(chan struct{})}
+	client.(*breakerClient).TChanClient = probe
+	c.Add(time.Minute)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- call(client)
+	}()
+	<-probe.started
+
+	assert.Equal(t, ErrCircuitOpen, call(client), "expected calls to be rejected during the probe")
+	_, err := r.GetClient("a")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	close(probe.release)
+	assert.NoError(t, <-done)
+	_, err = r.GetClient("a")
+	assert.NoError(t, err, "expected the probe to close the circuit")
+}
+
+func TestCircuitIgnoresApplicationErrors(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithCircuitBreaker(1, time.Minute))
+	client := stubClient(t, r, "a", &stubTChanClient{appErr: true})
+
+	assert.NoError(t, call(client))
+	_, err := r.GetClient("a")
+	assert.NoError(t, err)
+}
+
+func TestCircuitFallback(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithCircuitBreaker(1, time.Minute), WithCircuitFallback(2))
+	call(stubClient(t, r, "a", &stubTChanClient{err: errors.New("timeout")}))
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	b, _ := r.GetClient("b")
+	assert.Equal(t, b, client, "expected the client of the second replica")
+
+	call(stubClient(t, r, "b", &stubTChanClient{err: errors.New("timeout")}))
+	_, err = r.GetClient("a")
+	assert.Equal(t, ErrCircuitOpen, err)
+}
+
+func TestCircuitBreakerDisabledByDefault(t *testing.T) {
+	r, _ := newBreakerTestRouter(t)
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	_, ok := client.(*breakerClient)
+	assert.False(t, ok)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sort"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// defaultBroadcastParallelism bounds the number of concurrent calls of a
+// Broadcast when no parallelism is configured.
+const defaultBroadcastParallelism = 16
+
+// Result is the outcome of a Broadcast for one member of the ring.
+type Result struct {
+	// Destination is the address of the member.
+	Destination string
+
+	// Err is the error of the callback for the member, or the error getting
+	// its client. It is nil when the callback succeeded.
+	Err error
+}
+
+// Broadcast calls fn with the client of every reachable member of the ring,
+// including the local node, eg. to invalidate caches or push configuration
+// across the ring. The calls are made concurrently, with at most the number
+// of calls of WithBroadcastParallelism in flight. It returns a Result for
+// every member, sorted by destination. Members that are not called before
+// ctx is done get the error of ctx; fn is expected to honour ctx in the calls
+// it makes. When the members cannot be listed the only Result has no
+// destination and an error of kind ErrLookupFailed.
+func (r *router) Broadcast(ctx context.Context, fn func(dest string, client interface{}) error) []Result {
+	if err := r.admit(); err != nil {
+		return []Result{{Err: err}}
+	}
+	members, err := r.ringpop.GetReachableMembers()
+	if err != nil {
+		return []Result{{Err: wrapError(ErrLookupFailed, err)}}
+	}
+	sort.Strings(members)
+
+	parallelism := r.broadcastParallelism
+	if parallelism <= 0 {
+		parallelism = defaultBroadcastParallelism
+	}
+
+	results := make([]Result, len(members))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, dest := range members {
+		results[i].Destination = dest
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *Result) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			client, err := r.getClientForDest(result.Destination)
+			if err == nil {
+				err = fn(result.Destination, client)
+			}
+			result.Err = err
+		}(&results[i])
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		r.statter.IncCounter("router.broadcast.error", nil, int64(failed))
+	}
+	return results
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+	"golang.org/x/net/context"
+)
+
+func newBroadcastTestRouter(t *testing.T, opts ...Option) *router {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3002", "127.0.0.1:3000", "127.0.0.1:3001"}, nil)
+
+	dialer := func(dest string) (interface{}, error) {
+		if dest == "127.0.0.1:3002" {
+			return nil, errors.New("connection refused")
+		}
+		return "client of " + dest, nil
+	}
+	opts = append([]Option{WithRemoteDialer(dialer)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...)
+}
+
+func TestBroadcast(t *testing.T) {
+	r := newBroadcastTestRouter(t)
+
+	var mu sync.Mutex
+	called := make(map[string]interface{})
+	results := r.Broadcast(context.Background(), func(dest string, client interface{}) error {
+		mu.Lock()
+		called[dest] = client
+		mu.Unlock()
+		if dest == "127.0.0.1:3001" {
+			return errors.New("invalidation failed")
+		}
+		return nil
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"127.0.0.1:3000": "local client",
+		"127.0.0.1:3001": "client of 127.0.0.1:3001",
+	}, called)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, Result{Destination: "127.0.0.1:3000"}, results[0])
+		assert.Equal(t, "127.0.0.1:3001", results[1].Destination)
+		assert.EqualError(t, results[1].Err, "invalidation failed")
+		assert.Equal(t, "127.0.0.1:3002", results[2].Destination)
+		assert.EqualError(t, results[2].Err, "connection refused")
+	}
+}
+
+func TestBroadcastParallelism(t *testing.T) {
+	r := newBroadcastTestRouter(t, WithBroadcastParallelism(1))
+
+	var inflight, max int32
+	r.Broadcast(context.Background(), func(dest string, client interface{}) error {
+		n := atomic.AddInt32(&inflight, 1)
+		if n > atomic.LoadInt32(&max) {
+			atomic.StoreInt32(&max, n)
+		}
+		atomic.AddInt32(&inflight, -1)
+		return nil
+	})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&max))
+}
+
+func TestBroadcastContextDone(t *testing.T) {
+	r := newBroadcastTestRouter(t, WithBroadcastParallelism(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := r.Broadcast(ctx, func(dest string, client interface{}) error {
+		cancel()
+		return nil
+	})
+	if assert.Len(t, results, 3) {
+		assert.NoError(t, results[0].Err)
+		assert.Equal(t, context.Canceled, results[2].Err, "expected members not called to get the error of the context")
+	}
+}
+
+func TestBroadcastMembersError(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("GetReachableMembers").Return(nil, errors.New("ringpop not ready"))
+	r := New(rp, nil, nil)
+
+	results := r.Broadcast(context.Background(), func(dest string, client interface{}) error {
+		t.Error("unexpected call")
+		return nil
+	})
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, ErrLookupFailed, KindOf(results[0].Err))
+	}
+}
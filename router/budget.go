@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+// retryBudgetWindow is the window over which the retry budget is accounted.
+const retryBudgetWindow = time.Second
+
+// retryBudget is the budget of retries shared by all calls of the router, see
+// WithRetryBudget. Requests and retries are counted per window, of which the
+// previous one is kept so the budget does not run dry at the start of every
+// window.
+type retryBudget struct {
+	ratio float64
+	min   int
+
+	mu           sync.Mutex
+	windowStart  time.Time
+	requests     int
+	retries      int
+	lastRequests int
+}
+
+func newRetryBudget(ratio float64, minPerSecond int) *retryBudget {
+	if ratio <= 0 && minPerSecond <= 0 {
+		return nil
+	}
+	return &retryBudget{ratio: ratio, min: minPerSecond}
+}
+
+// advance moves the window forward to now. mu must be held.
+func (b *retryBudget) advance(now time.Time) {
+	elapsed := now.Sub(b.windowStart)
+	if elapsed < retryBudgetWindow {
+		return
+	}
+	if elapsed < 2*retryBudgetWindow {
+		b.lastRequests = b.requests
+	} else {
+		b.lastRequests = 0
+	}
+	b.windowStart = now
+	b.requests = 0
+	b.retries = 0
+}
+
+func (b *retryBudget) request(now time.Time) {
+	b.mu.Lock()
+	b.advance(now)
+	b.requests++
+	b.mu.Unlock()
+}
+
+// withdraw takes a retry from the budget and returns whether there was one
+// left.
+func (b *retryBudget) withdraw(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	requests := b.requests
+	if b.lastRequests > requests {
+		requests = b.lastRequests
+	}
+	if float64(b.retries) >= float64(b.min)+b.ratio*float64(requests) {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// recordRequest counts a call that may be retried against the retry budget,
+// when enabled.
+func (r *router) recordRequest() {
+	if r.retryBudget != nil {
+		r.retryBudget.request(r.clock.Now())
+	}
+}
+
+// allowRetry returns whether the retry budget, when enabled, allows another
+// retry. Denied retries are counted by the router.retry.budget.exhausted
+// counter.
+func (r *router) allowRetry() bool {
+	if r.retryBudget == nil || r.retryBudget.withdraw(r.clock.Now()) {
+		return true
+	}
+	r.statter.IncCounter("router.retry.budget.exhausted", nil, 1)
+	return false
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+)
+
+// dispatchAttempts dispatches a call that always fails with a connection error
+// and returns the number of attempts that were made.
+func dispatchAttempts(r *router) int {
+	attempts := 0
+	r.Dispatch("moving", func(client interface{}) error {
+		attempts++
+		return tchannel.ErrConnectionClosed
+	})
+	return attempts
+}
+
+func TestRetryBudget(t *testing.T) {
+	r, _ := newRetryTestRouter(t, RetryPolicy{MaxRetries: 1})
+	r.retryBudget = newRetryBudget(0.5, 0)
+	c := clock.NewMock()
+	r.clock = c
+
+	// half of the calls may be retried
+	var attempts []int
+	for i := 0; i < 4; i++ {
+		attempts = append(attempts, dispatchAttempts(r))
+	}
+	assert.Equal(t, []int{2, 1, 2, 1}, attempts)
+
+	// the calls of the last window count towards the next one
+	c.Add(time.Second)
+	attempts = nil
+	for i := 0; i < 3; i++ {
+		attempts = append(attempts, dispatchAttempts(r))
+	}
+	assert.Equal(t, []int{2, 2, 1}, attempts)
+
+	// and are forgotten once idle for longer
+	c.Add(3 * time.Second)
+	assert.Equal(t, 2, dispatchAttempts(r))
+	assert.Equal(t, 1, dispatchAttempts(r))
+}
+
+func TestRetryBudgetMinimum(t *testing.T) {
+	r, _ := newRetryTestRouter(t, RetryPolicy{MaxRetries: 3})
+	r.retryBudget = newRetryBudget(0, 2)
+	r.clock = clock.NewMock()
+
+	assert.Equal(t, 3, dispatchAttempts(r), "expected the minimum number of retries")
+	assert.Equal(t, 1, dispatchAttempts(r))
+}
+
+func TestRetryBudgetDisabled(t *testing.T) {
+	assert.Nil(t, newRetryBudget(0, 0))
+
+	r, _ := newRetryTestRouter(t, RetryPolicy{MaxRetries: 1})
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 2, dispatchAttempts(r))
+	}
+}
@@ -0,0 +1,457 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgryski/go-farm"
+)
+
+// defaultCacheShards is the number of shards of the client cache when it is
+// not configured with WithCacheShards.
+const defaultCacheShards = 32
+
+// clientCache holds the clients of a router, keyed by the cache key of their
+// destination. The cache is split in shards with a lock each, so goroutines
+// getting or creating clients of different destinations do not contend on a
+// single lock. It is shared by the routers of a MultiRouter.
+type clientCache struct {
+	// size is the number of entries in all shards. It is the first field to
+	// guarantee 64-bit alignment for atomic operations on 32-bit platforms.
+	size int64
+
+	// idleSwept is the time, in nanoseconds since the epoch, the expired
+	// entries were last removed, see sweep.
+	idleSwept int64
+
+	shards []*cacheShard
+}
+
+type cacheShard struct {
+	sync.RWMutex
+	entries  map[string]*cacheEntry
+	creating map[string]*creation
+}
+
+// A creation is a client being created for a key of the cache. Goroutines
+// that need the client wait for done to be closed.
+type creation struct {
+	done  chan struct{}
+	entry *cacheEntry
+	err   error
+
+	// discarded is set, under the lock of the shard, when the key is removed
+	// from the cache while its client is created, in which case the client
+	// is not cached.
+	discarded bool
+}
+
+func newClientCache(shards int) *clientCache {
+	if shards < 1 {
+		shards = 1
+	}
+
+	c := &clientCache{shards: make([]*cacheShard, shards)}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{
+			entries:  make(map[string]*cacheEntry),
+			creating: make(map[string]*creation),
+		}
+	}
+	return c
+}
+
+// shard returns the shard key is stored in.
+func (c *clientCache) shard(key string) *cacheShard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[farm.Fingerprint32([]byte(key))%uint32(len(c.shards))]
+}
+
+func (c *clientCache) get(key string) (*cacheEntry, bool) {
+	shard := c.shard(key)
+	shard.RLock()
+	entry, ok := shard.entries[key]
+	shard.RUnlock()
+	return entry, ok
+}
+
+// len returns the number of entries in the cache.
+func (c *clientCache) len() int {
+	return int(atomic.LoadInt64(&c.size))
+}
+
+// keys returns the keys of all entries in the cache.
+func (c *clientCache) keys() []string {
+	var keys []string
+	for _, shard := range c.shards {
+		shard.RLock()
+		for key := range shard.entries {
+			keys = append(keys, key)
+		}
+		shard.RUnlock()
+	}
+	return keys
+}
+
+// storeLocked stores entry under key in shard, whose lock the caller holds.
+func (c *clientCache) storeLocked(shard *cacheShard, key string, entry *cacheEntry) {
+	if old, ok := shard.entries[key]; ok {
+		old.account(-1)
+	} else {
+		atomic.AddInt64(&c.size, 1)
+	}
+	shard.entries[key] = entry
+	entry.account(1)
+}
+
+// deleteLocked removes key from shard, whose lock the caller holds.
+func (c *clientCache) deleteLocked(shard *cacheShard, key string) {
+	if entry, ok := shard.entries[key]; ok {
+		delete(shard.entries, key)
+		atomic.AddInt64(&c.size, -1)
+		entry.account(-1)
+	}
+}
+
+// remove removes key from the cache and returns the removed entry. A client
+// being created for key is not cached.
+func (c *clientCache) remove(key string) (*cacheEntry, bool) {
+	shard := c.shard(key)
+	shard.Lock()
+	entry, ok := shard.entries[key]
+	c.deleteLocked(shard, key)
+	if creation, creating := shard.creating[key]; creating {
+		creation.discarded = true
+	}
+	shard.Unlock()
+	return entry, ok
+}
+
+// removeEntry removes key from the cache when entry is still stored under it.
+func (c *clientCache) removeEntry(key string, entry *cacheEntry) bool {
+	shard := c.shard(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	if shard.entries[key] != entry {
+		return false
+	}
+	c.deleteLocked(shard, key)
+	return true
+}
+
+// removeIf removes and returns the entries for which remove returns true.
+func (c *clientCache) removeIf(remove func(key string, entry *cacheEntry) bool) []*cacheEntry {
+	var removed []*cacheEntry
+	for _, shard := range c.shards {
+		shard.Lock()
+		for key, entry := range shard.entries {
+			if remove(key, entry) {
+				c.deleteLocked(shard, key)
+				removed = append(removed, entry)
+			}
+		}
+		shard.Unlock()
+	}
+	return removed
+}
+
+// sweepDue returns whether the expired entries are to be removed at now,
+// which is at most once every interval. Only one of the goroutines calling
+// it concurrently is told to.
+func (c *clientCache) sweepDue(now time.Time, interval time.Duration) bool {
+	swept := atomic.LoadInt64(&c.idleSwept)
+	if now.UnixNano()-swept < int64(interval) {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&c.idleSwept, swept, now.UnixNano())
+}
+
+// keyedEntry is an entry of the cache together with its key.
+type keyedEntry struct {
+	key      string
+	entry    *cacheEntry
+	lastUsed int64
+}
+
+// byLastUse sorts keyedEntries from the least recently used.
+type byLastUse []keyedEntry
+
+func (s byLastUse) Len() int           { return len(s) }
+func (s byLastUse) Less(i, j int) bool { return s[i].lastUsed < s[j].lastUsed }
+func (s byLastUse) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// oldest returns the n least recently used entries with keys starting with
+// prefix, other than the one stored under keep, from the least recently used,
+// in a single pass over the cache.
+func (c *clientCache) oldest(prefix, keep string, n int) []keyedEntry {
+	entries := make([]keyedEntry, 0, c.len())
+	for _, shard := range c.shards {
+		shard.RLock()
+		for key, entry := range shard.entries {
+			if key != keep && strings.HasPrefix(key, prefix) {
+				entries = append(entries, keyedEntry{key, entry, entry.lastUsedAt()})
+			}
+		}
+		shard.RUnlock()
+	}
+	sort.Sort(byLastUse(entries))
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// A cacheEntry holds a client in the client cache of the router.
+type cacheEntry struct {
+	// lastUsed is the time, in nanoseconds since the epoch, the entry was
+	// last returned from the cache. It is the first field to guarantee 64-bit
+	// alignment for atomic operations on 32-bit platforms.
+	lastUsed int64
+
+	// hits is the number of times the client was returned from the cache.
+	hits int64
+
+	client  interface{}
+	created time.Time
+	local   bool
+	dest    string
+
+	// pool holds the clients of the destination, client being the first,
+	// when it has a pool, see WithClientPool. next is the index of the
+	// client returned next.
+	pool []interface{}
+	next uint32
+
+	// conns are the connections opened for the clients of the pool, closed
+	// with them.
+	conns []io.Closer
+
+	// calls counts the calls in flight through the client when evictions
+	// wait for them, see WithEvictionDrain.
+	calls *callTracker
+
+	// labels are the labels of the destination the client was created for,
+	// see WithLabels.
+	labels map[string]string
+
+	// uncacheable tells the client must not be cached nor shared, see
+	// Cacheable.
+	uncacheable bool
+
+	// connected is set once the destination was seen connected, see
+	// WithConnectionWatch.
+	connected int32
+
+	// owner is the router that created the entry, which accounts for it in
+	// the cache the routers of a MultiRouter share.
+	owner *router
+
+	// kinds are the clients of the destination by kind, see
+	// KindClientFactory, kindsClosed is set once they were closed.
+	kindsMu     sync.Mutex
+	kinds       map[string]interface{}
+	kindsClosed bool
+}
+
+// Cacheable is implemented by the clients of a ClientFactory that must not
+// always be cached by the router, eg. stateful facades of the local node that
+// are constructed for every request. Clients for which Cacheable returns
+// false are created again on every call and never shared between callers.
+// The router does not close them, they are owned by the caller.
+type Cacheable interface {
+	Cacheable() bool
+}
+
+// cacheable returns whether client may be cached.
+func cacheable(client interface{}) bool {
+	c, ok := client.(Cacheable)
+	return !ok || c.Cacheable()
+}
+
+func newCacheEntry(client interface{}, local bool, now time.Time) *cacheEntry {
+	return &cacheEntry{
+		lastUsed: now.UnixNano(),
+		client:   client,
+		created:  now,
+		local:    local,
+	}
+}
+
+// account adds delta to the number of cached clients of the owner of e.
+func (e *cacheEntry) account(delta int64) {
+	if e.owner != nil {
+		atomic.AddInt64(&e.owner.stats.cached, delta)
+	}
+}
+
+func (e *cacheEntry) touch(now time.Time) {
+	atomic.StoreInt64(&e.lastUsed, now.UnixNano())
+}
+
+func (e *cacheEntry) lastUsedAt() int64 {
+	return atomic.LoadInt64(&e.lastUsed)
+}
+
+// get returns the client of the entry, the clients of its pool in turn when it
+// has one.
+func (e *cacheEntry) get() interface{} {
+	if e.pool == nil {
+		return e.client
+	}
+	i := atomic.AddUint32(&e.next, 1) - 1
+	return e.pool[i%uint32(len(e.pool))]
+}
+
+// expired returns whether the entry has not been used for longer than the
+// idle timeout configured with WithClientIdleTimeout.
+func (r *router) expired(e *cacheEntry, now time.Time) bool {
+	if r.idleTimeout <= 0 {
+		return false
+	}
+	return now.UnixNano()-e.lastUsedAt() > int64(r.idleTimeout)
+}
+
+// sweep removes the expired entries, at most once every idle timeout, and,
+// when the cache holds more clients of the router than configured with
+// WithMaxClients, the least recently used entries of the router. Expired
+// entries that are not removed yet are created again when used, see
+// createClient. The entry stored under keep is never removed. The caller is
+// responsible for closing the returned entries.
+func (r *router) sweep(keep string, now time.Time) []*cacheEntry {
+	var evicted []*cacheEntry
+
+	if r.idleTimeout > 0 && r.cache.sweepDue(now, r.idleTimeout) {
+		evicted = r.cache.removeIf(func(key string, entry *cacheEntry) bool {
+			return key != keep && r.expired(entry, now)
+		})
+	}
+
+	if cached := r.cachedClients(); r.maxClients > 0 && cached > r.maxClients {
+		// evict down to the low watermark so the scan for the oldest
+		// entries is amortized over the next creations
+		n := cached - r.maxClients + r.maxClients/evictionBatchRatio
+		for _, e := range r.cache.oldest(r.cacheKey(""), keep, n) {
+			// another goroutine might have removed the entry meanwhile
+			if r.cache.removeEntry(e.key, e.entry) {
+				evicted = append(evicted, e.entry)
+			}
+		}
+	}
+
+	return evicted
+}
+
+// cachedClients returns the number of clients of the router in the cache,
+// which the routers of a MultiRouter share.
+func (r *router) cachedClients() int {
+	if !r.serviceScopedCache {
+		return r.cache.len()
+	}
+	return int(atomic.LoadInt64(&r.stats.cached))
+}
+
+// evictionBatchRatio is the inverse of the share of the clients, beyond the
+// clients over the limit, evicted at once when the cache is full. A cache of
+// 1000 clients is brought down to 985 clients, then only scanned again once
+// it is full.
+const evictionBatchRatio = 64
+
+// evict accounts for the entries evicted from the cache, notifies the
+// eviction listeners and closes their remote clients that implement
+// io.Closer, once their calls in flight finished when WithEvictionDrain is
+// configured. Local clients are owned by the ClientFactory and are never
+// closed by the router.
+func (r *router) evict(evicted []*cacheEntry) {
+	evicted = r.evictForeign(evicted)
+	if len(evicted) == 0 {
+		return
+	}
+	r.stats.evicted(len(evicted))
+	r.statter.IncCounter("router.client.evicted", nil, int64(len(evicted)))
+	r.logger.WithField("count", len(evicted)).Debug("router evicted clients from cache")
+	r.notifyEvicted(evicted)
+	for _, entry := range evicted {
+		r.closeWhenIdle(entry)
+	}
+}
+
+// evictForeign has the entries of evicted created by the other routers of a
+// MultiRouter evicted by their own router, eg. when they expired in the
+// cache the routers share, and returns the entries of r.
+func (r *router) evictForeign(evicted []*cacheEntry) []*cacheEntry {
+	var own []*cacheEntry
+	var foreign map[*router][]*cacheEntry
+	for i, entry := range evicted {
+		if entry.owner == nil || entry.owner == r {
+			if foreign != nil {
+				own = append(own, entry)
+			}
+			continue
+		}
+		if foreign == nil {
+			foreign = make(map[*router][]*cacheEntry)
+			own = append([]*cacheEntry(nil), evicted[:i]...)
+		}
+		foreign[entry.owner] = append(foreign[entry.owner], entry)
+	}
+	if foreign == nil {
+		return evicted
+	}
+
+	for owner, entries := range foreign {
+		owner.evict(entries)
+	}
+	return own
+}
+
+// closeClients closes the remote clients of entries that implement
+// io.Closer.
+func closeClients(entries []*cacheEntry) {
+	for _, entry := range entries {
+		closeClient(entry)
+	}
+}
+
+// closeClient closes the client, or the clients of the pool, of entry when it
+// is remote and implements io.Closer. The clients of the kinds of entry are
+// closed whether it is local or remote.
+func closeClient(entry *cacheEntry) {
+	closeKinds(entry)
+	if entry.local {
+		return
+	}
+	if entry.pool != nil {
+		closePool(entry.pool, entry.conns)
+		return
+	}
+	if closer, ok := entry.client.(io.Closer); ok {
+		closer.Close()
+	}
+}
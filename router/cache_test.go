@@ -0,0 +1,469 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type closingClient struct {
+	sync.Mutex
+	closed bool
+}
+
+func (c *closingClient) Close() error {
+	c.Lock()
+	c.closed = true
+	c.Unlock()
+	return nil
+}
+
+func (c *closingClient) isClosed() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.closed
+}
+
+// closingClientFactory creates a new closingClient for every call.
+type closingClientFactory struct {
+	sync.Mutex
+	created int
+}
+
+func (f *closingClientFactory) GetLocalClient() interface{} {
+	return f.newClient()
+}
+
+func (f *closingClientFactory) MakeRemoteClient(client thrift.TChanClient) interface{} {
+	return f.newClient()
+}
+
+func (f *closingClientFactory) newClient() *closingClient {
+	f.Lock()
+	f.created++
+	f.Unlock()
+	return &closingClient{}
+}
+
+func (f *closingClientFactory) numCreated() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.created
+}
+
+// newCacheTestRouter creates a router on which key "node<i>" resolves to
+// 127.0.0.1:300<i>, 127.0.0.1:3000 being the local node.
+func newCacheTestRouter(t *testing.T, opts ...Option) (*router, *closingClientFactory, *clock.Mock) {
+	rp := newTestRingpop(nil)
+	rp.On("Checksum").Return(uint32(1), nil)
+	for i := 0; i < 5; i++ {
+		rp.On("Lookup", fmt.Sprintf("node%d", i)).Return(fmt.Sprintf("127.0.0.1:300%d", i), nil)
+	}
+
+	f := &closingClientFactory{}
+	c := clock.NewMock()
+	opts = append([]Option{withFactory(f), WithClock(c)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...), f, c
+}
+
+func TestCacheKeepsAllClientsByDefault(t *testing.T) {
+	r, f, c := newCacheTestRouter(t)
+
+	for i := 0; i < 5; i++ {
+		_, err := r.GetClient(fmt.Sprintf("node%d", i))
+		assert.NoError(t, err)
+		c.Add(time.Hour)
+	}
+	for i := 0; i < 5; i++ {
+		_, err := r.GetClient(fmt.Sprintf("node%d", i))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 5, f.numCreated())
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	r, f, c := newCacheTestRouter(t, WithMaxClients(2))
+
+	first, err := r.GetClient("node1")
+	assert.NoError(t, err)
+	c.Add(time.Second)
+	_, err = r.GetClient("node2")
+	assert.NoError(t, err)
+	c.Add(time.Second)
+
+	// use node1 so node2 becomes the least recently used
+	_, err = r.GetClient("node1")
+	assert.NoError(t, err)
+	c.Add(time.Second)
+
+	_, err = r.GetClient("node3")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, r.cache.len())
+	assert.Contains(t, r.cache.keys(), "127.0.0.1:3001")
+	assert.Contains(t, r.cache.keys(), "127.0.0.1:3003")
+	assert.False(t, first.(*closingClient).isClosed())
+	assert.Equal(t, 3, f.numCreated())
+}
+
+func TestCacheEvictsIdleClients(t *testing.T) {
+	r, f, c := newCacheTestRouter(t, WithClientIdleTimeout(time.Minute))
+
+	first, err := r.GetClient("node1")
+	assert.NoError(t, err)
+	c.Add(30 * time.Second)
+
+	// a client in use does not expire
+	_, err = r.GetClient("node1")
+	assert.NoError(t, err)
+	c.Add(45 * time.Second)
+	_, err = r.GetClient("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, f.numCreated())
+
+	c.Add(2 * time.Minute)
+	second, err := r.GetClient("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, f.numCreated())
+	assert.True(t, first.(*closingClient).isClosed(), "expected the idle client to be closed")
+	assert.False(t, second.(*closingClient).isClosed())
+}
+
+func TestCacheSweepsIdleClientsOnCreation(t *testing.T) {
+	r, _, c := newCacheTestRouter(t, WithClientIdleTimeout(time.Minute))
+
+	idle, err := r.GetClient("node1")
+	assert.NoError(t, err)
+	c.Add(2 * time.Minute)
+
+	_, err = r.GetClient("node2")
+	assert.NoError(t, err)
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3001")
+	assert.True(t, idle.(*closingClient).isClosed())
+}
+
+func TestCacheSweepsIdleClientsOncePerTimeout(t *testing.T) {
+	r, _, c := newCacheTestRouter(t, WithClientIdleTimeout(time.Minute))
+
+	_, err := r.GetClient("node1")
+	assert.NoError(t, err)
+	c.Add(30 * time.Second)
+	_, err = r.GetClient("node2")
+	assert.NoError(t, err)
+	c.Add(45 * time.Second)
+	_, err = r.GetClient("node3")
+	assert.NoError(t, err)
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3001")
+
+	// node2 expired, but the cache was swept less than a minute ago
+	c.Add(30 * time.Second)
+	_, err = r.GetClient("node4")
+	assert.NoError(t, err)
+	assert.Contains(t, r.cache.keys(), "127.0.0.1:3002")
+
+	c.Add(30 * time.Second)
+	_, err = r.GetClient("node0")
+	assert.NoError(t, err)
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3002")
+}
+
+func TestCacheOldest(t *testing.T) {
+	cache := newClientCache(4)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		shard := cache.shard(key)
+		shard.Lock()
+		cache.storeLocked(shard, key, newCacheEntry(nil, false, time.Unix(0, int64(100-i))))
+		shard.Unlock()
+	}
+
+	var keys []string
+	for _, e := range cache.oldest("", "key99", 3) {
+		keys = append(keys, e.key)
+	}
+	assert.Equal(t, []string{"key98", "key97", "key96"}, keys, "expected the least recently used entries but keep")
+	assert.Len(t, cache.oldest("", "", 1000), 100)
+	assert.Len(t, cache.oldest("key1", "", 1000), 11, "expected only the entries of the prefix")
+}
+
+func TestCacheEvictsInBatches(t *testing.T) {
+	r, _, c := newCacheTestRouter(t, WithMaxClients(128))
+	for i := 0; i < 129; i++ {
+		key := fmt.Sprintf("key%d", i)
+		shard := r.cache.shard(key)
+		shard.Lock()
+		r.cache.storeLocked(shard, key, newCacheEntry(nil, false, c.Now()))
+		shard.Unlock()
+		c.Add(time.Second)
+	}
+
+	evicted := r.sweep("key128", c.Now())
+	assert.Len(t, evicted, 3, "expected the client over the limit and a 64th of the limit to be evicted")
+	assert.Equal(t, 126, r.cache.len())
+	assert.NotContains(t, r.cache.keys(), "key0")
+	assert.Contains(t, r.cache.keys(), "key128")
+}
+
+func TestCacheNeverClosesLocalClient(t *testing.T) {
+	r, _, c := newCacheTestRouter(t, WithClientIdleTimeout(time.Minute))
+
+	local, err := r.GetClient("node0")
+	assert.NoError(t, err)
+	c.Add(2 * time.Minute)
+
+	_, err = r.GetClient("node0")
+	assert.NoError(t, err)
+	assert.False(t, local.(*closingClient).isClosed())
+}
+
+func TestCacheClosesClientOnMembershipEviction(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+
+	client, err := r.GetClient("node1")
+	assert.NoError(t, err)
+
+	r.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Faulty,
+	})
+	assert.True(t, client.(*closingClient).isClosed())
+}
+
+func TestCacheShards(t *testing.T) {
+	c := newClientCache(4)
+	assert.Len(t, c.shards, 4)
+	assert.Equal(t, c.shard("127.0.0.1:3001"), c.shard("127.0.0.1:3001"))
+
+	entry := newCacheEntry("client", false, time.Now())
+	shard := c.shard("a")
+	shard.Lock()
+	c.storeLocked(shard, "a", entry)
+	c.storeLocked(shard, "a", entry)
+	shard.Unlock()
+	assert.Equal(t, 1, c.len(), "expected storing the same key twice to count once")
+
+	assert.False(t, c.removeEntry("a", newCacheEntry("other", false, time.Now())))
+	assert.True(t, c.removeEntry("a", entry))
+	assert.Equal(t, 0, c.len())
+
+	assert.Len(t, newClientCache(0).shards, 1)
+}
+
+func TestCacheConcurrentCreation(t *testing.T) {
+	r, f, _ := newCacheTestRouter(t, WithCacheShards(2), WithMaxClients(3))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				r.GetClient(fmt.Sprintf("node%d", i%5))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, r.cache.len() <= 3, "expected the cache to stay within its limit")
+	assert.Equal(t, r.cache.len(), len(r.cache.keys()))
+	assert.True(t, f.numCreated() >= 5)
+}
+
+// blockingDialer dials 127.0.0.1:3001 only once release is closed, so tests
+// can act while the client for it is being created.
+type blockingDialer struct {
+	sync.Mutex
+	dialed  map[string]int
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingDialer() *blockingDialer {
+	return &blockingDialer{
+		dialed:  make(map[string]int),
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (d *blockingDialer) dial(dest string) (interface{}, error) {
+	d.Lock()
+	d.dialed[dest]++
+	d.Unlock()
+
+	if dest == "127.0.0.1:3001" {
+		d.started <- struct{}{}
+		<-d.release
+	}
+	return &closingClient{}, nil
+}
+
+func (d *blockingDialer) numDialed(dest string) int {
+	d.Lock()
+	defer d.Unlock()
+	return d.dialed[dest]
+}
+
+func TestCacheCreatesClientOncePerDestination(t *testing.T) {
+	d := newBlockingDialer()
+	r, _, _ := newCacheTestRouter(t, WithCacheShards(1), WithRemoteDialer(d.dial))
+
+	clients := make(chan interface{}, 10)
+	for g := 0; g < cap(clients); g++ {
+		go func() {
+			client, err := r.GetClient("node1")
+			assert.NoError(t, err)
+			clients <- client
+		}()
+	}
+	<-d.started
+
+	// the shard is not locked while the client for node1 is created
+	_, err := r.GetClient("node2")
+	assert.NoError(t, err)
+
+	close(d.release)
+	first := <-clients
+	for i := 1; i < cap(clients); i++ {
+		assert.True(t, first == <-clients, "expected all callers to get the same client")
+	}
+	assert.Equal(t, 1, d.numDialed("127.0.0.1:3001"))
+	assert.Equal(t, 1, d.numDialed("127.0.0.1:3002"))
+}
+
+func TestCacheDiscardsClientRemovedDuringCreation(t *testing.T) {
+	d := newBlockingDialer()
+	r, _, _ := newCacheTestRouter(t, WithRemoteDialer(d.dial))
+
+	done := make(chan struct{})
+	go func() {
+		_, err := r.GetClient("node1")
+		assert.NoError(t, err)
+		close(done)
+	}()
+	<-d.started
+
+	r.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Faulty,
+	})
+	close(d.release)
+	<-done
+
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3001")
+}
+
+func TestCacheEvictsClientOfNewIncarnation(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Alive, Incarnation: 1})
+	client, err := r.GetClient("node1")
+	assert.NoError(t, err)
+
+	// the same incarnation keeps the client
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Suspect, Incarnation: 1})
+	assert.Contains(t, r.cache.keys(), "127.0.0.1:3001")
+	assert.False(t, client.(*closingClient).isClosed())
+
+	// the member restarted
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Alive, Incarnation: 2})
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3001")
+	assert.True(t, client.(*closingClient).isClosed())
+
+	newClient, err := r.GetClient("node1")
+	assert.NoError(t, err)
+	assert.True(t, client != newClient, "expected a new client for the new incarnation")
+}
+
+// perRequestClient is a client that must not be cached.
+type perRequestClient struct {
+	dest string
+}
+
+func (perRequestClient) Cacheable() bool {
+	return false
+}
+
+func TestUncachedLocalClient(t *testing.T) {
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+	cf.On("MakeRemoteClient", mock.Anything).Return("remote client")
+
+	rp := newTestRingpop(nil)
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	r := New(rp, cf, ch, WithUncachedLocalClient()).(*router)
+
+	for i := 0; i < 3; i++ {
+		client, err := r.GetClient("local")
+		assert.NoError(t, err)
+		assert.Equal(t, "local client", client)
+		_, err = r.GetClient("remote")
+		assert.NoError(t, err)
+	}
+	cf.AssertNumberOfCalls(t, "GetLocalClient", 3)
+	cf.AssertNumberOfCalls(t, "MakeRemoteClient", 1)
+	assert.Equal(t, []string{"127.0.0.1:3001"}, r.cache.keys())
+}
+
+func TestCacheableClients(t *testing.T) {
+	rp := newTestRingpop(nil)
+
+	var mu sync.Mutex
+	dialed := 0
+	dialer := func(dest string) (interface{}, error) {
+		mu.Lock()
+		dialed++
+		mu.Unlock()
+		return &perRequestClient{dest: dest}, nil
+	}
+	r := newRingpopTestRouter(t, rp, WithRemoteDialer(dialer))
+
+	var wg sync.WaitGroup
+	clients := make([]interface{}, 10)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := r.GetClient("remote")
+			assert.NoError(t, err)
+			clients[i] = client
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, dialed, "expected a client for every call")
+	for i := 1; i < len(clients); i++ {
+		assert.False(t, clients[0] == clients[i], "expected clients not to be shared")
+	}
+	assert.Empty(t, r.cache.keys())
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"time"
+
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// CallTimeouts are the timeouts of the calls made through the remote clients
+// created by the router whose context has no deadline, see WithCallTimeouts.
+type CallTimeouts struct {
+	// Default is the timeout of the calls to methods without a timeout of
+	// their own. Zero leaves calls to those methods without a deadline.
+	Default time.Duration
+
+	// Methods are the timeouts of methods, by service and method name
+	// joined by "::", eg. "KeyValue::Get".
+	Methods map[string]time.Duration
+}
+
+// timeout returns the timeout of calls to method of service, or zero.
+func (t CallTimeouts) timeout(service, method string) time.Duration {
+	if d, ok := t.Methods[service+"::"+method]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// callTimeout is the Interceptor of WithCallTimeouts. The deadline of a
+// context that has one is kept, so callers can override the timeouts.
+func (r *router) callTimeout(ctx thrift.Context, call *Call, next func(ctx thrift.Context) (bool, error)) (bool, error) {
+	if _, ok := ctx.Deadline(); ok {
+		return next(ctx)
+	}
+	d := r.callTimeouts.timeout(call.Service, call.Method)
+	if d <= 0 {
+		return next(ctx)
+	}
+
+	r.statter.IncCounter("router.call.timeout.defaulted", nil, 1)
+	timed, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	return next(thrift.WithHeaders(timed, ctx.Headers()))
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// deadlineStubClient records the deadline and headers of the calls it makes.
+type deadlineStubClient struct {
+	stubTChanClient
+	deadline time.Time
+	ok       bool
+	headers  map[string]string
+}
+
+func (c *deadlineStubClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	c.deadline, c.ok = ctx.Deadline()
+	c.headers = ctx.Headers()
+	return c.stubTChanClient.Call(ctx, serviceName, methodName, req, resp)
+}
+
+func TestCallTimeouts(t *testing.T) {
+	timeouts := CallTimeouts{
+		Default: time.Second,
+		Methods: map[string]time.Duration{"KeyValue::Scan": time.Minute, "KeyValue::Watch": 0},
+	}
+	r, _ := newBreakerTestRouter(t, WithCallTimeouts(timeouts))
+	timeouts.Methods["KeyValue::Get"] = time.Hour
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	ic, ok := client.(*interceptedClient)
+	if !assert.True(t, ok, "expected the remote client to be intercepted") {
+		return
+	}
+	stub := &deadlineStubClient{}
+	ic.TChanClient = stub
+	noDeadline := thrift.WithHeaders(context.Background(), map[string]string{"caller": "test"})
+
+	for _, tt := range []struct {
+		method  string
+		timeout time.Duration
+	}{
+		{"Get", time.Second},
+		{"Scan", time.Minute},
+	} {
+		start := time.Now()
+		_, err = ic.Call(noDeadline, "KeyValue", tt.method, nil, nil)
+		assert.NoError(t, err)
+		if assert.True(t, stub.ok, "expected a deadline for %s", tt.method) {
+			assert.WithinDuration(t, start.Add(tt.timeout), stub.deadline, 100*time.Millisecond)
+		}
+		assert.Equal(t, map[string]string{"caller": "test"}, stub.headers, "expected the headers to be kept")
+	}
+
+	_, err = ic.Call(noDeadline, "KeyValue", "Watch", nil, nil)
+	assert.NoError(t, err)
+	assert.False(t, stub.ok, "expected methods without a timeout to be left without deadline")
+
+	// the deadline of the caller wins
+	ctx, cancel := thrift.NewContext(time.Hour)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	_, err = ic.Call(ctx, "KeyValue", "Get", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, deadline, stub.deadline)
+}
+
+func TestNoCallTimeouts(t *testing.T) {
+	r, _ := newBreakerTestRouter(t)
+	assert.Empty(t, r.clientInterceptors())
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	_, ok := client.(*interceptedClient)
+	assert.False(t, ok, "expected the remote client not to be intercepted")
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+)
+
+// Close stops the router. It makes all calls for new clients fail with
+// ErrRouterClosed, waits for the calls running through Dispatch to finish and
+// closes the cached remote clients that implement io.Closer. When ctx is done
+// before all dispatched calls finished, the clients are closed anyway and the
+// error of ctx is returned. The health check, see WithHealthCheck, is stopped
+// and the streams of GetStreamClient and the watches of WatchKey are closed.
+// Calling Close again has no effect.
+//
+// Ringpop does not support removing listeners, so the router stays registered
+// but ignores all events once closed.
+func (r *router) Close(ctx context.Context) error {
+	r.dispatchMu.Lock()
+	if r.closed() {
+		r.dispatchMu.Unlock()
+		return nil
+	}
+	atomic.StoreInt32(&r.state.closed, 1)
+	drained := make(chan struct{})
+	r.drained = drained
+	if r.dispatching == 0 {
+		close(drained)
+	}
+	r.dispatchMu.Unlock()
+
+	if r.healthStop != nil {
+		close(r.healthStop)
+	}
+	if r.watchStop != nil {
+		close(r.watchStop)
+	}
+	if r.labelStop != nil {
+		close(r.labelStop)
+	}
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+
+	r.saveSnapshot()
+	closeClients(r.cache.removeIf(func(cacheKey string, entry *cacheEntry) bool {
+		return strings.HasPrefix(cacheKey, prefix)
+	}))
+
+	r.stickyMu.Lock()
+	for key, session := range r.sticky {
+		session.gone = true
+		delete(r.sticky, key)
+	}
+	r.stickyMu.Unlock()
+
+	r.closeStreams()
+	r.closeWatches()
+	return err
+}
+
+// beginDispatch registers a call made through Dispatch, the returned function
+// marks its end. It fails with ErrRouterClosed once the router is closed.
+func (r *router) beginDispatch() (func(), error) {
+	r.dispatchMu.Lock()
+	defer r.dispatchMu.Unlock()
+
+	if r.closed() {
+		return nil, ErrRouterClosed
+	}
+	r.dispatching++
+
+	return func() {
+		r.dispatchMu.Lock()
+		r.dispatching--
+		if r.dispatching == 0 && r.drained != nil {
+			close(r.drained)
+		}
+		r.dispatchMu.Unlock()
+	}, nil
+}
+
+// closed returns whether the router has been closed.
+func (r *router) closed() bool {
+	return atomic.LoadInt32(&r.state.closed) == 1
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+	"golang.org/x/net/context"
+)
+
+func TestCloseClosesClients(t *testing.T) {
+	r, f, _ := newCacheTestRouter(t)
+
+	local, err := r.GetClient("node0")
+	assert.NoError(t, err)
+	remote, err := r.GetClient("node1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Close(context.Background()))
+	assert.True(t, remote.(*closingClient).isClosed())
+	assert.False(t, local.(*closingClient).isClosed(), "expected the local client not to be closed")
+
+	_, err = r.GetClient("node1")
+	assert.Equal(t, ErrRouterClosed, err)
+	err = r.Dispatch("node1", func(client interface{}) error { return nil })
+	assert.Equal(t, ErrRouterClosed, err)
+	assert.Equal(t, 2, f.numCreated())
+
+	assert.NoError(t, r.Close(context.Background()), "expected a second close to do nothing")
+}
+
+func TestCloseWaitsForDispatchedCalls(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	dispatched := make(chan error)
+	go func() {
+		dispatched <- r.Dispatch("node1", func(client interface{}) error {
+			close(started)
+			<-finish
+			return nil
+		})
+	}()
+	<-started
+
+	closed := make(chan error)
+	go func() {
+		closed <- r.Close(context.Background())
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the dispatched call")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(finish)
+	assert.NoError(t, <-dispatched)
+	assert.NoError(t, <-closed)
+}
+
+func TestCloseGivesUpWhenContextIsDone(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	defer close(finish)
+	go r.Dispatch("node1", func(client interface{}) error {
+		close(started)
+		<-finish
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.Close(ctx))
+}
+
+func TestClosedRouterIgnoresEvents(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+	assert.NoError(t, r.Close(context.Background()))
+
+	r.HandleEvent(swim.MemberlistChangesReceivedEvent{Changes: []swim.Change{
+		{Address: "127.0.0.1:3001", Status: swim.Faulty},
+	}})
+	r.changesMu.Lock()
+	assert.Empty(t, r.lastChanges)
+	r.changesMu.Unlock()
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+// A Codec encodes the requests and decodes the responses of the calls of a
+// CodecClient, eg. as protobuf messages.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// ProtoCodec is the Codec of protobuf messages that marshal themselves, like
+// the messages generated by gogoproto. Messages of other generators can be
+// encoded by a Codec that calls their proto package.
+type ProtoCodec struct{}
+
+type protoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+type protoUnmarshaler interface {
+	Unmarshal(data []byte) error
+}
+
+// Marshal returns the encoding of the message v.
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(protoMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a protobuf message", v)
+	}
+	return m.Marshal()
+}
+
+// Unmarshal decodes data into the message v.
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(protoUnmarshaler)
+	if !ok {
+		return fmt.Errorf("%T is not a protobuf message", v)
+	}
+	return m.Unmarshal(data)
+}
+
+// A CodecClient calls the methods of a remote destination with requests and
+// responses encoded by a Codec. It is the connection a CodecTransport returns,
+// handed to the MakeRemoteCodecClient method of a CodecClientFactory.
+type CodecClient interface {
+	// Call calls method with req and decodes the response into resp. When
+	// the handler of method fails, the error is an *ApplicationError.
+	Call(ctx context.Context, method string, req, resp interface{}) error
+}
+
+// An ApplicationError is the error a CodecClient returns when the handler of
+// the method it called failed.
+type ApplicationError struct {
+	Method  string
+	Message string
+}
+
+func (e *ApplicationError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Method, e.Message)
+}
+
+// A CodecClientFactory is a ClientFactoryV2 that also creates the clients of
+// the destinations reached through a CodecTransport, so a service can move
+// from Thrift to another IDL, eg. protobuf, while keeping its router. Routers
+// whose factory does not implement CodecClientFactory use the CodecClient as
+// the client of the destination.
+type CodecClientFactory interface {
+	ClientFactoryV2
+
+	// MakeRemoteCodecClient creates the client that calls the node at dest
+	// through client. Errors are handled like the errors of
+	// MakeRemoteClient.
+	MakeRemoteCodecClient(dest Destination, client CodecClient) (interface{}, error)
+}
+
+// CodecTransport is the Transport that makes raw TChannel calls to remote
+// destinations, of which arg3 holds the request or response encoded by
+// Codec. The calls are not covered by the circuit breaker, the call limit or
+// the interceptors of the router, which only apply to Thrift calls.
+type CodecTransport struct {
+	// Channel is the channel the calls are made on.
+	Channel *tchannel.Channel
+
+	// Service is the name of the service that is called, the service of
+	// Channel when empty.
+	Service string
+
+	// Codec encodes the requests and decodes the responses.
+	Codec Codec
+}
+
+// Dial returns a CodecClient that calls dest.
+func (t *CodecTransport) Dial(dest string) (ClientConn, error) {
+	service := t.Service
+	if service == "" {
+		service = t.Channel.ServiceName()
+	}
+	return &codecClient{ch: t.Channel, service: service, codec: t.Codec, dest: dest}, nil
+}
+
+// Ping pings dest over the channel.
+func (t *CodecTransport) Ping(ctx context.Context, dest string) error {
+	return t.Channel.Ping(ctx, dest)
+}
+
+// codecClient is the CodecClient of a CodecTransport.
+type codecClient struct {
+	ch      *tchannel.Channel
+	service string
+	codec   Codec
+	dest    string
+}
+
+func (c *codecClient) Call(ctx context.Context, method string, req, resp interface{}) error {
+	body, err := c.codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	_, body, response, err := raw.Call(ctx, c.ch, c.dest, c.service, method, nil, body)
+	if err != nil {
+		return err
+	}
+	if response.ApplicationError() {
+		return &ApplicationError{Method: method, Message: string(body)}
+	}
+	return c.codec.Unmarshal(body, resp)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/raw"
+	"golang.org/x/net/context"
+)
+
+// textMessage is a message that marshals itself like a generated protobuf
+// message does.
+type textMessage struct {
+	text string
+}
+
+func (m *textMessage) Marshal() ([]byte, error) {
+	return []byte(m.text), nil
+}
+
+func (m *textMessage) Unmarshal(data []byte) error {
+	m.text = string(data)
+	return nil
+}
+
+// upperHandler answers "upper" with its request in upper case and fails
+// every other method.
+type upperHandler struct{}
+
+func (upperHandler) Handle(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	if args.Method != "upper" {
+		return &raw.Res{IsErr: true, Arg3: []byte("unknown method")}, nil
+	}
+	return &raw.Res{Arg3: []byte(strings.ToUpper(string(args.Arg3)))}, nil
+}
+
+func (upperHandler) OnError(ctx context.Context, err error) {}
+
+func TestProtoCodec(t *testing.T) {
+	var codec ProtoCodec
+
+	data, err := codec.Marshal(&textMessage{text: "hello"})
+	assert.NoError(t, err)
+	var m textMessage
+	assert.NoError(t, codec.Unmarshal(data, &m))
+	assert.Equal(t, "hello", m.text)
+
+	_, err = codec.Marshal("hello")
+	assert.Error(t, err, "expected values that are not messages to fail")
+	assert.Error(t, codec.Unmarshal(data, &struct{}{}))
+}
+
+func TestCodecTransport(t *testing.T) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	server.Register(raw.Wrap(upperHandler{}), "upper")
+	server.Register(raw.Wrap(upperHandler{}), "lower")
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+
+	ch, err := tchannel.NewChannel("client", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	transport := &CodecTransport{Channel: ch, Service: "remote", Codec: ProtoCodec{}}
+	conn, err := transport.Dial(server.PeerInfo().HostPort)
+	assert.NoError(t, err)
+	client, ok := conn.(CodecClient)
+	assert.True(t, ok, "expected a codec client")
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+
+	var resp textMessage
+	assert.NoError(t, client.Call(ctx, "upper", &textMessage{text: "hello"}, &resp))
+	assert.Equal(t, "HELLO", resp.text)
+
+	err = client.Call(ctx, "lower", &textMessage{text: "HELLO"}, &resp)
+	assert.Equal(t, &ApplicationError{Method: "lower", Message: "unknown method"}, err)
+
+	assert.NoError(t, transport.Ping(ctx, server.PeerInfo().HostPort))
+}
+
+// fakeCodecClient is a CodecClient that is never called.
+type fakeCodecClient string
+
+func (fakeCodecClient) Call(ctx context.Context, method string, req, resp interface{}) error {
+	return errors.New("not implemented")
+}
+
+// codecFactory is a CodecClientFactory of which the remote codec clients are
+// the destinations they are created for, it fails for 127.0.0.1:3002.
+type codecFactory struct {
+	destFactory
+}
+
+func (codecFactory) MakeRemoteCodecClient(dest Destination, client CodecClient) (interface{}, error) {
+	if dest.Address == "127.0.0.1:3002" {
+		return nil, errors.New("no config for destination")
+	}
+	return dest, nil
+}
+
+func newCodecTestRouter(f ClientFactoryV2) Router {
+	rp := newTestRingpop(testLookups{
+		"misconfigured": "127.0.0.1:3002",
+	})
+
+	dialer := func(dest string) (interface{}, error) {
+		return fakeCodecClient(dest), nil
+	}
+	return newChannelTestRouter(rp, nil, withFactoryV2(f), WithRemoteDialer(dialer))
+}
+
+func TestCodecClientFactory(t *testing.T) {
+	r := newCodecTestRouter(codecFactory{})
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, Destination{Address: "127.0.0.1:3001"}, client)
+
+	_, err = r.GetClient("misconfigured")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+}
+
+func TestCodecClientWithoutCodecFactory(t *testing.T) {
+	r := newCodecTestRouter(destFactory{})
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, fakeCodecClient("127.0.0.1:3001"), client, "expected the codec client itself")
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber-common/bark"
+	"golang.org/x/net/context"
+)
+
+// AdaptiveConcurrency configures the limits WithAdaptiveConcurrency adapts to
+// the latency of every destination. Zero fields take their default.
+type AdaptiveConcurrency struct {
+	// InitialLimit is the limit of a destination before its first call
+	// completed, 20 by default.
+	InitialLimit int
+
+	// MinLimit and MaxLimit bound the limit of a destination, 1 and 1000 by
+	// default.
+	MinLimit int
+	MaxLimit int
+
+	// Tolerance is how many times the lowest recent latency of a destination
+	// a call may take before the limit of the destination is decreased, 2 by
+	// default.
+	Tolerance float64
+
+	// LatencyWindow is the window over which the lowest latency of a
+	// destination is taken, 10 seconds by default. The lowest latency of the
+	// previous window counts as well, so a single fast call raises the bar
+	// for at most two windows.
+	LatencyWindow time.Duration
+
+	// Backoff is the factor the limit of a destination is multiplied by when
+	// it is decreased, 0.9 by default.
+	Backoff float64
+}
+
+// withDefaults returns c with the zero fields set to their default.
+func (c AdaptiveConcurrency) withDefaults() AdaptiveConcurrency {
+	if c.MinLimit <= 0 {
+		c.MinLimit = 1
+	}
+	if c.MaxLimit <= 0 {
+		c.MaxLimit = 1000
+	}
+	if c.MaxLimit < c.MinLimit {
+		c.MaxLimit = c.MinLimit
+	}
+	if c.InitialLimit <= 0 {
+		c.InitialLimit = 20
+	}
+	if c.InitialLimit < c.MinLimit {
+		c.InitialLimit = c.MinLimit
+	}
+	if c.InitialLimit > c.MaxLimit {
+		c.InitialLimit = c.MaxLimit
+	}
+	if c.Tolerance <= 1 {
+		c.Tolerance = 2
+	}
+	if c.Backoff <= 0 || c.Backoff >= 1 {
+		c.Backoff = 0.9
+	}
+	if c.LatencyWindow <= 0 {
+		c.LatencyWindow = 10 * time.Second
+	}
+	return c
+}
+
+// adaptiveLimit is the concurrency limit of a destination. It grows by one for
+// every limit calls that complete within the tolerance while the destination
+// is at least half busy, and shrinks by the backoff factor for every call that
+// is slower or times out.
+type adaptiveLimit struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	inflight int
+
+	// windowStart starts the window of which minLatency is the lowest
+	// latency, lastMinLatency is the lowest latency of the previous window
+	windowStart    time.Time
+	minLatency     time.Duration
+	lastMinLatency time.Duration
+}
+
+func newAdaptiveLimit(initial int) *adaptiveLimit {
+	l := &adaptiveLimit{limit: float64(initial)}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire takes a slot, waiting for one when block is set. It fails with
+// ErrDestinationBusy when there is no slot and block is not set, and with the
+// error of ctx when ctx is done while waiting.
+func (l *adaptiveLimit) acquire(ctx context.Context, block bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if block && l.inflight >= int(l.limit) && ctx.Done() != nil {
+		// wake the waiters up when ctx is done so they notice
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				l.mu.Lock()
+				l.cond.Broadcast()
+				l.mu.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+
+	for l.inflight >= int(l.limit) {
+		if !block {
+			return ErrDestinationBusy
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	l.inflight++
+	return nil
+}
+
+// baseline returns the lowest latency of the current and the previous window
+// at now, or 0 when no call succeeded in them. mu must be held.
+func (l *adaptiveLimit) baseline(c *AdaptiveConcurrency, now time.Time) time.Duration {
+	if elapsed := now.Sub(l.windowStart); elapsed >= c.LatencyWindow {
+		if elapsed < 2*c.LatencyWindow {
+			l.lastMinLatency = l.minLatency
+		} else {
+			l.lastMinLatency = 0
+		}
+		l.minLatency = 0
+		l.windowStart = now
+	}
+
+	switch {
+	case l.minLatency == 0:
+		return l.lastMinLatency
+	case l.lastMinLatency == 0 || l.minLatency < l.lastMinLatency:
+		return l.minLatency
+	default:
+		return l.lastMinLatency
+	}
+}
+
+// release gives a slot back after a call that ended at now, took latency and
+// ended with class, and returns the new limit and whether it changed.
+func (l *adaptiveLimit) release(c *AdaptiveConcurrency, now time.Time, latency time.Duration, class ErrorClass) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	before := int(l.limit)
+	busy := l.inflight*2 >= before
+	l.inflight--
+
+	baseline := l.baseline(c, now)
+	slow := baseline > 0 && float64(latency) > c.Tolerance*float64(baseline)
+	switch {
+	case class == ClassTimeout || slow:
+		l.limit *= c.Backoff
+		if l.limit < float64(c.MinLimit) {
+			l.limit = float64(c.MinLimit)
+		}
+	case class == ClassNone && busy:
+		l.limit += 1 / l.limit
+		if l.limit > float64(c.MaxLimit) {
+			l.limit = float64(c.MaxLimit)
+		}
+	}
+	if class == ClassNone && (l.minLatency == 0 || latency < l.minLatency) {
+		l.minLatency = latency
+	}
+
+	l.cond.Broadcast()
+	return int(l.limit), int(l.limit) != before
+}
+
+func (l *adaptiveLimit) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// adaptiveLimitFor returns the adaptive limit of dest, creating it if needed.
+func (r *router) adaptiveLimitFor(dest string) *adaptiveLimit {
+	r.inflightMu.Lock()
+	defer r.inflightMu.Unlock()
+
+	l, ok := r.adaptiveLimits[dest]
+	if !ok {
+		l = newAdaptiveLimit(r.adaptive.InitialLimit)
+		r.adaptiveLimits[dest] = l
+	}
+	return l
+}
+
+// acquireAdaptive takes an in-flight slot for dest under its adaptive limit
+// and returns the function that gives the slot back with the outcome of the
+// call. Changes of the limit are reported by the router.concurrency.limit
+// gauge.
+func (r *router) acquireAdaptive(ctx context.Context, dest string) (func(error), error) {
+	l := r.adaptiveLimitFor(dest)
+	if err := l.acquire(ctx, r.blockWhenBusy); err != nil {
+		return nil, err
+	}
+
+	start := r.clock.Now()
+	return func(err error) {
+		now := r.clock.Now()
+		limit, changed := l.release(r.adaptive, now, now.Sub(start), ClassifyError(err))
+		if changed {
+			r.statter.UpdateGauge("router.concurrency.limit", bark.Tags{"dest": dest}, int64(limit))
+		}
+	}, nil
+}
+
+// concurrencyLimits returns the current adaptive limit of every destination
+// called, or nil when WithAdaptiveConcurrency is not used.
+func (r *router) concurrencyLimits() map[string]int {
+	if r.adaptive == nil {
+		return nil
+	}
+
+	r.inflightMu.Lock()
+	limits := make(map[string]*adaptiveLimit, len(r.adaptiveLimits))
+	for dest, l := range r.adaptiveLimits {
+		limits[dest] = l
+	}
+	r.inflightMu.Unlock()
+
+	current := make(map[string]int, len(limits))
+	for dest, l := range limits {
+		current[dest] = l.current()
+	}
+	return current
+}
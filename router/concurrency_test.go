@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/test/mocks"
+	"golang.org/x/net/context"
+)
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	stats := &mocks.StatsReporter{}
+	stats.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	stats.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+	stats.On("UpdateGauge", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	r, c := newBreakerTestRouter(t, WithStatsReporter(stats), WithAdaptiveConcurrency(AdaptiveConcurrency{
+		InitialLimit: 2,
+		MaxLimit:     4,
+		Backoff:      0.5,
+	}))
+	defer r.Close(context.Background())
+	dispatch := func(latency time.Duration, err error) error {
+		return r.Dispatch("a", func(client interface{}) error {
+			c.Add(latency)
+			return err
+		})
+	}
+
+	// fast calls grow the limit by one for every limit calls
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, dispatch(10*time.Millisecond, nil))
+	}
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 3}, r.Stats().ConcurrencyLimits)
+	stats.AssertCalled(t, "UpdateGauge", "router.concurrency.limit", bark.Tags{"dest": "127.0.0.1:3001"}, int64(3))
+
+	// calls slower than the tolerance shrink it
+	assert.NoError(t, dispatch(50*time.Millisecond, nil))
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 1}, r.Stats().ConcurrencyLimits)
+
+	// and the destination is busy at the limit
+	err := r.Dispatch("a", func(client interface{}) error {
+		return r.Dispatch("a", func(client interface{}) error { return nil })
+	})
+	assert.Equal(t, ErrDestinationBusy, err)
+
+	// timeouts shrink it down to the minimum
+	assert.Equal(t, context.DeadlineExceeded, dispatch(time.Millisecond, context.DeadlineExceeded))
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 1}, r.Stats().ConcurrencyLimits)
+}
+
+func TestAdaptiveConcurrencyBounds(t *testing.T) {
+	r, c := newBreakerTestRouter(t, WithAdaptiveConcurrency(AdaptiveConcurrency{
+		InitialLimit: 1,
+		MaxLimit:     2,
+	}))
+	defer r.Close(context.Background())
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, r.Dispatch("a", func(client interface{}) error {
+			c.Add(time.Millisecond)
+			return nil
+		}))
+	}
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 2}, r.Stats().ConcurrencyLimits, "expected the limit to stop at the maximum")
+
+	r, _ = newBreakerTestRouter(t)
+	defer r.Close(context.Background())
+	assert.Nil(t, r.Stats().ConcurrencyLimits)
+}
+
+func TestAdaptiveConcurrencyPanicsReleaseSlots(t *testing.T) {
+	for _, opt := range []Option{WithMaxInflightPerDest(1), WithAdaptiveConcurrency(AdaptiveConcurrency{MaxLimit: 1})} {
+		r, _ := newBreakerTestRouter(t, opt)
+
+		func() {
+			defer func() { assert.NotNil(t, recover()) }()
+			r.Dispatch("a", func(client interface{}) error { panic("boom") })
+		}()
+		assert.NoError(t, r.Dispatch("a", func(client interface{}) error { return nil }), "expected the slot of the panicking call to be free")
+		r.Close(context.Background())
+	}
+}
+
+func TestAdaptiveConcurrencyBlockedDispatchCancelled(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithAdaptiveConcurrency(AdaptiveConcurrency{MaxLimit: 1}), WithBlockWhenBusy())
+	defer r.Close(context.Background())
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	defer close(unblock)
+	go r.Dispatch("a", func(client interface{}) error {
+		close(started)
+		<-unblock
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := r.DispatchContext(ctx, "a", func(client interface{}) error {
+		t.Error("expected fn not to be called while the destination is busy")
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestAdaptiveConcurrencyBaselineExpires(t *testing.T) {
+	r, c := newBreakerTestRouter(t, WithAdaptiveConcurrency(AdaptiveConcurrency{
+		InitialLimit:  4,
+		Backoff:       0.5,
+		LatencyWindow: time.Minute,
+	}))
+	defer r.Close(context.Background())
+	dispatch := func(latency time.Duration) {
+		assert.NoError(t, r.Dispatch("a", func(client interface{}) error {
+			c.Add(latency)
+			return nil
+		}))
+	}
+
+	// a single fast call, eg. a cache hit, sets the baseline
+	dispatch(time.Millisecond)
+	dispatch(10 * time.Millisecond)
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 2}, r.Stats().ConcurrencyLimits)
+
+	// until it is two windows old
+	c.Add(2 * time.Minute)
+	dispatch(10 * time.Millisecond)
+	dispatch(10 * time.Millisecond)
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 2}, r.Stats().ConcurrencyLimits, "expected normal calls not to be slow anymore")
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go"
+)
+
+// A ConnectionWatcher is a Transport that can report the destinations it has
+// an open connection to, see WithConnectionWatch.
+type ConnectionWatcher interface {
+	// Connected returns the set of the destinations with at least one open
+	// connection.
+	Connected() map[string]bool
+}
+
+// activeConnectionState is the state TChannel reports for connections that
+// can make calls.
+const activeConnectionState = "connectionActive"
+
+// Connected returns the peers of the channel with at least one active inbound
+// or outbound connection. TChannel keeps closed connections with their peer,
+// so their state is checked.
+func (t *TChannelTransport) Connected() map[string]bool {
+	peers := t.Channel.IntrospectState(&tchannel.IntrospectionOptions{}).RootPeers
+	connected := make(map[string]bool, len(peers))
+	for hostPort, peer := range peers {
+		conns := append(peer.OutboundConnections, peer.InboundConnections...)
+		for _, conn := range conns {
+			if conn.ConnectionState == activeConnectionState {
+				connected[hostPort] = true
+				break
+			}
+		}
+	}
+	return connected
+}
+
+// startConnectionWatch starts watching the connections of the transport when
+// enabled with WithConnectionWatch. It stops when the router is closed.
+func (r *router) startConnectionWatch() {
+	if _, ok := r.transport.(ConnectionWatcher); !ok || r.watchInterval <= 0 {
+		return
+	}
+
+	r.watchStop = make(chan struct{})
+	ticker := r.clock.Ticker(r.watchInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.watchConnections()
+			case <-r.watchStop:
+				return
+			}
+		}
+	}()
+}
+
+// watchConnections evicts the cached remote clients of this router whose
+// destination had an open connection when last watched and has none anymore.
+// Clients whose destination was never connected, eg. because they were not
+// called yet, are left alone.
+func (r *router) watchConnections() {
+	connected := r.transport.(ConnectionWatcher).Connected()
+
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		entry, ok := r.cache.get(cacheKey)
+		if !ok || entry.local {
+			continue
+		}
+
+		dest := strings.TrimPrefix(cacheKey, prefix)
+		if connected[r.dialAddress(dest)] {
+			atomic.StoreInt32(&entry.connected, 1)
+			continue
+		}
+		if atomic.LoadInt32(&entry.connected) == 0 {
+			continue
+		}
+
+		if r.cache.removeEntry(cacheKey, entry) {
+			r.statter.IncCounter("router.client.disconnected", nil, 1)
+			r.logger.WithFields(bark.Fields{
+				"dest": dest,
+			}).Debug("router evicted client of disconnected destination")
+			r.evict([]*cacheEntry{entry})
+		}
+	}
+}
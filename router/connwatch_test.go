@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// watchedTransport is a memoryTransport that reports the destinations of
+// connected as connected.
+type watchedTransport struct {
+	memoryTransport
+
+	mu        sync.Mutex
+	connected map[string]bool
+}
+
+func (t *watchedTransport) Connected() map[string]bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	connected := make(map[string]bool, len(t.connected))
+	for dest, ok := range t.connected {
+		if ok {
+			connected[dest] = true
+		}
+	}
+	return connected
+}
+
+func (t *watchedTransport) setConnected(dest string, connected bool) {
+	t.mu.Lock()
+	t.connected[dest] = connected
+	t.mu.Unlock()
+}
+
+func TestConnectionWatch(t *testing.T) {
+	transport := &watchedTransport{
+		memoryTransport: memoryTransport{conns: map[string]ClientConn{
+			"127.0.0.1:3001": "thrift client",
+			"127.0.0.1:3002": "raw client",
+		}},
+		connected: make(map[string]bool),
+	}
+	r := newTransportTestRouter(t, nil, WithTransport(transport), WithConnectionWatch(time.Minute))
+	defer r.Close(context.Background())
+	assert.NotNil(t, r.watchStop)
+
+	_, err := r.GetClient("thrift")
+	assert.NoError(t, err)
+	_, err = r.GetClient("raw")
+	assert.NoError(t, err)
+	_, err = r.GetClient("local")
+	assert.NoError(t, err)
+
+	// clients of destinations that were never connected are kept
+	r.watchConnections()
+	assert.Equal(t, 3, r.cache.len())
+
+	transport.setConnected("127.0.0.1:3001", true)
+	transport.setConnected("127.0.0.1:3002", true)
+	r.watchConnections()
+	assert.Equal(t, 3, r.cache.len())
+
+	transport.setConnected("127.0.0.1:3001", false)
+	r.watchConnections()
+	assert.Equal(t, []string{"127.0.0.1:3000", "127.0.0.1:3002"}, r.cache.keys(),
+		"expected the client of the disconnected destination to be evicted")
+
+	// the client is created again on the next call
+	_, err = r.GetClient("thrift")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, r.cache.len())
+}
+
+func TestConnectionWatchNeedsWatcher(t *testing.T) {
+	r := newTransportTestRouter(t, nil, WithTransport(&memoryTransport{}), WithConnectionWatch(time.Minute))
+	defer r.Close(context.Background())
+	assert.Nil(t, r.watchStop, "expected transports that are not watchers not to be watched")
+}
+
+func TestTChannelTransportConnected(t *testing.T) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	hostPort := server.PeerInfo().HostPort
+
+	ch, err := tchannel.NewChannel("client", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	transport := &TChannelTransport{Channel: ch}
+	assert.False(t, transport.Connected()[hostPort])
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	assert.NoError(t, transport.Ping(ctx, hostPort))
+	assert.True(t, transport.Connected()[hostPort], "expected the pinged peer to be connected")
+
+	server.Close()
+	for i := 0; i < 100 && transport.Connected()[hostPort]; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, transport.Connected()[hostPort], "expected the closed peer not to be connected")
+}
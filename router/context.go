@@ -0,0 +1,67 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "golang.org/x/net/context"
+
+// GetClientContext is like GetClient but gives up when ctx is cancelled or
+// its deadline expires before the key has been resolved or its client has
+// been created, in which case the error of ctx is returned. Lookups and
+// creations that are given up on are not aborted: a lookup completes in the
+// background and, once a creation completes, the client is cached for the
+// next caller. Cached clients are returned on the goroutine of the caller
+// once the key is resolved. With WithDeadlineRouting, owners that are not
+// expected to answer before the deadline of ctx are skipped.
+func (r *router) GetClientContext(ctx context.Context, key string) (interface{}, error) {
+	client, _, err := r.getClientContext(ctx, key)
+	return client, err
+}
+
+// whileNotDone runs fn and returns its error, or the error of ctx when ctx is
+// done before fn returns. fn runs on another goroutine when ctx can be done;
+// it is not aborted and its outcome is dropped when the caller gave up.
+func whileNotDone(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *router) getClientContext(ctx context.Context, key string) (interface{}, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	if r.tracer != nil {
+		return r.traceGetClient(ctx, key)
+	}
+	client, dest, _, err := r.resolveClient(ctx, key)
+	return client, dest, err
+}
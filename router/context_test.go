@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+func TestGetClientContext(t *testing.T) {
+	r := newTestRouter(t)
+
+	client, err := r.GetClientContext(context.Background(), "remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote client", client)
+}
+
+func TestGetClientContextForwardLookupError(t *testing.T) {
+	r := newTestRouter(t)
+
+	_, err := r.GetClientContext(context.Background(), "error")
+	assert.EqualError(t, err, "ringpop not ready")
+}
+
+func TestGetClientContextCancelled(t *testing.T) {
+	r := newTestRouter(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.GetClientContext(ctx, "remote")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestGetClientContextDeadlineWhileLookupStalls(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	rp := newTestRingpop(nil)
+	rp.On("Lookup", "stalled").Return("127.0.0.1:3001", nil).Run(func(mock.Arguments) {
+		<-unblock
+	})
+	r := newRingpopTestRouter(t, rp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := r.GetClientContext(ctx, "stalled")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestGetClientContextDeadlineWhileCreationStalls(t *testing.T) {
+	unblock := make(chan struct{})
+	cf := &mocks.ClientFactory{}
+	cf.On("MakeRemoteClient", mock.Anything).Return("remote client").Run(func(mock.Arguments) {
+		<-unblock
+	})
+
+	rp := newTestRingpop(testLookups{
+		"stalled": "127.0.0.1:3001",
+	})
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	r := New(rp, cf, ch).(*router)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = r.GetClientContext(ctx, "stalled")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// callers waiting for the same creation give up as well
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	_, err = r.GetClientContext(waitCtx, "stalled")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the abandoned creation completes and caches the client
+	close(unblock)
+	for i := 0; i < 100; i++ {
+		_, cached := r.cache.get("127.0.0.1:3001")
+		if cached {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("expected the client to be cached after the creation completed")
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// A Participant is an owner of keys of a Transaction, with the client the
+// router returned for it.
+type Participant struct {
+	Dest   string
+	Client interface{}
+	Keys   []string
+}
+
+// A PhaseFunc makes the call of one phase of a Transaction on a participant.
+// It should give up when ctx is done.
+type PhaseFunc func(ctx context.Context, p Participant) error
+
+// TransactionError is the error wrapped in an Error of kind
+// ErrTransactionAborted or ErrCommitFailed when a phase of a Transaction
+// failed on some of its participants. Errors holds the error of every
+// participant that failed the phase, by address.
+type TransactionError struct {
+	Phase  string
+	Errors map[string]error
+}
+
+func (e *TransactionError) Error() string {
+	dests := make([]string, 0, len(e.Errors))
+	for dest := range e.Errors {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	errs := make([]string, len(dests))
+	for i, dest := range dests {
+		errs[i] = dest + ": " + e.Errors[dest].Error()
+	}
+	return fmt.Sprintf("%s failed on %d participants: %s", e.Phase, len(dests), strings.Join(errs, ", "))
+}
+
+// A Coordinator runs calls that must take effect on the owners of several
+// keys together, with the clients of a router. A Transaction resolves the
+// owners of its keys once; services then make single calls when they are
+// co-located, or run a two-phase call over all of them.
+type Coordinator struct {
+	router  Router
+	timeout time.Duration
+}
+
+// NewCoordinator returns a Coordinator running its transactions with the
+// clients of r. Every phase of a transaction is bounded by timeout, if not
+// zero.
+func NewCoordinator(r Router, timeout time.Duration) *Coordinator {
+	return &Coordinator{router: r, timeout: timeout}
+}
+
+// A Transaction is a set of keys resolved to their owners, see
+// Coordinator.Begin.
+type Transaction struct {
+	c *Coordinator
+
+	// Participants are the owners of the keys, sorted by address.
+	Participants []Participant
+}
+
+// Begin resolves the owners of keys and returns the Transaction over them.
+// The owners are not resolved again: a transaction that fails because the
+// ring changed should be begun again.
+func (c *Coordinator) Begin(keys []string) (*Transaction, error) {
+	groups, err := c.router.GetClients(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{c: c, Participants: make([]Participant, 0, len(groups))}
+	for dest, group := range groups {
+		t.Participants = append(t.Participants, Participant{
+			Dest:   dest,
+			Client: group.Client,
+			Keys:   group.Keys,
+		})
+	}
+	sort.Sort(participants(t.Participants))
+	return t, nil
+}
+
+// Colocated returns whether all keys of t are owned by the same node, so a
+// single call to it is enough.
+func (t *Transaction) Colocated() bool {
+	return len(t.Participants) <= 1
+}
+
+// Run makes the two-phase call of t: prepare is called concurrently on all
+// participants and, once it succeeded on all of them, commit is. When prepare
+// failed on any participant abort is called on all of them instead, and Run
+// returns an Error of kind ErrTransactionAborted. Abort is called with a
+// context of its own, so participants are aborted even when prepare failed
+// because ctx is done. The errors of abort are ignored, so aborts must be
+// safe on participants that did not prepare.
+// When commit failed on some participants Run returns an Error of kind
+// ErrCommitFailed; the transaction is decided and the commit should be
+// retried on the participants of the TransactionError.
+func (t *Transaction) Run(ctx context.Context, prepare, commit, abort PhaseFunc) error {
+	if errs := t.phase(ctx, prepare); len(errs) > 0 {
+		// ctx may be done already, the timeout of the coordinator bounds the
+		// abort instead
+		t.phase(context.Background(), abort)
+		return wrapError(ErrTransactionAborted, &TransactionError{Phase: "prepare", Errors: errs})
+	}
+	if errs := t.phase(ctx, commit); len(errs) > 0 {
+		return wrapError(ErrCommitFailed, &TransactionError{Phase: "commit", Errors: errs})
+	}
+	return nil
+}
+
+// phase calls fn concurrently on all participants of t and returns the
+// errors of the ones that failed, by address.
+func (t *Transaction) phase(ctx context.Context, fn PhaseFunc) map[string]error {
+	if t.c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.c.timeout)
+		defer cancel()
+	}
+
+	results := make(chan quorumResult, len(t.Participants))
+	for _, p := range t.Participants {
+		go func(p Participant) {
+			results <- quorumResult{p.Dest, fn(ctx, p)}
+		}(p)
+	}
+
+	errs := make(map[string]error)
+	for range t.Participants {
+		if res := <-results; res.err != nil {
+			errs[res.dest] = res.err
+		}
+	}
+	return errs
+}
+
+// participants sorts Participants by address.
+type participants []Participant
+
+func (s participants) Len() int           { return len(s) }
+func (s participants) Less(i, j int) bool { return s[i].Dest < s[j].Dest }
+func (s participants) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,140 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// phaseRecorder records the participants every phase was called on.
+type phaseRecorder struct {
+	sync.Mutex
+	calls map[string][]string
+}
+
+func (p *phaseRecorder) phase(name string, fail map[string]bool) PhaseFunc {
+	return func(ctx context.Context, part Participant) error {
+		p.Lock()
+		defer p.Unlock()
+		if p.calls == nil {
+			p.calls = make(map[string][]string)
+		}
+		p.calls[name] = append(p.calls[name], part.Dest)
+		sort.Strings(p.calls[name])
+		if fail[part.Dest] {
+			return errors.New(name + " failed")
+		}
+		return nil
+	}
+}
+
+func TestTransactionParticipants(t *testing.T) {
+	c := NewCoordinator(newTestRouter(t), 0)
+
+	tx, err := c.Begin([]string{"remote", "local", "remote"})
+	assert.NoError(t, err)
+	assert.False(t, tx.Colocated())
+	assert.Equal(t, []Participant{
+		{Dest: "127.0.0.1:3000", Client: "local client", Keys: []string{"local"}},
+		{Dest: "127.0.0.1:3001", Client: "remote client", Keys: []string{"remote", "remote"}},
+	}, tx.Participants)
+
+	tx, err = c.Begin([]string{"remote"})
+	assert.NoError(t, err)
+	assert.True(t, tx.Colocated())
+
+	_, err = c.Begin([]string{"local", "error"})
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+}
+
+func TestTransactionCommit(t *testing.T) {
+	tx, err := NewCoordinator(newTestRouter(t), 0).Begin([]string{"local", "remote"})
+	assert.NoError(t, err)
+
+	rec := &phaseRecorder{}
+	err = tx.Run(context.Background(), rec.phase("prepare", nil), rec.phase("commit", nil), rec.phase("abort", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"prepare": {"127.0.0.1:3000", "127.0.0.1:3001"},
+		"commit":  {"127.0.0.1:3000", "127.0.0.1:3001"},
+	}, rec.calls)
+}
+
+func TestTransactionAbort(t *testing.T) {
+	tx, err := NewCoordinator(newTestRouter(t), 0).Begin([]string{"local", "remote"})
+	assert.NoError(t, err)
+
+	rec := &phaseRecorder{}
+	fail := map[string]bool{"127.0.0.1:3001": true}
+	err = tx.Run(context.Background(), rec.phase("prepare", fail), rec.phase("commit", nil), rec.phase("abort", fail))
+	assert.Equal(t, ErrTransactionAborted, KindOf(err))
+	assert.Equal(t, "prepare failed on 1 participants: 127.0.0.1:3001: prepare failed", err.Error())
+	assert.Equal(t, map[string][]string{
+		"prepare": {"127.0.0.1:3000", "127.0.0.1:3001"},
+		"abort":   {"127.0.0.1:3000", "127.0.0.1:3001"},
+	}, rec.calls, "expected every participant to be aborted")
+}
+
+func TestTransactionAbortAfterContextDone(t *testing.T) {
+	tx, err := NewCoordinator(newTestRouter(t), time.Second).Begin([]string{"local", "remote"})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	prepare := func(ctx context.Context, p Participant) error {
+		return ctx.Err()
+	}
+	var mu sync.Mutex
+	var aborted []error
+	abort := func(ctx context.Context, p Participant) error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, ok := ctx.Deadline()
+		assert.True(t, ok, "expected the abort to be bounded by the timeout")
+		aborted = append(aborted, ctx.Err())
+		return nil
+	}
+	err = tx.Run(ctx, prepare, nil, abort)
+	assert.Equal(t, ErrTransactionAborted, KindOf(err))
+	assert.Equal(t, []error{nil, nil}, aborted, "expected the participants to be aborted with a live context")
+}
+
+func TestTransactionCommitFailed(t *testing.T) {
+	tx, err := NewCoordinator(newTestRouter(t), 0).Begin([]string{"local", "remote"})
+	assert.NoError(t, err)
+
+	rec := &phaseRecorder{}
+	fail := map[string]bool{"127.0.0.1:3000": true}
+	err = tx.Run(context.Background(), rec.phase("prepare", nil), rec.phase("commit", fail), rec.phase("abort", nil))
+	assert.Equal(t, ErrCommitFailed, KindOf(err))
+	terr := err.(*Error).Err.(*TransactionError)
+	assert.Equal(t, "commit", terr.Phase)
+	assert.Len(t, terr.Errors, 1)
+	assert.Contains(t, terr.Errors, "127.0.0.1:3000")
+	assert.NotContains(t, rec.calls, "abort")
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// latencyDecay is the weight of the latest call in the moving averages of
+// the latencies of a destination.
+const latencyDecay = 0.1
+
+// latencyStats holds the exponentially weighted moving averages of the
+// latency of the calls to a destination and of its deviation, and a moving
+// estimate of its median.
+type latencyStats struct {
+	mean      float64
+	deviation float64
+	median    float64
+	samples   int
+}
+
+func (s *latencyStats) observe(d time.Duration) {
+	x := float64(d)
+	if s.samples == 0 {
+		s.mean = x
+		s.median = x
+	} else {
+		diff := x - s.mean
+		if diff < 0 {
+			diff = -diff
+		}
+		s.mean += latencyDecay * (x - s.mean)
+		s.deviation += latencyDecay * (diff - s.deviation)
+
+		// the median moves towards every call by a step of the scale of
+		// the deviation, and settles where as many calls are above as below
+		step := latencyDecay * s.deviation
+		switch {
+		case x > s.median+step:
+			s.median += step
+		case x < s.median-step:
+			s.median -= step
+		default:
+			s.median = x
+		}
+	}
+	s.samples++
+}
+
+// p99 estimates the 99th percentile of the latency as three mean deviations
+// above the mean, which holds for roughly normal latencies.
+func (s *latencyStats) p99() time.Duration {
+	return time.Duration(s.mean + 3*s.deviation)
+}
+
+// recordLatency records the latency of a call to dest.
+func (r *router) recordLatency(dest string, d time.Duration) {
+	r.latenciesMu.Lock()
+	s, ok := r.latencies[dest]
+	if !ok {
+		s = &latencyStats{}
+		r.latencies[dest] = s
+	}
+	s.observe(d)
+	r.latenciesMu.Unlock()
+
+	r.exportLatency(dest, d)
+}
+
+// meetsDeadline returns whether the estimated p99 latency of dest fits in the
+// time left until deadline. Destinations without calls yet meet any deadline.
+func (r *router) meetsDeadline(dest string, deadline time.Time) bool {
+	r.latenciesMu.Lock()
+	s, ok := r.latencies[dest]
+	var p99 time.Duration
+	if ok {
+		p99 = s.p99()
+	}
+	r.latenciesMu.Unlock()
+
+	return !ok || p99 <= deadline.Sub(r.clock.Now())
+}
+
+// routingDeadline returns the deadline of ctx when deadline-aware routing is
+// enabled with WithDeadlineRouting, or the zero time.
+func (r *router) routingDeadline(ctx context.Context) time.Time {
+	if !r.deadlineRouting {
+		return time.Time{}
+	}
+	deadline, _ := ctx.Deadline()
+	return deadline
+}
+
+// deadlineClient returns the client of the first of the replicas of key that
+// meets deadline, or ErrDeadlineInfeasible when none does or fallback to
+// replicas is disabled. It is used when the owner of key cannot meet
+// deadline, see WithDeadlineRouting.
+func (r *router) deadlineClient(ctx context.Context, key string, deadline time.Time) (interface{}, string, error) {
+	r.statter.IncCounter("router.deadline.infeasible", nil, 1)
+	if r.deadlineFallback <= 1 {
+		return nil, "", ErrDeadlineInfeasible
+	}
+	missesDeadline := func(dest string) bool {
+		return !r.meetsDeadline(dest, deadline)
+	}
+	return r.replicaClient(ctx, key, r.deadlineFallback, missesDeadline, ErrDeadlineInfeasible)
+}
+
+// latencyClient is the TChanClient handed to the ClientFactory for remote
+// destinations when latencies are tracked, see WithLatencyTracking and
+// WithDeadlineRouting. It records the latency of every call to its
+// destination.
+type latencyClient struct {
+	thrift.TChanClient
+
+	r    *router
+	dest string
+}
+
+func (c *latencyClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	start := c.r.clock.Now()
+	success, err := c.TChanClient.Call(ctx, serviceName, methodName, req, resp)
+	c.r.recordLatency(c.dest, c.r.clock.Now().Sub(start))
+	return success, err
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// slowTChanClient takes latency on the mock clock to answer every call.
+type slowTChanClient struct {
+	clock   *clock.Mock
+	latency time.Duration
+}
+
+func (c *slowTChanClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	c.clock.Add(c.latency)
+	return true, nil
+}
+
+// newDeadlineTestRouter creates a router on which 127.0.0.1:3001, the owner
+// of "a", answers in 500ms and 127.0.0.1:3002, its second replica, in 10ms.
+func newDeadlineTestRouter(t *testing.T, n int) *router {
+	r, _ := newBreakerTestRouter(t, WithDeadlineRouting(n), WithClock(clock.New()))
+	r.recordLatency("127.0.0.1:3001", 500*time.Millisecond)
+	r.recordLatency("127.0.0.1:3002", 10*time.Millisecond)
+	return r
+}
+
+func clientDest(t *testing.T, client interface{}) string {
+	lc, ok := client.(*latencyClient)
+	if !assert.True(t, ok, "expected the remote client to record latencies") {
+		return ""
+	}
+	return lc.dest
+}
+
+func TestDeadlineRoutingFallsBack(t *testing.T) {
+	r := newDeadlineTestRouter(t, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	client, err := r.GetClientContext(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", clientDest(t, client))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client, err = r.GetClientContext(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", clientDest(t, client), "expected the owner when it meets the deadline")
+
+	client, err = r.GetClientContext(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", clientDest(t, client), "expected the owner without a deadline")
+}
+
+func TestDeadlineRoutingInfeasible(t *testing.T) {
+	r := newDeadlineTestRouter(t, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err := r.GetClientContext(ctx, "a")
+	assert.Equal(t, ErrDeadlineInfeasible, err)
+
+	r = newDeadlineTestRouter(t, 0)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = r.GetClientContext(ctx, "a")
+	assert.Equal(t, ErrDeadlineInfeasible, err, "expected to fail fast without fallback")
+
+	// destinations without calls meet any deadline
+	r.latenciesMu.Lock()
+	delete(r.latencies, "127.0.0.1:3001")
+	r.latenciesMu.Unlock()
+	client, err := r.GetClientContext(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", clientDest(t, client))
+}
+
+func TestDeadlineRoutingRecordsLatencies(t *testing.T) {
+	r, c := newBreakerTestRouter(t, WithDeadlineRouting(2))
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	lc := client.(*latencyClient)
+	lc.TChanClient = &slowTChanClient{clock: c, latency: 200 * time.Millisecond}
+
+	assert.NoError(t, call(lc))
+	assert.NoError(t, call(lc))
+	assert.False(t, r.meetsDeadline("127.0.0.1:3001", c.Now().Add(100*time.Millisecond)))
+	assert.True(t, r.meetsDeadline("127.0.0.1:3001", c.Now().Add(300*time.Millisecond)))
+	assert.True(t, r.meetsDeadline("127.0.0.1:3003", c.Now()), "expected unknown destinations to meet any deadline")
+}
+
+func TestLatencyStats(t *testing.T) {
+	s := &latencyStats{}
+	s.observe(100 * time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, s.p99())
+
+	for i := 0; i < 50; i++ {
+		s.observe(50 * time.Millisecond)
+		s.observe(150 * time.Millisecond)
+	}
+	assert.InDelta(t, float64(100*time.Millisecond), s.mean, float64(10*time.Millisecond))
+	assert.True(t, s.p99() > 200*time.Millisecond, "expected the p99 to account for the deviation, got %v", s.p99())
+}
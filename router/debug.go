@@ -0,0 +1,192 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uber/ringpop-go/swim"
+)
+
+// A RoutingTable is a snapshot of the members the router routes to.
+type RoutingTable struct {
+	// Checksum is the checksum of ringpop's ring.
+	Checksum uint32 `json:"checksum"`
+
+	// Members are the reachable members, and the members the router last
+	// heard were faulty or left, sorted by address.
+	Members []MemberRoute `json:"members"`
+}
+
+// A MemberRoute is the state of the routes of the router to a member.
+type MemberRoute struct {
+	Address string `json:"address"`
+
+	// Status is the status of the last membership change the router applied
+	// for the member, or alive for reachable members it never heard about.
+	Status string `json:"status"`
+
+	Local         bool `json:"local"`
+	CachedClients int  `json:"cachedClients"`
+	CircuitOpen   bool `json:"circuitOpen"`
+	Quarantined   bool `json:"quarantined"`
+}
+
+// RoutingTable returns a snapshot of the members the router routes to. The
+// snapshot is not atomic: the ring may change while it is taken.
+func (r *router) RoutingTable() (RoutingTable, error) {
+	me, err := r.whoAmI()
+	if err != nil {
+		return RoutingTable{}, wrapError(ErrSelfLookupFailed, err)
+	}
+	checksum, err := r.ringpop.Checksum()
+	if err != nil {
+		return RoutingTable{}, wrapError(ErrLookupFailed, err)
+	}
+	reachable, err := r.ringpop.GetReachableMembers()
+	if err != nil {
+		return RoutingTable{}, wrapError(ErrLookupFailed, err)
+	}
+
+	routes := make(map[string]*MemberRoute)
+	for _, member := range reachable {
+		routes[member] = &MemberRoute{Address: member, Status: swim.Alive}
+	}
+
+	r.changesMu.Lock()
+	for member, change := range r.lastChanges {
+		route, ok := routes[member]
+		if !ok {
+			route = &MemberRoute{Address: member}
+			routes[member] = route
+		}
+		route.Status = change.Status
+		route.Quarantined = r.quarantine[member]
+	}
+	r.changesMu.Unlock()
+
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+	byCacheKey := make(map[string]*MemberRoute, len(routes))
+	for member, route := range routes {
+		byCacheKey[r.cacheKey(member)] = route
+	}
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		if route, ok := byCacheKey[cacheKey]; ok {
+			route.CachedClients++
+		}
+	}
+
+	table := RoutingTable{Checksum: checksum}
+	for member, route := range routes {
+		route.Local = member == me
+		route.CircuitOpen = r.circuitOpen(member)
+		table.Members = append(table.Members, *route)
+	}
+	sort.Sort(memberRoutes(table.Members))
+	return table, nil
+}
+
+type memberRoutes []MemberRoute
+
+func (m memberRoutes) Len() int           { return len(m) }
+func (m memberRoutes) Less(i, j int) bool { return m[i].Address < m[j].Address }
+func (m memberRoutes) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// A KeyRoute tells which member owns a key and whether a client to it is
+// cached, see ExplainKey.
+type KeyRoute struct {
+	Key         string `json:"key"`
+	Destination string `json:"destination"`
+	Local       bool   `json:"local"`
+	Cached      bool   `json:"cached"`
+
+	// Hash is the hash of the key, as mapped by the KeyMapper of the router,
+	// on ringpop's hash ring.
+	Hash uint32 `json:"hash"`
+
+	// Replicas are the members responsible for the key, owner first, when
+	// more than one was asked for.
+	Replicas []string `json:"replicas,omitempty"`
+}
+
+// ExplainKey returns the route of key, with its n replicas when n is more
+// than one, to triage reports of misrouted keys. The lookup of the replicas
+// is not recorded in the stats of the router.
+func (r *router) ExplainKey(key string, n int) (KeyRoute, error) {
+	dest, err := r.Resolve(key)
+	if err != nil {
+		return KeyRoute{}, err
+	}
+
+	mapped := r.mapKey(key)
+	route := KeyRoute{
+		Key:         key,
+		Destination: dest.Address,
+		Local:       dest.Local,
+		Hash:        keyHash(mapped),
+	}
+	_, route.Cached = r.cache.get(r.cacheKey(dest.Address))
+
+	if n > 1 {
+		route.Replicas, err = r.resolveKeyN(mapped, n)
+		if err != nil {
+			return KeyRoute{}, wrapError(ErrLookupFailed, err)
+		}
+	}
+	return route, nil
+}
+
+// DebugHandler returns a http.Handler that renders the routing table of r as
+// JSON. With a key query parameter it renders the route of that key instead,
+// with its replicas when an n query parameter is given, for example GET
+// /debug/router?key=user:42&n=3:
+//
+//     http.Handle("/debug/router", router.DebugHandler(r))
+//
+// The routerctl command in scripts/routerctl queries this handler.
+func DebugHandler(r Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body interface{}
+		var err error
+		if key := req.URL.Query().Get("key"); key != "" {
+			n, _ := strconv.Atoi(req.URL.Query().Get("n"))
+			body, err = r.ExplainKey(key, n)
+		} else {
+			body, err = r.RoutingTable()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+)
+
+func newDebugTestRouter(t *testing.T) *router {
+	rp := newTestRingpop(nil)
+	rp.On("Checksum").Return(uint32(42), nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3001", "127.0.0.1:3000"}, nil)
+	rp.On("LookupN", "remote", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3000"}, nil)
+
+	return newRingpopTestRouter(t, rp, WithRemoteDialer(destDialer))
+}
+
+func TestRoutingTable(t *testing.T) {
+	r := newDebugTestRouter(t)
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Faulty})
+
+	table, err := r.RoutingTable()
+	assert.NoError(t, err)
+	assert.Equal(t, RoutingTable{
+		Checksum: 42,
+		Members: []MemberRoute{
+			{Address: "127.0.0.1:3000", Status: swim.Alive, Local: true},
+			{Address: "127.0.0.1:3001", Status: swim.Alive, CachedClients: 1},
+			{Address: "127.0.0.1:3002", Status: swim.Faulty},
+		},
+	}, table)
+}
+
+func TestDebugHandler(t *testing.T) {
+	r := newDebugTestRouter(t)
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	h := DebugHandler(r)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/router", nil)
+	h.ServeHTTP(w, req)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var table RoutingTable
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &table))
+	assert.Equal(t, uint32(42), table.Checksum)
+	assert.Len(t, table.Members, 2)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/debug/router?key=remote", nil)
+	h.ServeHTTP(w, req)
+
+	var route KeyRoute
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &route))
+	assert.Equal(t, KeyRoute{Key: "remote", Destination: "127.0.0.1:3001", Cached: true, Hash: keyHash("remote")}, route)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/debug/router?key=local", nil)
+	h.ServeHTTP(w, req)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &route))
+	assert.Equal(t, KeyRoute{Key: "local", Destination: "127.0.0.1:3000", Local: true, Hash: keyHash("local")}, route)
+}
+
+func TestExplainKey(t *testing.T) {
+	r := newDebugTestRouter(t)
+
+	route, err := r.ExplainKey("remote", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, KeyRoute{
+		Key:         "remote",
+		Destination: "127.0.0.1:3001",
+		Hash:        keyHash("remote"),
+		Replicas:    []string{"127.0.0.1:3001", "127.0.0.1:3000"},
+	}, route)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/router?key=remote&n=2", nil)
+	DebugHandler(r).ServeHTTP(w, req)
+	route = KeyRoute{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &route))
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3000"}, route.Replicas)
+}
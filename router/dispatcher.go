@@ -0,0 +1,147 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+)
+
+// A Dispatcher runs a function against the client for the owner of a key.
+//
+// Contrary to GetClient the router knows when the call made by fn starts and
+// ends, which allows it to limit the number of concurrent calls per
+// destination (see WithMaxInflightPerDest and WithAdaptiveConcurrency). The
+// limit only applies to calls made through Dispatch; clients obtained through
+// GetClient are not counted. There is no global in-flight limit in the
+// router, nor does the limit interact with the in-flight accounting of
+// ringpop's request forwarding, which only tracks requests forwarded by
+// ringpop itself.
+type Dispatcher interface {
+	Dispatch(key string, fn func(client interface{}) error) error
+}
+
+// Dispatch gets the client for the owner of key and invokes fn with it while
+// holding one of the in-flight slots of that destination. When a retry policy
+// is configured with WithRetry and fn fails with a retryable error, the client
+// of the destination is evicted, key is resolved again and fn is invoked with
+// the client of the new owner, as long as the retry budget configured with
+// WithRetryBudget allows.
+func (r *router) Dispatch(key string, fn func(client interface{}) error) error {
+	return r.DispatchContext(context.Background(), key, fn)
+}
+
+// DispatchContext is like Dispatch but gives up with the error of ctx when
+// ctx is done while the client of the owner is created, see
+// GetClientContext, while waiting for an in-flight slot, see
+// WithBlockWhenBusy, or while waiting for a retry.
+func (r *router) DispatchContext(ctx context.Context, key string, fn func(client interface{}) error) error {
+	if r.retry == nil {
+		_, err := r.dispatch(ctx, key, fn)
+		return err
+	}
+
+	r.recordRequest()
+	for retry := 1; ; retry++ {
+		dest, err := r.dispatch(ctx, key, fn)
+		if err == nil || dest == "" || retry > r.retry.MaxRetries || !r.retry.retryable(err) || !r.allowRetry() {
+			return err
+		}
+
+		r.removeClient(dest)
+		r.statter.IncCounter("router.retry", nil, 1)
+		if err := r.waitRetry(ctx, r.retry, retry); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch invokes fn once with the client for the owner of key and returns
+// the destination the key resolved to, or an empty destination when no call
+// was made.
+func (r *router) dispatch(ctx context.Context, key string, fn func(client interface{}) error) (string, error) {
+	end, err := r.beginDispatch()
+	if err != nil {
+		return "", err
+	}
+	defer end()
+
+	client, dest, _, err := r.resolveClient(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	release, err := r.acquireInflight(ctx, dest)
+	if err != nil {
+		return "", err
+	}
+	// the slot is given back, as a failed call, when fn panics
+	callErr := errCallPanicked
+	defer func() { release(callErr) }()
+
+	r.recordDispatch(dest)
+	callErr = fn(client)
+	return dest, callErr
+}
+
+// errCallPanicked is the outcome of the calls made through Dispatch and
+// RunOnOwner that panicked, for the in-flight limits.
+var errCallPanicked = errors.New("router: call panicked")
+
+// acquireInflight takes an in-flight slot for dest and returns the function
+// that gives the slot back with the error of the call. When it waits for a
+// slot, see WithBlockWhenBusy, it gives up with the error of ctx when ctx is
+// done first.
+func (r *router) acquireInflight(ctx context.Context, dest string) (func(error), error) {
+	if r.adaptive != nil {
+		return r.acquireAdaptive(ctx, dest)
+	}
+	if r.maxInflightPerDest <= 0 {
+		return func(error) {}, nil
+	}
+
+	r.inflightMu.Lock()
+	sem, ok := r.inflight[dest]
+	if !ok {
+		sem = make(chan struct{}, r.maxInflightPerDest)
+		r.inflight[dest] = sem
+	}
+	r.inflightMu.Unlock()
+
+	release := func(error) { <-sem }
+
+	if r.blockWhenBusy {
+		select {
+		case sem <- struct{}{}:
+			return release, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return release, nil
+	default:
+		return nil, ErrDestinationBusy
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestDispatchInvokesFnWithClient(t *testing.T) {
+	r := newTestRouter(t)
+
+	var got interface{}
+	err := r.Dispatch("remote", func(client interface{}) error {
+		got = client
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "remote client", got)
+}
+
+func TestDispatchReturnsFnError(t *testing.T) {
+	r := newTestRouter(t)
+
+	err := r.Dispatch("local", func(client interface{}) error {
+		return errors.New("call failed")
+	})
+	assert.EqualError(t, err, "call failed")
+}
+
+func TestDispatchForwardsLookupError(t *testing.T) {
+	r := newTestRouter(t)
+
+	called := false
+	err := r.Dispatch("error", func(client interface{}) error {
+		called = true
+		return nil
+	})
+	assert.EqualError(t, err, "ringpop not ready")
+	assert.False(t, called, "expected fn not to be called on lookup error")
+}
+
+func TestDispatchDestinationBusy(t *testing.T) {
+	r := newTestRouter(t, WithMaxInflightPerDest(1))
+
+	err := r.Dispatch("remote", func(client interface{}) error {
+		return r.Dispatch("remote", func(client interface{}) error {
+			return nil
+		})
+	})
+	assert.Equal(t, ErrDestinationBusy, err)
+
+	// other destinations have their own limit
+	err = r.Dispatch("remote", func(client interface{}) error {
+		return r.Dispatch("local", func(client interface{}) error {
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+
+	// the slot is released after the call
+	err = r.Dispatch("remote", func(client interface{}) error {
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestDispatchBlocksWhenBusy(t *testing.T) {
+	r := newTestRouter(t, WithMaxInflightPerDest(1), WithBlockWhenBusy())
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	go r.Dispatch("remote", func(client interface{}) error {
+		close(started)
+		<-unblock
+		return nil
+	})
+	<-started
+
+	done := make(chan error)
+	go func() {
+		done <- r.Dispatch("remote", func(client interface{}) error {
+			return nil
+		})
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected Dispatch to block while the destination is busy")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(unblock)
+	assert.NoError(t, <-done)
+}
+
+func TestDispatchContextCancelledWhileBusy(t *testing.T) {
+	r := newTestRouter(t, WithMaxInflightPerDest(1), WithBlockWhenBusy())
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	defer close(unblock)
+	go r.Dispatch("remote", func(client interface{}) error {
+		close(started)
+		<-unblock
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := r.DispatchContext(ctx, "remote", func(client interface{}) error {
+		t.Error("expected fn not to be called while the destination is busy")
+		return nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDispatchUnlimitedByDefault(t *testing.T) {
+	r := newTestRouter(t)
+
+	err := r.Dispatch("remote", func(client interface{}) error {
+		return r.Dispatch("remote", func(client interface{}) error {
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+)
+
+// Drain marks the local node as no longer routable ahead of a shutdown, so
+// in-flight state can be handed off before the node leaves the ring. From
+// then on GetClient, and the methods built on it, resolve the keys owned by
+// the local node to the next of the nodes responsible for them as returned by
+// LookupN, and return ErrDraining when there is none. Keys owned by other
+// nodes are routed as before. Keys routed away from the local node are counted
+// by the router.drained counter. Calling Drain again has no effect, a drained
+// router stays drained until it is closed.
+func (r *router) Drain() {
+	if atomic.CompareAndSwapInt32(&r.state.draining, 0, 1) {
+		r.logger.Info("router draining")
+	}
+}
+
+// draining returns whether the router has been drained.
+func (r *router) draining() bool {
+	return atomic.LoadInt32(&r.state.draining) == 1
+}
+
+// drainedClient returns the client of the node key is routed to instead of
+// dest when dest is the local node of a draining router. It returns no
+// destination when dest is a remote node.
+func (r *router) drainedClient(ctx context.Context, key, dest string) (interface{}, string, error) {
+	self, err := r.isSelf(dest)
+	if err != nil {
+		return nil, "", err
+	}
+	if !self {
+		return nil, "", nil
+	}
+
+	r.statter.IncCounter("router.drained", nil, 1)
+	local := func(replica string) bool {
+		return replica == dest
+	}
+	return r.replicaClient(ctx, key, 2, local, ErrDraining)
+}
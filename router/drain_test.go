@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDrainTestRouter creates a router on 127.0.0.1:3000 that owns "local",
+// which is replicated to 127.0.0.1:3001, and "alone", which is not
+// replicated. "remote" is owned by 127.0.0.1:3002. Remote clients are the
+// address of their destination.
+func newDrainTestRouter(t *testing.T) *router {
+	rp := newTestRingpop(testLookups{
+		"alone":  "127.0.0.1:3000",
+		"remote": "127.0.0.1:3002",
+	})
+	rp.On("LookupN", "local", 2).Return([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, nil)
+	rp.On("LookupN", "alone", 2).Return([]string{"127.0.0.1:3000"}, nil)
+
+	return newRingpopTestRouter(t, rp, WithRemoteDialer(destDialer))
+}
+
+func TestDrain(t *testing.T) {
+	r := newDrainTestRouter(t)
+
+	client, err := r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	r.Drain()
+	r.Drain()
+	assert.True(t, r.draining())
+
+	client, err = r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected the key to be routed to its next node")
+
+	client, err = r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client, "expected remote keys to be routed to their owner")
+
+	_, err = r.GetClient("alone")
+	assert.Equal(t, ErrDraining, err)
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// A ClientState is the state of the cached client of a destination, or of a
+// destination whose client failed to be created.
+type ClientState struct {
+	Destination string `json:"destination"`
+	Local       bool   `json:"local"`
+	Cached      bool   `json:"cached"`
+
+	// Age is the time since the client was created and Idle the time since
+	// it was last returned from the cache.
+	Age  time.Duration `json:"age"`
+	Idle time.Duration `json:"idle"`
+
+	// Hits is the number of times the client was returned from the cache.
+	Hits int64 `json:"hits"`
+
+	// LastError is the error of the last failed attempt to create the client
+	// of the destination, if any.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// recordClientError records the error of a failed attempt to create the
+// client of dest, for ClientStates.
+func (r *router) recordClientError(dest string, err error) {
+	r.clientErrsMu.Lock()
+	r.clientErrs[dest] = err
+	r.clientErrsMu.Unlock()
+}
+
+// ClientStates returns the state of the clients of the router, sorted by
+// destination. Destinations whose client failed to be created are included
+// even when no client is cached for them.
+func (r *router) ClientStates() []ClientState {
+	now := r.clock.Now()
+	states := make(map[string]*ClientState)
+
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		entry, ok := r.cache.get(cacheKey)
+		if !ok {
+			continue
+		}
+		dest := strings.TrimPrefix(cacheKey, prefix)
+		states[dest] = &ClientState{
+			Destination: dest,
+			Local:       entry.local,
+			Cached:      true,
+			Age:         now.Sub(entry.created),
+			Idle:        now.Sub(time.Unix(0, entry.lastUsedAt())),
+			Hits:        atomic.LoadInt64(&entry.hits),
+		}
+	}
+
+	r.clientErrsMu.Lock()
+	for dest, err := range r.clientErrs {
+		state, ok := states[dest]
+		if !ok {
+			state = &ClientState{Destination: dest}
+			states[dest] = state
+		}
+		state.LastError = err.Error()
+	}
+	r.clientErrsMu.Unlock()
+
+	result := make([]ClientState, 0, len(states))
+	for _, state := range states {
+		result = append(result, *state)
+	}
+	sort.Sort(clientStates(result))
+	return result
+}
+
+type clientStates []ClientState
+
+func (s clientStates) Len() int           { return len(s) }
+func (s clientStates) Less(i, j int) bool { return s[i].Destination < s[j].Destination }
+func (s clientStates) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// DumpState writes the state of the clients of the router to w as a table,
+// one destination per line, eg. to log it during an incident.
+func (r *router) DumpState(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "DESTINATION\tLOCAL\tCACHED\tAGE\tIDLE\tHITS\tLAST ERROR")
+	for _, s := range r.ClientStates() {
+		age, idle := "-", "-"
+		if s.Cached {
+			age, idle = s.Age.String(), s.Idle.String()
+		}
+		fmt.Fprintf(tw, "%s\t%t\t%t\t%s\t%s\t%d\t%s\n", s.Destination, s.Local, s.Cached, age, idle, s.Hits, s.LastError)
+	}
+	return tw.Flush()
+}
+
+// ClientStateHandler returns a http.Handler that renders the state of the
+// clients of r as JSON, or as the table of DumpState with a format=text query
+// parameter.
+func ClientStateHandler(r Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("format") == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			r.DumpState(w)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.ClientStates())
+	})
+}
+
+// RegisterDebugHandlers registers the DebugHandler of r on mux under
+// /debug/router and its ClientStateHandler under /debug/router/clients:
+//
+//     router.RegisterDebugHandlers(http.DefaultServeMux, r)
+func RegisterDebugHandlers(mux *http.ServeMux, r Router) {
+	mux.Handle("/debug/router", DebugHandler(r))
+	mux.Handle("/debug/router/clients", ClientStateHandler(r))
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDumpTestRouter(t *testing.T) (*router, *clock.Mock) {
+	rp := newTestRingpop(testLookups{
+		"unreachable": "127.0.0.1:3002",
+	})
+
+	dialer := func(dest string) (interface{}, error) {
+		if dest == "127.0.0.1:3002" {
+			return nil, errors.New("connection refused")
+		}
+		return dest, nil
+	}
+	c := clock.NewMock()
+	return newRingpopTestRouter(t, rp, WithRemoteDialer(dialer), WithClock(c)), c
+}
+
+func TestClientStates(t *testing.T) {
+	r, c := newDumpTestRouter(t)
+
+	for _, key := range []string{"remote", "local", "remote", "remote"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+	c.Add(time.Minute)
+	_, err := r.GetClient("local")
+	assert.NoError(t, err)
+	c.Add(time.Second)
+	_, err = r.GetClient("unreachable")
+	assert.Error(t, err)
+
+	assert.Equal(t, []ClientState{
+		{Destination: "127.0.0.1:3000", Local: true, Cached: true, Age: 61 * time.Second, Idle: time.Second, Hits: 1},
+		{Destination: "127.0.0.1:3001", Cached: true, Age: 61 * time.Second, Idle: 61 * time.Second, Hits: 2},
+		{Destination: "127.0.0.1:3002", LastError: "connection refused"},
+	}, r.ClientStates())
+}
+
+func TestDumpState(t *testing.T) {
+	r, _ := newDumpTestRouter(t)
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	_, err = r.GetClient("unreachable")
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.DumpState(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, []string{"DESTINATION", "LOCAL", "CACHED", "AGE", "IDLE", "HITS", "LAST", "ERROR"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"127.0.0.1:3001", "false", "true", "0s", "0s", "0"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"127.0.0.1:3002", "false", "false", "-", "-", "0", "connection", "refused"}, strings.Fields(lines[2]))
+	}
+}
+
+func TestRegisterDebugHandlers(t *testing.T) {
+	r, _ := newDumpTestRouter(t)
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	RegisterDebugHandlers(mux, r)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/router/clients", nil)
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var states []ClientState
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &states))
+	assert.Equal(t, r.ClientStates(), states)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/debug/router/clients?format=text", nil)
+	mux.ServeHTTP(w, req)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "DESTINATION"), "expected the table of DumpState")
+
+	_, pattern := mux.Handler(&http.Request{Method: "GET", URL: req.URL, Host: "localhost"})
+	assert.Equal(t, "/debug/router/clients", pattern)
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// defaultErrorWindow is the window over which error rates are accounted when
+// WithErrorBudget is used without WithErrorTracking.
+const defaultErrorWindow = 10 * time.Second
+
+// An ErrorClass tells why a routed call failed, see ClassifyError.
+type ErrorClass int
+
+const (
+	// ClassNone is the class of calls that succeeded.
+	ClassNone ErrorClass = iota
+
+	// ClassTimeout is the class of calls that timed out.
+	ClassTimeout
+
+	// ClassConnection is the class of calls that could not reach their
+	// destination, see IsConnectionError.
+	ClassConnection
+
+	// ClassBadRequest is the class of calls the destination rejected as
+	// malformed.
+	ClassBadRequest
+
+	// ClassApplication is the class of calls that failed with an exception
+	// declared by the Thrift service.
+	ClassApplication
+
+	// ClassServer is the class of the other calls that failed.
+	ClassServer
+
+	numErrorClasses = int(ClassServer) + 1
+)
+
+var errorClassNames = [numErrorClasses]string{
+	"none", "timeout", "connection", "bad-request", "application", "server",
+}
+
+func (c ErrorClass) String() string {
+	if c < 0 || int(c) >= numErrorClasses {
+		return "unknown"
+	}
+	return errorClassNames[c]
+}
+
+// ClassifyError returns the class of err, returned by a routed call. TChannel
+// Thrift clients report exceptions declared in the IDL with a nil error, which
+// ClassifyError cannot tell from a success; a CodecClient reports them with
+// an *ApplicationError.
+func ClassifyError(err error) ErrorClass {
+	switch err {
+	case nil:
+		return ClassNone
+	case context.DeadlineExceeded:
+		return ClassTimeout
+	}
+	if _, ok := err.(*ApplicationError); ok {
+		return ClassApplication
+	}
+
+	if _, ok := err.(tchannel.SystemError); ok {
+		switch tchannel.GetSystemErrorCode(err) {
+		case tchannel.ErrCodeTimeout:
+			return ClassTimeout
+		case tchannel.ErrCodeBadRequest:
+			return ClassBadRequest
+		}
+	}
+	if netErr, ok := err.(interface {
+		Timeout() bool
+	}); ok && netErr.Timeout() {
+		return ClassTimeout
+	}
+	if IsConnectionError(err) {
+		return ClassConnection
+	}
+	return ClassServer
+}
+
+// errorStats counts the calls to a destination and their errors by class per
+// window, of which the previous one is kept so rates do not drop to nothing
+// at the start of every window.
+type errorStats struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	calls       int
+	errors      [numErrorClasses]int
+	lastCalls   int
+	lastErrors  [numErrorClasses]int
+}
+
+// advance moves the window forward to now. mu must be held.
+func (s *errorStats) advance(now time.Time, window time.Duration) {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < window {
+		return
+	}
+	if elapsed < 2*window {
+		s.lastCalls, s.lastErrors = s.calls, s.errors
+	} else {
+		s.lastCalls, s.lastErrors = 0, [numErrorClasses]int{}
+	}
+	s.windowStart = now
+	s.calls = 0
+	s.errors = [numErrorClasses]int{}
+}
+
+func (s *errorStats) record(now time.Time, window time.Duration, class ErrorClass) {
+	s.mu.Lock()
+	s.advance(now, window)
+	s.calls++
+	s.errors[class]++
+	s.mu.Unlock()
+}
+
+// rate returns the share of the calls of the current and last windows that
+// failed with one of classes, and the number of those calls.
+func (s *errorStats) rate(now time.Time, window time.Duration, classes []ErrorClass) (float64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance(now, window)
+	calls := s.calls + s.lastCalls
+	if calls == 0 {
+		return 0, 0
+	}
+	failed := 0
+	for _, class := range classes {
+		if class > ClassNone && int(class) < numErrorClasses {
+			failed += s.errors[class] + s.lastErrors[class]
+		}
+	}
+	return float64(failed) / float64(calls), calls
+}
+
+// allErrorClasses are the classes counted by ErrorRate when none are given.
+var allErrorClasses = []ErrorClass{ClassTimeout, ClassConnection, ClassBadRequest, ClassApplication, ClassServer}
+
+// errorBudget is the rate of errors over which a destination is treated like
+// one whose circuit is open, see WithErrorBudget.
+type errorBudget struct {
+	maxRate  float64
+	minCalls int
+	classes  []ErrorClass
+}
+
+// errorTracking returns whether the errors of calls are classified.
+func (r *router) errorTracking() bool {
+	return r.errorWindow > 0 || r.errorBudget != nil
+}
+
+// errorStatsWindow returns the window error rates are accounted over.
+func (r *router) errorStatsWindow() time.Duration {
+	if r.errorWindow > 0 {
+		return r.errorWindow
+	}
+	return defaultErrorWindow
+}
+
+// errorStatsFor returns the error stats of dest, creating them when create is
+// set, or nil.
+func (r *router) errorStatsFor(dest string, create bool) *errorStats {
+	r.errorStatsMu.Lock()
+	defer r.errorStatsMu.Unlock()
+
+	s, ok := r.errorStats[dest]
+	if !ok && create {
+		s = &errorStats{}
+		r.errorStats[dest] = s
+	}
+	return s
+}
+
+// recordCall counts a call to dest that ended with class. Errors are counted
+// by the router.call.error.<class> counters.
+func (r *router) recordCall(dest string, class ErrorClass) {
+	r.errorStatsFor(dest, true).record(r.clock.Now(), r.errorStatsWindow(), class)
+	if class != ClassNone {
+		r.statter.IncCounter("router.call.error."+class.String(), nil, 1)
+	}
+}
+
+// ErrorRate returns the share of the recent calls to dest that failed with
+// one of classes, or with any error when no class is given. It is 0 when no
+// call to dest was recorded, see WithErrorTracking.
+func (r *router) ErrorRate(dest string, classes ...ErrorClass) float64 {
+	s := r.errorStatsFor(dest, false)
+	if s == nil {
+		return 0
+	}
+	if len(classes) == 0 {
+		classes = allErrorClasses
+	}
+	rate, _ := s.rate(r.clock.Now(), r.errorStatsWindow(), classes)
+	return rate
+}
+
+// overErrorBudget returns whether the recent calls to dest failed more than
+// the error budget of the router allows.
+func (r *router) overErrorBudget(dest string) bool {
+	if r.errorBudget == nil {
+		return false
+	}
+	s := r.errorStatsFor(dest, false)
+	if s == nil {
+		return false
+	}
+	rate, calls := s.rate(r.clock.Now(), r.errorStatsWindow(), r.errorBudget.classes)
+	return calls >= r.errorBudget.minCalls && rate > r.errorBudget.maxRate
+}
+
+// classifyingClient is the TChanClient handed to the ClientFactory for remote
+// destinations when error tracking is enabled. It records the class of the
+// outcome of every call to its destination.
+type classifyingClient struct {
+	thrift.TChanClient
+
+	r    *router
+	dest string
+}
+
+func (c *classifyingClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	success, err := c.TChanClient.Call(ctx, serviceName, methodName, req, resp)
+	class := ClassifyError(err)
+	if err == nil && !success {
+		class = ClassApplication
+	}
+	c.r.recordCall(c.dest, class)
+	return success, err
+}
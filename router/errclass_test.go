@@ -0,0 +1,144 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{nil, ClassNone},
+		{context.DeadlineExceeded, ClassTimeout},
+		{tchannel.ErrTimeout, ClassTimeout},
+		{timeoutError{}, ClassTimeout},
+		{tchannel.ErrConnectionClosed, ClassConnection},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ClassConnection},
+		{tchannel.NewSystemError(tchannel.ErrCodeDeclined, "declined"), ClassConnection},
+		{tchannel.NewSystemError(tchannel.ErrCodeBadRequest, "no handler"), ClassBadRequest},
+		{tchannel.NewSystemError(tchannel.ErrCodeUnexpected, "panic"), ClassServer},
+		{&ApplicationError{Method: "get", Message: "not found"}, ClassApplication},
+		{errors.New("boom"), ClassServer},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.class, ClassifyError(c.err), "unexpected class of %v", c.err)
+	}
+	assert.Equal(t, "bad-request", ClassBadRequest.String())
+	assert.Equal(t, "unknown", ErrorClass(42).String())
+}
+
+// newErrorTestRouter returns a router whose client for "thrift" makes its
+// calls through stub.
+func newErrorTestRouter(t *testing.T, stub *stubTChanClient, opts ...Option) (*router, *clock.Mock, thrift.TChanClient) {
+	transport := &memoryTransport{conns: map[string]ClientConn{"127.0.0.1:3001": stub}}
+	c := clock.NewMock()
+	r := newTransportTestRouter(t, nil, append([]Option{WithTransport(transport), WithClock(c)}, opts...)...)
+
+	client, err := r.GetClient("thrift")
+	assert.NoError(t, err)
+	tc, ok := client.(thrift.TChanClient)
+	assert.True(t, ok, "expected a TChannel client")
+	return r, c, tc
+}
+
+func TestErrorTracking(t *testing.T) {
+	stub := &stubTChanClient{}
+	r, c, client := newErrorTestRouter(t, stub, WithErrorTracking(time.Minute))
+	dest := "127.0.0.1:3001"
+	assert.Equal(t, 0.0, r.ErrorRate(dest), "expected no rate before any call")
+
+	call(client)
+	call(client)
+	stub.appErr = true
+	call(client)
+	stub.appErr = false
+	stub.err = tchannel.ErrConnectionClosed
+	assert.Equal(t, tchannel.ErrConnectionClosed, call(client))
+
+	assert.Equal(t, 0.5, r.ErrorRate(dest))
+	assert.Equal(t, 0.25, r.ErrorRate(dest, ClassConnection))
+	assert.Equal(t, 0.25, routerRingView{r}.ErrorRate(dest, ClassApplication))
+	assert.Equal(t, 0.0, r.ErrorRate(dest, ClassTimeout))
+
+	// the last window is kept, older ones are forgotten
+	c.Add(time.Minute)
+	assert.Equal(t, 0.5, r.ErrorRate(dest))
+	c.Add(2 * time.Minute)
+	assert.Equal(t, 0.0, r.ErrorRate(dest))
+}
+
+func TestErrorBudget(t *testing.T) {
+	stub := &stubTChanClient{}
+	r, c, client := newErrorTestRouter(t, stub, WithErrorBudget(0.5, 3))
+	dest := "127.0.0.1:3001"
+
+	// bad requests do not count against the budget
+	stub.err = tchannel.NewSystemError(tchannel.ErrCodeBadRequest, "no handler")
+	call(client)
+	call(client)
+	call(client)
+	assert.False(t, r.circuitOpen(dest))
+
+	stub.err = tchannel.ErrTimeout
+	call(client)
+	call(client)
+	assert.False(t, r.circuitOpen(dest))
+	call(client)
+	call(client)
+	assert.True(t, r.circuitOpen(dest), "expected the destination to be over budget")
+	assert.False(t, routerRingView{r}.Healthy(dest))
+
+	_, err := r.GetClient("thrift")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	c.Add(2 * defaultErrorWindow)
+	_, err = r.GetClient("thrift")
+	assert.NoError(t, err, "expected the budget to recover once the errors are forgotten")
+}
+
+func TestCircuitBreakerIgnoresBadRequests(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithCircuitBreaker(2, time.Minute))
+	stub := &stubTChanClient{err: tchannel.NewSystemError(tchannel.ErrCodeBadRequest, "no handler")}
+	client := stubClient(t, r, "a", stub)
+
+	for i := 0; i < 3; i++ {
+		assert.Error(t, call(client))
+	}
+	assert.False(t, r.circuitOpen("127.0.0.1:3001"), "expected bad requests not to open the circuit")
+}
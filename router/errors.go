@@ -0,0 +1,169 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "errors"
+
+var (
+	// ErrLookupFailed is the kind of the errors returned when ringpop fails to
+	// resolve a key, typically because the ring is not ready or is changing.
+	// These failures are transient and the request can be retried.
+	ErrLookupFailed = errors.New("lookup failed")
+
+	// ErrSelfLookupFailed is the kind of the errors returned when ringpop
+	// fails to return the address of the local node.
+	ErrSelfLookupFailed = errors.New("self lookup failed")
+
+	// ErrNotOwner is the kind of the errors returned by handlers built on the
+	// router when they are asked to serve a key that is owned by another node.
+	ErrNotOwner = errors.New("not the owner of the key")
+
+	// ErrClientCreation is the kind of the errors returned when the client
+	// for a destination cannot be created, for example because a RemoteDialer
+	// failed. These usually point to a misconfiguration.
+	ErrClientCreation = errors.New("client creation failed")
+
+	// ErrCreationThrottled is returned when the client for a destination is
+	// not created because too many clients are being created at the same
+	// time, see WithCreationLimit. Nothing is cached and the client is created
+	// on a later call.
+	ErrCreationThrottled = errors.New("client creation throttled")
+
+	// ErrDestinationBusy is returned by Dispatch when the destination a key
+	// resolves to already has the maximum number of calls in flight.
+	ErrDestinationBusy = errors.New("destination has too many calls in flight")
+
+	// ErrDeadlineInfeasible is returned by GetClientContext when no node
+	// responsible for a key is expected to answer before the deadline of the
+	// context, see WithDeadlineRouting.
+	ErrDeadlineInfeasible = errors.New("deadline cannot be met by any destination")
+
+	// ErrQuorumFailed is the kind of the errors returned by QuorumCall when
+	// fewer than the quorum of calls succeeded. The underlying error is a
+	// *QuorumError.
+	ErrQuorumFailed = errors.New("quorum not reached")
+
+	// ErrTransactionAborted is the kind of the errors returned by
+	// Transaction.Run when the prepare phase failed on some participants and
+	// the transaction was aborted. The underlying error is a
+	// *TransactionError.
+	ErrTransactionAborted = errors.New("transaction aborted")
+
+	// ErrCommitFailed is the kind of the errors returned by Transaction.Run
+	// when the commit phase failed on some participants. The underlying error
+	// is a *TransactionError.
+	ErrCommitFailed = errors.New("transaction commit failed")
+
+	// ErrStickyDestinationGone is returned by a StickyClient when the node it
+	// is pinned to has been declared faulty or has left the ring.
+	ErrStickyDestinationGone = errors.New("pinned destination is no longer available")
+
+	// ErrCircuitOpen is returned when the destination a key resolves to has
+	// failed too many calls in a row, see WithCircuitBreaker.
+	ErrCircuitOpen = errors.New("circuit to destination is open")
+
+	// ErrDestinationQuarantined is returned when the destination a key
+	// resolves to has been quarantined by the StatusPredicate of the router,
+	// see WithStatusPredicate.
+	ErrDestinationQuarantined = errors.New("destination is quarantined")
+
+	// ErrNoDestination is returned by GetClientExcluding when all nodes
+	// responsible for a key are excluded.
+	ErrNoDestination = errors.New("no destination left for key")
+
+	// ErrForwardingLoop is returned by a forwarding server for a call that
+	// would be forwarded back to the node it originated on, or further than
+	// the maximum number of hops, see WithMaxHops.
+	ErrForwardingLoop = errors.New("call is forwarded in a loop")
+
+	// ErrChecksumMismatch is returned by a ChecksumValidator for a call that
+	// was routed with a ring that disagrees with the ring of the local node
+	// for too long.
+	ErrChecksumMismatch = errors.New("ring checksum of call does not match")
+
+	// ErrDraining is returned for keys owned by the local node of a router
+	// that is draining when no other node is responsible for them, see Drain.
+	ErrDraining = errors.New("router is draining")
+
+	// ErrNotReady is returned for keys routed while the channel of the router
+	// is not advertised to Hyperbahn, see WithAdvertisement.
+	ErrNotReady = errors.New("router is not ready")
+
+	// ErrQuotaExceeded is returned for keys of a tenant that is over its
+	// quota, see WithTenantQuotas.
+	ErrQuotaExceeded = errors.New("tenant quota exceeded")
+
+	// ErrInvalidDestination is the underlying error of the ErrLookupFailed
+	// errors returned when ringpop resolves a key to an empty address, or to
+	// one that is not a member of the ring, as happens while it bootstraps,
+	// see WithDestinationValidation.
+	ErrInvalidDestination = errors.New("lookup returned an invalid destination")
+
+	// ErrRouterClosed is returned for calls for clients made after the router
+	// has been closed.
+	ErrRouterClosed = errors.New("router is closed")
+)
+
+// Error is an error of the router that wraps the underlying error Err. Kind
+// is one of the sentinel errors of this package and tells what failed.
+//
+// The text of an Error is the text of Err, so the errors of ringpop and of
+// the client factory read as they did before the router wrapped them; the
+// kind is only exposed through KindOf. Error implements Is and Unwrap as
+// well, so errors.Is(err, ErrLookupFailed) reports errors of kind
+// ErrLookupFailed and errors.Is(err, cause) reports errors wrapping cause
+// where errors.Is is available.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// wrapError returns err wrapped in an Error of the given kind, or nil when err
+// is nil.
+func wrapError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Is reports whether target is the kind of the error.
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of err when it is an Error, and err itself
+// otherwise.
+func KindOf(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestLookupErrorKind(t *testing.T) {
+	r := newTestRouter(t)
+
+	_, err := r.GetClient("error")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+	assert.EqualError(t, err.(*Error).Unwrap(), "ringpop not ready")
+	assert.True(t, err.(*Error).Is(ErrLookupFailed))
+	assert.False(t, err.(*Error).Is(ErrSelfLookupFailed))
+}
+
+func TestSelfLookupErrorKind(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("Lookup", "key").Return("127.0.0.1:3000", nil)
+	rp.On("WhoAmI").Return("", errors.New("not bootstrapped"))
+
+	_, err := New(rp, nil, nil).GetClient("key")
+	assert.Equal(t, ErrSelfLookupFailed, KindOf(err))
+}
+
+func TestClientCreationErrorKind(t *testing.T) {
+	dialer := func(dest string) (interface{}, error) {
+		return nil, errors.New("connection refused")
+	}
+	r := newTestRouter(t, WithRemoteDialer(dialer))
+
+	_, err := r.GetClient("remote")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+}
+
+func TestKindOfOtherErrors(t *testing.T) {
+	assert.Nil(t, KindOf(nil))
+	assert.Equal(t, ErrCircuitOpen, KindOf(ErrCircuitOpen))
+	assert.Nil(t, wrapError(ErrLookupFailed, nil))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "github.com/uber/ringpop-go/events"
+
+// A ClientCreatedEvent is sent when the client of a destination is created and
+// cached.
+type ClientCreatedEvent struct {
+	Destination string
+}
+
+// A ClientEvictedEvent is sent when the client of a destination is evicted
+// from the cache, see OnEvict.
+type ClientEvictedEvent struct {
+	Destination string
+}
+
+// A LabelsChangedEvent is sent when the labels of a destination changed since
+// its client was created, and the client is evicted, see RefreshLabels.
+type LabelsChangedEvent struct {
+	Destination string
+	Labels      map[string]string
+}
+
+// A LookupFailedEvent is sent when a key cannot be resolved.
+type LookupFailedEvent struct {
+	Key   string
+	Error error
+}
+
+// An OwnerChangedEvent is sent with the ranges of the ring that moved to
+// another node when ringpop's ring changes, see OnOwnershipChange.
+type OwnerChangedEvent struct {
+	Moved []KeyRange
+}
+
+// RegisterListener adds a listener to the router, which is sent the events of
+// the router like ringpop sends its events: each on a goroutine of its own, so
+// HandleEvent should be thread safe and events may be handled out of order.
+// Registering a listener starts the tracking of ownership changes, with the
+// ring at the time of the first registration as the baseline, see
+// OnOwnershipChange.
+func (r *router) RegisterListener(l events.EventListener) {
+	r.ownershipMu.Lock()
+	r.trackRing()
+	r.ownershipMu.Unlock()
+
+	r.listenersMu.Lock()
+	r.listeners = append(r.listeners, l)
+	r.listenersMu.Unlock()
+}
+
+// emit sends event to the listeners of the router.
+func (r *router) emit(event events.Event) {
+	r.listenersMu.RLock()
+	for _, listener := range r.listeners {
+		go listener.HandleEvent(event)
+	}
+	r.listenersMu.RUnlock()
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/events"
+)
+
+// chanListener sends the events it is sent on a channel.
+type chanListener chan events.Event
+
+func (l chanListener) HandleEvent(event events.Event) {
+	l <- event
+}
+
+// nextEvent returns the next event of l, failing the test when none is sent
+// in time.
+func nextEvent(t *testing.T, l chanListener) events.Event {
+	select {
+	case event := <-l:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("expected an event")
+		return nil
+	}
+}
+
+func TestRouterEvents(t *testing.T) {
+	rp := newTestRingpop(testLookups{
+		"key": "127.0.0.1:3001",
+	})
+	rp.On("Lookup", "missing").Return("", errors.New("ring not ready"))
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3001"}, nil).Once()
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+
+	r := newRingpopTestRouter(t, rp, WithRemoteDialer(destDialer))
+	l := make(chanListener, 1)
+	r.RegisterListener(l)
+
+	_, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, ClientCreatedEvent{Destination: "127.0.0.1:3001"}, nextEvent(t, l))
+
+	_, err = r.GetClient("key")
+	assert.NoError(t, err)
+	r.removeClient("127.0.0.1:3001")
+	assert.Equal(t, ClientEvictedEvent{Destination: "127.0.0.1:3001"}, nextEvent(t, l), "expected cached clients to be created once")
+
+	_, err = r.GetClient("missing")
+	assert.Error(t, err)
+	assert.Equal(t, LookupFailedEvent{Key: "missing", Error: errors.New("ring not ready")}, nextEvent(t, l))
+
+	r.HandleEvent(events.RingChangedEvent{ServersAdded: []string{"127.0.0.1:3002"}})
+	event, ok := nextEvent(t, l).(OwnerChangedEvent)
+	if assert.True(t, ok, "expected an OwnerChangedEvent") {
+		assert.NotEmpty(t, event.Moved)
+		for _, kr := range event.Moved {
+			assert.Equal(t, "127.0.0.1:3002", kr.To)
+		}
+	}
+}
+
+func TestRouterEventsWithoutListeners(t *testing.T) {
+	r := newPolicyTestRouter(t, nil)
+
+	_, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Empty(t, r.listeners)
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// callTracker counts the calls in flight through the clients of a cache
+// entry, see WithEvictionDrain.
+type callTracker struct {
+	sync.Mutex
+	calls int
+
+	// waiting is closed when the last call in flight finishes while
+	// someone waits for the calls, see idle.
+	waiting chan struct{}
+}
+
+func (t *callTracker) begin() {
+	t.Lock()
+	t.calls++
+	t.Unlock()
+}
+
+func (t *callTracker) end() {
+	t.Lock()
+	t.calls--
+	if t.calls == 0 && t.waiting != nil {
+		close(t.waiting)
+		t.waiting = nil
+	}
+	t.Unlock()
+}
+
+// idle returns a channel that is closed once no calls are in flight.
+func (t *callTracker) idle() <-chan struct{} {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.calls == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	if t.waiting == nil {
+		t.waiting = make(chan struct{})
+	}
+	return t.waiting
+}
+
+// trackedClient is the TChanClient handed to the ClientFactory for remote
+// destinations when evictions wait for calls in flight, see
+// WithEvictionDrain.
+type trackedClient struct {
+	thrift.TChanClient
+
+	calls *callTracker
+}
+
+func (c *trackedClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	c.calls.begin()
+	defer c.calls.end()
+
+	return c.TChanClient.Call(ctx, serviceName, methodName, req, resp)
+}
+
+// OnEvict registers fn to be called with the destination and the client of
+// every client that is evicted from the cache, whatever the reason of the
+// eviction, eg. a member that became faulty, an idle client or a full cache.
+// Clients closed by Close are not evicted. fn is called before the client is
+// closed, synchronously on the path of the eviction, and may be called
+// concurrently, so it should be cheap and thread safe.
+func (r *router) OnEvict(fn func(dest string, client interface{})) {
+	r.evictMu.Lock()
+	defer r.evictMu.Unlock()
+	r.evictListeners = append(r.evictListeners, fn)
+}
+
+// notifyEvicted calls the eviction listeners, and sends a ClientEvictedEvent,
+// for every evicted entry.
+func (r *router) notifyEvicted(evicted []*cacheEntry) {
+	for _, entry := range evicted {
+		r.emit(ClientEvictedEvent{Destination: entry.dest})
+	}
+
+	r.evictMu.Lock()
+	listeners := r.evictListeners
+	r.evictMu.Unlock()
+
+	for _, fn := range listeners {
+		for _, entry := range evicted {
+			fn(entry.dest, entry.client)
+		}
+	}
+}
+
+// closeWhenIdle closes the client of the evicted entry once its calls in
+// flight finished, or the drain timeout expired. Clients whose calls are not
+// tracked are closed right away.
+func (r *router) closeWhenIdle(entry *cacheEntry) {
+	if entry.calls == nil {
+		closeClient(entry)
+		return
+	}
+
+	idle := entry.calls.idle()
+	select {
+	case <-idle:
+		closeClient(entry)
+		return
+	default:
+	}
+
+	timeout := r.clock.After(r.evictionDrain)
+	go func() {
+		select {
+		case <-idle:
+		case <-timeout:
+			r.statter.IncCounter("router.client.drain.timeout", nil, 1)
+		}
+		closeClient(entry)
+	}()
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// drainingClient is a remote client that makes its calls through the
+// TChanClient of the router and records when it is closed.
+type drainingClient struct {
+	thrift.TChanClient
+	*closingClient
+}
+
+// drainingClientFactory creates drainingClients.
+type drainingClientFactory struct{}
+
+func (drainingClientFactory) GetLocalClient() interface{} {
+	return "local client"
+}
+
+func (drainingClientFactory) MakeRemoteClient(dest Destination, client thrift.TChanClient) (interface{}, error) {
+	return &drainingClient{TChanClient: client, closingClient: &closingClient{}}, nil
+}
+
+// newEvictTestRouter creates a router on which the calls of the client of key
+// "a" block on conn.
+func newEvictTestRouter(t *testing.T, conn *blockingTChanClient, opts ...Option) (*router, *clock.Mock) {
+	rp := newTestRingpop(testLookups{
+		"a": "127.0.0.1:3001",
+	})
+
+	transport := &memoryTransport{conns: map[string]ClientConn{"127.0.0.1:3001": conn}}
+	c := clock.NewMock()
+	opts = append([]Option{withFactoryV2(drainingClientFactory{}), WithClock(c)}, opts...)
+	return newChannelTestRouter(rp, nil, append(opts, WithTransport(transport))...), c
+}
+
+// startCall gets the client of key "a" and starts a call through it that
+// blocks until conn releases it.
+func startCall(t *testing.T, r *router, conn *blockingTChanClient) (*drainingClient, *sync.WaitGroup) {
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	dc := client.(*drainingClient)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := thrift.NewContext(time.Second)
+		defer cancel()
+		dc.Call(ctx, "service", "method", nil, nil)
+	}()
+	<-conn.started
+	return dc, &wg
+}
+
+func waitClosed(t *testing.T, c *drainingClient) {
+	deadline := time.Now().Add(time.Second)
+	for !c.isClosed() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, c.isClosed(), "expected the client to be closed")
+}
+
+func TestOnEvict(t *testing.T) {
+	conn := newBlockingTChanClient()
+	close(conn.release)
+	r, _ := newEvictTestRouter(t, conn)
+
+	var evicted []string
+	r.OnEvict(func(dest string, client interface{}) {
+		assert.False(t, client.(*drainingClient).isClosed(), "expected the callback before the client is closed")
+		evicted = append(evicted, dest)
+	})
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	r.removeClient("127.0.0.1:3001")
+
+	assert.Equal(t, []string{"127.0.0.1:3001"}, evicted)
+	assert.True(t, client.(*drainingClient).isClosed(), "expected the client to be closed right away by default")
+}
+
+func TestEvictionDrainWaitsForCalls(t *testing.T) {
+	conn := newBlockingTChanClient()
+	r, _ := newEvictTestRouter(t, conn, WithEvictionDrain(time.Minute))
+
+	client, calls := startCall(t, r, conn)
+	r.removeClient("127.0.0.1:3001")
+	assert.False(t, client.isClosed(), "expected the client to stay open while a call is in flight")
+
+	close(conn.release)
+	calls.Wait()
+	waitClosed(t, client)
+}
+
+func TestEvictionDrainTimeout(t *testing.T) {
+	conn := newBlockingTChanClient()
+	r, c := newEvictTestRouter(t, conn, WithEvictionDrain(time.Minute))
+
+	client, calls := startCall(t, r, conn)
+	r.removeClient("127.0.0.1:3001")
+
+	c.Add(time.Minute)
+	waitClosed(t, client)
+
+	close(conn.release)
+	calls.Wait()
+}
+
+func TestCallTracker(t *testing.T) {
+	var calls callTracker
+	select {
+	case <-calls.idle():
+	default:
+		t.Fatal("expected no calls to be idle")
+	}
+
+	calls.begin()
+	calls.begin()
+	idle := calls.idle()
+	calls.end()
+	select {
+	case <-idle:
+		t.Fatal("expected a call in flight")
+	default:
+	}
+	calls.end()
+	<-idle
+}
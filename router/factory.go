@@ -0,0 +1,147 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/ringpop-go"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// A ClientFactoryV2 is a ClientFactory of which the remote clients are created
+// for a known destination and may fail to be created, eg. because the factory
+// dials auxiliary connections or consults configuration for the destination.
+type ClientFactoryV2 interface {
+	GetLocalClient() interface{}
+
+	// MakeRemoteClient creates the client that calls the node at dest through
+	// client. Errors are returned by GetClient as an Error of kind
+	// ErrClientCreation, and the client is created again on the next call.
+	// The Checksum of dest is not set, clients outlive the ring they are
+	// created for. Its Labels are set when the router has a LabelsFunc, see
+	// WithLabels.
+	MakeRemoteClient(dest Destination, client thrift.TChanClient) (interface{}, error)
+}
+
+// A ContextClientFactory is a ClientFactoryV2 of which the remote clients are
+// created with the context of the router, see WithFactoryContext, so the
+// factory can read configuration, TLS material or per-environment settings
+// from the values of the context rather than from package-level globals.
+// Routers call MakeRemoteClientContext instead of MakeRemoteClient on such
+// factories.
+type ContextClientFactory interface {
+	ClientFactoryV2
+
+	// MakeRemoteClientContext creates the client that calls the node at dest
+	// through client, like MakeRemoteClient. The context is never done.
+	MakeRemoteClientContext(ctx context.Context, dest Destination, client thrift.TChanClient) (interface{}, error)
+}
+
+// NewV2 creates a Router of which the clients are created by f. See New for a
+// description of the other arguments.
+func NewV2(rp ringpop.Interface, f ClientFactoryV2, ch *tchannel.Channel, opts ...Option) Router {
+	r := newRouter(rp, f, ch, opts...)
+	rp.RegisterListener(r)
+	r.start()
+	return r
+}
+
+// factoryV1 adapts a ClientFactory to a ClientFactoryV2.
+type factoryV1 struct {
+	ClientFactory
+}
+
+func (f factoryV1) MakeRemoteClient(dest Destination, client thrift.TChanClient) (interface{}, error) {
+	return f.ClientFactory.MakeRemoteClient(client), nil
+}
+
+// newRemoteClient creates the client that calls the node at d through client
+// with the factory of the router.
+func (r *router) newRemoteClient(d Destination, client thrift.TChanClient) (interface{}, error) {
+	return r.callFactory(d, func() (interface{}, error) {
+		f, ok := r.factory.(ContextClientFactory)
+		if !ok {
+			return r.factory.MakeRemoteClient(d, client)
+		}
+		ctx := r.factoryCtx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return f.MakeRemoteClientContext(ctx, d, client)
+	})
+}
+
+// A FactoryPanicError is the error of a client the factory of the router
+// panicked creating, when recovered with WithFactoryRecovery.
+type FactoryPanicError struct {
+	// Dest is the address of the destination of the client.
+	Dest string
+
+	// Value is the value the factory panicked with.
+	Value interface{}
+}
+
+func (e *FactoryPanicError) Error() string {
+	return fmt.Sprintf("client factory panicked creating the client of %s: %v", e.Dest, e.Value)
+}
+
+// An ErrorTranslator translates the error the factory of the router returned
+// creating the client of dest, eg. to map the errors of a client library to
+// the errors of a service, see WithFactoryErrorTranslator. Returning nil
+// keeps err.
+type ErrorTranslator func(dest Destination, err error) error
+
+// callFactory creates the client of d with fn, a call to the factory of the
+// router, recovering its panics when enabled with WithFactoryRecovery and
+// translating its errors with the ErrorTranslator of the router.
+func (r *router) callFactory(d Destination, fn func() (interface{}, error)) (interface{}, error) {
+	client, err := r.recoverFactory(d, fn)
+	if err != nil && r.factoryErrors != nil {
+		if translated := r.factoryErrors(d, err); translated != nil {
+			err = translated
+		}
+	}
+	return client, err
+}
+
+// recoverFactory calls fn and returns a FactoryPanicError when it panics and
+// recovery is enabled.
+func (r *router) recoverFactory(d Destination, fn func() (interface{}, error)) (client interface{}, err error) {
+	if r.factoryRecovery {
+		defer func() {
+			if v := recover(); v != nil {
+				r.statter.IncCounter("router.factory.panic", nil, 1)
+				r.logger.WithFields(bark.Fields{
+					"dest":  d.Address,
+					"panic": v,
+					"stack": string(debug.Stack()),
+				}).Error("router recovered panic of client factory")
+				client, err = nil, &FactoryPanicError{Dest: d.Address, Value: v}
+			}
+		}()
+	}
+	return fn()
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/thrift/pingpong"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// destFactory is a ClientFactoryV2 of which the remote clients are the
+// destinations they are created for, it fails for 127.0.0.1:3002.
+type destFactory struct{}
+
+func (destFactory) GetLocalClient() interface{} {
+	return "local client"
+}
+
+func (destFactory) MakeRemoteClient(dest Destination, client thrift.TChanClient) (interface{}, error) {
+	if dest.Address == "127.0.0.1:3002" {
+		return nil, errors.New("no config for destination")
+	}
+	return dest, nil
+}
+
+// envKey is the key of the environment in the context of envFactory.
+type envKey struct{}
+
+// envFactory is a ContextClientFactory of which the remote clients are the
+// environment set in the context they are created with.
+type envFactory struct {
+	destFactory
+}
+
+func (envFactory) MakeRemoteClientContext(ctx context.Context, dest Destination, client thrift.TChanClient) (interface{}, error) {
+	env, ok := ctx.Value(envKey{}).(string)
+	if !ok {
+		return nil, errors.New("no environment")
+	}
+	return env + " client", nil
+}
+
+func TestClientFactoryV2(t *testing.T) {
+	rp := newTestRingpop(testLookups{
+		"misconfigured": "127.0.0.1:3002",
+	})
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	r := NewV2(rp, destFactory{}, ch)
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, Destination{Address: "127.0.0.1:3001"}, client)
+
+	client, err = r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	_, err = r.GetClient("misconfigured")
+	assert.EqualError(t, err, "no config for destination")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.NotContains(t, r.(*router).cache.keys(), "127.0.0.1:3002", "expected failed clients not to be cached")
+}
+
+func TestClientFactoryV2Loopback(t *testing.T) {
+	rp := newTestRingpop(nil)
+
+	r := NewV2(rp, destFactory{}, nil, WithLocalLoopback(pingpong.NewTChanPingPongServer(&pingHandler{source: "local"})))
+
+	client, err := r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, Destination{Address: "127.0.0.1:3000", Local: true}, client)
+}
+
+func TestWithFactoryContext(t *testing.T) {
+	rp := newTestRingpop(nil)
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), envKey{}, "staging")
+	r := NewV2(rp, envFactory{}, ch, WithFactoryContext(ctx))
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "staging client", client)
+
+	r = NewV2(rp, envFactory{}, ch)
+	_, err = r.GetClient("remote")
+	assert.EqualError(t, err, "no environment")
+}
+
+// panickingFactory is a ClientFactoryV2 that panics creating any client.
+type panickingFactory struct{}
+
+func (panickingFactory) GetLocalClient() interface{} {
+	panic("no local client")
+}
+
+func (panickingFactory) MakeRemoteClient(dest Destination, client thrift.TChanClient) (interface{}, error) {
+	panic("no remote client")
+}
+
+func TestWithFactoryRecovery(t *testing.T) {
+	rp := newTestRingpop(nil)
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	r := NewV2(rp, panickingFactory{}, ch, WithFactoryRecovery())
+	_, err = r.GetClient("remote")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Equal(t, &FactoryPanicError{Dest: "127.0.0.1:3001", Value: "no remote client"}, err.(*Error).Err)
+
+	_, err = r.GetClient("local")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.EqualError(t, err, "client factory panicked creating the client of 127.0.0.1:3000: no local client")
+
+	r = NewV2(rp, panickingFactory{}, ch)
+	assert.Panics(t, func() { r.GetClient("remote") }, "expected panics to propagate without recovery")
+}
+
+func TestFactoryPanicsReleaseCreation(t *testing.T) {
+	rp := newTestRingpop(nil)
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	r := NewV2(rp, panickingFactory{}, ch, WithCreationLimit(1, 0)).(*router)
+	for i := 0; i < 2; i++ {
+		// the second call neither waits for the first creation nor is
+		// throttled by its slot
+		assert.Panics(t, func() { r.GetClient("remote") })
+	}
+	shard := r.cache.shard(r.cacheKey("127.0.0.1:3001"))
+	assert.Empty(t, shard.creating)
+}
+
+func TestWithFactoryErrorTranslator(t *testing.T) {
+	rp := newTestRingpop(testLookups{
+		"misconfigured": "127.0.0.1:3002",
+	})
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	unavailable := errors.New("destination unavailable")
+	var translated []string
+	translate := func(dest Destination, err error) error {
+		translated = append(translated, dest.Address)
+		if _, ok := err.(*FactoryPanicError); ok {
+			return nil
+		}
+		return unavailable
+	}
+
+	r := NewV2(rp, destFactory{}, ch, WithFactoryErrorTranslator(translate))
+	_, err = r.GetClient("misconfigured")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Equal(t, unavailable, err.(*Error).Err)
+
+	_, err = r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3002"}, translated, "expected only errors to be translated")
+
+	r = NewV2(rp, panickingFactory{}, ch, WithFactoryRecovery(), WithFactoryErrorTranslator(translate))
+	_, err = r.GetClient("remote")
+	_, ok := err.(*Error).Err.(*FactoryPanicError)
+	assert.True(t, ok, "expected the error to be kept when the translator returns nil")
+}
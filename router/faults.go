@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// FaultConfig configures the faults a router injects to test the resilience
+// of its users, see WithFaultInjection. The rates are the probabilities,
+// between 0 and 1, that a fault is injected into a lookup or a request for a
+// client.
+type FaultConfig struct {
+	// Enabled must be set for any fault to be injected, so configurations
+	// can be rolled out disabled and turned on for a game day.
+	Enabled bool
+
+	// LookupDelay is the time the lookups picked at LookupDelayRate are
+	// delayed by.
+	LookupDelay     time.Duration
+	LookupDelayRate float64
+
+	// WrongOwnerRate is the rate of the lookups that resolve their key to a
+	// random member of the ring other than its owner.
+	WrongOwnerRate float64
+
+	// DropClientRate is the rate of the requests for cached clients that drop
+	// the client from the cache, so it is created again.
+	DropClientRate float64
+}
+
+// injectFault returns whether to inject a fault of the given rate.
+func (r *router) injectFault(rate float64) bool {
+	return r.faults.Enabled && rate > 0 && r.rand.Float64() < rate
+}
+
+// delayLookup delays a lookup when a fault is injected, and gives up with the
+// error of ctx when ctx is done before the delay is over.
+func (r *router) delayLookup(ctx context.Context) error {
+	if !r.injectFault(r.faults.LookupDelayRate) {
+		return nil
+	}
+	r.statter.IncCounter("router.fault.delayed", nil, 1)
+	select {
+	case <-r.clock.After(r.faults.LookupDelay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// misroute returns another reachable member than dest when a fault is
+// injected, and dest otherwise.
+func (r *router) misroute(dest string) string {
+	if !r.injectFault(r.faults.WrongOwnerRate) {
+		return dest
+	}
+	members, err := r.ringpop.GetReachableMembers()
+	if err != nil {
+		return dest
+	}
+
+	others := make([]string, 0, len(members))
+	for _, member := range members {
+		if member != dest {
+			others = append(others, member)
+		}
+	}
+	if len(others) == 0 {
+		return dest
+	}
+	r.statter.IncCounter("router.fault.misrouted", nil, 1)
+	return others[r.rand.Intn(len(others))]
+}
+
+// dropClient drops the cached client of dest when a fault is injected.
+func (r *router) dropClient(dest string) {
+	if r.injectFault(r.faults.DropClientRate) {
+		r.statter.IncCounter("router.fault.dropped", nil, 1)
+		r.removeClient(dest)
+	}
+}
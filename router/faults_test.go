@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// alwaysSource is a rand.Source whose Float64 draws are always 0.
+type alwaysSource struct{}
+
+func (alwaysSource) Int63() int64 { return 0 }
+func (alwaysSource) Seed(int64)   {}
+
+func TestFaultInjectionDisabled(t *testing.T) {
+	config := FaultConfig{WrongOwnerRate: 1, DropClientRate: 1}
+	r, _ := newValidationTestRouter(t, WithFaultInjection(config), WithRandSource(alwaysSource{}))
+
+	for i := 0; i < 3; i++ {
+		dest, err := r.lookup("remote")
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3001", dest)
+	}
+}
+
+func TestFaultInjectionWrongOwner(t *testing.T) {
+	config := FaultConfig{Enabled: true, WrongOwnerRate: 1}
+	r, _ := newValidationTestRouter(t, WithFaultInjection(config), WithRandSource(alwaysSource{}))
+
+	dest, err := r.lookup("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3000", dest, "expected the key to be routed to another member")
+}
+
+func TestFaultInjectionDropClient(t *testing.T) {
+	config := FaultConfig{Enabled: true, DropClientRate: 1}
+	r, _ := newValidationTestRouter(t, WithFaultInjection(config), WithRandSource(alwaysSource{}))
+
+	_, hit, err := r.getClientForDestHit(context.Background(), "127.0.0.1:3000")
+	assert.NoError(t, err)
+	assert.False(t, hit)
+	_, hit, err = r.getClientForDestHit(context.Background(), "127.0.0.1:3000")
+	assert.NoError(t, err)
+	assert.False(t, hit, "expected the cached client to be dropped")
+}
+
+func TestFaultInjectionLookupDelay(t *testing.T) {
+	config := FaultConfig{Enabled: true, LookupDelay: 50 * time.Millisecond, LookupDelayRate: 1}
+	r, _ := newValidationTestRouter(t, WithFaultInjection(config), WithRandSource(rand.NewSource(1)))
+
+	start := time.Now()
+	_, err := r.lookup("remote")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond, "expected the lookup to be delayed")
+
+	// the delay is given up on when the deadline of the caller expires
+	config.LookupDelay = time.Hour
+	r, _ = newValidationTestRouter(t, WithFaultInjection(config), WithRandSource(rand.NewSource(1)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = r.GetClientContext(ctx, "remote")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/uber/ringpop-go"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// HeaderChecksum is the header of a call that holds the checksum of the ring
+// the caller routed it with, see WithChecksumHeaders.
+const HeaderChecksum = "ringpop-checksum"
+
+// checksumHeader is the Interceptor of WithChecksumHeaders. Calls are made
+// without the header when ringpop fails to return its checksum.
+func (r *router) checksumHeader(ctx thrift.Context, call *Call, next func(ctx thrift.Context) (bool, error)) (bool, error) {
+	checksum, err := r.ringpop.Checksum()
+	if err != nil {
+		return next(ctx)
+	}
+
+	headers := make(map[string]string, len(ctx.Headers())+1)
+	for k, v := range ctx.Headers() {
+		headers[k] = v
+	}
+	headers[HeaderChecksum] = strconv.FormatUint(uint64(checksum), 10)
+	return next(thrift.WithHeaders(ctx, headers))
+}
+
+// checksumSeen tells when a checksum that differs from the one of the local
+// ring was first and last seen.
+type checksumSeen struct {
+	first time.Time
+	last  time.Time
+}
+
+// A ChecksumValidator rejects calls routed with a ring that disagrees with the
+// ring of the local node for longer than a tolerance, which fences off the
+// callers of a split brain while rings converging after a change go through.
+// Register it in the handlers of a service whose callers route with
+// WithChecksumHeaders:
+//
+//     validator := router.NewChecksumValidator(rp, 5*time.Second)
+//
+//     func (h *handler) Set(ctx thrift.Context, key, value string) error {
+//         if err := validator.Validate(ctx); err != nil {
+//             return err
+//         }
+//         ...
+//     }
+//
+// A ChecksumValidator is safe for concurrent use.
+type ChecksumValidator struct {
+	ringpop   ringpop.Interface
+	tolerance time.Duration
+	clock     clock.Clock
+
+	mu       sync.Mutex
+	checksum uint32
+	seen     map[uint32]checksumSeen
+}
+
+// NewChecksumValidator returns a ChecksumValidator that accepts the calls of
+// which the checksum differs from the checksum of the ring of rp for at most
+// tolerance: since the local ring last had that checksum, or since the
+// checksum was first seen when the local ring never had it.
+func NewChecksumValidator(rp ringpop.Interface, tolerance time.Duration) *ChecksumValidator {
+	return &ChecksumValidator{
+		ringpop:   rp,
+		tolerance: tolerance,
+		clock:     clock.New(),
+		seen:      make(map[uint32]checksumSeen),
+	}
+}
+
+// Validate returns ErrChecksumMismatch when the call of ctx was routed with a
+// ring whose checksum disagrees with the local ring for longer than the
+// tolerance of v. Calls without a valid HeaderChecksum are accepted, as are
+// all calls while ringpop fails to return its checksum.
+func (v *ChecksumValidator) Validate(ctx thrift.Context) error {
+	header, ok := ctx.Headers()[HeaderChecksum]
+	if !ok {
+		return nil
+	}
+	caller, err := strconv.ParseUint(header, 10, 32)
+	if err != nil {
+		return nil
+	}
+	local, err := v.ringpop.Checksum()
+	if err != nil {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.clock.Now()
+	if local != v.checksum {
+		// the previous checksum of the local ring is valid for the
+		// tolerance from now on
+		if v.checksum != 0 {
+			v.seen[v.checksum] = checksumSeen{first: now, last: now}
+		}
+		delete(v.seen, local)
+		v.checksum = local
+	}
+	if uint32(caller) == local {
+		return nil
+	}
+
+	seen, ok := v.seen[uint32(caller)]
+	if !ok {
+		v.forget(now)
+		seen.first = now
+	}
+	seen.last = now
+	v.seen[uint32(caller)] = seen
+
+	if now.Sub(seen.first) > v.tolerance {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// forget removes the checksums that have not been seen for longer than the
+// tolerance, so the checksums of calls that stopped are not kept forever.
+// mu must be held.
+func (v *ChecksumValidator) forget(now time.Time) {
+	for checksum, seen := range v.seen {
+		if now.Sub(seen.last) > v.tolerance {
+			delete(v.seen, checksum)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+func TestChecksumHeaders(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithChecksumHeaders())
+	r.ringpop.(*mocks.Ringpop).On("Checksum").Return(uint32(42), nil)
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	ic, ok := client.(*interceptedClient)
+	if !assert.True(t, ok, "expected the remote client to be intercepted") {
+		return
+	}
+	stub := &headerStubClient{}
+	ic.TChanClient = stub
+
+	assert.NoError(t, call(ic))
+	assert.Equal(t, "42", stub.headers[HeaderChecksum])
+}
+
+// checksumContext returns a context of a call routed with the ring of
+// checksum.
+func checksumContext(checksum string) thrift.Context {
+	ctx, _ := thrift.NewContext(time.Second)
+	return thrift.WithHeaders(ctx, map[string]string{HeaderChecksum: checksum})
+}
+
+func newTestChecksumValidator(local uint32) (*ChecksumValidator, *mocks.Ringpop, *clock.Mock) {
+	rp := &mocks.Ringpop{}
+	rp.On("Checksum").Return(local, nil)
+	v := NewChecksumValidator(rp, time.Minute)
+	c := clock.NewMock()
+	v.clock = c
+	return v, rp, c
+}
+
+func TestChecksumValidator(t *testing.T) {
+	v, _, c := newTestChecksumValidator(1)
+
+	assert.NoError(t, v.Validate(checksumContext("1")))
+	ctx, _ := thrift.NewContext(time.Second)
+	assert.NoError(t, v.Validate(ctx), "expected calls without a checksum to be accepted")
+	assert.NoError(t, v.Validate(checksumContext("not a checksum")))
+
+	// another ring is accepted while converging, but not beyond the tolerance
+	assert.NoError(t, v.Validate(checksumContext("2")))
+	c.Add(30 * time.Second)
+	assert.NoError(t, v.Validate(checksumContext("2")))
+	c.Add(31 * time.Second)
+	assert.Equal(t, ErrChecksumMismatch, v.Validate(checksumContext("2")))
+	assert.NoError(t, v.Validate(checksumContext("1")))
+}
+
+func TestChecksumValidatorAcceptsPreviousRing(t *testing.T) {
+	v, rp, c := newTestChecksumValidator(1)
+	assert.NoError(t, v.Validate(checksumContext("1")))
+
+	rp.ExpectedCalls = nil
+	rp.On("Checksum").Return(uint32(2), nil)
+	c.Add(time.Hour)
+	assert.NoError(t, v.Validate(checksumContext("1")), "expected the previous ring to be accepted")
+	assert.NoError(t, v.Validate(checksumContext("2")))
+
+	c.Add(2 * time.Minute)
+	assert.Equal(t, ErrChecksumMismatch, v.Validate(checksumContext("1")))
+}
+
+func TestChecksumValidatorWithoutChecksum(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("Checksum").Return(uint32(0), errors.New("ring not ready"))
+	v := NewChecksumValidator(rp, 0)
+
+	assert.NoError(t, v.Validate(checksumContext("1")))
+}
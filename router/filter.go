@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "errors"
+
+var errNoMatchingMember = errors.New("no reachable member matches the member filter")
+
+// A Member is a member of the ring as seen by a MemberFilter.
+type Member struct {
+	Address string
+
+	// Labels are the labels of the member when the router has a LabelsFunc,
+	// see WithLabels, and nil otherwise or when its labels cannot be read.
+	Labels map[string]string
+}
+
+// A MemberFilter returns whether keys may resolve to member, see
+// WithMemberFilter. It is called for every lookup and should be cheap.
+type MemberFilter func(member Member) bool
+
+// filteredLookupN returns the first n members responsible for key, according
+// to the lookup strategy of the router, that match the member filter. The
+// members and their labels are those of the snapshot of the current ring, see
+// memberSnapshot.
+func (r *router) filteredLookupN(key string, n int) ([]string, error) {
+	snapshot, err := r.memberSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	members := snapshot.members
+	if len(members) == 0 {
+		return nil, errNoMembers
+	}
+
+	// the members of the ring are listed in growing batches from the owner
+	// of key on, so keys whose first members match do not walk the ring
+	for batch := n; ; batch *= 2 {
+		if batch < 1 {
+			batch = 1
+		}
+		if batch > len(members) {
+			batch = len(members)
+		}
+		candidates, err := r.filterCandidates(snapshot, key, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		var dests []string
+		for _, dest := range candidates {
+			if len(dests) == n {
+				break
+			}
+			labels := snapshot.memberLabels(r, dest)
+			if r.memberFilter(Member{Address: dest, Labels: labels}) {
+				dests = append(dests, dest)
+			}
+		}
+		if len(dests) == n || batch == len(members) || len(candidates) == len(members) {
+			if len(dests) == 0 {
+				return nil, errNoMatchingMember
+			}
+			return dests, nil
+		}
+	}
+}
+
+// filterCandidates returns the members responsible for key in the order of
+// the lookup strategy of the router: the first batch of them on ringpop's
+// ring, or all of them with the strategies that rank every member anyway.
+func (r *router) filterCandidates(snapshot *memberSnapshot, key string, batch int) ([]string, error) {
+	switch r.lookupStrategy {
+	case RendezvousLookup:
+		return rankMembers(snapshot.members, key, len(snapshot.members), r.weight), nil
+	case RangeLookup:
+		return snapshot.rangeTable(r.rangeSplits).owners[rangeIndex(r.rangeSplits, key)], nil
+	default:
+		return r.ringpop.LookupN(key, batch)
+	}
+}
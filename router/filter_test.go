@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/mocks"
+	"golang.org/x/net/context"
+)
+
+var memberRoles = map[string]string{
+	"127.0.0.1:3001": "frontend",
+	"127.0.0.1:3002": "worker",
+	"127.0.0.1:3003": "worker",
+}
+
+func roleLabels(dest string) (map[string]string, error) {
+	return map[string]string{"role": memberRoles[dest]}, nil
+}
+
+func workers(member Member) bool {
+	return member.Labels["role"] == "worker"
+}
+
+func newFilterTestRouter(t *testing.T, opts ...Option) *router {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, nil)
+	rp.On("Checksum").Return(uint32(1), nil)
+	rp.On("LookupN", "key", 1).Return([]string{"127.0.0.1:3001"}, nil)
+	rp.On("LookupN", "key", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3003"}, nil)
+	rp.On("LookupN", "key", 3).Return([]string{"127.0.0.1:3001", "127.0.0.1:3003", "127.0.0.1:3002"}, nil)
+
+	opts = append([]Option{WithRemoteDialer(destDialer), WithLabels(roleLabels)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...)
+}
+
+func TestMemberFilter(t *testing.T) {
+	r := newFilterTestRouter(t, WithMemberFilter(workers))
+
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3003", client, "expected the first worker from the owner on")
+
+	dests, err := r.lookupN(context.Background(), "key", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3003", "127.0.0.1:3002"}, dests)
+}
+
+func TestMemberFilterRendezvous(t *testing.T) {
+	r := newFilterTestRouter(t, WithMemberFilter(workers), WithLookupStrategy(RendezvousLookup))
+
+	dests, err := r.lookupN(context.Background(), "key", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, rankMembers([]string{"127.0.0.1:3002", "127.0.0.1:3003"}, "key", 2, r.weight), dests)
+}
+
+func TestMemberFilterNoMatch(t *testing.T) {
+	r := newFilterTestRouter(t, WithMemberFilter(func(member Member) bool {
+		return false
+	}))
+
+	_, err := r.GetClient("key")
+	assert.EqualError(t, err, "no reachable member matches the member filter")
+}
+
+func TestMemberFilterKeepsMembers(t *testing.T) {
+	reads := make(map[string]int)
+	labels := func(dest string) (map[string]string, error) {
+		reads[dest]++
+		return roleLabels(dest)
+	}
+	r := newFilterTestRouter(t, WithMemberFilter(workers), WithLabels(labels))
+	rp := r.ringpop.(*mocks.Ringpop)
+
+	for i := 0; i < 3; i++ {
+		dest, err := r.lookup("key")
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3003", dest)
+	}
+	rp.AssertNumberOfCalls(t, "GetReachableMembers", 1)
+	rp.AssertNotCalled(t, "LookupN", "key", 3)
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 1, "127.0.0.1:3003": 1}, reads, "expected the labels to be read once")
+}
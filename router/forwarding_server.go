@@ -0,0 +1,262 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strconv"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber-common/bark"
+	"github.com/uber/ringpop-go"
+	"github.com/uber/ringpop-go/forward"
+	"github.com/uber/ringpop-go/logging"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// RawArgs are the undecoded arguments of an incoming call.
+type RawArgs interface {
+	// Decode reads the arguments into the generated args struct of the
+	// method, eg. *pingpong.PingPongPingArgs.
+	Decode(args athrift.TStruct) error
+}
+
+// KeyFunc returns the key that determines which node handles a call. An
+// empty key makes the call be handled locally.
+type KeyFunc func(ctx thrift.Context, method string, args RawArgs) (string, error)
+
+// ShardKey is a KeyFunc that routes on the shard key of the incoming call.
+func ShardKey(ctx thrift.Context, method string, args RawArgs) (string, error) {
+	call := tchannel.CurrentCall(ctx)
+	if call == nil {
+		return "", nil
+	}
+	return call.ShardKey(), nil
+}
+
+const (
+	// HeaderOrigin is the header of forwarded calls that holds the address
+	// of the node that forwarded the call first.
+	HeaderOrigin = "ringpop-origin"
+
+	// HeaderHops is the header of forwarded calls that holds the number of
+	// times the call has been forwarded.
+	HeaderHops = "ringpop-hops"
+)
+
+// forwardingServer is a thrift.TChanServer that handles calls for keys owned
+// by this node and forwards all others to their owner.
+type forwardingServer struct {
+	thrift.TChanServer
+
+	ringpop ringpop.Interface
+	channel *tchannel.Channel
+	key     KeyFunc
+	tracer  Tracer
+	maxHops int
+	logger  bark.Logger
+
+	idempotencyKeys bool
+}
+
+// A ForwardingOption configures a server created by NewForwardingServer.
+type ForwardingOption func(*forwardingServer)
+
+// WithForwardingTracer makes the forwarding server trace every call it
+// forwards with a span started by t as a child of the span of the incoming
+// call. The span context is injected into the headers of the forwarded call.
+func WithForwardingTracer(t Tracer) ForwardingOption {
+	return func(s *forwardingServer) {
+		s.tracer = t
+	}
+}
+
+// WithMaxHops lets the forwarding server forward a call that was forwarded to
+// it again, when the node that forwarded it disagrees with this node about the
+// owner of the key, until the call has been forwarded n times. A call that
+// would be forwarded more often, or back to the node it was forwarded by
+// first, is rejected with ErrForwardingLoop and logged as a warning. By
+// default, and for n of 1 or less, forwarded calls are handled locally.
+func WithMaxHops(n int) ForwardingOption {
+	return func(s *forwardingServer) {
+		s.maxHops = n
+	}
+}
+
+// WithForwardingIdempotencyKeys makes the forwarding server give the calls it
+// forwards a new idempotency key, in the HeaderIdempotencyKey header, unless
+// they carry one already, so the owner of the key can recognize the calls
+// TChannel retries. See WithIdempotencyKey.
+func WithForwardingIdempotencyKeys() ForwardingOption {
+	return func(s *forwardingServer) {
+		s.idempotencyKeys = true
+	}
+}
+
+// NewForwardingServer wraps server so that every call is handled by the node
+// that owns the key returned by key. Register the returned server instead of
+// server:
+//
+//     server.Register(router.NewForwardingServer(rp, ch, pingpong.NewTChanPingPongServer(h), router.ShardKey))
+//
+// Calls are forwarded at most once, a call that was already forwarded is
+// always handled locally unless WithMaxHops allows more hops. Forwarded calls
+// carry the HeaderOrigin and HeaderHops headers.
+func NewForwardingServer(rp ringpop.Interface, ch *tchannel.Channel, server thrift.TChanServer, key KeyFunc, opts ...ForwardingOption) thrift.TChanServer {
+	s := &forwardingServer{
+		TChanServer: server,
+		ringpop:     rp,
+		channel:     ch,
+		key:         key,
+		logger:      logging.Logger("router"),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Handle forwards the call to the owner of its key, or passes it to the
+// wrapped server when this node is the owner.
+func (s *forwardingServer) Handle(ctx thrift.Context, method string, protocol athrift.TProtocol) (bool, athrift.TStruct, error) {
+	forwarded := forward.HasForwardedHeader(ctx)
+	if forwarded && s.maxHops <= 1 {
+		return s.TChanServer.Handle(ctx, method, protocol)
+	}
+
+	args := &rawStruct{}
+	if err := args.Read(protocol); err != nil {
+		return false, nil, err
+	}
+
+	key, dest, local, err := s.destination(ctx, method, args)
+	if err != nil {
+		return false, nil, err
+	}
+	if local {
+		return s.TChanServer.Handle(ctx, method, args.protocol())
+	}
+
+	if forwarded {
+		origin, hops := forwardingHeaders(ctx)
+		if hops >= s.maxHops || dest == origin {
+			s.logger.WithFields(bark.Fields{
+				"method": method,
+				"dest":   dest,
+				"origin": origin,
+				"hops":   hops,
+			}).Warn("router rejected call forwarded in a loop")
+			return false, nil, ErrForwardingLoop
+		}
+	}
+	return s.forward(ctx, key, dest, method, args)
+}
+
+// forwardingHeaders returns the origin and the number of hops of a forwarded
+// call. Calls forwarded by nodes that do not set HeaderHops made one hop.
+func forwardingHeaders(ctx thrift.Context) (string, int) {
+	headers := ctx.Headers()
+	hops, err := strconv.Atoi(headers[HeaderHops])
+	if err != nil || hops < 1 {
+		hops = 1
+	}
+	return headers[HeaderOrigin], hops
+}
+
+// withForwardingHeaders returns ctx with the headers of a call that is
+// forwarded by this node: the forwarded header of ringpop, the origin of the
+// call, its number of hops and, when enabled, its idempotency key.
+func (s *forwardingServer) withForwardingHeaders(ctx thrift.Context) (thrift.Context, error) {
+	origin, hops := forwardingHeaders(ctx)
+	if !forward.HasForwardedHeader(ctx) {
+		me, err := s.ringpop.WhoAmI()
+		if err != nil {
+			return nil, wrapError(ErrSelfLookupFailed, err)
+		}
+		origin, hops = me, 0
+	}
+
+	headers := make(map[string]string, len(ctx.Headers())+2)
+	for k, v := range ctx.Headers() {
+		headers[k] = v
+	}
+	headers[HeaderOrigin] = origin
+	headers[HeaderHops] = strconv.Itoa(hops + 1)
+	if s.idempotencyKeys && headers[HeaderIdempotencyKey] == "" {
+		headers[HeaderIdempotencyKey] = newIdempotencyKey()
+	}
+	return forward.SetForwardedHeader(thrift.WithHeaders(ctx, headers)), nil
+}
+
+// forward makes the call for key on dest and returns its result.
+func (s *forwardingServer) forward(ctx thrift.Context, key, dest, method string, args *rawStruct) (bool, athrift.TStruct, error) {
+	if s.tracer != nil {
+		spanCtx, span := s.tracer.StartSpan(ctx, "router.Forward")
+		defer span.Finish()
+		span.SetTag(TagKeyHash, keyHash(key))
+		span.SetTag(TagDestination, dest)
+		span.SetTag(TagForwarded, true)
+
+		headers := make(map[string]string, len(ctx.Headers()))
+		for k, v := range ctx.Headers() {
+			headers[k] = v
+		}
+		span.Inject(headers)
+		ctx = thrift.WithHeaders(spanCtx, headers)
+	}
+
+	client := thrift.NewClient(s.channel, s.channel.ServiceName(), &thrift.ClientOptions{
+		HostPort: dest,
+	})
+
+	ctx, err := s.withForwardingHeaders(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+
+	result := &rawStruct{}
+	success, err := client.Call(ctx, s.Service(), method, args, result)
+	if err != nil {
+		return false, nil, err
+	}
+	return success, result, nil
+}
+
+// destination returns the key of the call, its owner and whether that is this
+// node.
+func (s *forwardingServer) destination(ctx thrift.Context, method string, args RawArgs) (string, string, bool, error) {
+	key, err := s.key(ctx, method, args)
+	if err != nil || key == "" {
+		return "", "", true, err
+	}
+
+	dest, err := s.ringpop.Lookup(key)
+	if err != nil {
+		return "", "", false, wrapError(ErrLookupFailed, err)
+	}
+
+	me, err := s.ringpop.WhoAmI()
+	if err != nil {
+		return "", "", false, wrapError(ErrSelfLookupFailed, err)
+	}
+
+	return key, dest, dest == me, nil
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/ringpop-go/test/thrift/pingpong"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type pingHandler struct {
+	source  string
+	calls   int32
+	headers atomic.Value
+}
+
+func (h *pingHandler) Ping(ctx thrift.Context, request *pingpong.Ping) (*pingpong.Pong, error) {
+	atomic.AddInt32(&h.calls, 1)
+	h.headers.Store(ctx.Headers())
+	if request.Key == "fail" {
+		return nil, &pingpong.PingError{}
+	}
+	return &pingpong.Pong{Source: h.source}, nil
+}
+
+// pingKey routes ping calls on the key in the request.
+func pingKey(ctx thrift.Context, method string, args RawArgs) (string, error) {
+	ping := pingpong.NewPingPongPingArgs()
+	if err := args.Decode(ping); err != nil {
+		return "", err
+	}
+	return ping.Request.Key, nil
+}
+
+type forwardingNode struct {
+	channel *tchannel.Channel
+	ringpop *mocks.Ringpop
+	handler *pingHandler
+}
+
+func newForwardingNodes(t *testing.T, n int, opts ...ForwardingOption) []*forwardingNode {
+	nodes := make([]*forwardingNode, n)
+	for i := range nodes {
+		ch, err := tchannel.NewChannel("forwarding", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, ch.ListenAndServe("127.0.0.1:0"))
+
+		rp := &mocks.Ringpop{}
+		rp.On("WhoAmI").Return(ch.PeerInfo().HostPort, nil)
+
+		handler := &pingHandler{source: ch.PeerInfo().HostPort}
+		server := NewForwardingServer(rp, ch, pingpong.NewTChanPingPongServer(handler), pingKey, opts...)
+		thrift.NewServer(ch).Register(server)
+
+		nodes[i] = &forwardingNode{channel: ch, ringpop: rp, handler: handler}
+	}
+
+	// every node believes key "0" is owned by node 0, "1" by node 1, ...
+	for _, node := range nodes {
+		for i, owner := range nodes {
+			node.ringpop.On("Lookup", strconv.Itoa(i)).Return(owner.channel.PeerInfo().HostPort, nil)
+		}
+		node.ringpop.On("Lookup", mock.Anything).Return(nodes[0].channel.PeerInfo().HostPort, nil)
+	}
+	return nodes
+}
+
+func closeForwardingNodes(nodes []*forwardingNode) {
+	for _, node := range nodes {
+		node.channel.Close()
+	}
+}
+
+func ping(t *testing.T, from, to *forwardingNode, key string) (*pingpong.Pong, error) {
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+
+	client := pingpong.NewTChanPingPongClient(thrift.NewClient(from.channel, "forwarding", &thrift.ClientOptions{
+		HostPort: to.channel.PeerInfo().HostPort,
+	}))
+	return client.Ping(ctx, &pingpong.Ping{Key: key})
+}
+
+func TestForwardingServerHandlesLocalKeys(t *testing.T) {
+	nodes := newForwardingNodes(t, 2)
+	defer closeForwardingNodes(nodes)
+
+	pong, err := ping(t, nodes[1], nodes[0], "0")
+	assert.NoError(t, err)
+	assert.Equal(t, nodes[0].channel.PeerInfo().HostPort, pong.Source)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&nodes[0].handler.calls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&nodes[1].handler.calls))
+}
+
+func TestForwardingServerForwardsRemoteKeys(t *testing.T) {
+	nodes := newForwardingNodes(t, 2)
+	defer closeForwardingNodes(nodes)
+
+	pong, err := ping(t, nodes[0], nodes[0], "1")
+	assert.NoError(t, err)
+	assert.Equal(t, nodes[1].channel.PeerInfo().HostPort, pong.Source)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&nodes[0].handler.calls))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&nodes[1].handler.calls))
+}
+
+func TestForwardingServerForwardsApplicationErrors(t *testing.T) {
+	nodes := newForwardingNodes(t, 2)
+	defer closeForwardingNodes(nodes)
+
+	// the key "fail" is owned by node 0, so call node 1
+	_, err := ping(t, nodes[1], nodes[1], "fail")
+	assert.IsType(t, &pingpong.PingError{}, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&nodes[0].handler.calls))
+}
+
+func TestForwardingServerForwardsOnce(t *testing.T) {
+	nodes := newForwardingNodes(t, 2)
+	defer closeForwardingNodes(nodes)
+
+	// node 1 disagrees and thinks node 0 owns key "1"
+	nodes[1].ringpop.ExpectedCalls = nil
+	nodes[1].ringpop.On("WhoAmI").Return(nodes[1].channel.PeerInfo().HostPort, nil)
+	nodes[1].ringpop.On("Lookup", mock.Anything).Return(nodes[0].channel.PeerInfo().HostPort, nil)
+
+	pong, err := ping(t, nodes[0], nodes[0], "1")
+	assert.NoError(t, err)
+	assert.Equal(t, nodes[1].channel.PeerInfo().HostPort, pong.Source)
+}
+
+// disagree makes node believe key is owned by owner.
+func disagree(node, owner *forwardingNode, key string) {
+	node.ringpop.ExpectedCalls = nil
+	node.ringpop.On("WhoAmI").Return(node.channel.PeerInfo().HostPort, nil)
+	node.ringpop.On("Lookup", key).Return(owner.channel.PeerInfo().HostPort, nil)
+}
+
+func TestForwardingServerSetsForwardingHeaders(t *testing.T) {
+	nodes := newForwardingNodes(t, 2)
+	defer closeForwardingNodes(nodes)
+
+	_, err := ping(t, nodes[0], nodes[0], "1")
+	assert.NoError(t, err)
+
+	headers := nodes[1].handler.headers.Load().(map[string]string)
+	assert.Equal(t, nodes[0].channel.PeerInfo().HostPort, headers[HeaderOrigin])
+	assert.Equal(t, "1", headers[HeaderHops])
+}
+
+func TestForwardingServerMaxHops(t *testing.T) {
+	nodes := newForwardingNodes(t, 3, WithMaxHops(2))
+	defer closeForwardingNodes(nodes)
+
+	// node 1 disagrees and thinks node 2 owns key "0", which node 0 owns
+	disagree(nodes[1], nodes[2], "0")
+
+	pong, err := ping(t, nodes[1], nodes[1], "0")
+	assert.NoError(t, err)
+	assert.Equal(t, nodes[0].channel.PeerInfo().HostPort, pong.Source)
+
+	headers := nodes[0].handler.headers.Load().(map[string]string)
+	assert.Equal(t, nodes[1].channel.PeerInfo().HostPort, headers[HeaderOrigin])
+	assert.Equal(t, "2", headers[HeaderHops])
+
+	// node 2 disagrees too, so a third hop would be needed
+	disagree(nodes[2], nodes[1], "0")
+	disagree(nodes[0], nodes[2], "0")
+
+	_, err = ping(t, nodes[0], nodes[0], "0")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&nodes[0].handler.calls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&nodes[1].handler.calls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&nodes[2].handler.calls))
+}
+
+func TestForwardingServerRejectsLoops(t *testing.T) {
+	nodes := newForwardingNodes(t, 2, WithMaxHops(5))
+	defer closeForwardingNodes(nodes)
+
+	// node 0 and node 1 both think the other owns key "1"
+	disagree(nodes[0], nodes[1], "1")
+	disagree(nodes[1], nodes[0], "1")
+
+	_, err := ping(t, nodes[0], nodes[0], "1")
+	assert.Error(t, err, "expected the call not to be forwarded back to its origin")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&nodes[0].handler.calls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&nodes[1].handler.calls))
+}
+
+func TestShardKey(t *testing.T) {
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+
+	key, err := ShardKey(ctx, "Ping", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", key, "expected no shard key outside of a call")
+}
+
+func TestForwardingServerIdempotencyKeys(t *testing.T) {
+	nodes := newForwardingNodes(t, 2, WithForwardingIdempotencyKeys())
+	defer closeForwardingNodes(nodes)
+
+	_, err := ping(t, nodes[0], nodes[0], "1")
+	assert.NoError(t, err)
+	headers := nodes[1].handler.headers.Load().(map[string]string)
+	assert.Len(t, headers[HeaderIdempotencyKey], 32, "expected a new idempotency key")
+
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+	client := pingpong.NewTChanPingPongClient(thrift.NewClient(nodes[0].channel, "forwarding", &thrift.ClientOptions{
+		HostPort: nodes[0].channel.PeerInfo().HostPort,
+	}))
+	_, err = client.Ping(thrift.WithHeaders(ctx, map[string]string{HeaderIdempotencyKey: "write-1"}), &pingpong.Ping{Key: "1"})
+	assert.NoError(t, err)
+	headers = nodes[1].handler.headers.Load().(map[string]string)
+	assert.Equal(t, "write-1", headers[HeaderIdempotencyKey], "expected the key of the call to be kept")
+}
+
+func TestForwardingServerWithoutIdempotencyKeys(t *testing.T) {
+	nodes := newForwardingNodes(t, 2)
+	defer closeForwardingNodes(nodes)
+
+	_, err := ping(t, nodes[0], nodes[0], "1")
+	assert.NoError(t, err)
+	headers := nodes[1].handler.headers.Load().(map[string]string)
+	assert.NotContains(t, headers, HeaderIdempotencyKey)
+}
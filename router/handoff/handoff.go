@@ -0,0 +1,223 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package handoff moves the state of keys to their new owner before traffic
+// switches over. When the ring of a router changes, the local node is called
+// to transfer the state of every range of keys it lost, and calls made
+// through the Handoff for keys being transferred are buffered until the
+// transfer ends or served by the local node, which still holds their state.
+package handoff
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/ringpop-go/router"
+	"golang.org/x/net/context"
+)
+
+// A TransferFunc transfers the state of the keys in kr, which moved from the
+// local node to kr.To, to their new owner. The keys already resolve to kr.To,
+// so the state of every key can be sent through the client the router returns
+// for it. It should give up when ctx is done.
+type TransferFunc func(ctx context.Context, kr router.KeyRange) error
+
+// A Mode tells how calls for keys being transferred are handled.
+type Mode int
+
+const (
+	// Buffer makes calls for keys being transferred wait until the transfer
+	// ends and then go to the new owner.
+	Buffer Mode = iota
+
+	// Forward makes calls for keys being transferred run on the local node,
+	// their previous owner, until the transfer ends.
+	Forward
+)
+
+// A Handoff transfers the ranges of keys the local node loses to their new
+// owners and routes the calls for those keys while they are transferred.
+type Handoff interface {
+	// RunOnOwner is like router.Router.RunOnOwner but handles calls for keys
+	// being transferred as configured with WithMode.
+	RunOnOwner(ctx context.Context, key string, local router.LocalFunc, remote router.RemoteFunc) error
+
+	// Transferring returns whether key is being transferred.
+	Transferring(key string) bool
+
+	// Close stops following the ring, cancels the context of the transfers
+	// in progress and waits for them to end.
+	Close()
+}
+
+// An Option configures a Handoff created by New.
+type Option func(*handoff)
+
+// WithMode sets how calls for keys being transferred are handled, Buffer by
+// default.
+func WithMode(m Mode) Option {
+	return func(h *handoff) {
+		h.mode = m
+	}
+}
+
+// WithTimeout bounds every transfer to timeout, after which the calls for its
+// keys go to the new owner whether or not the state was transferred. Without
+// a timeout transfers are only bounded by Close.
+func WithTimeout(timeout time.Duration) Option {
+	return func(h *handoff) {
+		h.timeout = timeout
+	}
+}
+
+// WithErrorHandler makes the Handoff call fn with the ranges whose transfer
+// failed, eg. to log them. The calls for their keys go to the new owner.
+func WithErrorHandler(fn func(kr router.KeyRange, err error)) Option {
+	return func(h *handoff) {
+		h.onError = fn
+	}
+}
+
+// handoff is a Handoff following the ring of a router.
+type handoff struct {
+	router   router.Router
+	me       string
+	transfer TransferFunc
+	mode     Mode
+	timeout  time.Duration
+	onError  func(kr router.KeyRange, err error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	transfers map[*transfer]struct{}
+	closed    bool
+}
+
+// transfer is a range of keys being transferred, done is closed once it
+// ended.
+type transfer struct {
+	kr   router.KeyRange
+	done chan struct{}
+}
+
+// New creates a Handoff that calls fn for every range of keys the local node,
+// of address me as returned by ringpop's WhoAmI, loses to another node when
+// the ring of r changes, see router.Router.OnOwnershipChange.
+func New(r router.Router, me string, fn TransferFunc, opts ...Option) Handoff {
+	h := &handoff{
+		router:    r,
+		me:        me,
+		transfer:  fn,
+		transfers: make(map[*transfer]struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	r.OnOwnershipChange(h.ownershipChanged)
+	return h
+}
+
+// ownershipChanged starts the transfer of the ranges lost by the local node.
+func (h *handoff) ownershipChanged(moved []router.KeyRange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	for _, kr := range moved {
+		if kr.From != h.me || kr.To == "" || kr.To == h.me {
+			continue
+		}
+		t := &transfer{kr: kr, done: make(chan struct{})}
+		h.transfers[t] = struct{}{}
+		h.wg.Add(1)
+		go h.run(t)
+	}
+}
+
+// run transfers the range of t and ends t.
+func (h *handoff) run(t *transfer) {
+	defer h.wg.Done()
+
+	ctx := h.ctx
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	err := h.transfer(ctx, t.kr)
+
+	h.mu.Lock()
+	delete(h.transfers, t)
+	h.mu.Unlock()
+	close(t.done)
+
+	if err != nil && h.onError != nil {
+		h.onError(t.kr, err)
+	}
+}
+
+// active returns the transfer key is part of, or nil.
+func (h *handoff) active(key string) *transfer {
+	hash := h.router.KeyHash(key)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for t := range h.transfers {
+		if t.kr.ContainsHash(hash) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (h *handoff) Transferring(key string) bool {
+	return h.active(key) != nil
+}
+
+func (h *handoff) RunOnOwner(ctx context.Context, key string, local router.LocalFunc, remote router.RemoteFunc) error {
+	for t := h.active(key); t != nil; t = h.active(key) {
+		if h.mode == Forward {
+			return local(ctx)
+		}
+		select {
+		case <-t.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return h.router.RunOnOwner(ctx, key, local, remote)
+}
+
+func (h *handoff) Close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+
+	h.cancel()
+	h.wg.Wait()
+}
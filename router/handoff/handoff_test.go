@@ -0,0 +1,228 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/ringpop-go/router/routertest"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+const (
+	me    = "127.0.0.1:3000"
+	other = "127.0.0.1:3001"
+)
+
+func newTestRouter(t *testing.T, rp *routertest.Ringpop, opts ...router.Option) router.Router {
+	ch, err := tchannel.NewChannel("service", nil)
+	assert.NoError(t, err)
+	return router.NewV2(rp, &routertest.RecordingClientFactory{}, ch, opts...)
+}
+
+// movedKey returns a key rp resolves to dest.
+func movedKey(t *testing.T, rp *routertest.Ringpop, dest string) string {
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if owner, _ := rp.Lookup(key); owner == dest {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", dest)
+	return ""
+}
+
+// blockingTransfer returns a TransferFunc that records the ranges it is
+// called with and blocks until release is closed.
+func blockingTransfer(started chan<- router.KeyRange, release <-chan struct{}) TransferFunc {
+	return func(ctx context.Context, kr router.KeyRange) error {
+		select {
+		case started <- kr:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func local(ctx context.Context) error {
+	return errors.New("local")
+}
+
+func remote(ctx context.Context, client interface{}) error {
+	return errors.New("remote")
+}
+
+func TestHandoffBuffersCallsDuringTransfer(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	r := newTestRouter(t, rp)
+	started := make(chan router.KeyRange, 100)
+	release := make(chan struct{})
+	h := New(r, me, blockingTransfer(started, release))
+	defer h.Close()
+
+	rp.Join(other)
+	kr := <-started
+	assert.Equal(t, me, kr.From)
+	assert.Equal(t, other, kr.To)
+
+	key := movedKey(t, rp, other)
+	assert.True(t, h.Transferring(key), "expected the key to be transferred")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.RunOnOwner(context.Background(), key, local, remote)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the call to wait for the transfer")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	assert.EqualError(t, <-done, "remote", "expected the call to go to the new owner")
+	assert.False(t, h.Transferring(key))
+}
+
+func TestHandoffMapsKeys(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	mapper := func(key string) string {
+		return strings.SplitN(key, ":", 2)[0]
+	}
+	r := newTestRouter(t, rp, router.WithKeyMapper(mapper))
+	started := make(chan router.KeyRange, 100)
+	release := make(chan struct{})
+	h := New(r, me, blockingTransfer(started, release))
+	defer h.Close()
+	defer close(release)
+
+	rp.Join(other)
+	<-started
+
+	moved, kept := movedKey(t, rp, other), movedKey(t, rp, me)
+	assert.False(t, h.Transferring(kept))
+	assert.True(t, h.Transferring(moved+":"+kept), "expected the key to be transferred by its mapped key")
+}
+
+func TestHandoffBufferedCallsHonorContext(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	r := newTestRouter(t, rp)
+	started := make(chan router.KeyRange, 100)
+	h := New(r, me, blockingTransfer(started, make(chan struct{})))
+	defer h.Close()
+
+	rp.Join(other)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := h.RunOnOwner(ctx, movedKey(t, rp, other), local, remote)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestHandoffForwardsCallsDuringTransfer(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	r := newTestRouter(t, rp)
+	started := make(chan router.KeyRange, 100)
+	release := make(chan struct{})
+	h := New(r, me, blockingTransfer(started, release), WithMode(Forward))
+	defer h.Close()
+
+	rp.Join(other)
+	<-started
+
+	key := movedKey(t, rp, other)
+	assert.EqualError(t, h.RunOnOwner(context.Background(), key, local, remote), "local",
+		"expected the call to run on the previous owner")
+
+	close(release)
+	for h.Transferring(key) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.EqualError(t, h.RunOnOwner(context.Background(), key, local, remote), "remote")
+}
+
+func TestHandoffIgnoresGainedRanges(t *testing.T) {
+	rp := routertest.NewRingpop(me, other)
+	r := newTestRouter(t, rp)
+	h := New(r, me, func(ctx context.Context, kr router.KeyRange) error {
+		t.Errorf("unexpected transfer of %v", kr)
+		return nil
+	})
+	defer h.Close()
+
+	key := movedKey(t, rp, other)
+	rp.Fail(other)
+	assert.False(t, h.Transferring(key))
+	assert.EqualError(t, h.RunOnOwner(context.Background(), key, local, remote), "local")
+}
+
+func TestHandoffTimeout(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	r := newTestRouter(t, rp)
+	started := make(chan router.KeyRange, 100)
+	failed := make(chan error, 100)
+	h := New(r, me, blockingTransfer(started, make(chan struct{})),
+		WithTimeout(10*time.Millisecond),
+		WithErrorHandler(func(kr router.KeyRange, err error) {
+			failed <- err
+		}))
+	defer h.Close()
+
+	rp.Join(other)
+	<-started
+
+	key := movedKey(t, rp, other)
+	assert.EqualError(t, h.RunOnOwner(context.Background(), key, local, remote), "remote",
+		"expected the call to go to the new owner once the transfer timed out")
+	assert.Equal(t, context.DeadlineExceeded, <-failed)
+}
+
+func TestHandoffClose(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	r := newTestRouter(t, rp)
+	started := make(chan router.KeyRange, 100)
+	h := New(r, me, blockingTransfer(started, make(chan struct{})))
+
+	rp.Join(other)
+	<-started
+
+	key := movedKey(t, rp, other)
+	h.Close()
+	assert.False(t, h.Transferring(key), "expected the transfers to be cancelled")
+
+	n := len(started)
+	rp.Leave(other)
+	rp.Join(other)
+	assert.Equal(t, n, len(started), "expected no transfer once closed")
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go"
+)
+
+// defaultHealthTimeout bounds every ping of the health check when no timeout
+// is configured.
+const defaultHealthTimeout = time.Second
+
+// healthCheckParallelism is the number of destinations the health check pings
+// at the same time, so a slow destination does not delay the checks of the
+// others by a full timeout.
+const healthCheckParallelism = 16
+
+// startHealthCheck starts pinging the destinations of the cached clients when
+// enabled with WithHealthCheck. It stops when the router is closed.
+func (r *router) startHealthCheck() {
+	// connections of transports that cannot ping are managed by the transport
+	if _, ok := r.transport.(Pinger); !ok || r.healthInterval <= 0 {
+		return
+	}
+
+	r.healthStop = make(chan struct{})
+	ticker := r.clock.Ticker(r.healthInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.healthCheck()
+			case <-r.healthStop:
+				return
+			}
+		}
+	}()
+}
+
+// healthCheck pings the destination of every cached remote client of this
+// router once, healthCheckParallelism destinations at a time, and evicts the
+// clients of the destinations that do not respond.
+func (r *router) healthCheck() {
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+
+	entries := make(map[string]*cacheEntry)
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		if entry, ok := r.cache.get(cacheKey); ok && !entry.local {
+			entries[cacheKey] = entry
+		}
+	}
+
+	var (
+		mu        sync.Mutex
+		unhealthy = make(map[string]bool)
+		wg        sync.WaitGroup
+	)
+	slots := make(chan struct{}, healthCheckParallelism)
+	for cacheKey := range entries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(dest string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if !r.ping(dest) {
+				mu.Lock()
+				unhealthy[dest] = true
+				mu.Unlock()
+			}
+		}(strings.TrimPrefix(cacheKey, prefix))
+	}
+	wg.Wait()
+
+	for cacheKey, entry := range entries {
+		dest := strings.TrimPrefix(cacheKey, prefix)
+		if !unhealthy[dest] {
+			continue
+		}
+
+		if r.cache.removeEntry(cacheKey, entry) {
+			r.statter.IncCounter("router.healthcheck.evicted", nil, 1)
+			r.logger.WithFields(bark.Fields{
+				"dest": dest,
+			}).Debug("router evicted client of unhealthy destination")
+			r.evict([]*cacheEntry{entry})
+		}
+	}
+}
+
+// ping returns whether dest responds to a ping of the Transport within the
+// timeout of the health check.
+func (r *router) ping(dest string) bool {
+	timeout := r.healthTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	ctx, cancel := tchannel.NewContext(timeout)
+	defer cancel()
+	if err := r.transport.(Pinger).Ping(ctx, r.dialAddress(dest)); err != nil {
+		r.statter.IncCounter("router.healthcheck.failed", nil, 1)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// newHealthCheckTestRouter creates a router on which key "healthy" is owned
+// by a listening TChannel and "dead" by an address nothing listens on. The
+// health check runs on the returned mock clock.
+func newHealthCheckTestRouter(t *testing.T, opts ...Option) (*router, *clock.Mock, func()) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+
+	rp := newTestRingpop(testLookups{
+		"dead": "127.0.0.1:1",
+	})
+	rp.On("Lookup", "healthy").Return(server.PeerInfo().HostPort, nil)
+
+	c := clock.NewMock()
+	opts = append([]Option{withFactory(&closingClientFactory{}), WithClock(c), WithHealthCheck(time.Minute, time.Second)}, opts...)
+	r := newRingpopTestRouter(t, rp, opts...)
+	return r, c, func() {
+		r.channel.Close()
+		server.Close()
+	}
+}
+
+func TestHealthCheckEvictsUnhealthyClients(t *testing.T) {
+	r, _, stop := newHealthCheckTestRouter(t)
+	defer stop()
+
+	for _, key := range []string{"local", "healthy", "dead"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+	dead, _ := r.cache.get("127.0.0.1:1")
+
+	r.healthCheck()
+
+	assert.Len(t, r.cache.keys(), 2, "expected only the client of the dead destination to be evicted")
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:1")
+	assert.True(t, dead.client.(*closingClient).isClosed())
+
+	// the client is created again on the next call
+	_, err := r.GetClient("dead")
+	assert.NoError(t, err)
+	assert.Contains(t, r.cache.keys(), "127.0.0.1:1")
+}
+
+func TestHealthCheckRunsEveryInterval(t *testing.T) {
+	r, c, stop := newHealthCheckTestRouter(t)
+	defer stop()
+
+	_, err := r.GetClient("dead")
+	assert.NoError(t, err)
+
+	c.Add(time.Minute)
+	deadline := time.Now().Add(time.Second)
+	for r.cache.len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, r.cache.len(), "expected the health check to evict the client")
+
+	assert.NoError(t, r.Close(context.Background()))
+}
+
+func TestHealthCheckDisabledByDefault(t *testing.T) {
+	r := newTestRouter(t).(*router)
+	assert.Nil(t, r.healthStop)
+
+	// clients created by a RemoteDialer are not checked
+	r = newTestRouter(t, WithHealthCheck(time.Second, 0), WithRemoteDialer(func(dest string) (interface{}, error) {
+		return "dialed client", nil
+	})).(*router)
+	assert.Nil(t, r.healthStop)
+}
+
+// slowPingTransport is a memoryTransport on which the ping of 127.0.0.1:3001
+// only returns once 127.0.0.1:3002 was pinged, or fails when its context is
+// done first.
+type slowPingTransport struct {
+	memoryTransport
+	fastPinged chan struct{}
+}
+
+func (t *slowPingTransport) Ping(ctx context.Context, dest string) error {
+	if dest != "127.0.0.1:3001" {
+		close(t.fastPinged)
+		return t.memoryTransport.Ping(ctx, dest)
+	}
+	select {
+	case <-t.fastPinged:
+		return t.memoryTransport.Ping(ctx, dest)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestHealthCheckPingsConcurrently(t *testing.T) {
+	transport := &slowPingTransport{
+		memoryTransport: memoryTransport{conns: map[string]ClientConn{
+			"127.0.0.1:3001": &stubTChanClient{},
+			"127.0.0.1:3002": "raw client",
+		}},
+		fastPinged: make(chan struct{}),
+	}
+	r := newTransportTestRouter(t, nil, WithTransport(transport), WithHealthCheck(time.Minute, 100*time.Millisecond))
+	for _, key := range []string{"thrift", "raw"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+
+	r.healthCheck()
+	assert.Len(t, r.cache.keys(), 2, "expected the slow destination to be pinged next to the other")
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// A HedgedFunc makes a call through the client of one of the nodes
+// responsible for a key. It should give up when ctx is done, which happens
+// when the call to the other node won.
+type HedgedFunc func(ctx context.Context, client interface{}) (interface{}, error)
+
+type hedgedResult struct {
+	secondary bool
+	result    interface{}
+	err       error
+}
+
+// HedgedCall calls fn with the client of the owner of key and, when the call
+// has not succeeded after delay, with the client of the second node
+// responsible for key as well, as resolved by ringpop's LookupN. It returns
+// the result of the first call to succeed and cancels the context of the
+// other. A call that fails before delay makes the second call start right
+// away. When both calls fail the error of the call to the owner is returned.
+// When key has a single node, HedgedCall calls fn once.
+//
+// The client of the second node is only created when the second call starts.
+// When it cannot be created, which the router.hedge.error counter counts, the
+// call to the owner goes on alone. Like calls made through Dispatch, the calls
+// of HedgedCall, including the one that lost, are waited for by Close.
+func (r *router) HedgedCall(ctx context.Context, key string, delay time.Duration, fn HedgedFunc) (interface{}, error) {
+	end, err := r.beginDispatch()
+	if err != nil {
+		return nil, err
+	}
+	var calls sync.WaitGroup
+	defer func() {
+		// the losing call may still be running
+		go func() {
+			calls.Wait()
+			end()
+		}()
+	}()
+
+	if err := r.admit(key); err != nil {
+		return nil, err
+	}
+	dests, err := r.lookupN(ctx, key, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(dests) == 0 {
+		return nil, wrapError(ErrLookupFailed, errNoMembers)
+	}
+	primary, err := r.getClientForDest(dests[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered so the losing call can finish after HedgedCall returned
+	results := make(chan hedgedResult, 2)
+	call := func(client interface{}, secondary bool) {
+		defer calls.Done()
+		result, err := fn(ctx, client)
+		results <- hedgedResult{secondary, result, err}
+	}
+
+	calls.Add(1)
+	go call(primary, false)
+	pending := 1
+
+	var hedge <-chan time.Time
+	if len(dests) > 1 {
+		hedge = r.clock.After(delay)
+	}
+	startHedge := func() {
+		hedge = nil
+		secondary, err := r.getClientForDest(dests[1])
+		if err != nil {
+			r.statter.IncCounter("router.hedge.error", nil, 1)
+			return
+		}
+		r.statter.IncCounter("router.hedge", nil, 1)
+		calls.Add(1)
+		go call(secondary, true)
+		pending++
+	}
+
+	var primaryErr error
+	for {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if res.secondary {
+					r.statter.IncCounter("router.hedge.won", nil, 1)
+				}
+				return res.result, nil
+			}
+			if !res.secondary {
+				primaryErr = res.err
+			}
+			if hedge != nil {
+				startHedge()
+			}
+			if pending == 0 {
+				return nil, primaryErr
+			}
+		case <-hedge:
+			startHedge()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
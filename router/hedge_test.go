@@ -0,0 +1,189 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// newHedgeTestRouter creates a router on which "key" is owned by
+// 127.0.0.1:3001 with 127.0.0.1:3002 as second node, and "single" only has
+// 127.0.0.1:3001. Remote clients are the address of their destination.
+func newHedgeTestRouter(t *testing.T, opts ...Option) (*router, *clock.Mock) {
+	rp := newTestRingpop(nil)
+	rp.On("LookupN", "key", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+	rp.On("LookupN", "single", 2).Return([]string{"127.0.0.1:3001"}, nil)
+
+	c := clock.NewMock()
+	return newRingpopTestRouter(t, rp, append([]Option{WithRemoteDialer(destDialer), WithClock(c)}, opts...)...), c
+}
+
+func TestHedgedCallReturnsFastPrimary(t *testing.T) {
+	r, _ := newHedgeTestRouter(t)
+
+	var called []interface{}
+	result, err := r.HedgedCall(context.Background(), "key", time.Second, func(ctx context.Context, client interface{}) (interface{}, error) {
+		called = append(called, client)
+		return "result of " + client.(string), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "result of 127.0.0.1:3001", result)
+	assert.Equal(t, []interface{}{"127.0.0.1:3001"}, called)
+}
+
+func TestHedgedCallHedgesSlowPrimary(t *testing.T) {
+	r, c := newHedgeTestRouter(t)
+
+	started := make(chan interface{}, 2)
+	cancelled := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, err := r.HedgedCall(context.Background(), "key", time.Second, func(ctx context.Context, client interface{}) (interface{}, error) {
+			started <- client
+			if client == "127.0.0.1:3001" {
+				<-ctx.Done()
+				close(cancelled)
+				return nil, ctx.Err()
+			}
+			return "result of " + client.(string), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "result of 127.0.0.1:3002", result)
+	}()
+
+	assert.Equal(t, "127.0.0.1:3001", <-started)
+	// the timer of the hedge is set once the primary call started
+	for {
+		c.Add(time.Second)
+		select {
+		case client := <-started:
+			assert.Equal(t, "127.0.0.1:3002", client)
+			<-done
+			<-cancelled
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestHedgedCallHedgesFailedPrimary(t *testing.T) {
+	r, _ := newHedgeTestRouter(t)
+
+	result, err := r.HedgedCall(context.Background(), "key", time.Hour, func(ctx context.Context, client interface{}) (interface{}, error) {
+		if client == "127.0.0.1:3001" {
+			return nil, errors.New("primary failed")
+		}
+		return "result of " + client.(string), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "result of 127.0.0.1:3002", result)
+}
+
+func TestHedgedCallAllFail(t *testing.T) {
+	r, _ := newHedgeTestRouter(t)
+
+	_, err := r.HedgedCall(context.Background(), "key", time.Hour, func(ctx context.Context, client interface{}) (interface{}, error) {
+		return nil, errors.New(client.(string) + " failed")
+	})
+	assert.EqualError(t, err, "127.0.0.1:3001 failed", "expected the error of the owner")
+}
+
+func TestHedgedCallSingleNode(t *testing.T) {
+	r, _ := newHedgeTestRouter(t)
+
+	calls := 0
+	_, err := r.HedgedCall(context.Background(), "single", 0, func(ctx context.Context, client interface{}) (interface{}, error) {
+		calls++
+		return nil, errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, 1, calls)
+}
+
+func TestHedgedCallContextDone(t *testing.T) {
+	r, _ := newHedgeTestRouter(t)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := r.HedgedCall(ctx, "single", time.Hour, func(ctx context.Context, client interface{}) (interface{}, error) {
+		cancel()
+		<-release
+		return nil, nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestHedgedCallToleratesSecondaryCreationFailure(t *testing.T) {
+	r, _ := newHedgeTestRouter(t, WithRemoteDialer(func(dest string) (interface{}, error) {
+		if dest == "127.0.0.1:3002" {
+			return nil, errors.New("unreachable")
+		}
+		return dest, nil
+	}))
+
+	result, err := r.HedgedCall(context.Background(), "key", 0, func(ctx context.Context, client interface{}) (interface{}, error) {
+		return "result of " + client.(string), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "result of 127.0.0.1:3001", result)
+
+	_, err = r.HedgedCall(context.Background(), "key", time.Hour, func(ctx context.Context, client interface{}) (interface{}, error) {
+		return nil, errors.New(client.(string) + " failed")
+	})
+	assert.EqualError(t, err, "127.0.0.1:3001 failed", "expected the error of the owner")
+}
+
+func TestCloseWaitsForHedgedCalls(t *testing.T) {
+	r, _ := newHedgeTestRouter(t)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go r.HedgedCall(context.Background(), "single", time.Hour, func(ctx context.Context, client interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		r.Close(context.Background())
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the hedged call")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+
+	_, err := r.HedgedCall(context.Background(), "key", 0, nil)
+	assert.Equal(t, ErrRouterClosed, err)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgryski/go-farm"
+)
+
+// The dimensions of the count-min sketch the rates of the keys are estimated
+// with. The estimates overcount by at most about 3/hotKeyWidth of the keys
+// routed in a window, for 98% of the keys.
+const (
+	hotKeyDepth = 4
+	hotKeyWidth = 1024
+)
+
+// A HotKeyDetectedEvent is sent when a key, or the group of keys it belongs
+// to, is routed at least the threshold of times within a window, see
+// WithHotKeyDetection. It is sent once per window the key is hot in.
+type HotKeyDetectedEvent struct {
+	Key    string
+	Count  int
+	Window time.Duration
+}
+
+// A HotKeySplitter returns the key to route a hot key on instead, eg. the key
+// with a salt appended so its load is shared by several nodes, see
+// WithHotKeySplitter. The owners of the split keys must be able to serve the
+// key, and readers have to look for it under all its splits.
+type HotKeySplitter func(key string) string
+
+// SaltSplitter returns a HotKeySplitter that spreads a hot key round-robin
+// over salts split keys, suffixed with "#0" to "#<salts-1>".
+func SaltSplitter(salts int) HotKeySplitter {
+	var next uint64
+	return func(key string) string {
+		salt := (atomic.AddUint64(&next, 1) - 1) % uint64(salts)
+		return key + "#" + strconv.FormatUint(salt, 10)
+	}
+}
+
+// hotKeys estimates how often keys are routed in fixed windows with a
+// count-min sketch per window, and tells the keys that are hot in the current
+// or the previous window. Keys are counted with atomic operations, only the
+// start of a window takes a lock.
+type hotKeys struct {
+	threshold int
+	window    time.Duration
+	group     func(key string) string
+
+	// windows holds the *hotKeyWindows of the current and previous window,
+	// replaced under mu when a window starts.
+	mu      sync.Mutex
+	windows atomic.Value
+}
+
+// hotKeyWindows are the sketches of the current window and of the previous
+// one, which is nil before the second window.
+type hotKeyWindows struct {
+	current, previous *hotKeySketch
+}
+
+// hotKeySketch counts the keys routed in the window started at started.
+// detected flags the keys detected in the window by their cell of the first
+// row, so the rare keys sharing it with a hot key are not reported.
+type hotKeySketch struct {
+	started  time.Time
+	counts   [hotKeyDepth][hotKeyWidth]uint32
+	detected [hotKeyWidth]uint32
+}
+
+// cell returns the index of the cell of the fingerprint h1, h2 in row i. The
+// rows are indexed with double hashing of the fingerprint.
+func (s *hotKeySketch) cell(i int, h1, h2 uint32) uint32 {
+	return (h1 + uint32(i)*h2) % hotKeyWidth
+}
+
+// add counts the fingerprint h1, h2 and returns its estimated count.
+func (s *hotKeySketch) add(h1, h2 uint32) uint32 {
+	estimate := uint32(0)
+	for i := range s.counts {
+		n := atomic.AddUint32(&s.counts[i][s.cell(i, h1, h2)], 1)
+		if i == 0 || n < estimate {
+			estimate = n
+		}
+	}
+	return estimate
+}
+
+// estimate returns the estimated count of the fingerprint h1, h2.
+func (s *hotKeySketch) estimate(h1, h2 uint32) uint32 {
+	estimate := uint32(0)
+	for i := range s.counts {
+		n := atomic.LoadUint32(&s.counts[i][s.cell(i, h1, h2)])
+		if i == 0 || n < estimate {
+			estimate = n
+		}
+	}
+	return estimate
+}
+
+// detect returns whether the fingerprint h1, h2 is detected for the first
+// time in the window.
+func (s *hotKeySketch) detect(h1, h2 uint32) bool {
+	flag := &s.detected[s.cell(0, h1, h2)]
+	return atomic.LoadUint32(flag) == 0 && atomic.CompareAndSwapUint32(flag, 0, 1)
+}
+
+// hotKeyFingerprint returns the halves of the fingerprint of group the cells
+// of the sketches are indexed with.
+func hotKeyFingerprint(group string) (uint32, uint32) {
+	sum := farm.Fingerprint64([]byte(group))
+	return uint32(sum), uint32(sum >> 32)
+}
+
+func newHotKeys(threshold int, window time.Duration, group func(key string) string) *hotKeys {
+	h := &hotKeys{
+		threshold: threshold,
+		window:    window,
+		group:     group,
+	}
+	h.windows.Store(&hotKeyWindows{current: &hotKeySketch{}})
+	return h
+}
+
+// windowsAt returns the windows at now, starting a new window when the
+// current one is over.
+func (h *hotKeys) windowsAt(now time.Time) *hotKeyWindows {
+	w := h.windows.Load().(*hotKeyWindows)
+	if now.Sub(w.current.started) < h.window {
+		return w
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// another goroutine might have started the window meanwhile
+	w = h.windows.Load().(*hotKeyWindows)
+	if now.Sub(w.current.started) >= h.window {
+		w = &hotKeyWindows{current: &hotKeySketch{started: now}, previous: w.current}
+		h.windows.Store(w)
+	}
+	return w
+}
+
+// observe counts a routing of key at now. It returns the group of key,
+// whether it is hot and, when it just turned hot, its estimated count.
+func (h *hotKeys) observe(key string, now time.Time) (group string, hot bool, detected int) {
+	group = key
+	if h.group != nil {
+		if g := h.group(key); g != "" {
+			group = g
+		}
+	}
+	h1, h2 := hotKeyFingerprint(group)
+
+	w := h.windowsAt(now)
+	threshold := uint32(0)
+	if h.threshold > 0 {
+		threshold = uint32(h.threshold)
+	}
+	if estimate := w.current.add(h1, h2); estimate >= threshold {
+		if w.current.detect(h1, h2) {
+			detected = int(estimate)
+		}
+		return group, true, detected
+	}
+	return group, w.previous != nil && w.previous.estimate(h1, h2) >= threshold, 0
+}
+
+// routedKey counts a routing of key when hot key detection is enabled, and
+// returns the key to route it on: its split when it is hot and the router has
+// a HotKeySplitter, and key otherwise.
+func (r *router) routedKey(key string) string {
+	if r.hotKeyStats == nil {
+		return key
+	}
+
+	group, hot, detected := r.hotKeyStats.observe(key, r.clock.Now())
+	if detected > 0 {
+		r.statter.IncCounter("router.hotkey.detected", nil, 1)
+		r.logger.WithField("key", group).Warn("router detected hot key")
+		r.emit(HotKeyDetectedEvent{Key: group, Count: detected, Window: r.hotKeyStats.window})
+	}
+	if !hot || r.hotKeySplit == nil {
+		return key
+	}
+	r.statter.IncCounter("router.hotkey.split", nil, 1)
+	return r.hotKeySplit(key)
+}
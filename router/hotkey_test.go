@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotKeys(t *testing.T) {
+	h := newHotKeys(3, time.Second, PrefixTenant("/"))
+	now := time.Unix(0, 0)
+
+	var detected []int
+	for i := 0; i < 4; i++ {
+		group, hot, count := h.observe("acme/orders/42", now)
+		assert.Equal(t, "acme", group)
+		assert.Equal(t, i >= 2, hot)
+		detected = append(detected, count)
+	}
+	assert.Equal(t, []int{0, 0, 3, 0}, detected, "expected the key to be detected once per window")
+
+	group, hot, _ := h.observe("orders", now)
+	assert.Equal(t, "orders", group, "expected keys without a group to count on their own")
+	assert.False(t, hot)
+
+	// hot keys stay hot for the next window
+	_, hot, count := h.observe("acme/orders/43", now.Add(time.Second))
+	assert.True(t, hot)
+	assert.Equal(t, 0, count)
+
+	_, hot, _ = h.observe("acme/orders/43", now.Add(2*time.Second))
+	assert.False(t, hot)
+}
+
+func TestHotKeysConcurrent(t *testing.T) {
+	h := newHotKeys(100, time.Minute, nil)
+	now := time.Unix(0, 0)
+
+	var wg sync.WaitGroup
+	detections := make(chan int, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if _, _, count := h.observe("key", now); count > 0 {
+					detections <- count
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(detections)
+
+	var counts []int
+	for count := range detections {
+		counts = append(counts, count)
+	}
+	assert.Len(t, counts, 1, "expected the key to be detected once")
+	assert.Equal(t, 800, int(h.windowsAt(now).current.estimate(hotKeyFingerprint("key"))))
+}
+
+func TestHotKeyDetection(t *testing.T) {
+	toLocal := func(key string) string { return "local" }
+	r, _ := newSelfTestRouter(t, nil, WithHotKeyDetection(2, time.Minute, nil), WithHotKeySplitter(toLocal))
+	l := make(chanListener, 1)
+	r.RegisterListener(l)
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote client", client)
+
+	client, err = r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client, "expected the hot key to be split")
+
+	for {
+		if event, ok := nextEvent(t, l).(HotKeyDetectedEvent); ok {
+			assert.Equal(t, HotKeyDetectedEvent{Key: "remote", Count: 2, Window: time.Minute}, event)
+			break
+		}
+	}
+}
+
+func TestSaltSplitter(t *testing.T) {
+	split := SaltSplitter(2)
+	assert.Equal(t, "k#0", split("k"))
+	assert.Equal(t, "k#1", split("k"))
+	assert.Equal(t, "k#0", split("k"))
+}
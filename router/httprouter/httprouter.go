@@ -0,0 +1,229 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package httprouter routes HTTP requests to the ringpop member that owns
+// their key. It is the HTTP counterpart of the forwarding server of the
+// router package: requests for keys owned by this node are served by a local
+// http.Handler, all others are reverse-proxied to the HTTP server of their
+// owner.
+package httprouter
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uber/ringpop-go"
+)
+
+// forwardedHeader marks requests that were proxied by a handler already, so
+// they are never forwarded twice, eg. while the ring is converging. Its value
+// is the address of the member that forwarded the request.
+const forwardedHeader = "Ringpop-Forwarded"
+
+// KeyFunc returns the key that determines which node handles a request. An
+// empty key makes the request be handled locally.
+type KeyFunc func(r *http.Request) (string, error)
+
+// HeaderKey is a KeyFunc that routes on the value of the header name.
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		return r.Header.Get(name), nil
+	}
+}
+
+// PathKey is a KeyFunc that routes on the segment at index of the path of
+// the URL, eg. PathKey(1) routes "/users/42/orders" on "42".
+func PathKey(index int) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if index < 0 || index >= len(segments) {
+			return "", nil
+		}
+		return segments[index], nil
+	}
+}
+
+// AddressFunc returns the base URL of the HTTP server of the ringpop member
+// at address dest, which is the host:port of its TChannel.
+type AddressFunc func(dest string) (*url.URL, error)
+
+// Port is an AddressFunc for clusters in which every member serves HTTP on
+// the same port of the host of its TChannel.
+func Port(port int) AddressFunc {
+	return func(dest string) (*url.URL, error) {
+		host := dest
+		if i := strings.LastIndex(dest, ":"); i >= 0 {
+			host = dest[:i]
+		}
+		return &url.URL{
+			Scheme: "http",
+			Host:   host + ":" + strconv.Itoa(port),
+		}, nil
+	}
+}
+
+// handler is a http.Handler that serves requests for keys owned by this node
+// and reverse-proxies all others to their owner.
+type handler struct {
+	ringpop   ringpop.Interface
+	local     http.Handler
+	key       KeyFunc
+	address   AddressFunc
+	transport http.RoundTripper
+
+	proxiesMu sync.Mutex
+	proxies   map[string]*httputil.ReverseProxy
+}
+
+// An Option configures a handler created by New.
+type Option func(*handler)
+
+// WithTransport makes the handler proxy requests with t instead of
+// http.DefaultTransport.
+func WithTransport(t http.RoundTripper) Option {
+	return func(h *handler) {
+		h.transport = t
+	}
+}
+
+// New returns a http.Handler that serves every request on the node that owns
+// the key returned by key. Requests owned by this node are served by local,
+// others are reverse-proxied to the URL returned by address for their owner:
+//
+//     http.Handle("/users/", httprouter.New(rp, users, httprouter.PathKey(1), httprouter.Port(8080)))
+//
+// Requests are forwarded at most once, a request that was already forwarded
+// is served by local. Only requests forwarded by a reachable member of the
+// ring, connecting from the host of its address, count as forwarded: the
+// header marking forwarded requests is removed from all others, so external
+// callers cannot force a request to be served by a node that does not own its
+// key. The handler responds with 400 Bad Request when key
+// fails, with 503 Service Unavailable when ringpop cannot resolve the owner
+// and with 502 Bad Gateway when the owner cannot be reached.
+func New(rp ringpop.Interface, local http.Handler, key KeyFunc, address AddressFunc, opts ...Option) http.Handler {
+	h := &handler{
+		ringpop: rp,
+		local:   local,
+		key:     key,
+		address: address,
+		proxies: make(map[string]*httputil.ReverseProxy),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if from := r.Header.Get(forwardedHeader); from != "" {
+		if h.forwardedBy(from, r) {
+			h.local.ServeHTTP(w, r)
+			return
+		}
+		r.Header.Del(forwardedHeader)
+	}
+
+	key, err := h.key(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if key == "" {
+		h.local.ServeHTTP(w, r)
+		return
+	}
+
+	dest, err := h.ringpop.Lookup(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	me, err := h.ringpop.WhoAmI()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if dest == me {
+		h.local.ServeHTTP(w, r)
+		return
+	}
+
+	proxy, err := h.proxy(dest, me)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// forwardedBy returns whether r was forwarded by the member from: from is a
+// reachable member of the ring and r comes from its host.
+func (h *handler) forwardedBy(from string, r *http.Request) bool {
+	memberHost, _, err := net.SplitHostPort(from)
+	if err != nil {
+		return false
+	}
+	remoteHost, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil || remoteHost != memberHost {
+		return false
+	}
+
+	members, err := h.ringpop.GetReachableMembers()
+	if err != nil {
+		return false
+	}
+	for _, member := range members {
+		if member == from {
+			return true
+		}
+	}
+	return false
+}
+
+// proxy returns the reverse proxy that forwards requests to the HTTP server
+// of dest on behalf of me, creating it on the first request for dest.
+func (h *handler) proxy(dest, me string) (*httputil.ReverseProxy, error) {
+	h.proxiesMu.Lock()
+	defer h.proxiesMu.Unlock()
+
+	if proxy, ok := h.proxies[dest]; ok {
+		return proxy, nil
+	}
+	base, err := h.address(dest)
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = base.Scheme
+			r.URL.Host = base.Host
+			r.URL.Path = strings.TrimSuffix(base.Path, "/") + r.URL.Path
+			r.Header.Set(forwardedHeader, me)
+		},
+		Transport: h.transport,
+	}
+	h.proxies[dest] = proxy
+	return proxy, nil
+}
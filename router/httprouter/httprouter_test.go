@@ -0,0 +1,196 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package httprouter
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+// respond writes name and the path of the request as the body of every
+// response.
+func respond(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Forwarded-By", r.Header.Get(forwardedHeader))
+		w.Write([]byte(name + " " + r.URL.Path))
+	})
+}
+
+// newTestHandler creates a handler on which key "local" is owned by this
+// node, "remote" by a node served by a test server and "unreachable" by a
+// node of which the HTTP server is down.
+func newTestHandler(t *testing.T, key KeyFunc) (http.Handler, func()) {
+	remote := httptest.NewServer(respond("remote"))
+
+	rp := &mocks.Ringpop{}
+	rp.On("WhoAmI").Return("127.0.0.1:3000", nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+	rp.On("Lookup", "local").Return("127.0.0.1:3000", nil)
+	rp.On("Lookup", "remote").Return("127.0.0.1:3001", nil)
+	rp.On("Lookup", "unreachable").Return("127.0.0.1:3002", nil)
+	rp.On("Lookup", "error").Return("", errors.New("ringpop not ready"))
+
+	address := func(dest string) (*url.URL, error) {
+		switch dest {
+		case "127.0.0.1:3001":
+			return url.Parse(remote.URL)
+		case "127.0.0.1:3002":
+			return url.Parse("http://127.0.0.1:1")
+		}
+		return nil, errors.New("unknown member")
+	}
+
+	return New(rp, respond("local"), key, address), remote.Close
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerServesLocalKeysLocally(t *testing.T) {
+	h, stop := newTestHandler(t, HeaderKey("X-Key"))
+	defer stop()
+
+	r, _ := http.NewRequest("GET", "http://node/path", nil)
+	r.Header.Set("X-Key", "local")
+	w := serve(h, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "local /path", w.Body.String())
+
+	// requests without key are served locally too
+	r, _ = http.NewRequest("GET", "http://node/path", nil)
+	assert.Equal(t, "local /path", serve(h, r).Body.String())
+}
+
+func TestHandlerProxiesRemoteKeys(t *testing.T) {
+	h, stop := newTestHandler(t, HeaderKey("X-Key"))
+	defer stop()
+
+	r, _ := http.NewRequest("GET", "http://node/path", nil)
+	r.Header.Set("X-Key", "remote")
+	w := serve(h, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "remote /path", w.Body.String())
+	assert.Equal(t, "127.0.0.1:3000", w.Header().Get("Forwarded-By"), "expected the forwarding member in the header")
+
+	// the same proxy serves every request to a destination
+	assert.Equal(t, "remote /path", serve(h, r).Body.String())
+	assert.Len(t, h.(*handler).proxies, 1)
+}
+
+func TestHandlerForwardsOnce(t *testing.T) {
+	h, stop := newTestHandler(t, HeaderKey("X-Key"))
+	defer stop()
+
+	r, _ := http.NewRequest("GET", "http://node/path", nil)
+	r.Header.Set("X-Key", "remote")
+	r.Header.Set(forwardedHeader, "127.0.0.1:3001")
+	r.RemoteAddr = "127.0.0.1:52000"
+	assert.Equal(t, "local /path", serve(h, r).Body.String())
+}
+
+func TestHandlerIgnoresForeignForwardedHeaders(t *testing.T) {
+	h, stop := newTestHandler(t, HeaderKey("X-Key"))
+	defer stop()
+
+	for _, c := range []struct{ from, remoteAddr string }{
+		{"true", "127.0.0.1:52000"},
+		{"127.0.0.1:4000", "127.0.0.1:52000"},
+		{"127.0.0.1:3001", "10.0.0.1:52000"},
+	} {
+		r, _ := http.NewRequest("GET", "http://node/path", nil)
+		r.Header.Set("X-Key", "remote")
+		r.Header.Set(forwardedHeader, c.from)
+		r.RemoteAddr = c.remoteAddr
+		w := serve(h, r)
+		assert.Equal(t, "remote /path", w.Body.String(), "expected %v not to count as forwarded", c)
+		assert.Equal(t, "127.0.0.1:3000", w.Header().Get("Forwarded-By"))
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	failing := func(r *http.Request) (string, error) {
+		return "", errors.New("no key")
+	}
+	h, stop := newTestHandler(t, failing)
+	defer stop()
+
+	r, _ := http.NewRequest("GET", "http://node/path", nil)
+	assert.Equal(t, http.StatusBadRequest, serve(h, r).Code)
+
+	h, stop = newTestHandler(t, HeaderKey("X-Key"))
+	defer stop()
+
+	r.Header.Set("X-Key", "error")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(h, r).Code)
+
+	r.Header.Set("X-Key", "unreachable")
+	assert.Equal(t, http.StatusBadGateway, serve(h, r).Code)
+}
+
+func TestPathKey(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://node/users/42/orders", nil)
+
+	key, err := PathKey(1)(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", key)
+
+	key, _ = PathKey(5)(r)
+	assert.Equal(t, "", key)
+}
+
+func TestPort(t *testing.T) {
+	u, err := Port(8080)("10.0.0.1:3000")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://10.0.0.1:8080", u.String())
+}
+
+func TestWithTransport(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("WhoAmI").Return("127.0.0.1:3000", nil)
+	rp.On("Lookup", "remote").Return("127.0.0.1:3001", nil)
+
+	var proxied []string
+	transport := roundTripper(func(r *http.Request) (*http.Response, error) {
+		proxied = append(proxied, r.URL.String())
+		return nil, errors.New("transport down")
+	})
+	h := New(rp, respond("local"), HeaderKey("X-Key"), Port(8080), WithTransport(transport))
+
+	r, _ := http.NewRequest("GET", "http://node/path", nil)
+	r.Header.Set("X-Key", "remote")
+	assert.Equal(t, http.StatusBadGateway, serve(h, r).Code)
+	assert.Equal(t, []string{"http://127.0.0.1:8080/path"}, proxied)
+}
+
+type roundTripper func(r *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
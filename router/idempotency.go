@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// HeaderIdempotencyKey is the header of a call that holds its idempotency
+// key. Every attempt of a call that is retried or forwarded carries the same
+// key, which lets the handler recognize a call it processed already, eg. a
+// write retried against the new owner of a key while ownership moved.
+const HeaderIdempotencyKey = "ringpop-idempotency-key"
+
+// IdempotencyKey returns the idempotency key of the call of ctx, empty when
+// it has none.
+func IdempotencyKey(ctx thrift.Context) string {
+	return ctx.Headers()[HeaderIdempotencyKey]
+}
+
+// WithIdempotencyKey returns ctx with a new idempotency key, or ctx itself
+// when it carries one already. Calls retried by Dispatch share the key of the
+// context they are made with, so create it before dispatching:
+//
+//     ctx = router.WithIdempotencyKey(ctx)
+//     err := r.Dispatch(key, func(client interface{}) error {
+//         return client.(kv.TChanKV).Set(ctx, key, value)
+//     })
+func WithIdempotencyKey(ctx thrift.Context) thrift.Context {
+	if IdempotencyKey(ctx) != "" {
+		return ctx
+	}
+
+	headers := make(map[string]string, len(ctx.Headers())+1)
+	for k, v := range ctx.Headers() {
+		headers[k] = v
+	}
+	headers[HeaderIdempotencyKey] = newIdempotencyKey()
+	return thrift.WithHeaders(ctx, headers)
+}
+
+// IdempotencyKeys is the Interceptor that gives the calls without an
+// idempotency key a new one, so the retries TChannel makes of a call carry
+// the key of the call, see WithInterceptors. The key is the one of ctx when
+// it has one: RunOnOwner keys its context once for all of its attempts, and
+// the calls made through Dispatch share the key of a context created with
+// WithIdempotencyKey before dispatching.
+func IdempotencyKeys(ctx thrift.Context, call *Call, next func(ctx thrift.Context) (bool, error)) (bool, error) {
+	return next(WithIdempotencyKey(ctx))
+}
+
+// newIdempotencyKey returns a random idempotency key.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	// crypto/rand only fails when the system has no source of randomness
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+func TestWithIdempotencyKey(t *testing.T) {
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+	ctx = thrift.WithHeaders(ctx, map[string]string{"caller": "test"})
+	assert.Empty(t, IdempotencyKey(ctx))
+
+	keyed := WithIdempotencyKey(ctx)
+	key := IdempotencyKey(keyed)
+	assert.Len(t, key, 32)
+	assert.Equal(t, "test", keyed.Headers()["caller"], "expected the headers to be kept")
+	assert.Equal(t, key, IdempotencyKey(WithIdempotencyKey(keyed)), "expected the key to be kept")
+
+	assert.NotEqual(t, key, IdempotencyKey(WithIdempotencyKey(ctx)), "expected keys to be unique")
+}
+
+func TestIdempotencyKeysInterceptor(t *testing.T) {
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+
+	var keys []string
+	next := func(ctx thrift.Context) (bool, error) {
+		keys = append(keys, IdempotencyKey(ctx))
+		return true, nil
+	}
+	_, err := IdempotencyKeys(ctx, &Call{}, next)
+	assert.NoError(t, err)
+	_, err = IdempotencyKeys(WithIdempotencyKey(ctx), &Call{}, next)
+	assert.NoError(t, err)
+
+	assert.Len(t, keys, 2)
+	assert.Len(t, keys[0], 32, "expected calls without a key to get one")
+	assert.NotEqual(t, keys[0], keys[1])
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// A Call describes a call made through a remote client.
+type Call struct {
+	// Destination is the address of the node the call is made to.
+	Destination string
+
+	Service string
+	Method  string
+
+	Request  athrift.TStruct
+	Response athrift.TStruct
+}
+
+// An Interceptor wraps every call made through the remote clients created by
+// the router, see WithInterceptors. It makes the call by invoking next,
+// possibly with a context derived from ctx, eg. to add headers or a default
+// deadline, and returns its result, which it can inspect or replace:
+//
+//     func timing(ctx thrift.Context, call *router.Call, next func(thrift.Context) (bool, error)) (bool, error) {
+//         start := time.Now()
+//         success, err := next(ctx)
+//         log.Printf("%s::%s to %s took %v: %v", call.Service, call.Method, call.Destination, time.Since(start), err)
+//         return success, err
+//     }
+type Interceptor func(ctx thrift.Context, call *Call, next func(ctx thrift.Context) (bool, error)) (bool, error)
+
+// interceptedClient is the TChanClient handed to the ClientFactory for remote
+// destinations when interceptors are registered. It passes every call through
+// the interceptors, the first one being the outermost.
+type interceptedClient struct {
+	thrift.TChanClient
+
+	dest         string
+	interceptors []Interceptor
+}
+
+func (c *interceptedClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	call := &Call{
+		Destination: c.dest,
+		Service:     serviceName,
+		Method:      methodName,
+		Request:     req,
+		Response:    resp,
+	}
+	return c.invoke(ctx, call, 0)
+}
+
+// invoke passes call to the interceptor at index i, or makes the call when
+// all interceptors have been passed.
+func (c *interceptedClient) invoke(ctx thrift.Context, call *Call, i int) (bool, error) {
+	if i == len(c.interceptors) {
+		return c.TChanClient.Call(ctx, call.Service, call.Method, call.Request, call.Response)
+	}
+	return c.interceptors[i](ctx, call, func(ctx thrift.Context) (bool, error) {
+		return c.invoke(ctx, call, i+1)
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// headerStubClient records the headers of the context of the last call.
+type headerStubClient struct {
+	stubTChanClient
+	headers map[string]string
+}
+
+func (c *headerStubClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	c.headers = ctx.Headers()
+	return c.stubTChanClient.Call(ctx, serviceName, methodName, req, resp)
+}
+
+func TestInterceptors(t *testing.T) {
+	var order []string
+	var seen *Call
+	outer := func(ctx thrift.Context, call *Call, next func(thrift.Context) (bool, error)) (bool, error) {
+		order = append(order, "outer")
+		seen = call
+		return next(thrift.WithHeaders(ctx, map[string]string{"auth": "token"}))
+	}
+	inner := func(ctx thrift.Context, call *Call, next func(thrift.Context) (bool, error)) (bool, error) {
+		order = append(order, "inner")
+		success, err := next(ctx)
+		order = append(order, "inner done")
+		return success, err
+	}
+	r, _ := newBreakerTestRouter(t, WithInterceptors(outer), WithInterceptors(inner))
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	ic, ok := client.(*interceptedClient)
+	if !assert.True(t, ok, "expected the remote client to be intercepted") {
+		return
+	}
+	stub := &headerStubClient{}
+	ic.TChanClient = stub
+
+	assert.NoError(t, call(ic))
+	assert.Equal(t, []string{"outer", "inner", "inner done"}, order)
+	assert.Equal(t, &Call{Destination: "127.0.0.1:3001", Service: "remote", Method: "Ping"}, seen)
+	assert.Equal(t, map[string]string{"auth": "token"}, stub.headers)
+}
+
+func TestInterceptorSeesErrors(t *testing.T) {
+	var seen error
+	intercept := func(ctx thrift.Context, call *Call, next func(thrift.Context) (bool, error)) (bool, error) {
+		success, err := next(ctx)
+		seen = err
+		return success, err
+	}
+	r, _ := newBreakerTestRouter(t, WithInterceptors(intercept), WithCircuitBreaker(1, time.Minute))
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	ic := client.(*interceptedClient)
+	ic.TChanClient.(*breakerClient).TChanClient = &stubTChanClient{err: errors.New("connection refused")}
+
+	assert.EqualError(t, call(ic), "connection refused")
+	assert.EqualError(t, seen, "connection refused")
+
+	assert.Equal(t, ErrCircuitOpen, call(ic))
+	assert.Equal(t, ErrCircuitOpen, seen, "expected calls rejected by the breaker to be intercepted")
+}
+
+func TestNoInterceptorsByDefault(t *testing.T) {
+	r, _ := newBreakerTestRouter(t)
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	_, ok := client.(*interceptedClient)
+	assert.False(t, ok)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// lockedSource is a rand.Source that is safe for concurrent use, which the
+// sources of math/rand are not.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	s.src.Seed(seed)
+	s.mu.Unlock()
+}
+
+// newRand returns a rand.Rand over src that is safe for concurrent use.
+func newRand(src rand.Source) *rand.Rand {
+	return rand.New(&lockedSource{src: src})
+}
+
+// jitter returns d reduced by a random share of up to fraction of it, drawn
+// from the random source of the router, see WithRandSource.
+func (r *router) jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return d - time.Duration(fraction*r.rand.Float64()*float64(d))
+}
+
+// retryBackoff returns the time to wait before the given retry of p, counting
+// from 1, with the jitter of p applied.
+func (r *router) retryBackoff(p *RetryPolicy, retry int) time.Duration {
+	return r.jitter(p.backoff(retry), p.Jitter)
+}
+
+// waitRetry waits the backoff of the given retry of p, and returns the error
+// of ctx when ctx is done first.
+func (r *router) waitRetry(ctx context.Context, p *RetryPolicy, retry int) error {
+	d := r.retryBackoff(p, retry)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-r.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
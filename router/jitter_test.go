@@ -0,0 +1,67 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithClock(t *testing.T) {
+	c := clock.NewMock()
+	r := newTestRouter(t, WithClock(c), WithClientIdleTimeout(time.Minute)).(*router)
+	assert.True(t, r.clock == c, "expected the router to use the clock")
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	entry, ok := r.cache.get("127.0.0.1:3001")
+	if assert.True(t, ok, "expected the client to be cached") {
+		assert.False(t, r.expired(entry, c.Now()))
+		c.Add(2 * time.Minute)
+		assert.True(t, r.expired(entry, c.Now()), "expected the client to expire on the clock")
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	p := &RetryPolicy{Backoff: 100 * time.Millisecond, Jitter: 0.5}
+	r1 := newTestRouter(t, WithRandSource(rand.NewSource(42))).(*router)
+	r2 := newTestRouter(t, WithRandSource(rand.NewSource(42))).(*router)
+
+	for retry := 1; retry <= 10; retry++ {
+		d := r1.retryBackoff(p, retry)
+		assert.True(t, d > p.backoff(retry)/2 && d <= p.backoff(retry), "unexpected backoff %v for retry %d", d, retry)
+		assert.Equal(t, d, r2.retryBackoff(p, retry), "expected the same source to give the same backoffs")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	r := newTestRouter(t, WithRandSource(rand.NewSource(1))).(*router)
+	assert.Equal(t, time.Second, r.jitter(time.Second, 0), "expected no jitter")
+	assert.Equal(t, time.Duration(0), r.jitter(0, 0.5))
+	for i := 0; i < 100; i++ {
+		d := r.jitter(time.Second, 2)
+		assert.True(t, d >= 0 && d <= time.Second, "expected the jitter to be capped to the backoff, got %v", d)
+	}
+}
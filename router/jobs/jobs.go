@@ -0,0 +1,322 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package jobs runs recurring jobs on exactly one node of the ring of a
+// router. Every job is owned by the node that owns its name on the ring, runs
+// only there and moves to its new owner when the ring changes. The runs of a
+// job are given a Lease that fences off the previous owners: its context is
+// cancelled once the local node loses the job, and Check tells a run whether
+// its lease is still current before it makes changes.
+package jobs
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/uber/ringpop-go/router"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrDuplicateJob is returned by Schedule for a name already scheduled.
+	ErrDuplicateJob = errors.New("job is already scheduled")
+
+	// ErrLeaseLost is returned by Check for a lease the local node no longer
+	// holds.
+	ErrLeaseLost = errors.New("lease of the job was lost")
+
+	// ErrSchedulerClosed is returned by Schedule once the Scheduler is closed.
+	ErrSchedulerClosed = errors.New("scheduler is closed")
+)
+
+// A Lease is the ownership of a job by the local node, from the time it
+// acquired the job until it loses it.
+type Lease struct {
+	// Job is the name of the job.
+	Job string
+
+	// Owner is the address of the local node.
+	Owner string
+
+	// Checksum is the checksum of the ring the job was acquired on.
+	Checksum uint32
+
+	// Token is the fencing token of the lease, the time the job was acquired
+	// in nanoseconds since the Unix epoch. It increases with every lease of
+	// the local node, and with the leases of all nodes as long as their
+	// clocks differ by less than the time between two changes of the owner,
+	// so stores can reject the writes of leases older than the last they saw.
+	Token int64
+}
+
+// A JobFunc runs a job once with the lease of the local node, and should give
+// up when ctx is done, which happens once the local node loses the job.
+type JobFunc func(ctx context.Context, lease Lease) error
+
+// A Scheduler runs the jobs owned by the local node.
+type Scheduler interface {
+	// Schedule runs fn every interval while the local node owns the job
+	// name.
+	Schedule(name string, interval time.Duration, fn JobFunc) error
+
+	// Unschedule stops running the job name, cancelling the context of its
+	// run in progress.
+	Unschedule(name string)
+
+	// Owned returns the names of the jobs owned by the local node, in
+	// increasing order.
+	Owned() []string
+
+	// Check returns ErrLeaseLost when lease is no longer held by the local
+	// node, because the job moved to another node since or was unscheduled.
+	// The owner of the job is resolved again, so leases are fenced off even
+	// before the change of the ring is delivered.
+	Check(lease Lease) error
+
+	// Close stops running all jobs, cancels the context of the runs in
+	// progress and waits for them to end.
+	Close()
+}
+
+// An Option configures a Scheduler created by New.
+type Option func(*scheduler)
+
+// WithKeyPrefix makes the Scheduler place job name on the ring under key
+// prefix followed by name instead of "job-" followed by name.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *scheduler) {
+		s.prefix = prefix
+	}
+}
+
+// WithErrorHandler makes the Scheduler call fn with the errors of the runs of
+// jobs, eg. to log them. Failed runs are not retried before the next
+// interval.
+func WithErrorHandler(fn func(name string, err error)) Option {
+	return func(s *scheduler) {
+		s.onError = fn
+	}
+}
+
+// job is a scheduled job, of which lease is set while the local node owns
+// it.
+type job struct {
+	name     string
+	interval time.Duration
+	fn       JobFunc
+
+	lease  *Lease
+	cancel context.CancelFunc
+}
+
+// scheduler is a Scheduler of which the ownership of jobs follows the ring of
+// a router.
+type scheduler struct {
+	router  router.Router
+	prefix  string
+	onError func(name string, err error)
+	clock   clock.Clock
+	wg      sync.WaitGroup
+
+	mu        sync.Mutex
+	jobs      map[string]*job
+	lastToken int64
+	closed    bool
+}
+
+// New creates a Scheduler that runs the jobs owned by the local node on the
+// ring of r. Ownership is reevaluated every time the ring of r changes, see
+// router.Router.OnOwnershipChange.
+func New(r router.Router, opts ...Option) Scheduler {
+	s := &scheduler{
+		router: r,
+		prefix: "job-",
+		clock:  clock.New(),
+		jobs:   make(map[string]*job),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	r.OnOwnershipChange(func(moved []router.KeyRange) {
+		s.reconcile()
+	})
+	return s
+}
+
+// key returns the key under which job name is placed on the ring.
+func (s *scheduler) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *scheduler) Schedule(name string, interval time.Duration, fn JobFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrSchedulerClosed
+	}
+	if _, ok := s.jobs[name]; ok {
+		return ErrDuplicateJob
+	}
+	j := &job{name: name, interval: interval, fn: fn}
+	s.jobs[name] = j
+	s.reconcileJob(j)
+	return nil
+}
+
+func (s *scheduler) Unschedule(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j, ok := s.jobs[name]; ok {
+		s.release(j)
+		delete(s.jobs, name)
+	}
+}
+
+func (s *scheduler) Owned() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var owned []string
+	for name, j := range s.jobs {
+		if j.lease != nil {
+			owned = append(owned, name)
+		}
+	}
+	sort.Strings(owned)
+	return owned
+}
+
+func (s *scheduler) Check(lease Lease) error {
+	s.mu.Lock()
+	j, ok := s.jobs[lease.Job]
+	current := ok && j.lease != nil && *j.lease == lease
+	s.mu.Unlock()
+	if !current {
+		return ErrLeaseLost
+	}
+
+	dest, err := s.router.Resolve(s.key(lease.Job))
+	if err != nil {
+		return err
+	}
+	if !dest.Local {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *scheduler) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for _, j := range s.jobs {
+		s.release(j)
+	}
+	s.jobs = make(map[string]*job)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// reconcile resolves the owner of every job, starting the jobs acquired by
+// the local node and stopping those it lost.
+func (s *scheduler) reconcile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	for _, j := range s.jobs {
+		s.reconcileJob(j)
+	}
+}
+
+// reconcileJob starts j when the local node acquired it and stops it when
+// the local node lost it. Jobs that fail to resolve keep their previous
+// ownership. mu must be held.
+func (s *scheduler) reconcileJob(j *job) {
+	dest, err := s.router.Resolve(s.key(j.name))
+	if err != nil {
+		return
+	}
+	switch {
+	case dest.Local && j.lease == nil:
+		s.acquire(j, dest)
+	case !dest.Local && j.lease != nil:
+		s.release(j)
+	}
+}
+
+// acquire takes the lease of j for the local node, at dest, and starts
+// running j. mu must be held.
+func (s *scheduler) acquire(j *job, dest router.Destination) {
+	token := s.clock.Now().UnixNano()
+	if token <= s.lastToken {
+		token = s.lastToken + 1
+	}
+	s.lastToken = token
+
+	lease := Lease{
+		Job:      j.name,
+		Owner:    dest.Address,
+		Checksum: dest.Checksum,
+		Token:    token,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.lease, j.cancel = &lease, cancel
+
+	s.wg.Add(1)
+	go s.run(ctx, j, lease, s.clock.Ticker(j.interval))
+}
+
+// release gives up the lease of j and cancels its runs. mu must be held.
+func (s *scheduler) release(j *job) {
+	if j.lease == nil {
+		return
+	}
+	j.cancel()
+	j.lease, j.cancel = nil, nil
+}
+
+// run runs j with lease on every tick of ticker until ctx is done.
+func (s *scheduler) run(ctx context.Context, j *job, lease Lease, ticker *clock.Ticker) {
+	defer s.wg.Done()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Check(lease); err != nil {
+			continue
+		}
+		if err := j.fn(ctx, lease); err != nil && s.onError != nil {
+			s.onError(j.name, err)
+		}
+	}
+}
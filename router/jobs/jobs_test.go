@@ -0,0 +1,188 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/ringpop-go/router/routertest"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+const (
+	me    = "127.0.0.1:3000"
+	other = "127.0.0.1:3001"
+)
+
+func newTestScheduler(t *testing.T, rp *routertest.Ringpop, opts ...Option) (*scheduler, *clock.Mock) {
+	ch, err := tchannel.NewChannel("service", nil)
+	assert.NoError(t, err)
+	s := New(router.NewV2(rp, &routertest.RecordingClientFactory{}, ch), opts...).(*scheduler)
+	c := clock.NewMock()
+	s.clock = c
+	return s, c
+}
+
+// movingJob returns the name of a job that moves to other once it joins the
+// ring of me.
+func movingJob(t *testing.T) string {
+	rp := routertest.NewRingpop(me, other)
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("job%d", i)
+		if owner, _ := rp.Lookup("job-" + name); owner == other {
+			return name
+		}
+	}
+	t.Fatalf("no job owned by %s", other)
+	return ""
+}
+
+// leases returns a JobFunc that sends the leases it runs with on the returned
+// channel.
+func leases() (JobFunc, chan Lease) {
+	runs := make(chan Lease, 10)
+	return func(ctx context.Context, lease Lease) error {
+		runs <- lease
+		return nil
+	}, runs
+}
+
+func TestSchedulerRunsOwnedJobs(t *testing.T) {
+	s, c := newTestScheduler(t, routertest.NewRingpop(me))
+	defer s.Close()
+
+	fn, runs := leases()
+	assert.NoError(t, s.Schedule("cleanup", time.Minute, fn))
+	assert.Equal(t, ErrDuplicateJob, s.Schedule("cleanup", time.Minute, fn))
+	assert.Equal(t, []string{"cleanup"}, s.Owned())
+
+	c.Add(time.Minute)
+	lease := <-runs
+	assert.Equal(t, "cleanup", lease.Job)
+	assert.Equal(t, me, lease.Owner)
+	assert.True(t, lease.Token > 0, "expected a fencing token")
+	assert.NoError(t, s.Check(lease))
+
+	c.Add(time.Minute)
+	assert.Equal(t, lease, <-runs, "expected the runs of a lease to share it")
+
+	s.Unschedule("cleanup")
+	assert.Empty(t, s.Owned())
+	assert.Equal(t, ErrLeaseLost, s.Check(lease))
+}
+
+func TestSchedulerFollowsTheRing(t *testing.T) {
+	name := movingJob(t)
+	rp := routertest.NewRingpop(me)
+	s, c := newTestScheduler(t, rp)
+	defer s.Close()
+
+	started := make(chan Lease, 1)
+	stopped := make(chan struct{}, 1)
+	assert.NoError(t, s.Schedule(name, time.Minute, func(ctx context.Context, lease Lease) error {
+		started <- lease
+		<-ctx.Done()
+		stopped <- struct{}{}
+		return ctx.Err()
+	}))
+	c.Add(time.Minute)
+	first := <-started
+
+	// the job moves to the new node, cancelling its run
+	rp.Join(other)
+	<-stopped
+	assert.Empty(t, s.Owned())
+	assert.Equal(t, ErrLeaseLost, s.Check(first))
+
+	// and comes back with a new lease once the node fails
+	rp.Fail(other)
+	assert.Equal(t, []string{name}, s.Owned())
+	c.Add(time.Minute)
+	second := <-started
+	assert.True(t, second.Token > first.Token, "expected the fencing token to increase")
+	assert.Equal(t, ErrLeaseLost, s.Check(first))
+	assert.NoError(t, s.Check(second))
+}
+
+func TestSchedulerCheckFencesBeforeChanges(t *testing.T) {
+	name := movingJob(t)
+	rp := routertest.NewRingpop(me)
+	s, c := newTestScheduler(t, rp)
+	defer s.Close()
+
+	fn, runs := leases()
+	assert.NoError(t, s.Schedule(name, time.Minute, fn))
+	c.Add(time.Minute)
+	lease := <-runs
+
+	// the job moves but the change is not delivered yet
+	rp.SetOwner("job-"+name, other)
+	assert.Equal(t, ErrLeaseLost, s.Check(lease))
+	assert.Equal(t, []string{name}, s.Owned())
+}
+
+func TestSchedulerErrorHandler(t *testing.T) {
+	errs := make(chan error, 1)
+	s, c := newTestScheduler(t, routertest.NewRingpop(me), WithKeyPrefix("cron-"), WithErrorHandler(func(name string, err error) {
+		assert.Equal(t, "report", name)
+		errs <- err
+	}))
+	defer s.Close()
+
+	failure := errors.New("report failed")
+	assert.NoError(t, s.Schedule("report", time.Minute, func(ctx context.Context, lease Lease) error {
+		return failure
+	}))
+	c.Add(time.Minute)
+	assert.Equal(t, failure, <-errs)
+	assert.Equal(t, "cron-report", s.key("report"))
+}
+
+func TestSchedulerClose(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	s, c := newTestScheduler(t, rp)
+
+	stopped := make(chan struct{}, 1)
+	running := make(chan struct{})
+	assert.NoError(t, s.Schedule("cleanup", time.Minute, func(ctx context.Context, lease Lease) error {
+		close(running)
+		<-ctx.Done()
+		stopped <- struct{}{}
+		return nil
+	}))
+	c.Add(time.Minute)
+	<-running
+
+	s.Close()
+	<-stopped
+	assert.Empty(t, s.Owned())
+	assert.Equal(t, ErrSchedulerClosed, s.Schedule("other", time.Minute, nil))
+
+	rp.Join(other)
+	assert.Empty(t, s.Owned(), "expected a closed scheduler to ignore the ring")
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+// OwnersForKeyspace resolves every prefix of a keyspace and groups the
+// prefixes by the destination they resolve to, so a coordinator can schedule
+// one job per node. Prefixes are resolved like keys, so this is meant for
+// keyspaces whose keys are placed by their prefix, see WithKeyMapper. To
+// cover a keyspace whose keys are spread over the ring, iterate the hash
+// ranges returned by OwnerRanges instead.
+func (r *router) OwnersForKeyspace(prefixes []string) (map[string][]string, error) {
+	owners := make(map[string][]string)
+	for _, prefix := range prefixes {
+		dest, err := r.lookup(prefix)
+		if err != nil {
+			return nil, err
+		}
+		owners[dest] = append(owners[dest], prefix)
+	}
+	return owners, nil
+}
+
+// An OwnerRange is a range of the hash space of the ring together with the
+// node that owns the keys in it. The range holds the keys whose hash h
+// satisfies Start < h <= End, like a KeyRange.
+type OwnerRange struct {
+	Start, End uint32
+	Owner      string
+}
+
+// Contains returns whether key falls in the range. Keys are hashed as they
+// are, apply the KeyMapper of the router first when one is configured.
+func (or OwnerRange) Contains(key string) bool {
+	return inRange(or.Start, or.End, keyHash(key))
+}
+
+// OwnerRanges returns the ranges of the hash space owned by each member of
+// the ring, ordered by hash and with adjacent ranges of the same owner
+// merged, so full keyspace sweeps can be split into one scan per node
+// without looking up every key. The ranges mirror ringpop's hash ring, see
+// WithReplicaPoints, and do not apply to RendezvousLookup or pinned keys.
+func (r *router) OwnerRanges() ([]OwnerRange, error) {
+	servers, err := r.ringpop.GetReachableMembers()
+	if err != nil {
+		return nil, wrapError(ErrLookupFailed, err)
+	}
+
+	// every range of a ring without members moves to its owner on the ring
+	moved := movedRanges(nil, newTokenRing(servers, r.replicaPoints))
+	ranges := make([]OwnerRange, len(moved))
+	for i, kr := range moved {
+		ranges[i] = OwnerRange{Start: kr.Start, End: kr.End, Owner: kr.To}
+	}
+	return ranges, nil
+}
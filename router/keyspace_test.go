@@ -0,0 +1,83 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestOwnersForKeyspace(t *testing.T) {
+	r := newRingpopTestRouter(t, newTestRingpop(testLookups{
+		"tenant1": "127.0.0.1:3001",
+		"tenant2": "127.0.0.1:3002",
+		"tenant3": "127.0.0.1:3001",
+	}))
+
+	owners, err := r.OwnersForKeyspace([]string{"tenant1", "tenant2", "tenant3"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"127.0.0.1:3001": {"tenant1", "tenant3"},
+		"127.0.0.1:3002": {"tenant2"},
+	}, owners)
+
+	_, err = r.OwnersForKeyspace([]string{"tenant1", "error"})
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+}
+
+func TestOwnerRanges(t *testing.T) {
+	servers := []string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("GetReachableMembers").Return(servers, nil)
+	r := New(rp, nil, nil)
+
+	ranges, err := r.OwnerRanges()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ranges)
+
+	ring := newTokenRing(servers, defaultReplicaPoints)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		var owners []string
+		for _, or := range ranges {
+			if or.Contains(key) {
+				owners = append(owners, or.Owner)
+			}
+		}
+		assert.Equal(t, []string{ring.owner(keyHash(key))}, owners, "expected %s to be in exactly one range", key)
+	}
+}
+
+func TestOwnerRangesLookupFailed(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("GetReachableMembers").Return(nil, errors.New("ringpop not ready"))
+	r := New(rp, nil, nil)
+
+	_, err := r.OwnerRanges()
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"io"
+
+	"github.com/uber/tchannel-go/thrift"
+)
+
+var errNoClientKinds = errors.New("client factory does not create kinds of clients")
+
+// A KindClientFactory is a ClientFactoryV2 that creates several kinds of
+// clients for every destination, eg. "read", "write" and "admin" clients with
+// their own timeouts or retries, which GetClientKind returns. The clients of
+// every kind are created on first use, cached with the client of their
+// destination and evicted with it. Kinds are named by the application, the
+// router passes them on as is.
+type KindClientFactory interface {
+	ClientFactoryV2
+
+	// GetLocalClientKind returns the client of kind for the local node.
+	GetLocalClientKind(kind string) (interface{}, error)
+
+	// MakeRemoteClientKind creates the client of kind that calls the node at
+	// dest through client, like MakeRemoteClient.
+	MakeRemoteClientKind(kind string, dest Destination, client thrift.TChanClient) (interface{}, error)
+}
+
+// GetClientKind returns the client of kind for the destination key resolves
+// to, routing key like GetClient does. It fails with an Error of kind
+// ErrClientCreation when the factory of the router is not a
+// KindClientFactory.
+func (r *router) GetClientKind(key, kind string) (interface{}, error) {
+	f, ok := r.factory.(KindClientFactory)
+	if !ok {
+		return nil, wrapError(ErrClientCreation, errNoClientKinds)
+	}
+
+	for {
+		_, dest, err := r.getClient(key)
+		if err != nil {
+			return nil, err
+		}
+		entry, ok := r.cache.get(r.cacheKey(dest))
+		if !ok {
+			// the client of dest is not cacheable, nor are its kinds
+			local, err := r.isSelf(dest)
+			if err != nil {
+				return nil, err
+			}
+			entry = &cacheEntry{dest: dest, local: local}
+			return r.makeClientKind(f, entry, kind)
+		}
+
+		client, live, err := r.entryClientKind(f, entry, kind)
+		if live {
+			return client, err
+		}
+		// the entry was closed after it was looked up, the kind is created
+		// for the entry that replaces it
+	}
+}
+
+// entryClientKind returns the client of kind cached with entry, creating it
+// if needed, and whether entry was still live: the kinds of entries that were
+// closed are not created, they would never be closed.
+func (r *router) entryClientKind(f KindClientFactory, entry *cacheEntry, kind string) (interface{}, bool, error) {
+	entry.kindsMu.Lock()
+	defer entry.kindsMu.Unlock()
+
+	if entry.kindsClosed {
+		return nil, false, nil
+	}
+	if client, ok := entry.kinds[kind]; ok {
+		return client, true, nil
+	}
+	client, err := r.makeClientKind(f, entry, kind)
+	if err != nil {
+		return nil, true, err
+	}
+	if entry.kinds == nil {
+		entry.kinds = make(map[string]interface{})
+	}
+	entry.kinds[kind] = client
+	return client, true, nil
+}
+
+// makeClientKind creates the client of kind for the destination of entry.
+func (r *router) makeClientKind(f KindClientFactory, entry *cacheEntry, kind string) (interface{}, error) {
+	d := Destination{Address: entry.dest, Local: entry.local, Labels: entry.labels}
+	if entry.local {
+		client, err := r.callFactory(d, func() (interface{}, error) {
+			return f.GetLocalClientKind(kind)
+		})
+		return client, wrapError(ErrClientCreation, err)
+	}
+	return r.makeRemoteClientWith(d, entry.calls, func(d Destination, client thrift.TChanClient) (interface{}, error) {
+		return r.callFactory(d, func() (interface{}, error) {
+			return f.MakeRemoteClientKind(kind, d, client)
+		})
+	})
+}
+
+// closeKinds closes the clients of the kinds of entry that implement
+// io.Closer, local ones included, and keeps kinds from being added to entry
+// afterwards.
+func closeKinds(entry *cacheEntry) {
+	entry.kindsMu.Lock()
+	defer entry.kindsMu.Unlock()
+
+	entry.kindsClosed = true
+	for _, client := range entry.kinds {
+		if closer, ok := client.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
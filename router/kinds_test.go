@@ -0,0 +1,144 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// kindClient is a client of a kind for a destination.
+type kindClient struct {
+	closingClient
+	kind string
+	dest string
+}
+
+// kindFactory is a KindClientFactory of which the clients are kindClients,
+// it fails for the "broken" kind.
+type kindFactory struct {
+	destFactory
+	created []*kindClient
+}
+
+func (f *kindFactory) GetLocalClientKind(kind string) (interface{}, error) {
+	return f.MakeRemoteClientKind(kind, Destination{Address: "local"}, nil)
+}
+
+func (f *kindFactory) MakeRemoteClientKind(kind string, dest Destination, client thrift.TChanClient) (interface{}, error) {
+	if kind == "broken" {
+		return nil, errors.New("unknown kind")
+	}
+	c := &kindClient{kind: kind, dest: dest.Address}
+	f.created = append(f.created, c)
+	return c, nil
+}
+
+func newKindsTestRouter(t *testing.T, f ClientFactoryV2) *router {
+	rp := newTestRingpop(nil)
+
+	transport := &memoryTransport{conns: map[string]ClientConn{"127.0.0.1:3001": &stubTChanClient{}}}
+	return newChannelTestRouter(rp, nil, withFactoryV2(f), WithTransport(transport))
+}
+
+func TestGetClientKind(t *testing.T) {
+	f := &kindFactory{}
+	r := newKindsTestRouter(t, f)
+
+	for _, tt := range []struct {
+		key, kind, dest string
+	}{
+		{"remote", "read", "127.0.0.1:3001"},
+		{"remote", "write", "127.0.0.1:3001"},
+		{"local", "read", "local"},
+	} {
+		client, err := r.GetClientKind(tt.key, tt.kind)
+		assert.NoError(t, err)
+		if c, ok := client.(*kindClient); assert.True(t, ok, "expected a client of the kind") {
+			assert.Equal(t, tt.kind, c.kind)
+			assert.Equal(t, tt.dest, c.dest)
+		}
+
+		again, err := r.GetClientKind(tt.key, tt.kind)
+		assert.NoError(t, err)
+		assert.True(t, client == again, "expected the client of the kind to be cached")
+	}
+	assert.Len(t, f.created, 3)
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, Destination{Address: "127.0.0.1:3001"}, client, "expected the client of GetClient to be unchanged")
+
+	_, err = r.GetClientKind("remote", "broken")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+}
+
+func TestClientKindsAreEvicted(t *testing.T) {
+	f := &kindFactory{}
+	r := newKindsTestRouter(t, f)
+
+	read, err := r.GetClientKind("remote", "read")
+	assert.NoError(t, err)
+	r.removeClient("127.0.0.1:3001")
+	assert.True(t, read.(*kindClient).isClosed(), "expected the clients of the kinds to be closed")
+
+	again, err := r.GetClientKind("remote", "read")
+	assert.NoError(t, err)
+	assert.False(t, read == again, "expected a new client of the kind")
+}
+
+func TestLocalClientKindsAreClosed(t *testing.T) {
+	f := &kindFactory{}
+	r := newKindsTestRouter(t, f)
+
+	read, err := r.GetClientKind("local", "read")
+	assert.NoError(t, err)
+	r.removeClient("127.0.0.1:3000")
+	assert.True(t, read.(*kindClient).isClosed(), "expected the clients of the local kinds to be closed")
+}
+
+func TestClosedEntriesGetNoKinds(t *testing.T) {
+	f := &kindFactory{}
+	r := newKindsTestRouter(t, f)
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	entry, ok := r.cache.get("127.0.0.1:3001")
+	assert.True(t, ok)
+	closeKinds(entry)
+
+	// as when the entry is closed between its lookup and the kind
+	_, live, err := r.entryClientKind(f, entry, "read")
+	assert.NoError(t, err)
+	assert.False(t, live, "expected closed entries not to be live")
+	assert.Empty(t, f.created, "expected no kind for a closed entry")
+}
+
+func TestGetClientKindWithoutKinds(t *testing.T) {
+	r := newKindsTestRouter(t, destFactory{})
+
+	_, err := r.GetClientKind("remote", "read")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Equal(t, errNoClientKinds, err.(*Error).Err)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strings"
+
+	"github.com/uber-common/bark"
+)
+
+// A LabelsFunc returns the labels of the node at dest, eg. the version of the
+// interface it serves, so a ClientFactoryV2 can create the client that
+// matches the node during a rolling upgrade, see WithLabels. Ringpop does not
+// gossip labels, so they typically come from service discovery or from the
+// configuration of the deployment.
+type LabelsFunc func(dest string) (map[string]string, error)
+
+// memberLabels returns the labels of dest, or nil when the router has no
+// LabelsFunc. Errors are of kind ErrClientCreation.
+func (r *router) memberLabels(dest string) (map[string]string, error) {
+	if r.labels == nil {
+		return nil, nil
+	}
+	labels, err := r.labels(dest)
+	return labels, wrapError(ErrClientCreation, err)
+}
+
+// RefreshLabels reads the labels of dest again and evicts its client when
+// they changed since the client was created, so the next call creates a
+// client for the new labels, and sends a LabelsChangedEvent. Routers without
+// a LabelsFunc, and destinations without a cached client, are left alone.
+// Members that restart with new labels are evicted anyway when their new
+// incarnation is gossiped. The labels of a member are refreshed, in the
+// background, on every change of its membership, and of all members
+// periodically when enabled with WithLabelRefresh.
+func (r *router) RefreshLabels(dest string) error {
+	if r.labels == nil {
+		return nil
+	}
+	entry, ok := r.cache.get(r.cacheKey(dest))
+	if !ok || entry.local {
+		return nil
+	}
+
+	labels, err := r.memberLabels(dest)
+	if err != nil {
+		return err
+	}
+	if labelsEqual(labels, entry.labels) {
+		return nil
+	}
+
+	r.forgetMemberLabels(dest)
+	r.logger.WithField("dest", dest).Debug("router evicting client of relabeled member")
+	r.statter.IncCounter("router.client.relabeled", nil, 1)
+	if r.cache.removeEntry(r.cacheKey(dest), entry) {
+		r.evict([]*cacheEntry{entry})
+		r.emit(LabelsChangedEvent{Destination: dest, Labels: labels})
+	}
+	return nil
+}
+
+// refreshLabelsAsync refreshes the labels of dest on a goroutine of its own
+// when dest has a cached remote client, so the LabelsFunc, which typically
+// calls service discovery, does not hold up the delivery of the events of
+// ringpop. Errors are logged.
+func (r *router) refreshLabelsAsync(dest string) {
+	if r.labels == nil {
+		return
+	}
+	if entry, ok := r.cache.get(r.cacheKey(dest)); !ok || entry.local {
+		return
+	}
+
+	go func() {
+		if err := r.RefreshLabels(dest); err != nil {
+			r.logger.WithFields(bark.Fields{
+				"dest":  dest,
+				"error": err,
+			}).Warn("router failed to refresh labels")
+		}
+	}()
+}
+
+// startLabelRefresh starts refreshing the labels of the destinations of the
+// cached remote clients when enabled with WithLabelRefresh. It stops when the
+// router is closed.
+func (r *router) startLabelRefresh() {
+	if r.labels == nil || r.labelInterval <= 0 {
+		return
+	}
+
+	r.labelStop = make(chan struct{})
+	ticker := r.clock.Ticker(r.labelInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.refreshAllLabels()
+			case <-r.labelStop:
+				return
+			}
+		}
+	}()
+}
+
+// refreshAllLabels refreshes the labels of the destinations of the cached
+// remote clients of this router.
+func (r *router) refreshAllLabels() {
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		dest := strings.TrimPrefix(cacheKey, prefix)
+		if err := r.RefreshLabels(dest); err != nil {
+			r.logger.WithFields(bark.Fields{
+				"dest":  dest,
+				"error": err,
+			}).Warn("router failed to refresh labels")
+		}
+	}
+}
+
+func labelsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+	"golang.org/x/net/context"
+)
+
+// versionLabels is a LabelsFunc of which the labels can be changed by tests.
+type versionLabels struct {
+	sync.Mutex
+	version string
+}
+
+func (l *versionLabels) labels(dest string) (map[string]string, error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.version == "" {
+		return nil, errors.New("unknown member")
+	}
+	return map[string]string{"version": l.version}, nil
+}
+
+func (l *versionLabels) set(version string) {
+	l.Lock()
+	l.version = version
+	l.Unlock()
+}
+
+func newLabelsTestRouter(t *testing.T, labels *versionLabels, opts ...Option) Router {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, nil)
+
+	opts = append([]Option{withFactoryV2(destFactory{}), WithLabels(labels.labels)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...)
+}
+
+func TestWithLabels(t *testing.T) {
+	labels := &versionLabels{version: "v1"}
+	r := newLabelsTestRouter(t, labels)
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, Destination{Address: "127.0.0.1:3001", Labels: map[string]string{"version": "v1"}}, client)
+
+	client, err = r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+}
+
+func TestWithLabelsError(t *testing.T) {
+	r := newLabelsTestRouter(t, &versionLabels{})
+
+	_, err := r.GetClient("remote")
+	assert.EqualError(t, err, "unknown member")
+	assert.Empty(t, r.(*router).cache.keys(), "expected failed clients not to be cached")
+}
+
+func TestRefreshLabels(t *testing.T) {
+	labels := &versionLabels{version: "v1"}
+	r := newLabelsTestRouter(t, labels)
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+
+	// unchanged labels keep the client
+	assert.NoError(t, r.RefreshLabels("127.0.0.1:3001"))
+	assert.Equal(t, []string{"127.0.0.1:3001"}, r.(*router).cache.keys())
+
+	labels.set("v2")
+	assert.NoError(t, r.RefreshLabels("127.0.0.1:3001"))
+	assert.Empty(t, r.(*router).cache.keys(), "expected the client of the relabeled member to be evicted")
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"version": "v2"}, client.(Destination).Labels)
+
+	labels.set("")
+	assert.EqualError(t, r.RefreshLabels("127.0.0.1:3001"), "unknown member")
+	assert.NoError(t, r.RefreshLabels("127.0.0.1:3005"), "expected members without a client to be ignored")
+}
+
+func TestRefreshLabelsWithoutLabels(t *testing.T) {
+	r := newTestRouter(t)
+	assert.NoError(t, r.RefreshLabels("127.0.0.1:3001"))
+}
+
+func TestLabelsChangedEvent(t *testing.T) {
+	labels := &versionLabels{version: "v1"}
+	r := newLabelsTestRouter(t, labels)
+	l := make(chanListener, 1)
+	r.RegisterListener(l)
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	nextEvent(t, l) // ClientCreatedEvent
+
+	// the labels are refreshed with the membership of the member
+	labels.set("v2")
+	r.(*router).HandleEvent(swim.MemberlistChangesReceivedEvent{Changes: []swim.Change{
+		{Address: "127.0.0.1:3001", Status: swim.Alive},
+	}})
+
+	// in the background, the client being evicted before the event is sent
+	for {
+		if event, ok := nextEvent(t, l).(LabelsChangedEvent); ok {
+			assert.Equal(t, LabelsChangedEvent{
+				Destination: "127.0.0.1:3001",
+				Labels:      map[string]string{"version": "v2"},
+			}, event)
+			break
+		}
+	}
+	assert.Empty(t, r.(*router).cache.keys(), "expected the client of the relabeled member to be evicted")
+}
+
+func TestMembershipChangeSkipsLabelsOfUncachedMembers(t *testing.T) {
+	calls := 0
+	count := func(dest string) (map[string]string, error) {
+		calls++
+		return nil, nil
+	}
+	r := newTestRouter(t, WithLabels(count)).(*router)
+
+	r.HandleEvent(swim.MemberlistChangesReceivedEvent{Changes: []swim.Change{
+		{Address: "127.0.0.1:3001", Status: swim.Alive},
+	}})
+	assert.Equal(t, 0, calls, "expected members without a client not to be refreshed")
+}
+
+func TestLabelRefresh(t *testing.T) {
+	labels := &versionLabels{version: "v1"}
+	r := newLabelsTestRouter(t, labels, WithLabelRefresh(time.Minute)).(*router)
+	defer r.Close(context.Background())
+	assert.NotNil(t, r.labelStop)
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	_, err = r.GetClient("local")
+	assert.NoError(t, err)
+
+	r.refreshAllLabels()
+	assert.Len(t, r.cache.keys(), 2)
+
+	labels.set("v2")
+	r.refreshAllLabels()
+	assert.Equal(t, []string{"127.0.0.1:3000"}, r.cache.keys(), "expected only the relabeled remote client to be evicted")
+}
+
+func TestLabelRefreshWithoutLabels(t *testing.T) {
+	r := newTestRouter(t, WithLabelRefresh(time.Minute)).(*router)
+	assert.Nil(t, r.labelStop)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"time"
+
+	"github.com/uber-common/bark"
+)
+
+// DestinationStats are the statistics of the latency of the calls to a
+// destination, see WithLatencyTracking. The percentiles are estimated from
+// exponentially weighted moving averages, which favor the latest calls.
+type DestinationStats struct {
+	// Calls is the number of calls measured.
+	Calls int
+
+	// Mean is the moving average of the latency.
+	Mean time.Duration
+
+	// P50 is the moving estimate of the median latency.
+	P50 time.Duration
+
+	// P99 estimates the 99th percentile of the latency as three mean
+	// deviations above the mean, which holds for roughly normal latencies.
+	P99 time.Duration
+}
+
+// latencyTracked returns whether the latency of the calls is measured.
+func (r *router) latencyTracked() bool {
+	return r.deadlineRouting || r.latencyTracking
+}
+
+// DestinationStats returns the statistics of the latency of the calls to
+// dest, and false when no call to dest was measured.
+func (r *router) DestinationStats(dest string) (DestinationStats, bool) {
+	r.latenciesMu.Lock()
+	defer r.latenciesMu.Unlock()
+
+	s, ok := r.latencies[dest]
+	if !ok {
+		return DestinationStats{}, false
+	}
+	return DestinationStats{
+		Calls: s.samples,
+		Mean:  time.Duration(s.mean),
+		P50:   time.Duration(s.median),
+		P99:   s.p99(),
+	}, true
+}
+
+// exportLatency reports the latency of a call to dest to the stats reporter,
+// when enabled with WithLatencyTracking.
+func (r *router) exportLatency(dest string, d time.Duration) {
+	if r.latencyExport {
+		r.statter.RecordTimer("router.call.latency", bark.Tags{"dest": dest}, d)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestDestinationStats(t *testing.T) {
+	r, c := newBreakerTestRouter(t, WithLatencyTracking(false))
+	_, ok := r.DestinationStats("127.0.0.1:3001")
+	assert.False(t, ok, "expected no stats before any call")
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	lc, ok := client.(*latencyClient)
+	if !assert.True(t, ok, "expected the remote client to record latencies") {
+		return
+	}
+	lc.TChanClient = &slowTChanClient{clock: c, latency: 200 * time.Millisecond}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, call(lc))
+	}
+
+	stats, ok := r.DestinationStats("127.0.0.1:3001")
+	assert.True(t, ok)
+	assert.Equal(t, DestinationStats{
+		Calls: 3,
+		Mean:  200 * time.Millisecond,
+		P50:   200 * time.Millisecond,
+		P99:   200 * time.Millisecond,
+	}, stats)
+
+	stats, ok = routerRingView{r}.DestinationStats("127.0.0.1:3001")
+	assert.True(t, ok)
+	assert.Equal(t, 3, stats.Calls)
+}
+
+func TestLatencyStatsMedian(t *testing.T) {
+	s := &latencyStats{}
+	for i := 0; i < 200; i++ {
+		s.observe(10 * time.Millisecond)
+		s.observe(20 * time.Millisecond)
+		s.observe(500 * time.Millisecond)
+	}
+	assert.True(t, time.Duration(s.median) < time.Duration(s.mean), "expected the median to resist the outliers")
+	assert.InDelta(t, float64(20*time.Millisecond), s.median, float64(30*time.Millisecond))
+}
+
+func TestLatencyTrackingExport(t *testing.T) {
+	statter := &mocks.StatsReporter{}
+	statter.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	statter.On("UpdateGauge", mock.Anything, mock.Anything, mock.Anything).Return()
+	statter.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	r, _ := newBreakerTestRouter(t, WithLatencyTracking(true), WithStatsReporter(statter))
+	r.recordLatency("127.0.0.1:3001", 30*time.Millisecond)
+	statter.AssertCalled(t, "RecordTimer", "router.call.latency", bark.Tags{"dest": "127.0.0.1:3001"}, 30*time.Millisecond)
+}
+
+func TestLatencyTrackingDisabled(t *testing.T) {
+	r, _ := newBreakerTestRouter(t)
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	_, ok := client.(*latencyClient)
+	assert.False(t, ok, "expected latencies not to be recorded by default")
+}
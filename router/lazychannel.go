@@ -0,0 +1,123 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"io"
+	"sync"
+
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// A ChannelProvider returns the channel the router makes its remote calls on,
+// see WithChannelProvider.
+type ChannelProvider func() (*tchannel.Channel, error)
+
+// lazyTransport is the TChannelTransport over the channel of a
+// ChannelProvider, which is called on the first use of the transport. The
+// channel is kept once the provider returned one; errors are returned to the
+// caller and the provider is called again on the next use.
+type lazyTransport struct {
+	provider      ChannelProvider
+	service       string
+	clientOptions ClientOptionsProvider
+
+	mu        sync.Mutex
+	transport *TChannelTransport
+}
+
+// resolve returns the TChannelTransport of the channel of the provider,
+// calling the provider when it did not return a channel yet. Concurrent
+// callers wait for the same call of the provider.
+func (t *lazyTransport) resolve() (*TChannelTransport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transport != nil {
+		return t.transport, nil
+	}
+	ch, err := t.provider()
+	if err != nil {
+		return nil, err
+	}
+	if ch == nil {
+		return nil, errNoTransport
+	}
+	t.transport = &TChannelTransport{
+		Channel:       ch,
+		Service:       t.service,
+		ClientOptions: t.clientOptions,
+	}
+	return t.transport, nil
+}
+
+// resolved returns the TChannelTransport of the channel of the provider, or
+// nil when the provider was not called successfully yet.
+func (t *lazyTransport) resolved() *TChannelTransport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.transport
+}
+
+func (t *lazyTransport) Dial(dest string) (ClientConn, error) {
+	transport, err := t.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return transport.Dial(dest)
+}
+
+func (t *lazyTransport) Ping(ctx context.Context, dest string) error {
+	transport, err := t.resolve()
+	if err != nil {
+		return err
+	}
+	return transport.Ping(ctx, dest)
+}
+
+func (t *lazyTransport) Connect(ctx context.Context, dest string) (io.Closer, error) {
+	transport, err := t.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return transport.Connect(ctx, dest)
+}
+
+// CloseConnections does not call the provider: there are no connections
+// before the channel exists.
+func (t *lazyTransport) CloseConnections(dest string) error {
+	transport := t.resolved()
+	if transport == nil {
+		return nil
+	}
+	return transport.CloseConnections(dest)
+}
+
+// Connected does not call the provider: there are no connections before the
+// channel exists.
+func (t *lazyTransport) Connected() map[string]bool {
+	transport := t.resolved()
+	if transport == nil {
+		return nil
+	}
+	return transport.Connected()
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+func TestWithChannelProvider(t *testing.T) {
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	var mu sync.Mutex
+	calls := 0
+	provider := func() (*tchannel.Channel, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			return nil, errors.New("not configured yet")
+		}
+		return ch, nil
+	}
+	r := newTransportTestRouter(t, nil, WithChannelProvider(provider))
+	assert.Equal(t, 0, calls, "expected the provider not to be called on construction")
+
+	client, err := r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+	assert.Equal(t, 0, calls, "expected the local client not to need the channel")
+
+	_, err = r.GetClient("thrift")
+	assert.Equal(t, ErrClientCreation, KindOf(err), "expected the error of the provider")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := r.GetClient("thrift")
+			assert.NoError(t, err)
+			_, ok := client.(thrift.TChanClient)
+			assert.True(t, ok, "expected a TChannel client")
+		}()
+	}
+	wg.Wait()
+	_, err = r.GetClient("raw")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "expected the channel to be kept once provided")
+
+	transport := r.transport.(*lazyTransport).resolved()
+	if assert.NotNil(t, transport) {
+		assert.True(t, transport.Channel == ch)
+		assert.Equal(t, "remote", transport.Channel.ServiceName())
+	}
+}
+
+func TestChannelProviderIgnoredWithChannel(t *testing.T) {
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	provider := func() (*tchannel.Channel, error) {
+		t.Error("unexpected call of the provider")
+		return nil, nil
+	}
+	r := New(rp, tchanClientFactory{}, ch, WithChannelProvider(provider)).(*router)
+	_, ok := r.transport.(*TChannelTransport)
+	assert.True(t, ok, "expected the channel of New to be used")
+}
+
+func TestLazyTransportWithoutChannel(t *testing.T) {
+	transport := &lazyTransport{provider: func() (*tchannel.Channel, error) {
+		return nil, nil
+	}}
+	_, err := transport.Dial("127.0.0.1:3001")
+	assert.Equal(t, errNoTransport, err)
+	assert.Nil(t, transport.Connected(), "expected no connections before the channel exists")
+}
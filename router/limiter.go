@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// limitedClient is the TChanClient handed to the ClientFactory for remote
+// destinations when calls are limited with WithCallLimit. Every call holds
+// one of the slots of its destination, which are shared by all clients of
+// the destination.
+type limitedClient struct {
+	thrift.TChanClient
+
+	r     *router
+	slots chan struct{}
+}
+
+func (c *limitedClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		if !c.r.callLimitQueue {
+			c.r.statter.IncCounter("router.call.busy", nil, 1)
+			return false, ErrDestinationBusy
+		}
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			c.r.statter.IncCounter("router.call.busy", nil, 1)
+			return false, ctx.Err()
+		}
+	}
+	defer func() { <-c.slots }()
+
+	return c.TChanClient.Call(ctx, serviceName, methodName, req, resp)
+}
+
+// callSlots returns the slots of the calls through the remote clients of
+// dest, see WithCallLimit.
+func (r *router) callSlots(dest string) chan struct{} {
+	r.inflightMu.Lock()
+	defer r.inflightMu.Unlock()
+
+	slots, ok := r.calls[dest]
+	if !ok {
+		slots = make(chan struct{}, r.callLimit)
+		r.calls[dest] = slots
+	}
+	return slots
+}
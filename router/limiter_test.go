@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// blockingTChanClient blocks every call until release is closed.
+type blockingTChanClient struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingTChanClient() *blockingTChanClient {
+	return &blockingTChanClient{
+		started: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (c *blockingTChanClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	c.started <- struct{}{}
+	<-c.release
+	return true, nil
+}
+
+// limitedClients returns two clients of the destination of key "a" of which
+// the calls are made by stub.
+func limitedClients(t *testing.T, r *router, stub thrift.TChanClient) (*limitedClient, *limitedClient) {
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	first, ok := client.(*limitedClient)
+	if !assert.True(t, ok, "expected the remote client to be limited") {
+		t.FailNow()
+	}
+	first.TChanClient = stub
+
+	// clients created again for the destination share its slots
+	r.removeClient("127.0.0.1:3001")
+	client, err = r.GetClient("a")
+	assert.NoError(t, err)
+	second := client.(*limitedClient)
+	second.TChanClient = stub
+	return first, second
+}
+
+func TestCallLimitFailsFast(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithCallLimit(1, false))
+	stub := newBlockingTChanClient()
+	first, second := limitedClients(t, r, stub)
+
+	done := make(chan error)
+	go func() { done <- call(first) }()
+	<-stub.started
+
+	assert.Equal(t, ErrDestinationBusy, call(second))
+
+	// other destinations have slots of their own
+	other, err := r.GetClient("b")
+	assert.NoError(t, err)
+	other.(*limitedClient).TChanClient = &stubTChanClient{}
+	assert.NoError(t, call(other.(*limitedClient)))
+
+	close(stub.release)
+	assert.NoError(t, <-done)
+	assert.NoError(t, call(second), "expected the slot to be released after the call")
+}
+
+func TestCallLimitQueues(t *testing.T) {
+	r, _ := newBreakerTestRouter(t, WithCallLimit(1, true))
+	stub := newBlockingTChanClient()
+	first, second := limitedClients(t, r, stub)
+
+	done := make(chan error)
+	go func() { done <- call(first) }()
+	<-stub.started
+
+	ctx, cancel := thrift.NewContext(10 * time.Millisecond)
+	defer cancel()
+	_, err := second.Call(ctx, "remote", "Ping", nil, nil)
+	assert.Equal(t, ctx.Err(), err, "expected the queued call to give up with its context")
+
+	queued := make(chan error)
+	go func() { queued <- call(second) }()
+	close(stub.release)
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-queued)
+}
+
+func TestNoCallLimitByDefault(t *testing.T) {
+	r, _ := newBreakerTestRouter(t)
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	_, ok := client.(*limitedClient)
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/uber-common/bark"
+)
+
+// loadReport is the last load reported for a member.
+type loadReport struct {
+	load float64
+	at   time.Time
+}
+
+// A LoadTable holds the load last reported by every member, for
+// LeastLoadedReplica to route reads to the least loaded replica of a key:
+//
+//     loads := router.NewLoadTable(10 * time.Second)
+//     r := router.New(rp, factory, ch,
+//         router.WithReadPolicy(router.LeastLoadedReplica(3, loads.Load)))
+//
+// Ringpop does not gossip the load of members, so the application reports it
+// from wherever it learns it, eg. a header of the responses of the members or
+// its metrics system. A LoadTable is safe for concurrent use.
+type LoadTable struct {
+	maxAge time.Duration
+	clock  clock.Clock
+
+	mu    sync.RWMutex
+	loads map[string]loadReport
+}
+
+// NewLoadTable returns an empty LoadTable that ignores reports older than
+// maxAge, so a member that stops reporting is not picked for a load it no
+// longer has. A maxAge of zero or less keeps reports until they are replaced
+// or forgotten.
+func NewLoadTable(maxAge time.Duration) *LoadTable {
+	return &LoadTable{
+		maxAge: maxAge,
+		clock:  clock.New(),
+		loads:  make(map[string]loadReport),
+	}
+}
+
+// Report records load as the current load of member.
+func (t *LoadTable) Report(member string, load float64) {
+	t.mu.Lock()
+	t.loads[member] = loadReport{load: load, at: t.clock.Now()}
+	t.mu.Unlock()
+}
+
+// Forget removes the load reported for member, eg. once it left the ring.
+func (t *LoadTable) Forget(member string) {
+	t.mu.Lock()
+	delete(t.loads, member)
+	t.mu.Unlock()
+}
+
+// Load returns the load last reported for member. Members without a report,
+// or whose report is too old, have an infinite load so that a replica with a
+// known load is preferred and the owner is picked when no load is known. Load
+// is a LoadFunc.
+func (t *LoadTable) Load(member string) float64 {
+	t.mu.RLock()
+	report, ok := t.loads[member]
+	t.mu.RUnlock()
+
+	if !ok || (t.maxAge > 0 && t.clock.Now().Sub(report.at) > t.maxAge) {
+		return math.Inf(1)
+	}
+	return report.load
+}
+
+// readClient returns the client of the destination the read policy selects
+// for key, and false when there is no read policy, key is pinned or the
+// client cannot be had, for GetReadClient to route it like GetClient.
+func (r *router) readClient(key string) (interface{}, bool) {
+	if r.readPolicy == nil {
+		return nil, false
+	}
+	if _, ok := r.pinned(key); ok {
+		return nil, false
+	}
+
+	dest, err := r.readPolicy.SelectDestination(r.mapKey(key), routerRingView{r})
+	if err == nil {
+		var client interface{}
+		if client, err = r.getClientForDest(dest); err == nil {
+			return client, true
+		}
+	}
+	r.logger.WithFields(bark.Fields{
+		"key":   key,
+		"dest":  dest,
+		"error": err,
+	}).Debug("router read policy failed")
+	return nil, false
+}
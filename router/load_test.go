@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTable(t *testing.T) {
+	loads := NewLoadTable(time.Minute)
+	c := clock.NewMock()
+	loads.clock = c
+
+	assert.True(t, math.IsInf(loads.Load("127.0.0.1:3001"), 1), "expected unknown loads to be infinite")
+
+	loads.Report("127.0.0.1:3001", 2)
+	assert.Equal(t, 2.0, loads.Load("127.0.0.1:3001"))
+
+	c.Add(2 * time.Minute)
+	assert.True(t, math.IsInf(loads.Load("127.0.0.1:3001"), 1), "expected old reports to be ignored")
+
+	loads.Report("127.0.0.1:3001", 3)
+	assert.Equal(t, 3.0, loads.Load("127.0.0.1:3001"))
+	loads.Forget("127.0.0.1:3001")
+	assert.True(t, math.IsInf(loads.Load("127.0.0.1:3001"), 1), "expected forgotten loads to be infinite")
+}
+
+func TestReadPolicy(t *testing.T) {
+	loads := NewLoadTable(0)
+	r := newPolicyTestRouter(t, nil)
+	r.readPolicy = LeastLoadedReplica(3, loads.Load)
+
+	client, err := r.GetReadClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected the owner when no load is known")
+
+	loads.Report("127.0.0.1:3001", 10)
+	loads.Report("127.0.0.1:3002", 5)
+	loads.Report("127.0.0.1:3003", 1)
+	client, err = r.GetReadClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3003", client, "expected the least loaded replica")
+
+	client, err = r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected writes to go to the owner")
+
+	r.Pin("key", "127.0.0.1:3004")
+	client, err = r.GetReadClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3004", client, "expected reads of pinned keys to go to their pin")
+}
+
+func TestReadPolicyFails(t *testing.T) {
+	r := newPolicyTestRouter(t, nil)
+	r.readPolicy = PolicyFunc(func(key string, ring RingView) (string, error) {
+		return "", errors.New("no destination")
+	})
+
+	client, err := r.GetReadClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A LoadReport summarizes how the keys resolved by the router and the calls
+// it dispatched spread over the destinations of the ring, see WithLoadReport.
+// It covers the current window and the one before it, so capacity planners
+// can compare the load of members to decide when to grow the ring.
+type LoadReport struct {
+	// Window is the length of the windows the load is accounted in.
+	Window time.Duration `json:"window"`
+
+	// Keys is the number of keys resolved.
+	Keys int `json:"keys"`
+
+	// Calls is the number of calls dispatched.
+	Calls int `json:"calls"`
+
+	// Destinations is the load of every destination keys resolved to or
+	// calls were dispatched to, in the order of their address.
+	Destinations []DestinationLoad `json:"destinations"`
+}
+
+// DestinationLoad is the load of a destination in a LoadReport.
+type DestinationLoad struct {
+	Address string `json:"address"`
+
+	// Keys is the number of keys resolved to the destination as their owner.
+	Keys int `json:"keys"`
+
+	// Calls is the number of calls dispatched to the destination.
+	Calls int `json:"calls"`
+
+	// KeyShare is the share of all keys resolved that the destination owns.
+	KeyShare float64 `json:"keyShare"`
+}
+
+type destinationLoads []DestinationLoad
+
+func (l destinationLoads) Len() int           { return len(l) }
+func (l destinationLoads) Less(i, j int) bool { return l[i].Address < l[j].Address }
+func (l destinationLoads) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// keyLoad counts the keys and calls of a destination in a window.
+type keyLoad struct {
+	keys  int
+	calls int
+}
+
+// loadStats counts the keys and calls of the destinations per window, of
+// which the previous one is kept so reports do not drop to nothing at the
+// start of every window.
+type loadStats struct {
+	mu          sync.Mutex
+	window      time.Duration
+	windowStart time.Time
+	current     map[string]*keyLoad
+	last        map[string]*keyLoad
+}
+
+func newLoadStats(window time.Duration) *loadStats {
+	return &loadStats{
+		window:  window,
+		current: make(map[string]*keyLoad),
+		last:    make(map[string]*keyLoad),
+	}
+}
+
+// advance moves the window forward to now. mu must be held.
+func (s *loadStats) advance(now time.Time) {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < s.window {
+		return
+	}
+	if elapsed < 2*s.window {
+		s.last = s.current
+	} else {
+		s.last = make(map[string]*keyLoad)
+	}
+	s.windowStart = now
+	s.current = make(map[string]*keyLoad)
+}
+
+// record adds keys and calls to the load of dest.
+func (s *loadStats) record(now time.Time, dest string, keys, calls int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance(now)
+	l, ok := s.current[dest]
+	if !ok {
+		l = &keyLoad{}
+		s.current[dest] = l
+	}
+	l.keys += keys
+	l.calls += calls
+}
+
+// report returns the load of the current and last windows.
+func (s *loadStats) report(now time.Time) LoadReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance(now)
+	loads := make(map[string]*DestinationLoad)
+	report := LoadReport{Window: s.window}
+	for _, window := range []map[string]*keyLoad{s.last, s.current} {
+		for dest, l := range window {
+			d, ok := loads[dest]
+			if !ok {
+				d = &DestinationLoad{Address: dest}
+				loads[dest] = d
+			}
+			d.Keys += l.keys
+			d.Calls += l.calls
+			report.Keys += l.keys
+			report.Calls += l.calls
+		}
+	}
+
+	report.Destinations = make([]DestinationLoad, 0, len(loads))
+	for _, d := range loads {
+		if report.Keys > 0 {
+			d.KeyShare = float64(d.Keys) / float64(report.Keys)
+		}
+		report.Destinations = append(report.Destinations, *d)
+	}
+	sort.Sort(destinationLoads(report.Destinations))
+	return report
+}
+
+// LoadReport returns the load of the destinations of the recent windows, or
+// an empty report when load reporting is not enabled with WithLoadReport.
+func (r *router) LoadReport() LoadReport {
+	if r.loadStats == nil {
+		return LoadReport{}
+	}
+	return r.loadStats.report(r.clock.Now())
+}
+
+// recordKey counts a key resolved to its owner dest.
+func (r *router) recordKey(dest string) {
+	if r.loadStats != nil {
+		r.loadStats.record(r.clock.Now(), dest, 1, 0)
+	}
+}
+
+// recordDispatch counts a call dispatched to dest.
+func (r *router) recordDispatch(dest string) {
+	if r.loadStats != nil {
+		r.loadStats.record(r.clock.Now(), dest, 0, 1)
+	}
+}
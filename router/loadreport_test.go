@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadReport(t *testing.T) {
+	r, _ := newSelfTestRouter(t, nil, WithLoadReport(time.Minute))
+	c := clock.NewMock()
+	r.clock = c
+	r.loadStats.windowStart = c.Now()
+
+	call := func(client interface{}) error { return nil }
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.Dispatch("remote", call))
+	}
+	assert.NoError(t, r.Dispatch("local", call))
+	_, err := r.GetClient("local")
+	assert.NoError(t, err)
+
+	assert.Equal(t, LoadReport{
+		Window: time.Minute,
+		Keys:   5,
+		Calls:  4,
+		Destinations: []DestinationLoad{
+			{Address: "127.0.0.1:3000", Keys: 2, Calls: 1, KeyShare: 0.4},
+			{Address: "127.0.0.1:3001", Keys: 3, Calls: 3, KeyShare: 0.6},
+		},
+	}, r.LoadReport())
+
+	// the last window counts towards the report
+	c.Add(time.Minute)
+	assert.NoError(t, r.Dispatch("local", call))
+	report := r.LoadReport()
+	assert.Equal(t, 6, report.Keys)
+	assert.Equal(t, 5, report.Calls)
+
+	// and is forgotten once idle for longer
+	c.Add(2 * time.Minute)
+	assert.Equal(t, LoadReport{Window: time.Minute, Destinations: []DestinationLoad{}}, r.LoadReport())
+}
+
+func TestLoadReportDisabled(t *testing.T) {
+	r, _ := newSelfTestRouter(t, nil, WithLoadReport(0))
+	assert.Nil(t, r.loadStats)
+
+	assert.NoError(t, r.Dispatch("remote", func(client interface{}) error { return nil }))
+	assert.Equal(t, LoadReport{}, r.LoadReport())
+}
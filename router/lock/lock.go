@@ -0,0 +1,428 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package lock provides locks and semaphores keyed on the ring of a router,
+// for mutual exclusion of operations on entities without a lock service. The
+// Arbiter of the node owning a key grants leases on the key, which expire
+// unless renewed, and a Locker acquires them through the router, calling the
+// Arbiter of the local node or of the owner of the key.
+//
+// Leases do not survive the move of their key to another node: the new owner
+// holds back its leases on the keys it acquires for the longest lease
+// duration, so the leases granted by the previous owner expire first. The
+// Token of every lease grows with the time it was granted, so stores can also
+// fence off the writes of holders of older leases.
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/uber/ringpop-go/router"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultTTL is the duration of the leases of a Locker.
+	defaultTTL = 10 * time.Second
+
+	// defaultRetryInterval is the time a Locker waits between attempts to
+	// acquire a lease that is held.
+	defaultRetryInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrNotHeld is returned for leases that expired or were released.
+	ErrNotHeld = errors.New("lease is not held")
+
+	// ErrNotOwner is returned by an Arbiter asked for the lease of a key
+	// owned by another node, eg. because the ring changed since the caller
+	// resolved the key.
+	ErrNotOwner = errors.New("key is not owned by the local node")
+)
+
+// A Lease is a hold of one of the permits of a key, until Expires.
+type Lease struct {
+	Key    string
+	Holder string
+
+	// Token identifies the lease and increases with the time it was
+	// granted.
+	Token int64
+
+	Expires time.Time
+}
+
+// A Client acquires, renews and releases the leases of keys owned by a node.
+// The Arbiter of a node is the Client of its keys, and services expose the
+// methods of their Arbiter in handlers for the Clients of other nodes.
+type Client interface {
+	// Acquire grants holder one of the permits of key for ttl, and returns
+	// false when all permits of key are held. Acquiring a key again for the
+	// same holder returns the lease it holds, so retries are safe.
+	Acquire(ctx context.Context, key, holder string, permits int, ttl time.Duration) (Lease, bool, error)
+
+	// Renew extends lease by ttl from now.
+	Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error)
+
+	// Release gives up lease.
+	Release(ctx context.Context, lease Lease) error
+}
+
+// A ClientFunc returns the Client calling the node of client, a client the
+// router returned for the owner of a key.
+type ClientFunc func(client interface{}) Client
+
+// grace is a range of keys the local node acquired, of which no lease is
+// granted until the leases of the previous owner expired.
+type grace struct {
+	kr    router.KeyRange
+	until time.Time
+}
+
+// An Arbiter grants the leases of the keys owned by the local node. It is
+// safe for concurrent use.
+type Arbiter struct {
+	router router.Router
+	me     string
+	maxTTL time.Duration
+	clock  clock.Clock
+
+	mu        sync.Mutex
+	leases    map[string][]Lease
+	graces    []grace
+	lastToken int64
+}
+
+// NewArbiter creates an Arbiter for the local node, of address me as returned
+// by ringpop's WhoAmI, that grants leases for at most maxTTL and follows the
+// ring of r to hold back the keys the local node acquires, see
+// router.Router.OnOwnershipChange.
+func NewArbiter(r router.Router, me string, maxTTL time.Duration) *Arbiter {
+	a := &Arbiter{
+		router: r,
+		me:     me,
+		maxTTL: maxTTL,
+		clock:  clock.New(),
+		leases: make(map[string][]Lease),
+	}
+	r.OnOwnershipChange(a.ownershipChanged)
+	return a
+}
+
+// ownershipChanged holds back the ranges the local node acquired and forgets
+// the leases of the ranges it lost.
+func (a *Arbiter) ownershipChanged(moved []router.KeyRange) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	until := a.clock.Now().Add(a.maxTTL)
+	for _, kr := range moved {
+		switch {
+		case kr.To == a.me && kr.From != "":
+			a.graces = append(a.graces, grace{kr: kr, until: until})
+		case kr.From == a.me:
+			for key := range a.leases {
+				if kr.ContainsHash(a.router.KeyHash(key)) {
+					delete(a.leases, key)
+				}
+			}
+		}
+	}
+}
+
+// held returns whether the leases of key are held back. mu must be held.
+func (a *Arbiter) held(key string, now time.Time) bool {
+	h := a.router.KeyHash(key)
+	graces := a.graces[:0]
+	held := false
+	for _, g := range a.graces {
+		if now.Before(g.until) {
+			graces = append(graces, g)
+			held = held || g.kr.ContainsHash(h)
+		}
+	}
+	a.graces = graces
+	return held
+}
+
+// live returns the leases of key that did not expire, forgetting the others.
+// mu must be held.
+func (a *Arbiter) live(key string, now time.Time) []Lease {
+	leases := a.leases[key][:0]
+	for _, l := range a.leases[key] {
+		if now.Before(l.Expires) {
+			leases = append(leases, l)
+		}
+	}
+	if len(leases) == 0 {
+		delete(a.leases, key)
+		return nil
+	}
+	a.leases[key] = leases
+	return leases
+}
+
+// ttl bounds ttl to the longest lease duration of a.
+func (a *Arbiter) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > a.maxTTL {
+		return a.maxTTL
+	}
+	return ttl
+}
+
+// Acquire grants holder one of the permits of key for ttl, at most the
+// longest lease duration of a, and returns false when all permits of key are
+// held or key was recently acquired by the local node. When holder holds a
+// lease of key already it is renewed and returned. Keys owned by other nodes
+// are rejected with ErrNotOwner.
+func (a *Arbiter) Acquire(ctx context.Context, key, holder string, permits int, ttl time.Duration) (Lease, bool, error) {
+	dest, err := a.router.Resolve(key)
+	if err != nil {
+		return Lease{}, false, err
+	}
+	if dest.Address != a.me {
+		return Lease{}, false, ErrNotOwner
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	leases := a.live(key, now)
+	for i, l := range leases {
+		if l.Holder == holder {
+			leases[i].Expires = now.Add(a.ttl(ttl))
+			return leases[i], true, nil
+		}
+	}
+	if a.held(key, now) || len(leases) >= permits {
+		return Lease{}, false, nil
+	}
+
+	token := now.UnixNano()
+	if token <= a.lastToken {
+		token = a.lastToken + 1
+	}
+	a.lastToken = token
+
+	lease := Lease{
+		Key:     key,
+		Holder:  holder,
+		Token:   token,
+		Expires: now.Add(a.ttl(ttl)),
+	}
+	a.leases[key] = append(a.leases[key], lease)
+	return lease, true, nil
+}
+
+// Renew extends lease by ttl from now, at most the longest lease duration of
+// a, and returns ErrNotHeld when the lease expired or was released.
+func (a *Arbiter) Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.clock.Now()
+	leases := a.live(lease.Key, now)
+	for i, l := range leases {
+		if l.Token == lease.Token {
+			leases[i].Expires = now.Add(a.ttl(ttl))
+			return leases[i], nil
+		}
+	}
+	return Lease{}, ErrNotHeld
+}
+
+// Release gives up lease, and returns ErrNotHeld when the lease expired or
+// was released already.
+func (a *Arbiter) Release(ctx context.Context, lease Lease) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	leases := a.live(lease.Key, a.clock.Now())
+	for i, l := range leases {
+		if l.Token == lease.Token {
+			a.leases[lease.Key] = append(leases[:i], leases[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotHeld
+}
+
+// An Option configures a Locker created by New.
+type Option func(*Locker)
+
+// WithTTL sets the duration of the leases, 10s by default. Holders renew
+// their leases before they expire to keep them.
+func WithTTL(ttl time.Duration) Option {
+	return func(l *Locker) {
+		l.ttl = ttl
+	}
+}
+
+// WithRetryInterval sets the time Lock and Acquire wait between attempts to
+// acquire a lease that is held, 100ms by default.
+func WithRetryInterval(d time.Duration) Option {
+	return func(l *Locker) {
+		l.retryInterval = d
+	}
+}
+
+// WithHolder sets the name of the holder of the leases, eg. to identify the
+// process holding a lock, a random name by default. Every acquisition holds
+// its lease under the name followed by its sequence number, so the
+// acquisitions of a Locker exclude each other.
+func WithHolder(holder string) Option {
+	return func(l *Locker) {
+		l.holder = holder
+	}
+}
+
+// A Locker acquires the leases of keys from the Arbiter of their owner. It is
+// safe for concurrent use.
+type Locker struct {
+	// acquisitions is the number of acquisitions started. It is the first
+	// field to guarantee 64-bit alignment for atomic operations on 32-bit
+	// platforms.
+	acquisitions int64
+
+	router        router.Router
+	arbiter       *Arbiter
+	client        ClientFunc
+	holder        string
+	ttl           time.Duration
+	retryInterval time.Duration
+	clock         clock.Clock
+}
+
+// New creates a Locker that acquires the leases of keys owned by the local
+// node from a, and of keys owned by other nodes through the Client client
+// returns for their router client, see router.Router.RunOnOwner.
+func New(r router.Router, a *Arbiter, client ClientFunc, opts ...Option) *Locker {
+	l := &Locker{
+		router:        r,
+		arbiter:       a,
+		client:        client,
+		holder:        newHolder(),
+		ttl:           defaultTTL,
+		retryInterval: defaultRetryInterval,
+		clock:         clock.New(),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// newHolder returns a random holder name.
+func newHolder() string {
+	b := make([]byte, 8)
+	// crypto/rand only fails when the system has no source of randomness
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// nextHolder returns the holder of a new acquisition.
+func (l *Locker) nextHolder() string {
+	return fmt.Sprintf("%s/%d", l.holder, atomic.AddInt64(&l.acquisitions, 1))
+}
+
+// call calls fn with the Client of the owner of key.
+func (l *Locker) call(ctx context.Context, key string, fn func(c Client) error) error {
+	return l.router.RunOnOwner(ctx, key, func(ctx context.Context) error {
+		return fn(l.arbiter)
+	}, func(ctx context.Context, client interface{}) error {
+		return fn(l.client(client))
+	})
+}
+
+// Lock acquires the lock of key, waiting until it is released or ctx is
+// done.
+func (l *Locker) Lock(ctx context.Context, key string) (Lease, error) {
+	return l.Acquire(ctx, key, 1)
+}
+
+// TryLock acquires the lock of key, and returns false when it is held.
+func (l *Locker) TryLock(ctx context.Context, key string) (Lease, bool, error) {
+	return l.TryAcquire(ctx, key, 1)
+}
+
+// Acquire acquires one of the permits of the semaphore of key, waiting until
+// one is released or ctx is done. All holders of a semaphore must agree on
+// its number of permits.
+func (l *Locker) Acquire(ctx context.Context, key string, permits int) (Lease, error) {
+	// every attempt acquires for the same holder, so a lease granted to an
+	// attempt that failed is returned to the next one
+	holder := l.nextHolder()
+	for {
+		lease, ok, err := l.tryAcquire(ctx, key, holder, permits)
+		if err != nil || ok {
+			return lease, err
+		}
+		select {
+		case <-l.clock.After(l.retryInterval):
+		case <-ctx.Done():
+			return Lease{}, ctx.Err()
+		}
+	}
+}
+
+// TryAcquire acquires one of the permits of the semaphore of key, and returns
+// false when all are held.
+func (l *Locker) TryAcquire(ctx context.Context, key string, permits int) (Lease, bool, error) {
+	return l.tryAcquire(ctx, key, l.nextHolder(), permits)
+}
+
+// tryAcquire acquires one of the permits of the semaphore of key for holder.
+// The owner may be called more than once, eg. when the router retries the
+// call, which the Client returns the lease of holder for.
+func (l *Locker) tryAcquire(ctx context.Context, key, holder string, permits int) (lease Lease, ok bool, err error) {
+	err = l.call(ctx, key, func(c Client) error {
+		var err error
+		lease, ok, err = c.Acquire(ctx, key, holder, permits, l.ttl)
+		return err
+	})
+	return lease, ok, err
+}
+
+// Renew extends lease by the lease duration of l.
+func (l *Locker) Renew(ctx context.Context, lease Lease) (renewed Lease, err error) {
+	err = l.call(ctx, lease.Key, func(c Client) error {
+		var err error
+		renewed, err = c.Renew(ctx, lease, l.ttl)
+		return err
+	})
+	return renewed, err
+}
+
+// Unlock releases lease.
+func (l *Locker) Unlock(ctx context.Context, lease Lease) error {
+	return l.call(ctx, lease.Key, func(c Client) error {
+		return c.Release(ctx, lease)
+	})
+}
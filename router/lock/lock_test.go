@@ -0,0 +1,226 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lock
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/ringpop-go/router/routertest"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+const (
+	me    = "127.0.0.1:3000"
+	other = "127.0.0.1:3001"
+)
+
+func newTestRouter(t *testing.T, rp *routertest.Ringpop) router.Router {
+	ch, err := tchannel.NewChannel("service", nil)
+	assert.NoError(t, err)
+	return router.NewV2(rp, &routertest.RecordingClientFactory{}, ch)
+}
+
+func newTestArbiter(t *testing.T, rp *routertest.Ringpop, me string) (*Arbiter, *clock.Mock) {
+	a := NewArbiter(newTestRouter(t, rp), me, time.Minute)
+	c := clock.NewMock()
+	a.clock = c
+	return a, c
+}
+
+// ownedKey returns a key owned by dest on the ring of rp.
+func ownedKey(t *testing.T, rp *routertest.Ringpop, dest string) string {
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if owner, _ := rp.Lookup(key); owner == dest {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", dest)
+	return ""
+}
+
+func TestArbiter(t *testing.T) {
+	a, c := newTestArbiter(t, routertest.NewRingpop(me), me)
+	ctx := context.Background()
+
+	lease, ok, err := a.Acquire(ctx, "key", "first", 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Lease{Key: "key", Holder: "first", Token: 1, Expires: c.Now().Add(time.Second)}, lease)
+
+	_, ok, err = a.Acquire(ctx, "key", "second", 1, time.Second)
+	assert.NoError(t, err)
+	assert.False(t, ok, "expected the lock to be held")
+
+	// leases expire unless renewed
+	c.Add(500 * time.Millisecond)
+	lease, err = a.Renew(ctx, lease, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, c.Now().Add(time.Second), lease.Expires)
+	c.Add(time.Second)
+	_, err = a.Renew(ctx, lease, time.Second)
+	assert.Equal(t, ErrNotHeld, err)
+
+	second, ok, err := a.Acquire(ctx, "key", "second", 1, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, second.Token > lease.Token, "expected tokens to increase")
+	assert.Equal(t, c.Now().Add(time.Minute), second.Expires, "expected leases to be bounded")
+
+	assert.Equal(t, ErrNotHeld, a.Release(ctx, lease))
+	assert.NoError(t, a.Release(ctx, second))
+	assert.Equal(t, ErrNotHeld, a.Release(ctx, second))
+}
+
+func TestArbiterSemaphore(t *testing.T) {
+	a, _ := newTestArbiter(t, routertest.NewRingpop(me), me)
+	ctx := context.Background()
+
+	var leases []Lease
+	for i := 0; i < 3; i++ {
+		lease, ok, err := a.Acquire(ctx, "pool", fmt.Sprint("holder", i), 3, time.Second)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		leases = append(leases, lease)
+	}
+	_, ok, _ := a.Acquire(ctx, "pool", "holder3", 3, time.Second)
+	assert.False(t, ok, "expected all permits to be held")
+
+	assert.NoError(t, a.Release(ctx, leases[1]))
+	_, ok, _ = a.Acquire(ctx, "pool", "holder3", 3, time.Second)
+	assert.True(t, ok)
+}
+
+func TestArbiterAcquireIsIdempotent(t *testing.T) {
+	a, c := newTestArbiter(t, routertest.NewRingpop(me), me)
+	ctx := context.Background()
+
+	lease, ok, err := a.Acquire(ctx, "key", "holder", 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	c.Add(500 * time.Millisecond)
+	again, ok, err := a.Acquire(ctx, "key", "holder", 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok, "expected the holder to get its lease again")
+	assert.Equal(t, lease.Token, again.Token)
+	assert.Equal(t, c.Now().Add(time.Second), again.Expires, "expected the lease to be renewed")
+	assert.Len(t, a.leases["key"], 1)
+}
+
+func TestArbiterRejectsKeysOfOtherNodes(t *testing.T) {
+	rp := routertest.NewRingpop(me, other)
+	a, _ := newTestArbiter(t, rp, me)
+
+	_, ok, err := a.Acquire(context.Background(), ownedKey(t, rp, other), "holder", 1, time.Second)
+	assert.Equal(t, ErrNotOwner, err)
+	assert.False(t, ok)
+	assert.Empty(t, a.leases)
+}
+
+func TestArbiterHoldsBackAcquiredKeys(t *testing.T) {
+	rp := routertest.NewRingpop(me, other)
+	a, c := newTestArbiter(t, rp, me)
+	ctx := context.Background()
+	key := ownedKey(t, rp, other)
+
+	// the key moves to the local node, the leases of other may still be held
+	rp.Fail(other)
+	_, ok, err := a.Acquire(ctx, key, "holder", 1, time.Second)
+	assert.NoError(t, err)
+	assert.False(t, ok, "expected the acquired key to be held back")
+
+	c.Add(time.Minute)
+	_, ok, err = a.Acquire(ctx, key, "holder", 1, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// and its leases are forgotten once it moves away
+	rp.Join(other)
+	assert.Empty(t, a.leases)
+}
+
+func TestLocker(t *testing.T) {
+	rp := routertest.NewRingpop(me, other)
+	local, _ := newTestArbiter(t, rp, me)
+	remote, _ := newTestArbiter(t, routertest.NewRingpop(other, me), other)
+	clients := func(client interface{}) Client {
+		assert.Equal(t, other, client.(*routertest.RemoteClient).Dest)
+		return remote
+	}
+	l := New(newTestRouter(t, rp), local, clients, WithHolder("worker"), WithTTL(time.Second))
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		key     string
+		arbiter *Arbiter
+	}{
+		{ownedKey(t, rp, me), local},
+		{ownedKey(t, rp, other), remote},
+	} {
+		lease, err := l.Lock(ctx, tt.key)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(lease.Holder, "worker/"), "expected the holder to be named after the locker")
+		assert.Len(t, tt.arbiter.leases[tt.key], 1, "expected the lease to be granted by the owner")
+
+		_, ok, err := l.TryLock(ctx, tt.key)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		renewed, err := l.Renew(ctx, lease)
+		assert.NoError(t, err)
+		assert.Equal(t, lease.Token, renewed.Token)
+
+		assert.NoError(t, l.Unlock(ctx, renewed))
+		assert.Equal(t, ErrNotHeld, l.Unlock(ctx, renewed))
+	}
+}
+
+func TestLockerWaits(t *testing.T) {
+	rp := routertest.NewRingpop(me)
+	a, _ := newTestArbiter(t, rp, me)
+	l := New(newTestRouter(t, rp), a, nil, WithRetryInterval(time.Millisecond))
+	bg := context.Background()
+
+	held, err := l.Lock(bg, "key")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(bg, 20*time.Millisecond)
+	defer cancel()
+	_, err = l.Lock(ctx, "key")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	acquired := make(chan Lease)
+	go func() {
+		lease, err := l.Lock(bg, "key")
+		assert.NoError(t, err)
+		acquired <- lease
+	}()
+	assert.NoError(t, l.Unlock(bg, held))
+	assert.True(t, (<-acquired).Token > held.Token)
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// loopbackClient is a thrift.TChanClient that calls a TChanServer in the same
+// process. Requests and responses are serialized as they would be for a
+// remote call, so the local node sees the same semantics as remote callers.
+type loopbackClient struct {
+	server thrift.TChanServer
+}
+
+func (c *loopbackClient) Call(ctx thrift.Context, serviceName, methodName string, req, resp athrift.TStruct) (bool, error) {
+	in := athrift.NewTMemoryBuffer()
+	if err := req.Write(athrift.NewTBinaryProtocolTransport(in)); err != nil {
+		return false, err
+	}
+
+	success, result, err := c.server.Handle(ctx, methodName, athrift.NewTBinaryProtocolTransport(in))
+	if err != nil {
+		return false, err
+	}
+
+	out := athrift.NewTMemoryBuffer()
+	protocol := athrift.NewTBinaryProtocolTransport(out)
+	if err := result.Write(protocol); err != nil {
+		return false, err
+	}
+	if err := resp.Read(protocol); err != nil {
+		return false, err
+	}
+	return success, nil
+}
+
+// localClient returns the client for the local node, see WithLocalLoopback.
+func (r *router) localClient(me string) (interface{}, error) {
+	d := Destination{Address: me, Local: true}
+	client, err := r.callFactory(d, func() (interface{}, error) {
+		if r.loopback != nil {
+			return r.factory.MakeRemoteClient(d, &loopbackClient{server: r.loopback})
+		}
+		return r.factory.GetLocalClient(), nil
+	})
+	return client, wrapError(ErrClientCreation, err)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/thrift/pingpong"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// pingPongClientFactory creates pingpong clients, with handler as the local
+// implementation.
+type pingPongClientFactory struct {
+	handler pingpong.TChanPingPong
+}
+
+func (f pingPongClientFactory) GetLocalClient() interface{} {
+	return f.handler
+}
+
+func (f pingPongClientFactory) MakeRemoteClient(client thrift.TChanClient) interface{} {
+	return pingpong.NewTChanPingPongClient(client)
+}
+
+func newLoopbackTestRouter(t *testing.T, handler pingpong.TChanPingPong, opts ...Option) Router {
+	rp := newTestRingpop(nil)
+	return newChannelTestRouter(rp, nil, append([]Option{withFactory(pingPongClientFactory{handler})}, opts...)...)
+}
+
+func TestLocalClientIsImplementationByDefault(t *testing.T) {
+	handler := &pingHandler{source: "local"}
+	client, err := newLoopbackTestRouter(t, handler).GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, handler, client)
+}
+
+func TestLocalLoopback(t *testing.T) {
+	handler := &pingHandler{source: "local"}
+	r := newLoopbackTestRouter(t, handler, WithLocalLoopback(pingpong.NewTChanPingPongServer(handler)))
+
+	client, err := r.GetClient("local")
+	assert.NoError(t, err)
+	assert.NotEqual(t, handler, client, "expected a client calling the server")
+
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+
+	pong, err := client.(pingpong.TChanPingPong).Ping(ctx, &pingpong.Ping{Key: "local"})
+	assert.NoError(t, err)
+	assert.Equal(t, "local", pong.Source)
+
+	_, err = client.(pingpong.TChanPingPong).Ping(ctx, &pingpong.Ping{Key: "fail"})
+	assert.IsType(t, &pingpong.PingError{}, err, "expected application errors to be returned as for remote calls")
+	assert.Equal(t, int32(2), handler.calls)
+}
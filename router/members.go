@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "sync"
+
+// memberSnapshot is the set of reachable members of the ring with a given
+// checksum, with what the router derives from them: the labels read for the
+// member filter and the assignment of the key ranges. It saves lookups that
+// filter or validate their destinations, or resolve key ranges, from listing
+// the members and reading their labels every time.
+type memberSnapshot struct {
+	checksum  uint32
+	members   []string
+	reachable map[string]bool
+
+	mu     sync.Mutex
+	labels map[string]map[string]string
+	ranges *rangeTable
+}
+
+func newMemberSnapshot(checksum uint32, members []string) *memberSnapshot {
+	reachable := make(map[string]bool, len(members))
+	for _, member := range members {
+		reachable[member] = true
+	}
+	return &memberSnapshot{
+		checksum:  checksum,
+		members:   members,
+		reachable: reachable,
+		labels:    make(map[string]map[string]string),
+	}
+}
+
+// memberSnapshot returns the snapshot of the members of the current ring.
+// Like the lookup memo, a snapshot is only kept when the ring did not change
+// while the members were listed, and none is kept when the checksum of the
+// ring cannot be had.
+func (r *router) memberSnapshot() (*memberSnapshot, error) {
+	checksum, checksumErr := r.ringpop.Checksum()
+	if checksumErr == nil {
+		r.membersMu.Lock()
+		snapshot := r.members
+		r.membersMu.Unlock()
+		if snapshot != nil && snapshot.checksum == checksum {
+			return snapshot, nil
+		}
+	}
+
+	members, err := r.ringpop.GetReachableMembers()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := newMemberSnapshot(checksum, members)
+	if checksumErr != nil {
+		return snapshot, nil
+	}
+	if after, err := r.ringpop.Checksum(); err == nil && after == checksum {
+		r.membersMu.Lock()
+		r.members = snapshot
+		r.membersMu.Unlock()
+	}
+	return snapshot, nil
+}
+
+// memberLabels returns the labels of member, read once for the snapshot.
+// Labels that cannot be read are read again on the next call.
+func (s *memberSnapshot) memberLabels(r *router, member string) map[string]string {
+	s.mu.Lock()
+	labels, ok := s.labels[member]
+	s.mu.Unlock()
+	if ok {
+		return labels
+	}
+
+	labels, err := r.memberLabels(member)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	s.labels[member] = labels
+	s.mu.Unlock()
+	return labels
+}
+
+// forgetLabels forgets the labels read for member, eg. when RefreshLabels
+// found them changed.
+func (s *memberSnapshot) forgetLabels(member string) {
+	s.mu.Lock()
+	delete(s.labels, member)
+	s.mu.Unlock()
+}
+
+// rangeTable returns the assignment of the ranges delimited by splits to the
+// members, made once for the snapshot.
+func (s *memberSnapshot) rangeTable(splits []string) *rangeTable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ranges == nil {
+		s.ranges = newRangeTable(s.members, splits)
+	}
+	return s.ranges
+}
+
+// forgetMemberLabels forgets the labels of member in the snapshot of the
+// members, so the member filter reads them again.
+func (r *router) forgetMemberLabels(member string) {
+	r.membersMu.Lock()
+	snapshot := r.members
+	r.membersMu.Unlock()
+	if snapshot != nil {
+		snapshot.forgetLabels(member)
+	}
+}
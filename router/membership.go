@@ -0,0 +1,176 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strings"
+
+	"github.com/uber/ringpop-go/swim"
+)
+
+// ReconcileMembers evicts the clients of all destinations that are not
+// reachable members of the ring according to ringpop, ends their sticky
+// sessions and removes the keys pinned to them. Clients of members that are
+// still reachable are kept.
+//
+// A ringpop that bootstraps again replaces its member list without reporting
+// a change for every member that left in the meantime, so the router
+// reconciles its whole cache against the member list when a join completes
+// rather than waiting for change events that may never arrive. The evicted
+// clients are counted by the router.reconcile.evicted counter.
+func (r *router) ReconcileMembers() {
+	if r.closed() {
+		return
+	}
+
+	members, err := r.ringpop.GetReachableMembers()
+	if err != nil {
+		r.logger.WithField("error", err).Debug("router failed to list members")
+		return
+	}
+	reachable := make(map[string]bool, len(members))
+	for _, member := range members {
+		reachable[r.normalize(member)] = true
+	}
+	r.forgetDestinations(reachable)
+
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+
+	var gone []string
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		entry, ok := r.cache.get(cacheKey)
+		if !ok || entry.local {
+			continue
+		}
+		if dest := strings.TrimPrefix(cacheKey, prefix); !reachable[dest] {
+			gone = append(gone, dest)
+		}
+	}
+	if len(gone) == 0 {
+		return
+	}
+
+	r.changesMu.Lock()
+	for _, dest := range gone {
+		r.logger.WithField("member", dest).Debug("router evicting client of departed member")
+		r.removeClient(dest)
+		r.endStickySessions(dest)
+		r.unpinDest(dest)
+	}
+	r.changesMu.Unlock()
+
+	r.statter.IncCounter("router.reconcile.evicted", nil, int64(len(gone)))
+	r.warmHotKeys("")
+}
+
+// forgetDestinations drops the state the router keeps by destination, eg.
+// circuit breakers, latencies and concurrency limits, for the destinations
+// that are not reachable, so the state of departed members does not
+// accumulate. Members that come back start afresh. The last change about a
+// member that is no longer alive is kept aside until a newer change about the
+// member arrives, so older changes delivered late, eg. an Alive after a
+// Leave, are still ignored; the last change about a member still joining is
+// kept as is.
+func (r *router) forgetDestinations(reachable map[string]bool) {
+	gone := func(dest string) bool {
+		return !reachable[dest]
+	}
+
+	r.changesMu.Lock()
+	for dest, change := range r.lastChanges {
+		if gone(dest) && change.Status != swim.Alive && change.Status != swim.Suspect {
+			r.departed[dest] = change
+			delete(r.lastChanges, dest)
+			delete(r.quarantine, dest)
+		}
+	}
+	r.changesMu.Unlock()
+
+	r.inflightMu.Lock()
+	for dest := range r.inflight {
+		if gone(dest) {
+			delete(r.inflight, dest)
+		}
+	}
+	for dest := range r.calls {
+		if gone(dest) {
+			delete(r.calls, dest)
+		}
+	}
+	for dest := range r.adaptiveLimits {
+		if gone(dest) {
+			delete(r.adaptiveLimits, dest)
+		}
+	}
+	r.inflightMu.Unlock()
+
+	r.breakersMu.Lock()
+	for dest := range r.breakers {
+		if gone(dest) {
+			delete(r.breakers, dest)
+		}
+	}
+	r.breakersMu.Unlock()
+
+	r.latenciesMu.Lock()
+	for dest := range r.latencies {
+		if gone(dest) {
+			delete(r.latencies, dest)
+		}
+	}
+	r.latenciesMu.Unlock()
+
+	r.errorStatsMu.Lock()
+	for dest := range r.errorStats {
+		if gone(dest) {
+			delete(r.errorStats, dest)
+		}
+	}
+	r.errorStatsMu.Unlock()
+
+	r.clientErrsMu.Lock()
+	for dest := range r.clientErrs {
+		if gone(dest) {
+			delete(r.clientErrs, dest)
+		}
+	}
+	r.clientErrsMu.Unlock()
+}
+
+// invalidateRing forgets the memoized destinations of keys and evicts the
+// clients of the destinations that left the ring, see ReconcileMembers. It
+// runs once for every checksum of the ring, so the router converges with the
+// ring even when ringpop coalesces membership changes or the router missed
+// some of their events.
+func (r *router) invalidateRing() {
+	if r.memo != nil {
+		r.memo.forget()
+	}
+	r.statter.IncCounter("router.ring.invalidated", nil, 1)
+	if r.cache.len() > 0 {
+		r.ReconcileMembers()
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestReconcileMembers(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+	r.ringpop.(*mocks.Ringpop).On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+
+	for i := 0; i < 5; i++ {
+		_, err := r.GetClient(fmt.Sprintf("node%d", i))
+		assert.NoError(t, err)
+	}
+	departed, _ := r.cache.get("127.0.0.1:3003")
+	r.Pin("pinned", "127.0.0.1:3004")
+
+	r.HandleEvent(swim.JoinCompleteEvent{})
+
+	assert.Len(t, r.cache.keys(), 3, "expected the clients of departed members to be evicted")
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3003")
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3004")
+	assert.True(t, departed.client.(*closingClient).isClosed())
+
+	_, ok := r.pinned("pinned")
+	assert.False(t, ok, "expected keys pinned to departed members to be unpinned")
+}
+
+func TestReconcileMembersForgetsDepartedDestinations(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t, WithCircuitBreaker(3, time.Second))
+	r.ringpop.(*mocks.Ringpop).On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, nil)
+
+	for _, dest := range []string{"127.0.0.1:3001", "127.0.0.1:3002"} {
+		r.breakerFor(dest)
+		r.recordLatency(dest, time.Millisecond)
+		r.errorStatsFor(dest, true)
+		r.recordClientError(dest, errors.New("dial failed"))
+	}
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Alive, Incarnation: 1})
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Leave, Incarnation: 1})
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3003", Status: swim.Alive, Incarnation: 1})
+
+	r.ReconcileMembers()
+
+	assert.Len(t, r.breakers, 1)
+	assert.Contains(t, r.breakers, "127.0.0.1:3001")
+	assert.Len(t, r.latencies, 1)
+	assert.Len(t, r.errorStats, 1)
+	assert.Len(t, r.clientErrs, 1)
+	assert.Contains(t, r.lastChanges, "127.0.0.1:3001")
+	assert.NotContains(t, r.lastChanges, "127.0.0.1:3002", "expected the last change of a departed member to be forgotten")
+	assert.Contains(t, r.lastChanges, "127.0.0.1:3003", "expected the last change of a joining member to be kept")
+}
+
+func TestReconcileMembersIgnoresStaleChangesOfDepartedMembers(t *testing.T) {
+	r, f, _ := newCacheTestRouter(t, WithWarmUp(0, time.Second))
+	r.ringpop.(*mocks.Ringpop).On("GetReachableMembers").Return([]string{"127.0.0.1:3000"}, nil)
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Leave, Incarnation: 2})
+	r.ReconcileMembers()
+
+	// an Alive sent before the Leave is delivered late
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Alive, Incarnation: 2})
+	assert.NotContains(t, r.lastChanges, "127.0.0.1:3002")
+	assert.Equal(t, 0, f.numCreated(), "expected no client for the departed member")
+
+	// the member rejoins with a new incarnation
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Alive, Incarnation: 3})
+	assert.Contains(t, r.lastChanges, "127.0.0.1:3002")
+	assert.NotContains(t, r.departed, "127.0.0.1:3002")
+	assert.Equal(t, 1, f.numCreated(), "expected the rejoined member to be warmed up")
+}
+
+func TestRingChangeInvalidates(t *testing.T) {
+	r, rp := newMemoTestRouter(t, 10)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3002"}, nil)
+
+	for _, key := range []string{"a", "b"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+
+	// checksums that did not change are ignored
+	r.HandleEvent(events.RingChecksumEvent{OldChecksum: 1, NewChecksum: 1})
+	assert.Len(t, r.memo.dests, 2)
+	assert.Equal(t, 2, r.cache.len())
+
+	r.HandleEvent(events.RingChecksumEvent{OldChecksum: 1, NewChecksum: 2})
+	assert.Empty(t, r.memo.dests, "expected the memoized destinations to be forgotten")
+	assert.Equal(t, []string{"127.0.0.1:3002"}, r.cache.keys(), "expected the clients of departed members to be evicted")
+
+	// a checksum invalidated already is skipped, and ring changes rely on
+	// the checksum event sent before them
+	_, err := r.GetClient("a")
+	assert.NoError(t, err)
+	r.HandleEvent(events.RingChecksumEvent{OldChecksum: 1, NewChecksum: 2})
+	r.HandleEvent(events.RingChangedEvent{})
+	assert.Len(t, r.memo.dests, 1)
+
+	r.HandleEvent(events.RingChecksumEvent{OldChecksum: 2, NewChecksum: 3})
+	assert.Empty(t, r.memo.dests)
+	assert.Equal(t, []string{"127.0.0.1:3002"}, r.cache.keys())
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+
+	"github.com/uber/ringpop-go"
+)
+
+// lookupMemo remembers the destinations keys resolved to on the ring with a
+// given checksum, so hot keys are not looked up again until the ring changes,
+// see WithLookupMemo.
+type lookupMemo struct {
+	sync.RWMutex
+
+	size     int
+	checksum uint32
+	dests    map[string]string
+}
+
+func newLookupMemo(size int) *lookupMemo {
+	return &lookupMemo{size: size, dests: make(map[string]string)}
+}
+
+// lookup returns the destination of key on the ring of rp and whether it was
+// memoized. Destinations memoized for another checksum than the current one
+// of the ring are forgotten.
+func (m *lookupMemo) lookup(rp ringpop.Interface, key string) (dest string, hit bool, err error) {
+	checksum, err := rp.Checksum()
+	if err != nil {
+		dest, err = rp.Lookup(key)
+		return dest, false, err
+	}
+
+	m.RLock()
+	dest, ok := m.dests[key]
+	current := m.checksum == checksum
+	m.RUnlock()
+	if ok && current {
+		return dest, true, nil
+	}
+
+	dest, err = rp.Lookup(key)
+	if err != nil {
+		return "", false, err
+	}
+	if dest == "" {
+		// never remember the invalid destinations of a bootstrapping ring
+		return dest, false, nil
+	}
+	// only remember the destination when the ring did not change meanwhile
+	if after, err := rp.Checksum(); err != nil || after != checksum {
+		return dest, false, nil
+	}
+
+	m.Lock()
+	if m.checksum != checksum {
+		m.checksum = checksum
+		m.dests = make(map[string]string)
+	}
+	if _, ok := m.dests[key]; !ok && len(m.dests) >= m.size {
+		// make room with an arbitrary key, hot keys are memoized again on
+		// their next lookup
+		for k := range m.dests {
+			delete(m.dests, k)
+			break
+		}
+	}
+	m.dests[key] = dest
+	m.Unlock()
+	return dest, false, nil
+}
+
+// forget forgets all memoized destinations.
+func (m *lookupMemo) forget() {
+	m.Lock()
+	m.dests = make(map[string]string)
+	m.Unlock()
+}
+
+// memoizedLookup returns the destination of key on the ring, from the memo
+// when enabled with WithLookupMemo.
+func (r *router) memoizedLookup(key string) (string, error) {
+	if r.memo == nil {
+		return r.ringpop.Lookup(key)
+	}
+	dest, hit, err := r.memo.lookup(r.ringpop, key)
+	if hit {
+		r.statter.IncCounter("router.lookup.memo.hit", nil, 1)
+	}
+	return dest, err
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func newMemoTestRouter(t *testing.T, size int) (*router, *mocks.Ringpop) {
+	rp := newTestRingpop(testLookups{
+		"a": "127.0.0.1:3001",
+		"b": "127.0.0.1:3002",
+	})
+	rp.On("Checksum").Return(uint32(1), nil)
+
+	return newRingpopTestRouter(t, rp, WithRemoteDialer(destDialer), WithLookupMemo(size)), rp
+}
+
+func TestLookupMemo(t *testing.T) {
+	r, rp := newMemoTestRouter(t, 10)
+
+	for i := 0; i < 3; i++ {
+		client, err := r.GetClient("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3001", client)
+	}
+	rp.AssertNumberOfCalls(t, "Lookup", 1)
+
+	_, err := r.GetClient("error")
+	assert.Error(t, err)
+	_, err = r.GetClient("error")
+	assert.Error(t, err)
+	rp.AssertNumberOfCalls(t, "Lookup", 3)
+}
+
+func TestLookupMemoInvalidatedByChecksum(t *testing.T) {
+	r, rp := newMemoTestRouter(t, 10)
+
+	_, err := r.GetClient("a")
+	assert.NoError(t, err)
+
+	// the ring changes and "a" moves
+	rp.ExpectedCalls = nil
+	rp.On("WhoAmI").Return("127.0.0.1:3000", nil)
+	rp.On("Checksum").Return(uint32(2), nil)
+	rp.On("Lookup", "a").Return("127.0.0.1:3002", nil)
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+	assert.Equal(t, uint32(2), r.memo.checksum)
+	assert.Len(t, r.memo.dests, 1)
+}
+
+func TestLookupMemoSize(t *testing.T) {
+	r, rp := newMemoTestRouter(t, 1)
+
+	for _, key := range []string{"a", "b", "a"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+	rp.AssertNumberOfCalls(t, "Lookup", 3)
+	assert.Equal(t, map[string]string{"a": "127.0.0.1:3001"}, r.memo.dests)
+}
+
+func TestLookupMemoDisabled(t *testing.T) {
+	r, _ := newMemoTestRouter(t, 0)
+	assert.Nil(t, r.memo)
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"github.com/uber/ringpop-go"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// A MultiRouter routes keys to the clients of several Thrift services that
+// run on the same ring. The routers of all services share a single client
+// cache, in which clients are cached per service and destination, and a
+// single ringpop listener.
+type MultiRouter interface {
+	// Service returns the router for the named service, or nil when no
+	// ClientFactory was given for it.
+	Service(name string) Router
+
+	// ServiceFor returns the router for the service key is routed to, as
+	// decided by the ServiceFunc configured with WithServiceFunc, or nil when
+	// there is no ServiceFunc or no ClientFactory was given for the service.
+	ServiceFor(key string) Router
+
+	// Close closes the routers of all services.
+	Close(ctx context.Context) error
+}
+
+type multiRouter struct {
+	routers     map[string]*router
+	serviceFunc ServiceFunc
+}
+
+// A ServiceFunc returns the name of the service that serves key, see
+// WithServiceFunc.
+type ServiceFunc func(key string) string
+
+// NewMulti creates a MultiRouter for the services in factories, which maps
+// the name of each service to the ClientFactory creating its clients. Remote
+// clients call the service under its name over ch, whatever WithService sets.
+// The options apply to the router of every service; options for the cache
+// configure the shared cache, which evicts idle clients in a single sweep for
+// all services. WithMaxClients bounds the clients of every service, so a
+// service only evicts its own clients. Evicted clients are accounted for, and
+// notified to the listeners of, the router of their service.
+func NewMulti(rp ringpop.Interface, factories map[string]ClientFactory, ch *tchannel.Channel, opts ...Option) MultiRouter {
+	m := &multiRouter{routers: make(map[string]*router, len(factories))}
+
+	var cache *clientCache
+	for service, f := range factories {
+		serviceOpts := append(append([]Option(nil), opts...), withService(service))
+		r := newRouter(rp, factoryV1{f}, ch, serviceOpts...)
+		if cache == nil {
+			cache = r.cache
+		}
+		r.cache = cache
+		m.routers[service] = r
+		m.serviceFunc = r.serviceFunc
+	}
+
+	rp.RegisterListener(m)
+	for _, r := range m.routers {
+		r.start()
+	}
+	return m
+}
+
+// withService makes the router call service and scope its clients in the
+// cache shared by the routers of a MultiRouter to the service.
+func withService(service string) Option {
+	return func(r *router) {
+		r.service = service
+		r.serviceScopedCache = true
+	}
+}
+
+func (m *multiRouter) Service(name string) Router {
+	r, ok := m.routers[name]
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+func (m *multiRouter) ServiceFor(key string) Router {
+	if m.serviceFunc == nil {
+		return nil
+	}
+	return m.Service(m.serviceFunc(key))
+}
+
+// HandleEvent passes event to the routers of all services.
+func (m *multiRouter) HandleEvent(event events.Event) {
+	for _, r := range m.routers {
+		r.HandleEvent(event)
+	}
+}
+
+func (m *multiRouter) Close(ctx context.Context) error {
+	var err error
+	for _, r := range m.routers {
+		if closeErr := r.Close(ctx); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
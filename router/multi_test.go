@@ -0,0 +1,159 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+func newMultiTestRouter(t *testing.T, opts ...Option) (MultiRouter, *mocks.Ringpop) {
+	rp := newTestRingpop(testLookups{
+		"other": "127.0.0.1:3002",
+	})
+
+	factories := make(map[string]ClientFactory)
+	for _, service := range []string{"users", "orders"} {
+		cf := &mocks.ClientFactory{}
+		cf.On("MakeRemoteClient", mock.Anything).Return(service + " client")
+		factories[service] = cf
+	}
+
+	ch, err := tchannel.NewChannel("caller", nil)
+	assert.NoError(t, err)
+
+	return NewMulti(rp, factories, ch, opts...), rp
+}
+
+func cachedKeys(r Router) []string {
+	return r.(*router).cache.keys()
+}
+
+func TestMultiRouterRoutesPerService(t *testing.T) {
+	m, rp := newMultiTestRouter(t)
+	rp.AssertNumberOfCalls(t, "RegisterListener", 1)
+	assert.Nil(t, m.Service("unknown"))
+
+	client, err := m.Service("users").GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "users client", client)
+
+	client, err = m.Service("orders").GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "orders client", client)
+
+	assert.Equal(t, "users", m.Service("users").(*router).serviceName())
+	assert.Len(t, cachedKeys(m.Service("users")), 2, "expected the cache to be shared")
+	assert.Contains(t, cachedKeys(m.Service("users")), "users@127.0.0.1:3001")
+	assert.Contains(t, cachedKeys(m.Service("users")), "orders@127.0.0.1:3001")
+}
+
+func TestMultiRouterEvictsAllServices(t *testing.T) {
+	m, _ := newMultiTestRouter(t)
+	m.Service("users").GetClient("remote")
+	m.Service("orders").GetClient("remote")
+
+	m.(*multiRouter).HandleEvent(swim.MemberlistChangesReceivedEvent{Changes: []swim.Change{
+		{Address: "127.0.0.1:3001", Status: swim.Faulty},
+	}})
+	assert.Empty(t, cachedKeys(m.Service("users")))
+}
+
+func TestMultiRouterBoundsClientsPerService(t *testing.T) {
+	m, _ := newMultiTestRouter(t, WithMaxClients(1))
+	users, orders := m.Service("users"), m.Service("orders")
+	_, err := users.GetClient("remote")
+	assert.NoError(t, err)
+	_, err = orders.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Len(t, cachedKeys(users), 2, "expected every service to hold its own clients")
+
+	_, err = orders.GetClient("other")
+	assert.NoError(t, err)
+	assert.Contains(t, cachedKeys(users), "users@127.0.0.1:3001", "expected a service not to evict the clients of another")
+	assert.NotContains(t, cachedKeys(users), "orders@127.0.0.1:3001")
+	assert.Equal(t, int64(0), users.Stats().Evictions)
+	assert.Equal(t, int64(1), orders.Stats().Evictions)
+}
+
+func TestMultiRouterSweepsOnce(t *testing.T) {
+	c := clock.NewMock()
+	m, _ := newMultiTestRouter(t, WithClock(c), WithClientIdleTimeout(time.Minute))
+	users, orders := m.Service("users"), m.Service("orders")
+	_, err := users.GetClient("remote")
+	assert.NoError(t, err)
+	_, err = orders.GetClient("remote")
+	assert.NoError(t, err)
+
+	// the sweep of the shared cache by orders evicts the idle client of
+	// users, which users accounts for
+	c.Add(2 * time.Minute)
+	_, err = orders.GetClient("other")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders@127.0.0.1:3002"}, cachedKeys(users))
+	assert.Equal(t, int64(1), users.Stats().Evictions)
+	assert.Equal(t, int64(1), orders.Stats().Evictions)
+}
+
+func TestMultiRouterCloseService(t *testing.T) {
+	m, _ := newMultiTestRouter(t)
+	m.Service("users").GetClient("remote")
+	m.Service("orders").GetClient("remote")
+
+	assert.NoError(t, m.Service("users").Close(context.Background()))
+	assert.Equal(t, []string{"orders@127.0.0.1:3001"}, cachedKeys(m.Service("orders")))
+
+	_, err := m.Service("orders").GetClient("remote")
+	assert.NoError(t, err, "expected the other services to keep working")
+
+	assert.NoError(t, m.Close(context.Background()))
+	assert.Empty(t, cachedKeys(m.Service("orders")))
+}
+
+func TestMultiRouterServiceFor(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	factories := map[string]ClientFactory{
+		"users":  &mocks.ClientFactory{},
+		"orders": &mocks.ClientFactory{},
+	}
+	byPrefix := func(key string) string {
+		return strings.SplitN(key, ":", 2)[0]
+	}
+	m := NewMulti(rp, factories, nil, WithServiceFunc(byPrefix), WithService("ignored"))
+
+	assert.Equal(t, m.Service("users"), m.ServiceFor("users:42"))
+	assert.Equal(t, m.Service("orders"), m.ServiceFor("orders:42"))
+	assert.Nil(t, m.ServiceFor("unknown:42"))
+	assert.Equal(t, "users", m.Service("users").(*router).serviceName(), "expected WithService to be ignored")
+
+	m, _ = newMultiTestRouter(t)
+	assert.Nil(t, m.ServiceFor("users:42"), "expected no router without a ServiceFunc")
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"net"
+	"strings"
+)
+
+// A Normalizer returns the canonical form of the address of a destination,
+// so that equivalent addresses written differently by the ring, by membership
+// changes and by callers share a client, see WithNormalizer.
+type Normalizer func(hostport string) string
+
+// NormalizeHostPort returns a Normalizer that writes IP addresses in their
+// canonical form, bracketing IPv6 addresses and shortening IPv4 addresses
+// mapped to IPv6, lowercases host names and adds defaultPort to addresses
+// without a port, unless it is empty. When resolve is not nil the host names
+// it returns an address for are replaced by that address, so a destination
+// known by its name and by its IP address is cached once. resolve runs for
+// every address normalized, and should not block on DNS.
+func NormalizeHostPort(defaultPort string, resolve func(host string) string) Normalizer {
+	return func(hostport string) string {
+		host, port, err := net.SplitHostPort(hostport)
+		if err != nil {
+			// without a port, possibly a bracketed IPv6 address
+			host, port = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), defaultPort
+		}
+		if host == "" {
+			return hostport
+		}
+
+		host = normalizeHost(host)
+		if resolve != nil && net.ParseIP(host) == nil {
+			if addr := resolve(host); addr != "" {
+				host = normalizeHost(addr)
+			}
+		}
+		if port == "" {
+			if strings.Contains(host, ":") {
+				return "[" + host + "]"
+			}
+			return host
+		}
+		return net.JoinHostPort(host, port)
+	}
+}
+
+// normalizeHost returns the canonical form of an IP address, keeping its
+// zone, or host lowercased when it is not an IP address.
+func normalizeHost(host string) string {
+	addr, zone := host, ""
+	if i := strings.LastIndex(host, "%"); i >= 0 {
+		addr, zone = host[:i], host[i:]
+	}
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String() + zone
+	}
+	return strings.ToLower(host)
+}
+
+// normalize returns the address dest is cached, evicted and reported under.
+// Destinations are normalized where they enter the router: when they come
+// out of a lookup and with the membership changes about them.
+func (r *router) normalize(dest string) string {
+	if r.normalizer == nil || dest == "" {
+		return dest
+	}
+	return r.normalizer(dest)
+}
+
+// normalizeAll returns dests normalized. dests is not modified, lookups may
+// share it.
+func (r *router) normalizeAll(dests []string) []string {
+	if r.normalizer == nil {
+		return dests
+	}
+	normalized := make([]string, len(dests))
+	for i, dest := range dests {
+		normalized[i] = r.normalize(dest)
+	}
+	return normalized
+}
+
+// sameDest returns whether a and b are the address of the same destination,
+// eg. a normalized destination and the address ringpop reports for the local
+// node.
+func (r *router) sameDest(a, b string) bool {
+	return a == b || r.normalizer != nil && r.normalize(a) == r.normalize(b)
+}
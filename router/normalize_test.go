@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+)
+
+func TestNormalizeHostPort(t *testing.T) {
+	hosts := map[string]string{"node-1": "10.0.0.1", "node-6": "2001:db8::1"}
+	normalize := NormalizeHostPort("2300", func(host string) string { return hosts[host] })
+
+	cases := map[string]string{
+		"10.0.0.1:2300":          "10.0.0.1:2300",
+		"10.0.0.1":               "10.0.0.1:2300",
+		"[::ffff:10.0.0.1]:2300": "10.0.0.1:2300",
+		"[2001:DB8:0::1]:2300":   "[2001:db8::1]:2300",
+		"2001:db8::1":            "[2001:db8::1]:2300",
+		"[2001:db8::1]":          "[2001:db8::1]:2300",
+		"[fe80::1%eth0]:2300":    "[fe80::1%eth0]:2300",
+		"Node-1:2300":            "10.0.0.1:2300",
+		"node-6":                 "[2001:db8::1]:2300",
+		"unknown.example.com:80": "unknown.example.com:80",
+		"":                       "",
+	}
+	for hostport, expected := range cases {
+		assert.Equal(t, expected, normalize(hostport), "normalizing %q", hostport)
+	}
+
+	assert.Equal(t, "10.0.0.1", NormalizeHostPort("", nil)("10.0.0.1"), "expected no port to be added")
+	assert.Equal(t, "node-1:2300", NormalizeHostPort("", nil)("Node-1:2300"))
+}
+
+func TestWithNormalizer(t *testing.T) {
+	rp := newTestRingpop(testLookups{
+		"name": "Node-1",
+		"v6":   "[2001:DB8::0:1]:2300",
+	})
+
+	hosts := map[string]string{"node-1": "10.0.0.1"}
+	r := newRingpopTestRouter(t, rp, WithNormalizer(NormalizeHostPort("2300", func(host string) string {
+		return hosts[host]
+	})))
+
+	for _, key := range []string{"name", "v6"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"10.0.0.1:2300", "[2001:db8::1]:2300"}, r.cache.keys())
+
+	// changes written differently evict the clients of their destination
+	r.HandleEvent(swim.MemberlistChangesReceivedEvent{Changes: []swim.Change{
+		{Address: "10.0.0.1:2300", Status: swim.Faulty},
+		{Address: "[2001:db8::1]:2300", Status: swim.Leave},
+	}})
+	assert.Equal(t, 0, r.cache.len())
+
+	// the state kept by destination is keyed by the normalized address
+	dest, err := r.lookup("name")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:2300", dest, "expected lookups to return normalized destinations")
+	r.HandleEvent(swim.MemberlistChangesReceivedEvent{Changes: []swim.Change{
+		{Address: "Node-1", Status: swim.Alive, Incarnation: 2},
+	}})
+	_, ok := r.lastChanges["10.0.0.1:2300"]
+	assert.True(t, ok, "expected changes to be recorded for the normalized address")
+	r.Pin("pinned", "Node-1")
+	dest, err = r.lookup("pinned")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:2300", dest, "expected pins to be normalized")
+}
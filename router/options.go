@@ -0,0 +1,1030 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/uber-common/bark"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// An Option is a modifier function that configures a router during
+// construction. Options are passed as trailing arguments to New.
+type Option func(*router)
+
+// WithMaxInflightPerDest limits the number of concurrent calls made through
+// Dispatch to a single destination. A value of zero or less disables the
+// limit, which is also the default.
+//
+// By default Dispatch returns ErrDestinationBusy when the limit for a
+// destination has been reached, see WithBlockWhenBusy to wait for a free slot
+// instead.
+func WithMaxInflightPerDest(n int) Option {
+	return func(r *router) {
+		r.maxInflightPerDest = n
+	}
+}
+
+// WithBlockWhenBusy makes Dispatch wait for a free slot when a destination
+// has reached the limit configured by WithMaxInflightPerDest, instead of
+// failing with ErrDestinationBusy. DispatchContext stops waiting when its
+// context is done.
+func WithBlockWhenBusy() Option {
+	return func(r *router) {
+		r.blockWhenBusy = true
+	}
+}
+
+// WithCallLimit limits the number of concurrent calls made through the remote
+// clients of a single destination to n, so a hot destination cannot exhaust
+// the goroutines and connections of the caller. Calls over the limit fail
+// with ErrDestinationBusy, or, when queue is set, wait for a free slot until
+// their context is done and fail with the error of the context. The limit is
+// shared by all clients of a destination and applies to calls made with
+// clients obtained in any way, contrary to WithMaxInflightPerDest which only
+// limits calls made through Dispatch. Clients of the local node and clients
+// created by a RemoteDialer are not limited.
+func WithCallLimit(n int, queue bool) Option {
+	return func(r *router) {
+		r.callLimit = n
+		r.callLimitQueue = queue
+	}
+}
+
+// WithDecisionSampler hands the given fraction of routing decisions to s. The
+// decision to sample is based on a counter, so a fraction of 0.01 passes every
+// hundredth decision to s. A fraction of zero or less or a nil sampler disable
+// sampling.
+func WithDecisionSampler(fraction float64, s Sampler) Option {
+	return func(r *router) {
+		r.sampler = newDecisionSampler(fraction, s)
+	}
+}
+
+// WithHotKeys configures keys for which the router recreates the client of
+// the new owner as soon as the previous owner is evicted, instead of on the
+// first request for the key.
+func WithHotKeys(keys ...string) Option {
+	return func(r *router) {
+		r.hotKeys = keys
+	}
+}
+
+// WithServiceScopedCache includes the name of the called service in the key
+// of the client cache, making it service + "@" + destination instead of only
+// the destination, so clients for different services on the same host:port
+// are cached separately. By default the cache is keyed on the destination.
+func WithServiceScopedCache() Option {
+	return func(r *router) {
+		r.serviceScopedCache = true
+	}
+}
+
+// WithMaxClients limits the number of clients kept in the client cache. When
+// a new client would exceed the limit, the least recently used clients are
+// evicted, along with a small share of the limit so the next creations do
+// not evict again. A value of zero or less, the default, keeps all clients.
+//
+// Evicted remote clients that implement io.Closer are closed, this holds for
+// every client evicted by the router, including those evicted because their
+// destination left the ring. Local clients are never closed.
+func WithMaxClients(n int) Option {
+	return func(r *router) {
+		r.maxClients = n
+	}
+}
+
+// WithCacheShards sets the number of shards of the client cache. Every shard
+// has its own lock, so more shards reduce contention between goroutines
+// getting or creating clients for different destinations. It defaults to 32.
+func WithCacheShards(n int) Option {
+	return func(r *router) {
+		r.cacheShards = n
+	}
+}
+
+// WithClientIdleTimeout evicts clients that have not been returned by the
+// router for longer than d. Idle clients are evicted when they are requested
+// again, which creates a new client, or when another client is created at
+// least d after the last eviction of idle clients. A duration of zero or
+// less, the default, keeps idle clients.
+func WithClientIdleTimeout(d time.Duration) Option {
+	return func(r *router) {
+		r.idleTimeout = d
+	}
+}
+
+// WithStatsReporter is used to specify a bark-compatible (bark.StatsReporter)
+// stats reporter to which the router emits its metrics in addition to keeping
+// the counters returned by Stats. Backends such as Prometheus or Tally can be
+// used through a bark.StatsReporter adapter. If no reporter is provided,
+// metrics are only available through Stats.
+func WithStatsReporter(s bark.StatsReporter) Option {
+	return func(r *router) {
+		r.statter = s
+	}
+}
+
+// WithLogger sets the logger the router logs to. At debug level the router
+// logs its lookups, the creation of clients and their removal from the cache.
+// Other logging libraries can be used through a bark.Logger adapter. By
+// default the router logs to the "router" logger of the logging package,
+// whose level can be set with logging.SetLevel.
+func WithLogger(l bark.Logger) Option {
+	return func(r *router) {
+		r.logger = l
+	}
+}
+
+// A RemoteDialer creates the client for a remote destination from its
+// address, instead of having the ClientFactory wrap a TChannel Thrift client.
+// This allows remote clients to use another transport, for example gRPC:
+//
+//     dialer := func(dest string) (interface{}, error) {
+//         conn, err := grpc.Dial(dest, grpc.WithInsecure())
+//         if err != nil {
+//             return nil, err
+//         }
+//         return pb.NewKeyValueClient(conn), nil
+//     }
+//     r := router.New(rp, factory, nil, router.WithRemoteDialer(dialer))
+//
+// The ClientFactory is still used for the local client and no TChannel
+// channel is needed. An error returned by the dialer is returned from
+// GetClient as an Error of kind ErrClientCreation and nothing is cached. If
+// the returned client implements io.Closer it is closed when it is evicted
+// from the cache. A returned thrift.TChanClient is handed to the ClientFactory
+// like the connections of any Transport, see ClientConn.
+type RemoteDialer func(dest string) (interface{}, error)
+
+// WithRemoteDialer makes the router create remote clients with d, see
+// RemoteDialer. It is a shorthand for WithTransport(d).
+func WithRemoteDialer(d RemoteDialer) Option {
+	return func(r *router) {
+		r.transport = d
+	}
+}
+
+// WithCircuitBreaker opens the circuit to a remote destination after failures
+// consecutive calls to it failed. While the circuit is open GetClient returns
+// ErrCircuitOpen for keys owned by the destination, and calls through clients
+// that were already handed out fail with ErrCircuitOpen without reaching the
+// destination. After cooldown a single call is let through while the others
+// still fail; the circuit closes when it succeeds and stays open for another
+// cooldown when it fails.
+//
+// Only calls that fail with an error count as failures, application errors
+// declared in the Thrift IDL and ClassBadRequest do not. Clients created by a
+// RemoteDialer are not covered. A value of zero or less for failures, the
+// default, disables circuit breaking.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(r *router) {
+		r.breakerFailures = failures
+		r.breakerCooldown = cooldown
+	}
+}
+
+// WithCircuitFallback makes GetClient fall back to the next of the n nodes
+// responsible for a key, as resolved by ringpop's LookupN, when the circuit of
+// the owner is open. ErrCircuitOpen is only returned when the circuits of all
+// n nodes are open.
+func WithCircuitFallback(n int) Option {
+	return func(r *router) {
+		r.circuitFallback = n
+	}
+}
+
+// WithReplicaPoints sets the number of replica points per node of ringpop's
+// ring, which the router needs to compute the key ranges passed to the
+// callbacks registered with OnOwnershipChange. It must match the
+// ReplicaPoints of the hashring.Configuration ringpop was created with and
+// defaults to ringpop's default of 100.
+func WithReplicaPoints(n int) Option {
+	return func(r *router) {
+		r.replicaPoints = n
+	}
+}
+
+// WithRetry makes Dispatch retry calls that fail because the destination
+// could not be reached, after evicting the client of the destination and
+// resolving the key again, so the retry goes to the new owner once the ring
+// has converged. Only calls made through Dispatch are retried. Make the calls
+// with a context of WithIdempotencyKey so the owner can recognize a write it
+// processed already.
+func WithRetry(policy RetryPolicy) Option {
+	return func(r *router) {
+		r.retry = &policy
+	}
+}
+
+// WithWarmUp makes the router create the client of a member as soon as it
+// becomes alive, instead of on the first request for one of its keys, and
+// open the TChannel connection to it with a ping bounded by timeout. When
+// nearest is greater than zero only the nearest members following the local
+// node on the ring, as resolved by ringpop's LookupN on the address of the
+// local node, are warmed up; otherwise all members are. A timeout of zero or
+// less defaults to one second.
+//
+// Warm-up runs on the goroutine delivering the membership change. Clients
+// created by a RemoteDialer are created but not pinged.
+func WithWarmUp(nearest int, timeout time.Duration) Option {
+	return func(r *router) {
+		r.warmUpEnabled = true
+		r.warmUpNearest = nearest
+		r.warmUpTimeout = timeout
+		if timeout <= 0 {
+			r.warmUpTimeout = defaultWarmUpTimeout
+		}
+	}
+}
+
+// WithLocalLoopback makes the client for the local node call server, the
+// Thrift server of the local implementation, instead of calling the local
+// implementation directly. The client is created by the ClientFactory's
+// MakeRemoteClient, and requests and responses are serialized as they are for
+// remote calls, which gives local calls the exact semantics of remote calls
+// at the cost of the serialization. It does not go through the network.
+//
+// By default the local client is the implementation returned by the
+// ClientFactory's GetLocalClient, which is called without serialization.
+func WithLocalLoopback(server thrift.TChanServer) Option {
+	return func(r *router) {
+		r.loopback = server
+	}
+}
+
+// WithSuspectFallback makes GetClient and Dispatch route a key to another of
+// the n nodes responsible for it, as resolved by ringpop's LookupN, while the
+// last membership change about the owner reported it as suspect, faulty or
+// leaving. When all n nodes are in such a state the owner is used anyway.
+// This keeps keys served during partial outages, at the cost of consistency
+// for writes, so it is best suited to reads.
+func WithSuspectFallback(n int) Option {
+	return func(r *router) {
+		r.suspectFallback = n
+	}
+}
+
+// A KeyMapper reduces a key to the part of it that decides which node owns
+// the key, for example the tenant of a "tenant:entity:id" key:
+//
+//     mapper := func(key string) string {
+//         return strings.SplitN(key, ":", 2)[0]
+//     }
+type KeyMapper func(key string) string
+
+// WithKeyMapper makes the router resolve the keys passed to it against the
+// ring after mapping them with m. Keys are reported unmapped everywhere else,
+// for example to a Sampler.
+func WithKeyMapper(m KeyMapper) Option {
+	return func(r *router) {
+		r.keyMapper = m
+	}
+}
+
+// WithTracer makes the router trace GetClient and GetClientContext with spans
+// started by t, tagged with the hash of the key, the destination and whether
+// the client came from the cache. GetClientContext starts its span as a child
+// of the span in its context, GetClient starts a new trace.
+func WithTracer(t Tracer) Option {
+	return func(r *router) {
+		r.tracer = t
+	}
+}
+
+// WithHealthCheck makes the router ping the destinations of its cached remote
+// clients every interval, waiting at most timeout for every ping. The clients
+// of a destination that does not respond are evicted from the cache, and
+// created again on the next call for it, without waiting for the membership
+// to mark the destination faulty. Clients created by a RemoteDialer are not
+// checked.
+func WithHealthCheck(interval, timeout time.Duration) Option {
+	return func(r *router) {
+		r.healthInterval = interval
+		r.healthTimeout = timeout
+	}
+}
+
+// WithStatusPredicate makes the router decide with p what to do with the
+// clients of the member every membership change is about, instead of
+// DefaultStatusPredicate. For example, to stop routing to suspect members:
+//
+//     router.WithStatusPredicate(func(change swim.Change) router.EvictionDecision {
+//         if change.Status == swim.Suspect {
+//             return router.QuarantineClient
+//         }
+//         return router.DefaultStatusPredicate(change)
+//     })
+//
+// Hot keys are warmed after every eviction, members are only warmed up when
+// they become alive and their clients are kept.
+func WithStatusPredicate(p StatusPredicate) Option {
+	return func(r *router) {
+		r.statusPredicate = p
+	}
+}
+
+// A ClientOptionsProvider returns the options of the TChannel client created
+// for the remote destination dest. A nil result, or options without HostPort,
+// make the client call dest.
+type ClientOptionsProvider func(dest string) *thrift.ClientOptions
+
+// WithClientOptions makes the router create the TChannel clients of remote
+// destinations with the options returned by p instead of options that only
+// set the HostPort to the destination. Only the TChannelTransport the router
+// creates on its channel uses p; clients created by a RemoteDialer or another
+// Transport are not affected.
+func WithClientOptions(p ClientOptionsProvider) Option {
+	return func(r *router) {
+		r.clientOptionsProvider = p
+	}
+}
+
+// WithLookupStrategy makes the router resolve keys with s instead of
+// ringpop's ring, see LookupStrategy. The strategy applies to every way of
+// getting a client and to Resolve. OnOwnershipChange keeps reporting the
+// ranges of ringpop's ring.
+func WithLookupStrategy(s LookupStrategy) Option {
+	return func(r *router) {
+		r.lookupStrategy = s
+	}
+}
+
+// A WeightFunc returns the capacity of member relative to the other members,
+// see WithWeights.
+type WeightFunc func(member string) float64
+
+// WithWeights makes the router place keys in proportion to the weights
+// returned by fn, so a member of weight 4 owns about four times the keys of a
+// member of weight 1. Weighting is done with rendezvous hashing, so
+// WithWeights selects RendezvousLookup, unless RangeLookup is selected by
+// another option, in whichever order, which ignores the weights. Members
+// without a positive weight have weight 1. fn is called for every member on
+// every lookup and must be fast, eg. read from a map maintained by the
+// application.
+func WithWeights(fn WeightFunc) Option {
+	return func(r *router) {
+		r.weights = fn
+	}
+}
+
+// WithWeighting is WithWeights with the weight of a member read from its
+// label named label, as read by the LabelsFunc of WithLabels, which must be
+// set as well. The label holds a number, eg. weight=4; members whose label is
+// missing, does not parse or is not positive have weight 1. Labels are read
+// once for every member until the ring changes or RefreshLabels finds them
+// changed. A WeightFunc given to WithWeights takes precedence.
+func WithWeighting(label string) Option {
+	return func(r *router) {
+		r.weightLabel = label
+	}
+}
+
+// WithInterceptors makes every call through the remote clients created by the
+// router pass through interceptors, the first one being the outermost. They
+// see calls rejected by an open circuit, see WithCircuitBreaker. Calls to the
+// local node and through clients created by a RemoteDialer are not
+// intercepted.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(r *router) {
+		r.interceptors = append(r.interceptors, interceptors...)
+	}
+}
+
+// WithShadow makes GetShadowedClient return, for the given fraction of its
+// calls, the client of the destination resolve places the key on next to the
+// client of its owner, so traffic can be mirrored to validate a new placement
+// before switching to it. Calls are sampled like WithDecisionSampler does.
+// The counters router.shadow and router.shadow.mismatch count the sampled
+// calls and the calls whose shadow destination differs from the owner.
+func WithShadow(fraction float64, resolve ShadowResolver) Option {
+	return func(r *router) {
+		r.shadow = newShadow(fraction, resolve)
+	}
+}
+
+// WithTransport makes the router connect to remote destinations through t
+// instead of a TChannelTransport on the channel it is created with, which
+// then may be nil. See Transport.
+func WithTransport(t Transport) Option {
+	return func(r *router) {
+		r.transport = t
+	}
+}
+
+// WithAuditLog hands a record of the given fraction of the lookups of keys to
+// export, see AuditRecord, to debug reports of a key being routed to several
+// nodes. Lookups are sampled like WithDecisionSampler does, failed lookups are
+// not recorded. A fraction of zero or less or a nil export disable the log.
+func WithAuditLog(fraction float64, export AuditFunc) Option {
+	return func(r *router) {
+		r.auditLog = newAuditLog(fraction, export)
+	}
+}
+
+// WithStaleReads makes GetReadClient return the client of the previous owner
+// of a key when its owner is unreachable and ownership of the key moved to
+// the owner within the given window, for reads that tolerate brief staleness
+// but not unavailability. An owner is unreachable when it is suspected, has
+// failed or left, is quarantined, or its client cannot be created, eg. because
+// its circuit is open. Ownership is tracked against ringpop's hash ring, so
+// stale reads are not served for keys resolved with RendezvousLookup. A
+// window of zero or less, the default, disables stale reads.
+func WithStaleReads(window time.Duration) Option {
+	return func(r *router) {
+		r.staleReadWindow = window
+	}
+}
+
+// WithEvictionDrain makes the router wait, for at most timeout, for the calls
+// in flight through an evicted remote client to finish before closing it,
+// instead of closing it right away while calls are active. Calls started
+// through the client while the router waits are waited for too. Clients whose
+// calls are still running after timeout are closed anyway and counted by the
+// router.client.drain.timeout counter. Calls through clients created by a
+// RemoteDialer, or by a Transport that does not return TChannel clients, are
+// not tracked. A timeout of zero or less, the default, closes evicted
+// clients right away.
+func WithEvictionDrain(timeout time.Duration) Option {
+	return func(r *router) {
+		r.evictionDrain = timeout
+	}
+}
+
+// WithCreationLimit bounds the number of remote clients the router creates at
+// the same time to n, so a large membership change does not cause a
+// thundering herd of connection setups. A creation beyond the limit waits for
+// at most wait for another creation to finish and fails with
+// ErrCreationThrottled after that, counted by the router.client.throttled
+// counter; a wait of zero or less fails right away. Calls for a destination
+// whose client is being created wait for that creation and do not count
+// against the limit. A value of zero or less for n, the default, disables the
+// limit.
+func WithCreationLimit(n int, wait time.Duration) Option {
+	return func(r *router) {
+		r.creationLimit = n
+		r.creationWait = wait
+	}
+}
+
+// WithPolicy makes the router route keys to the destination p selects instead
+// of their owner, eg. LeastLoadedReplica or LocalityAware for zone aware
+// routing. The policy applies to every way of getting the client of a single
+// key; GetClientN and the other ways of getting the clients of all replicas of
+// a key are not affected, and pinned keys go to their pinned destination. The
+// owner of a key, as reported by Resolve and used for ownership decisions, eg.
+// by OwnersForKeyspace and WarmUp, is never chosen by the policy. A nil policy,
+// the default, routes keys to their owner.
+func WithPolicy(p Policy) Option {
+	return func(r *router) {
+		r.policy = p
+	}
+}
+
+// WithReadPolicy makes GetReadClient route keys to the destination p selects,
+// eg. LeastLoadedReplica with the loads of a LoadTable to spread the reads of
+// hot keys over their replicas, or FollowerReplica to keep reads off the
+// owners, while writes through GetClient keep going to the destination of
+// WithPolicy and writes through GetWriteClient to the owner. Reads of pinned
+// keys, and reads for which p fails or selects a destination whose client
+// cannot be had, are routed like GetClient routes them. A nil policy, the
+// default, routes all reads like GetClient.
+func WithReadPolicy(p Policy) Option {
+	return func(r *router) {
+		r.readPolicy = p
+	}
+}
+
+// WithChecksumHeaders makes every call through the remote clients created by
+// the router carry the checksum of ringpop's ring at the time of the call in
+// the HeaderChecksum header, for the destination to reject calls routed with a
+// ring it disagrees with, see ChecksumValidator. The header is set before the
+// calls go through the interceptors of WithInterceptors, and like them it is
+// not set on calls through clients created by a RemoteDialer.
+func WithChecksumHeaders() Option {
+	return func(r *router) {
+		r.checksumHeaders = true
+	}
+}
+
+// WithRetryBudget bounds the retries of Dispatch and RunOnOwner, see
+// WithRetry, across all calls of the router to minPerSecond retries per second
+// plus ratio of the calls made in the last second, eg. a ratio of 0.1 lets 10%
+// of the calls be retried. Once the budget is spent, calls fail with the error
+// of their last attempt instead of being retried, counted by the
+// router.retry.budget.exhausted counter, so an incident affecting the whole
+// ring does not turn into a retry storm. A ratio and a minimum of zero or
+// less, the default, leave retries unbounded.
+func WithRetryBudget(ratio float64, minPerSecond int) Option {
+	return func(r *router) {
+		r.retryBudget = newRetryBudget(ratio, minPerSecond)
+	}
+}
+
+// WithClientPool makes the router keep size(dest) clients for the remote
+// destination dest, and return them in turn from GetClient, so the calls to a
+// hot destination are spread over several connections. Every client of a
+// pool is made from a Dial of the Transport; a Transport that is a Connector,
+// like the default TChannelTransport, opens another connection to the
+// destination for every client but the first. The pool is sized when the
+// client of a destination is created and stays the same until the clients are
+// evicted. A nil size, the default, or a size of one or less keeps a single
+// client per destination.
+func WithClientPool(size PoolSizeFunc) Option {
+	return func(r *router) {
+		r.poolSize = size
+	}
+}
+
+// WithService makes the remote clients of the default TChannelTransport call
+// the named service instead of the service of the channel the router is
+// created with, to route keys to the nodes of another service, eg. from the
+// channel of "api" to "geo-sharded-storage". The ringpop of the router must
+// be the one of the ring of that service. It has no effect with WithTransport
+// or on the routers of NewMulti, which call the service they are created for.
+func WithService(name string) Option {
+	return func(r *router) {
+		r.service = name
+	}
+}
+
+// WithServiceFunc makes ServiceFor of a MultiRouter return the router of the
+// service fn returns for a key, so the keys of several services that share a
+// ring are routed from one place. It has no effect on a single Router.
+func WithServiceFunc(fn ServiceFunc) Option {
+	return func(r *router) {
+		r.serviceFunc = fn
+	}
+}
+
+// WithLabels makes the router pass the labels fn returns for a destination to
+// the ClientFactoryV2 in Destination.Labels, so the factory can create a
+// client for the version of the interface the node serves. Labels are read
+// when the client of a destination is created; call RefreshLabels when the
+// labels of a node change to have its client created again, or see
+// WithLabelRefresh.
+func WithLabels(fn LabelsFunc) Option {
+	return func(r *router) {
+		r.labels = fn
+	}
+}
+
+// WithDeadlineRouting makes the router track the latency of the calls to
+// every destination and makes GetClientContext, when its context has a
+// deadline, skip the owner of a key if its estimated p99 latency exceeds the
+// time left. Such keys fall back to the next of the n nodes responsible for
+// them, as resolved by ringpop's LookupN, that can meet the deadline, and
+// fail fast with ErrDeadlineInfeasible when none can or n is one or less.
+// Only Thrift calls through the remote clients are measured.
+func WithDeadlineRouting(n int) Option {
+	return func(r *router) {
+		r.deadlineRouting = true
+		r.deadlineFallback = n
+	}
+}
+
+// WithAdvertisement pauses the router until its channel has been advertised
+// to Hyperbahn, and again when Hyperbahn gives up advertising it, so a node
+// other peers cannot reach stops serving keyed traffic. While paused, every
+// method handing out clients, GetClient, GetClientN, GetClients, Broadcast and
+// the methods built on them, returns ErrNotReady. The router only
+// learns about the advertisement through the handler of AdvertisementHandler,
+// which must be passed to the Hyperbahn client of the channel.
+func WithAdvertisement() Option {
+	return func(r *router) {
+		r.advertisement = true
+		r.state.paused = 1
+	}
+}
+
+// WithLookupMemo makes the router remember the destinations of up to size
+// keys, so routing the same keys over and over does not look them up on the
+// ring every time. The destinations are remembered with the checksum of the
+// ring and forgotten as soon as ringpop's Checksum changes. It only applies
+// to the RingLookup strategy, whose result depends on the ring alone. A size
+// of zero or less, the default, disables the memo.
+func WithLookupMemo(size int) Option {
+	return func(r *router) {
+		if size > 0 {
+			r.memo = newLookupMemo(size)
+		}
+	}
+}
+
+// WithBroadcastParallelism limits the number of members a Broadcast calls
+// concurrently to n. The default is 16.
+func WithBroadcastParallelism(n int) Option {
+	return func(r *router) {
+		r.broadcastParallelism = n
+	}
+}
+
+// WithQuorumTimeout bounds every call of a QuorumCall to timeout, so a slow
+// node fails its call rather than holding up the quorum. Without it the calls
+// are only bounded by the context of the QuorumCall.
+func WithQuorumTimeout(timeout time.Duration) Option {
+	return func(r *router) {
+		r.quorumTimeout = timeout
+	}
+}
+
+// WithUncachedLocalClient makes the router get the client of the local node
+// from the ClientFactory on every call instead of caching it, for factories
+// whose local client is a stateful facade that must be constructed for every
+// request. Remote clients can opt out of the cache by implementing Cacheable.
+func WithUncachedLocalClient() Option {
+	return func(r *router) {
+		r.uncachedLocal = true
+	}
+}
+
+// WithMemberFilter makes keys only resolve to the members of the ring that
+// filter accepts, eg. the members labeled role=worker in a ring that mixes
+// roles, or none of the canaries. A key resolves to the first accepted member
+// from its owner on, in the order of the ring or of the rendezvous scores.
+// Labels are read with the LabelsFunc of WithLabels, once for every member
+// until the ring changes or RefreshLabels finds them changed. Filtering walks
+// the members from the owner on for every lookup, which is slower than a
+// plain lookup; combine it with the client cache rather than WithLookupMemo,
+// which it bypasses.
+func WithMemberFilter(filter MemberFilter) Option {
+	return func(r *router) {
+		r.memberFilter = filter
+	}
+}
+
+// WithZoneRouting routes keys to the first healthy of the n nodes responsible
+// for them that is in the zone of the local node, and to another zone when
+// none is, see LocalityAware. The zone of a member is the value of its label
+// named label, as read by the LabelsFunc of WithLabels, which must be set as
+// well. Routes to remote nodes are counted by the router.route.zone.local and
+// router.route.zone.cross counters. The policy of WithPolicy, in whichever
+// order the options are given, then selects among the nodes in the zone, eg.
+// the least loaded of them.
+func WithZoneRouting(n int, label string) Option {
+	return func(r *router) {
+		r.zoneLabel = label
+		r.zoneReplicas = n
+	}
+}
+
+// WithAddressTranslator makes the Transport dial, ping and connect to the
+// address t returns for a member instead of its address in the ring, for
+// nodes that gossip an address other nodes cannot dial, eg. behind a NAT or
+// in Kubernetes pods without host networking. Clients are still cached,
+// evicted and reported by the address of the member in the ring. The
+// ClientOptionsProvider of WithClientOptions is given the dialed address.
+func WithAddressTranslator(t AddressTranslator) Option {
+	return func(r *router) {
+		r.addressTranslator = t
+	}
+}
+
+// WithKeyRanges makes the router resolve keys by their order, cutting the key
+// space into the ranges delimited by splits, see RangeLookup. A key belongs
+// to the range starting at the greatest split not after it, or to the first
+// range when it is before every split, so len(splits) + 1 ranges are shared
+// by the members. Splits are compared as strings, so numeric keys should be
+// zero-padded to a fixed width. Every node must be given the same splits.
+// WithKeyRanges selects RangeLookup.
+func WithKeyRanges(splits ...string) Option {
+	return func(r *router) {
+		r.rangeSplits = sortedSplits(splits)
+		r.lookupStrategy = RangeLookup
+	}
+}
+
+// WithErrorTracking makes the router classify the outcome of every call
+// through the TChannel clients it creates, see ErrorClass, and keep the rates
+// of every class per destination over window, as returned by ErrorRate and
+// RingView.ErrorRate for policies. Errors are counted by the
+// router.call.error.<class> counters, eg. router.call.error.timeout. Calls
+// through clients created by a RemoteDialer or another Transport that is not
+// TChannel's are not tracked.
+func WithErrorTracking(window time.Duration) Option {
+	return func(r *router) {
+		r.errorWindow = window
+	}
+}
+
+// WithErrorBudget treats a destination like one whose circuit is open, see
+// WithCircuitBreaker, while more than maxRate of its recent calls failed with
+// one of classes, by default ClassTimeout and ClassConnection. Its clients
+// fail with ErrCircuitOpen, policies see it as not healthy and
+// WithCircuitFallback routes its keys to replicas. Destinations with fewer
+// than minCalls recent calls are never over budget. It enables error
+// tracking, over a window of 10 seconds unless set with WithErrorTracking.
+func WithErrorBudget(maxRate float64, minCalls int, classes ...ErrorClass) Option {
+	if len(classes) == 0 {
+		classes = []ErrorClass{ClassTimeout, ClassConnection}
+	}
+	return func(r *router) {
+		r.errorBudget = &errorBudget{maxRate: maxRate, minCalls: minCalls, classes: classes}
+	}
+}
+
+// WithConnectionWatch makes the router check the connections of its Transport
+// every interval and evict the cached client of a destination as soon as its
+// connections closed, without waiting for the membership to report a change
+// of the destination or for the next call to fail. TChannel does not notify
+// of closed connections, hence the polling. Only transports that are
+// ConnectionWatchers are watched, TChannelTransport is one.
+func WithConnectionWatch(interval time.Duration) Option {
+	return func(r *router) {
+		r.watchInterval = interval
+	}
+}
+
+// WithClock makes the router read the time and wait with c instead of the
+// system clock. Every time-based behavior of the router goes through c, eg.
+// cache expiry, health checks, hedging delays, retry backoffs and circuit
+// cool downs, so tests can drive it with a clock.Mock.
+func WithClock(c clock.Clock) Option {
+	return func(r *router) {
+		r.clock = c
+	}
+}
+
+// WithRandSource makes the router draw the random numbers of its jitter, see
+// RetryPolicy.Jitter, from src instead of a source seeded with the time, so
+// tests can be deterministic. src need not be safe for concurrent use.
+func WithRandSource(src rand.Source) Option {
+	return func(r *router) {
+		r.rand = newRand(src)
+	}
+}
+
+// WithChannelProvider makes the router get the channel of its remote calls
+// from p on the creation of its first remote client, instead of taking it as
+// an argument of New, so the router can be constructed before the channel is
+// ready, eg. by a dependency injection container. Concurrent first calls wait
+// for a single call of p. The channel is kept once p returned one; when p
+// fails, the creation of the client fails with ErrClientCreation and p is
+// called again for the next client. It has no effect when New is given a
+// channel or with WithTransport.
+func WithChannelProvider(p ChannelProvider) Option {
+	return func(r *router) {
+		r.channelProvider = p
+	}
+}
+
+// WithSnapshotFile makes the router write its Snapshot to path when it is
+// closed and, when created, read the snapshot left there by the previous run
+// of the node and warm its destinations in the background, see WarmSnapshot,
+// so a restarted node connects to its previous peers while ringpop
+// bootstraps. A missing file is ignored; failures to read or write it are
+// logged and counted by the router.snapshot.error counter. The routers of a
+// MultiRouter use the file of path suffixed with a dot and their service.
+func WithSnapshotFile(path string) Option {
+	return func(r *router) {
+		r.snapshotFile = path
+	}
+}
+
+// WithTenantQuotas limits the rate at which the keys of every tenant, as
+// returned by tenant, are routed to the quota returned by quota, so the keys
+// of a tenant cannot starve those of the others on the destinations they
+// share. Keys over the quota of their tenant are rejected with
+// ErrQuotaExceeded when resolved, before a client or a call slot is used,
+// and counted by the router.tenant.rejected counter. The quota applies to every
+// way of getting clients for keys, eg. GetClientN and GetClients, which reject
+// all keys when one of them is over its quota. Quotas are per router, not per
+// cluster.
+func WithTenantQuotas(tenant TenantFunc, quota QuotaFunc) Option {
+	return func(r *router) {
+		r.tenant = tenant
+		r.quota = quota
+	}
+}
+
+// WithLatencyTracking makes the router measure the latency of the Thrift
+// calls through its remote clients and keep moving estimates of it per
+// destination, as returned by DestinationStats and RingView.DestinationStats
+// for policies, to spot slow peers. When export is set the latency of every
+// call is also reported to the stats reporter as the router.call.latency
+// timer, tagged with the destination. WithDeadlineRouting tracks latencies as
+// well.
+func WithLatencyTracking(export bool) Option {
+	return func(r *router) {
+		r.latencyTracking = true
+		r.latencyExport = export
+	}
+}
+
+// WithDestinationValidation makes the router check that the destinations keys
+// resolve to are reachable members of the ring, and not only non-empty
+// addresses, before clients are created or cached for them. Ringpop resolves
+// keys to such destinations while it bootstraps. The fallback tells whether
+// these lookups fail with ErrInvalidDestination, are retried, or are routed
+// to the local node. Without this option keys resolving to an empty address
+// fail with ErrInvalidDestination.
+func WithDestinationValidation(fallback DestinationFallback) Option {
+	return func(r *router) {
+		r.validateMembers = true
+		r.destFallback = fallback
+	}
+}
+
+// WithSelfCache makes the router remember the address of the local node once
+// ringpop's WhoAmI returned it, instead of asking ringpop for every client
+// created. The address is looked up again when ringpop completes a join, as
+// the identity of the node may change then.
+func WithSelfCache() Option {
+	return func(r *router) {
+		r.selfCache = true
+	}
+}
+
+// WithLocalAddresses sets the addresses the local node is known by, to route
+// keys while ringpop's WhoAmI fails, typically before it bootstraps. The
+// destinations that are not one of addrs are then clearly remote and get
+// their clients, and the ones that are get the local client. Without this
+// option routing fails with ErrSelfLookupFailed when WhoAmI fails.
+func WithLocalAddresses(addrs ...string) Option {
+	return func(r *router) {
+		r.localAddrs = make(map[string]bool, len(addrs))
+		for _, addr := range addrs {
+			r.localAddrs[addr] = true
+		}
+	}
+}
+
+// WithFaultInjection makes the router inject the faults of config, to run
+// game days against keyed routing: lookups are delayed or resolve keys to the
+// wrong owner, and cached clients are dropped, each at the configured rate.
+// Nothing is injected unless config.Enabled is set. The faults are drawn from
+// the random source of the router, see WithRandSource.
+func WithFaultInjection(config FaultConfig) Option {
+	return func(r *router) {
+		r.faults = config
+	}
+}
+
+// WithLabelRefresh makes the router read the labels of the destinations of
+// its cached remote clients every interval, and evict the clients whose
+// labels changed, see RefreshLabels. This catches the labels that change
+// without a change of membership, eg. a node flipping to state=draining,
+// which a MemberFilter reading the labels then routes around. It has no
+// effect without a LabelsFunc, see WithLabels.
+func WithLabelRefresh(interval time.Duration) Option {
+	return func(r *router) {
+		r.labelInterval = interval
+	}
+}
+
+// WithHotKeyDetection makes the router estimate how often keys are routed in
+// windows of the given length, with a count-min sketch of fixed size, and
+// send a HotKeyDetectedEvent to its listeners when a key is routed at least
+// threshold times in a window. With a non-nil group, eg. PrefixTenant, the
+// routings are counted per group of keys instead, keys without a group
+// counting on their own. Keys stay hot for the window after the one they
+// were detected in, see WithHotKeySplitter.
+func WithHotKeyDetection(threshold int, window time.Duration, group func(key string) string) Option {
+	return func(r *router) {
+		r.hotKeyStats = newHotKeys(threshold, window, group)
+	}
+}
+
+// WithHotKeySplitter makes the router route the keys detected as hot with
+// WithHotKeyDetection on the keys split returns instead, eg. a SaltSplitter,
+// so the load of a hot key is shared by several nodes.
+func WithHotKeySplitter(split HotKeySplitter) Option {
+	return func(r *router) {
+		r.hotKeySplit = split
+	}
+}
+
+// WithFactoryContext sets the context the remote clients of a
+// ContextClientFactory are created with. The factory reads its dependencies,
+// eg. configuration or TLS material, from the values of ctx, which is never
+// cancelled by the router. Without this option the clients are created with
+// an empty context.
+func WithFactoryContext(ctx context.Context) Option {
+	return func(r *router) {
+		r.factoryCtx = ctx
+	}
+}
+
+// WithTLS makes the router dial remote destinations over TLS with the
+// configuration fn returns for each of them, eg. an IdentityTLS for mutual
+// TLS verified against the identity of the members. The Transport of the
+// router must be a TLSTransport, eg. a TLSDialer: TChannel channels dial
+// plain TCP connections, so with them clients fail to be created rather than
+// calls being made in the clear. Certificates are read when connections are
+// made: the clients connected before a rotation keep their connections until
+// they are evicted, eg. by WithClientIdleTimeout.
+func WithTLS(fn TLSConfigFunc) Option {
+	return func(r *router) {
+		r.tlsConfig = fn
+	}
+}
+
+// WithLoadReport makes the router count the keys it resolves per owner and
+// the calls it dispatches per destination in windows of the given length,
+// as summarized by LoadReport for capacity planning, eg. to add members once
+// the busiest one owns far more than its share of the keys. Only calls made
+// through Dispatch are counted. A window of zero or less, the default,
+// disables load reporting.
+func WithLoadReport(window time.Duration) Option {
+	return func(r *router) {
+		if window > 0 {
+			r.loadStats = newLoadStats(window)
+		} else {
+			r.loadStats = nil
+		}
+	}
+}
+
+// WithFactoryRecovery makes the router recover the panics of its
+// ClientFactory while it creates clients: GetClient then returns an Error of
+// kind ErrClientCreation wrapping a FactoryPanicError instead of the panic
+// taking down the goroutine routing the call. Recovered panics are logged
+// with their stack and counted by the router.factory.panic counter.
+func WithFactoryRecovery() Option {
+	return func(r *router) {
+		r.factoryRecovery = true
+	}
+}
+
+// WithFactoryErrorTranslator makes the router translate the errors its
+// ClientFactory returns, and the FactoryPanicErrors of WithFactoryRecovery,
+// with fn before wrapping them in an Error of kind ErrClientCreation.
+func WithFactoryErrorTranslator(fn ErrorTranslator) Option {
+	return func(r *router) {
+		r.factoryErrors = fn
+	}
+}
+
+// WithCallTimeouts sets the timeouts of the calls made through the remote
+// clients created by the router whose context has no deadline, so calls made
+// with a context that was left without one cannot pile up. The timeouts apply
+// before the calls go through the interceptors of WithInterceptors, and like
+// them not to calls through clients created by a RemoteDialer. Calls given a
+// timeout are counted by the router.call.timeout.defaulted counter.
+func WithCallTimeouts(timeouts CallTimeouts) Option {
+	methods := make(map[string]time.Duration, len(timeouts.Methods))
+	for method, d := range timeouts.Methods {
+		methods[method] = d
+	}
+	timeouts.Methods = methods
+	return func(r *router) {
+		r.callTimeouts = &timeouts
+	}
+}
+
+// WithAdaptiveConcurrency limits the number of concurrent calls made through
+// Dispatch and RunOnOwner to a single destination like WithMaxInflightPerDest,
+// which it replaces, with a limit adapted to the latency of the destination:
+// the limit shrinks when calls get slower than the tolerance of c allows or
+// time out, and grows back while calls are fast. The current limits are part
+// of Stats and reported by the router.concurrency.limit gauge.
+func WithAdaptiveConcurrency(c AdaptiveConcurrency) Option {
+	c = c.withDefaults()
+	return func(r *router) {
+		r.adaptive = &c
+		r.adaptiveLimits = make(map[string]*adaptiveLimit)
+	}
+}
+
+// WithNormalizer makes the router cache and evict the clients of destinations
+// under the address n returns for them, eg. NormalizeHostPort, so a change of
+// the membership of 10.0.0.1:2300 evicts the client cached for an equivalent
+// address written differently. Destinations are normalized as they come out
+// of lookups and with the membership changes about them, so their circuit
+// breakers, latencies and in-flight limits are shared too, and are reported
+// by their normalized address.
+func WithNormalizer(n Normalizer) Option {
+	return func(r *router) {
+		r.normalizer = n
+	}
+}
+
+// WithWatchReplicas makes the replica sets of the keys watched with WatchKey
+// the n nodes ringpop's LookupN returns for them instead of their owner alone.
+func WithWatchReplicas(n int) Option {
+	return func(r *router) {
+		r.watchReplicas = n
+	}
+}
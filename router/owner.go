@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// A LocalFunc handles a request for a key owned by the local node.
+type LocalFunc func(ctx context.Context) error
+
+// A RemoteFunc handles a request for a key owned by another node by calling
+// that node through client.
+type RemoteFunc func(ctx context.Context, client interface{}) error
+
+// defaultOwnerRetry is the retry policy of RunOnOwner when the router has
+// none: the key is resolved again once when the owner cannot be reached.
+var defaultOwnerRetry = &RetryPolicy{MaxRetries: 1}
+
+// RunOnOwner runs local when the local node owns key and remote with the
+// client of the owner otherwise. Like Dispatch, calls to remote hold one of
+// the in-flight slots of the owner and are counted by Close.
+//
+// When remote fails with a retryable error the client of the owner is
+// evicted, key is resolved again and local or remote is run for the new
+// owner. Errors are retried as configured with WithRetry or, without a retry
+// policy, once when they are connection errors, see IsConnectionError, as
+// long as the retry budget configured with WithRetryBudget allows.
+// Errors of local are never retried. RunOnOwner gives up with the error of
+// ctx when ctx is done before a client or an in-flight slot is available or
+// while waiting for a retry.
+//
+// A ctx that is a thrift.Context is given an idempotency key, unless it has
+// one, before the first attempt, so every attempt carries the same key, see
+// WithIdempotencyKey.
+func (r *router) RunOnOwner(ctx context.Context, key string, local LocalFunc, remote RemoteFunc) error {
+	policy := r.retry
+	if policy == nil {
+		policy = defaultOwnerRetry
+	}
+	if tctx, ok := ctx.(thrift.Context); ok {
+		ctx = WithIdempotencyKey(tctx)
+	}
+
+	r.recordRequest()
+	for retry := 1; ; retry++ {
+		dest, err := r.runOnOwner(ctx, key, local, remote)
+		if err == nil || dest == "" || retry > policy.MaxRetries || !policy.retryable(err) || !r.allowRetry() {
+			return err
+		}
+
+		r.removeClient(dest)
+		r.statter.IncCounter("router.retry", nil, 1)
+		if err := r.waitRetry(ctx, policy, retry); err != nil {
+			return err
+		}
+	}
+}
+
+// runOnOwner runs local or remote once for the owner of key and returns the
+// remote destination that was called, or an empty destination when remote
+// was not called.
+func (r *router) runOnOwner(ctx context.Context, key string, local LocalFunc, remote RemoteFunc) (string, error) {
+	end, err := r.beginDispatch()
+	if err != nil {
+		return "", err
+	}
+	defer end()
+
+	client, dest, err := r.getClientContext(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	self, err := r.isSelf(dest)
+	if err != nil {
+		return "", err
+	}
+	if self {
+		return "", local(ctx)
+	}
+
+	release, err := r.acquireInflight(ctx, dest)
+	if err != nil {
+		return "", err
+	}
+	callErr := errCallPanicked
+	defer func() { release(callErr) }()
+
+	callErr = remote(ctx, client)
+	return dest, callErr
+}
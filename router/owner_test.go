@@ -0,0 +1,147 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// newOwnerTestRouter creates a router on which "local" is owned by the local
+// node and "moving" first resolves to 127.0.0.1:3001 and then to the local
+// node. Remote clients are the address of their destination.
+func newOwnerTestRouter(t *testing.T, opts ...Option) *router {
+	rp := newTestRingpop(nil)
+	rp.On("Lookup", "moving").Return("127.0.0.1:3001", nil).Once()
+	rp.On("Lookup", "moving").Return("127.0.0.1:3000", nil)
+
+	return newRingpopTestRouter(t, rp, append(opts, WithRemoteDialer(destDialer))...)
+}
+
+// ownerCalls records the calls made by RunOnOwner.
+type ownerCalls struct {
+	local  int
+	remote []interface{}
+	err    error
+}
+
+func (c *ownerCalls) runLocal(ctx context.Context) error {
+	c.local++
+	return nil
+}
+
+func (c *ownerCalls) runRemote(ctx context.Context, client interface{}) error {
+	c.remote = append(c.remote, client)
+	return c.err
+}
+
+func TestRunOnOwnerRunsLocally(t *testing.T) {
+	r := newOwnerTestRouter(t)
+	calls := &ownerCalls{}
+
+	assert.NoError(t, r.RunOnOwner(context.Background(), "local", calls.runLocal, calls.runRemote))
+	assert.Equal(t, 1, calls.local)
+	assert.Empty(t, calls.remote)
+}
+
+func TestRunOnOwnerRunsRemotely(t *testing.T) {
+	r := newOwnerTestRouter(t)
+	calls := &ownerCalls{err: errors.New("application error")}
+
+	err := r.RunOnOwner(context.Background(), "moving", calls.runLocal, calls.runRemote)
+	assert.EqualError(t, err, "application error", "expected other errors not to be retried")
+	assert.Equal(t, []interface{}{"127.0.0.1:3001"}, calls.remote)
+	assert.Equal(t, 0, calls.local)
+}
+
+func TestRunOnOwnerResolvesAgainOnConnectionError(t *testing.T) {
+	r := newOwnerTestRouter(t)
+	calls := &ownerCalls{err: tchannel.ErrConnectionClosed}
+
+	assert.NoError(t, r.RunOnOwner(context.Background(), "moving", calls.runLocal, calls.runRemote))
+	assert.Equal(t, []interface{}{"127.0.0.1:3001"}, calls.remote)
+	assert.Equal(t, 1, calls.local, "expected the key to be run locally once it moved here")
+
+	_, cached := r.cache.get("127.0.0.1:3001")
+	assert.False(t, cached, "expected the client of the failed owner to be evicted")
+}
+
+func TestRunOnOwnerKeysAttemptsOnce(t *testing.T) {
+	r := newOwnerTestRouter(t)
+
+	var keys []string
+	local := func(ctx context.Context) error {
+		keys = append(keys, IdempotencyKey(ctx.(thrift.Context)))
+		return nil
+	}
+	remote := func(ctx context.Context, client interface{}) error {
+		keys = append(keys, IdempotencyKey(ctx.(thrift.Context)))
+		return tchannel.ErrConnectionClosed
+	}
+
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+	assert.NoError(t, r.RunOnOwner(ctx, "moving", local, remote))
+	if assert.Len(t, keys, 2) {
+		assert.NotEmpty(t, keys[0])
+		assert.Equal(t, keys[0], keys[1], "expected every attempt to carry the key of the call")
+	}
+
+	keyed := WithIdempotencyKey(ctx)
+	keys = nil
+	assert.NoError(t, r.RunOnOwner(keyed, "local", local, remote))
+	assert.Equal(t, []string{IdempotencyKey(keyed)}, keys, "expected the key of the context to be kept")
+}
+
+func TestRunOnOwnerRetryPolicy(t *testing.T) {
+	r := newOwnerTestRouter(t, WithRetry(RetryPolicy{MaxRetries: 0}))
+	calls := &ownerCalls{err: tchannel.ErrConnectionClosed}
+
+	err := r.RunOnOwner(context.Background(), "moving", calls.runLocal, calls.runRemote)
+	assert.Equal(t, tchannel.ErrConnectionClosed, err)
+	assert.Equal(t, 0, calls.local)
+}
+
+func TestRunOnOwnerContextDone(t *testing.T) {
+	r := newOwnerTestRouter(t)
+	calls := &ownerCalls{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := r.RunOnOwner(ctx, "local", calls.runLocal, calls.runRemote)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, calls.local)
+}
+
+func TestRunOnOwnerClosed(t *testing.T) {
+	r := newOwnerTestRouter(t)
+	assert.NoError(t, r.Close(context.Background()))
+
+	calls := &ownerCalls{}
+	err := r.RunOnOwner(context.Background(), "local", calls.runLocal, calls.runRemote)
+	assert.Equal(t, ErrRouterClosed, err)
+}
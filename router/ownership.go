@@ -0,0 +1,226 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dgryski/go-farm"
+)
+
+// defaultReplicaPoints is the number of replica points ringpop uses by
+// default, see hashring.Configuration.
+const defaultReplicaPoints = 100
+
+// A KeyRange is a range of the hash space of the ring whose owner changed.
+// The range holds the keys whose hash h satisfies Start < h <= End. When End
+// is smaller than or equal to Start the range wraps around the end of the hash
+// space.
+//
+// From is the previous owner and To the new owner of the keys in the range.
+// Either is empty when the ring had no members before or after the change.
+// Keys gained by the local node have To set to its address, keys lost have
+// From set to its address.
+type KeyRange struct {
+	Start, End uint32
+	From, To   string
+}
+
+// Contains returns whether key falls in the range. Keys are hashed as they
+// are, use ContainsHash with the KeyHash of the router when it has a
+// KeyMapper.
+func (kr KeyRange) Contains(key string) bool {
+	return kr.ContainsHash(farm.Fingerprint32([]byte(key)))
+}
+
+// ContainsHash returns whether the keys of hash h, see Router.KeyHash, fall
+// in the range.
+func (kr KeyRange) ContainsHash(h uint32) bool {
+	return inRange(kr.Start, kr.End, h)
+}
+
+// KeyHash returns the hash key is placed on the ring with, once mapped by the
+// KeyMapper of the router.
+func (r *router) KeyHash(key string) uint32 {
+	return keyHash(r.mapKey(key))
+}
+
+func inRange(start, end, h uint32) bool {
+	if start < end {
+		return start < h && h <= end
+	}
+	// wrapping range, which covers the full ring when start == end
+	return h > start || h <= end
+}
+
+type token struct {
+	hash   uint32
+	server string
+}
+
+// tokenRing mirrors the placement of servers on ringpop's hash ring.
+type tokenRing []token
+
+func newTokenRing(servers []string, replicaPoints int) tokenRing {
+	ring := make(tokenRing, 0, len(servers)*replicaPoints)
+	for _, server := range servers {
+		for i := 0; i < replicaPoints; i++ {
+			address := fmt.Sprintf("%s%v", server, i)
+			ring = append(ring, token{farm.Fingerprint32([]byte(address)), server})
+		}
+	}
+	sort.Sort(ring)
+	return ring
+}
+
+func (t tokenRing) Len() int           { return len(t) }
+func (t tokenRing) Less(i, j int) bool { return t[i].hash < t[j].hash }
+func (t tokenRing) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// owner returns the server owning hash h, the server of the first token at or
+// after h.
+func (t tokenRing) owner(h uint32) string {
+	if len(t) == 0 {
+		return ""
+	}
+	i := sort.Search(len(t), func(i int) bool { return t[i].hash >= h })
+	if i == len(t) {
+		i = 0
+	}
+	return t[i].server
+}
+
+// movedRanges returns the ranges of the hash space whose owner differs
+// between old and new. Adjacent ranges moving between the same owners are
+// merged.
+func movedRanges(old, new tokenRing) []KeyRange {
+	bounds := make([]uint32, 0, len(old)+len(new))
+	for _, t := range old {
+		bounds = append(bounds, t.hash)
+	}
+	for _, t := range new {
+		bounds = append(bounds, t.hash)
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	sort.Sort(uint32s(bounds))
+	bounds = dedupe(bounds)
+
+	// no token lies within (bounds[i-1], bounds[i]], so all of its keys have
+	// the owner of bounds[i]
+	var moved []KeyRange
+	start := bounds[len(bounds)-1]
+	for _, end := range bounds {
+		from, to := old.owner(end), new.owner(end)
+		if from != to {
+			last := len(moved) - 1
+			if last >= 0 && moved[last].End == start && moved[last].From == from && moved[last].To == to {
+				moved[last].End = end
+			} else {
+				moved = append(moved, KeyRange{Start: start, End: end, From: from, To: to})
+			}
+		}
+		start = end
+	}
+
+	// merge the range wrapping around the end of the hash space
+	if n := len(moved); n > 1 {
+		first, last := moved[0], moved[n-1]
+		if last.End == first.Start && last.From == first.From && last.To == first.To {
+			moved[0].Start = last.Start
+			moved = moved[:n-1]
+		}
+	}
+	return moved
+}
+
+// dedupe removes repeated values from the sorted slice s.
+func dedupe(s []uint32) []uint32 {
+	out := s[:0]
+	for _, v := range s {
+		if len(out) == 0 || v != out[len(out)-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+type uint32s []uint32
+
+func (s uint32s) Len() int           { return len(s) }
+func (s uint32s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// OnOwnershipChange registers fn to be called with the ranges of keys that
+// moved between nodes whenever ringpop's ring changes.
+func (r *router) OnOwnershipChange(fn func(moved []KeyRange)) {
+	r.ownershipMu.Lock()
+	defer r.ownershipMu.Unlock()
+
+	// the ring at the time of the first registration is the baseline
+	r.trackRing()
+	r.ownershipListeners = append(r.ownershipListeners, fn)
+}
+
+// trackRing starts tracking the ring for ownership changes with the current
+// ring as the baseline, unless it is tracked already. ownershipMu must be
+// held.
+func (r *router) trackRing() {
+	if r.ringTracked {
+		return
+	}
+	servers, _ := r.ringpop.GetReachableMembers()
+	r.ring = newTokenRing(servers, r.replicaPoints)
+	r.ringTracked = true
+}
+
+// reconcileOwnership compares the current members of the ring with the ring
+// seen on the previous change, notifies the ownership listeners and the
+// listeners of the router of the ranges that moved and records them for stale
+// reads, see WithStaleReads.
+func (r *router) reconcileOwnership() {
+	r.ownershipMu.Lock()
+	defer r.ownershipMu.Unlock()
+
+	if !r.ringTracked {
+		return
+	}
+
+	servers, err := r.ringpop.GetReachableMembers()
+	if err != nil {
+		return
+	}
+
+	ring := newTokenRing(servers, r.replicaPoints)
+	moved := movedRanges(r.ring, ring)
+	r.ring = ring
+	if len(moved) == 0 {
+		return
+	}
+
+	r.recordOwnership(moved)
+	for _, fn := range r.ownershipListeners {
+		fn(moved)
+	}
+	r.emit(OwnerChangedEvent{Moved: moved})
+}
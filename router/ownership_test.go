@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/hashring"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestTokenRingMatchesHashRing(t *testing.T) {
+	servers := []string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}
+	ring := hashring.New(farm.Fingerprint32, defaultReplicaPoints)
+	ring.AddRemoveServers(servers, nil)
+	tokens := newTokenRing(servers, defaultReplicaPoints)
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owner, _ := ring.Lookup(key)
+		assert.Equal(t, owner, tokens.owner(farm.Fingerprint32([]byte(key))), key)
+	}
+}
+
+// movedOwners returns the previous and new owners of key according to the
+// ranges in moved.
+func movedOwners(moved []KeyRange, key string) (string, string, bool) {
+	for _, kr := range moved {
+		if kr.Contains(key) {
+			return kr.From, kr.To, true
+		}
+	}
+	return "", "", false
+}
+
+func TestMovedRanges(t *testing.T) {
+	old := newTokenRing([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, defaultReplicaPoints)
+	new := newTokenRing([]string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}, defaultReplicaPoints)
+	moved := movedRanges(old, new)
+	assert.NotEmpty(t, moved)
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		h := farm.Fingerprint32([]byte(key))
+		from, to, ok := movedOwners(moved, key)
+		if old.owner(h) == new.owner(h) {
+			assert.False(t, ok, "expected %s not to move", key)
+			continue
+		}
+		assert.True(t, ok, "expected %s to move", key)
+		assert.Equal(t, old.owner(h), from)
+		assert.Equal(t, new.owner(h), to)
+		assert.Equal(t, "127.0.0.1:3002", to, "expected keys to only move to the new node")
+	}
+}
+
+func TestMovedRangesFromEmptyRing(t *testing.T) {
+	new := newTokenRing([]string{"127.0.0.1:3000"}, defaultReplicaPoints)
+	moved := movedRanges(nil, new)
+	if assert.Len(t, moved, 1) {
+		assert.Equal(t, KeyRange{Start: moved[0].Start, End: moved[0].Start, To: "127.0.0.1:3000"}, moved[0])
+		assert.True(t, moved[0].Contains("any key"))
+	}
+	assert.Empty(t, movedRanges(new, new))
+	assert.Empty(t, movedRanges(nil, nil))
+}
+
+func TestOnOwnershipChange(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, nil).Once()
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000"}, nil).Once()
+
+	r := New(rp, nil, nil).(*router)
+
+	var calls [][]KeyRange
+	r.OnOwnershipChange(func(moved []KeyRange) {
+		calls = append(calls, moved)
+	})
+	r.HandleEvent(events.RingChangedEvent{ServersRemoved: []string{"127.0.0.1:3001"}})
+
+	if assert.Len(t, calls, 1) {
+		for _, kr := range calls[0] {
+			assert.Equal(t, "127.0.0.1:3001", kr.From)
+			assert.Equal(t, "127.0.0.1:3000", kr.To)
+		}
+	}
+}
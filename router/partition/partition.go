@@ -0,0 +1,234 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package partition places a fixed number of virtual partitions on the ring
+// of a router. Every partition is owned by the node that owns its key, the
+// local node is notified when it acquires or releases partitions as the ring
+// changes, and calls for a partition are routed to its owner.
+package partition
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/uber/ringpop-go/router"
+)
+
+// ErrInvalidPartition is returned for partition IDs outside of [0, n) for a
+// Manager of n partitions.
+var ErrInvalidPartition = errors.New("invalid partition")
+
+// A Manager manages the partitions owned by the local node.
+type Manager interface {
+	// GetPartitionClient returns the client of the owner of partition id.
+	GetPartitionClient(id int) (interface{}, error)
+
+	// Owner returns the address of the owner of partition id.
+	Owner(id int) (string, error)
+
+	// Owned returns the IDs of the partitions owned by the local node, in
+	// increasing order.
+	Owned() []int
+
+	// Close releases all partitions owned by the local node. The Manager no
+	// longer follows the ring once closed.
+	Close()
+}
+
+// A Listener is notified by a Manager when the local node acquires or
+// releases a partition. The methods are called one at a time and must not
+// call Close.
+type Listener interface {
+	Acquire(id int)
+	Release(id int)
+}
+
+// manager is a Manager of which the ownership of partitions follows the ring
+// of a router.
+type manager struct {
+	router     router.Router
+	partitions int
+	prefix     string
+	listener   Listener
+
+	// notifyMu serializes reconciliations, so the listener sees the changes
+	// of ownership in order
+	notifyMu sync.Mutex
+
+	mu     sync.Mutex
+	owned  map[int]bool
+	closed bool
+}
+
+// An Option configures a Manager created by New.
+type Option func(*manager)
+
+// WithListener makes the Manager notify l of the partitions the local node
+// acquires and releases.
+func WithListener(l Listener) Option {
+	return func(m *manager) {
+		m.listener = l
+	}
+}
+
+// WithKeyPrefix makes the Manager place partition id on the ring under key
+// prefix followed by id instead of "partition-" followed by id, so different
+// sets of partitions are placed independently.
+func WithKeyPrefix(prefix string) Option {
+	return func(m *manager) {
+		m.prefix = prefix
+	}
+}
+
+// New creates a Manager for partitions 0 to n-1 placed on the ring of r and
+// notifies its listener of the partitions owned by the local node before
+// returning. Ownership is reevaluated every time the ring of r changes, see
+// router.Router.OnOwnershipChange.
+func New(r router.Router, n int, opts ...Option) Manager {
+	m := &manager{
+		router:     r,
+		partitions: n,
+		prefix:     "partition-",
+		owned:      make(map[int]bool),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	m.reconcile()
+	r.OnOwnershipChange(func(moved []router.KeyRange) {
+		m.reconcile()
+	})
+	return m
+}
+
+// key returns the key under which partition id is placed on the ring.
+func (m *manager) key(id int) string {
+	return m.prefix + strconv.Itoa(id)
+}
+
+func (m *manager) valid(id int) bool {
+	return id >= 0 && id < m.partitions
+}
+
+func (m *manager) GetPartitionClient(id int) (interface{}, error) {
+	if !m.valid(id) {
+		return nil, ErrInvalidPartition
+	}
+	return m.router.GetClient(m.key(id))
+}
+
+func (m *manager) Owner(id int) (string, error) {
+	if !m.valid(id) {
+		return "", ErrInvalidPartition
+	}
+	dest, err := m.router.Resolve(m.key(id))
+	if err != nil {
+		return "", err
+	}
+	return dest.Address, nil
+}
+
+func (m *manager) Owned() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	owned := make([]int, 0, len(m.owned))
+	for id := range m.owned {
+		owned = append(owned, id)
+	}
+	sort.Ints(owned)
+	return owned
+}
+
+func (m *manager) Close() {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	var released []int
+	for id := 0; id < m.partitions; id++ {
+		if m.owned[id] {
+			delete(m.owned, id)
+			released = append(released, id)
+		}
+	}
+	m.mu.Unlock()
+
+	m.notify(nil, released)
+}
+
+// reconcile resolves the owner of every partition and notifies the listener
+// of the partitions acquired and released since the last reconciliation.
+// Partitions that fail to resolve keep their previous ownership.
+func (m *manager) reconcile() {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return
+	}
+
+	var acquired, released []int
+	for id := 0; id < m.partitions; id++ {
+		dest, err := m.router.Resolve(m.key(id))
+		if err != nil {
+			continue
+		}
+
+		m.mu.Lock()
+		switch {
+		case dest.Local && !m.owned[id]:
+			m.owned[id] = true
+			acquired = append(acquired, id)
+		case !dest.Local && m.owned[id]:
+			delete(m.owned, id)
+			released = append(released, id)
+		}
+		m.mu.Unlock()
+	}
+
+	m.notify(acquired, released)
+}
+
+// notify notifies the listener of the acquired and released partitions,
+// releases first so state handed off by the local node is released before
+// new state is taken on.
+func (m *manager) notify(acquired, released []int) {
+	if m.listener == nil {
+		return
+	}
+	for _, id := range released {
+		m.listener.Release(id)
+	}
+	for _, id := range acquired {
+		m.listener.Acquire(id)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package partition
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/ringpop-go/router/routertest"
+	"github.com/uber/tchannel-go"
+)
+
+// recordingListener records the partitions acquired and released.
+type recordingListener struct {
+	sync.Mutex
+	acquired []int
+	released []int
+}
+
+func (l *recordingListener) Acquire(id int) {
+	l.Lock()
+	l.acquired = append(l.acquired, id)
+	l.Unlock()
+}
+
+func (l *recordingListener) Release(id int) {
+	l.Lock()
+	l.released = append(l.released, id)
+	l.Unlock()
+}
+
+func newTestRouter(t *testing.T, rp *routertest.Ringpop) router.Router {
+	ch, err := tchannel.NewChannel("service", nil)
+	assert.NoError(t, err)
+	return router.NewV2(rp, &routertest.RecordingClientFactory{}, ch)
+}
+
+func TestManagerAcquiresAllPartitionsOfSingleNode(t *testing.T) {
+	rp := routertest.NewRingpop("127.0.0.1:3000")
+	l := &recordingListener{}
+	m := New(newTestRouter(t, rp), 4, WithListener(l))
+
+	assert.Equal(t, []int{0, 1, 2, 3}, m.Owned())
+	assert.Equal(t, []int{0, 1, 2, 3}, l.acquired)
+
+	owner, err := m.Owner(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3000", owner)
+
+	client, err := m.GetPartitionClient(2)
+	assert.NoError(t, err)
+	assert.Equal(t, routertest.LocalClient, client)
+}
+
+func TestManagerFollowsTheRing(t *testing.T) {
+	rp := routertest.NewRingpop("127.0.0.1:3000")
+	r := newTestRouter(t, rp)
+	l := &recordingListener{}
+	m := New(r, 32, WithListener(l))
+
+	rp.Join("127.0.0.1:3001")
+	assert.NotEmpty(t, l.released, "expected partitions to move to the new node")
+	assert.Len(t, m.Owned(), 32-len(l.released))
+	for _, id := range l.released {
+		owner, err := m.Owner(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3001", owner)
+
+		client, err := m.GetPartitionClient(id)
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3001", client.(*routertest.RemoteClient).Dest)
+	}
+
+	released := len(l.released)
+	rp.Fail("127.0.0.1:3001")
+	assert.Len(t, m.Owned(), 32)
+	assert.Len(t, l.acquired, 32+released, "expected the partitions to be acquired again")
+}
+
+func TestManagerClose(t *testing.T) {
+	rp := routertest.NewRingpop("127.0.0.1:3000")
+	l := &recordingListener{}
+	m := New(newTestRouter(t, rp), 2, WithListener(l))
+
+	m.Close()
+	m.Close()
+	assert.Equal(t, []int{0, 1}, l.released)
+	assert.Empty(t, m.Owned())
+
+	rp.Join("127.0.0.1:3001")
+	assert.Len(t, l.acquired, 2, "expected a closed manager to ignore the ring")
+}
+
+func TestManagerInvalidPartition(t *testing.T) {
+	m := New(newTestRouter(t, routertest.NewRingpop("127.0.0.1:3000")), 2)
+
+	_, err := m.GetPartitionClient(2)
+	assert.Equal(t, ErrInvalidPartition, err)
+	_, err = m.Owner(-1)
+	assert.Equal(t, ErrInvalidPartition, err)
+}
+
+func TestKeyPrefix(t *testing.T) {
+	rp := routertest.NewRingpop("127.0.0.1:3000", "127.0.0.1:3001")
+	rp.SetOwner("shard-1", "127.0.0.1:3001")
+	m := New(newTestRouter(t, rp), 2, WithKeyPrefix("shard-"))
+
+	owner, err := m.Owner(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", owner)
+	assert.NotContains(t, m.Owned(), 1)
+}
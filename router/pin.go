@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "github.com/uber-common/bark"
+
+// Pin routes key to dest instead of the owner of key on the ring until Unpin
+// is called for key or dest is declared faulty or leaves the ring, eg. while
+// the entity of a hot key is migrated live. Pinning a key again replaces its
+// destination. Pins apply to the key before WithKeyMapper maps it.
+func (r *router) Pin(key, dest string) {
+	r.pinsMu.Lock()
+	r.pins[key] = r.normalize(dest)
+	r.pinsMu.Unlock()
+
+	r.logger.WithFields(bark.Fields{
+		"key":  key,
+		"dest": dest,
+	}).Debug("router pinned key")
+}
+
+// Unpin routes key to its owner on the ring again.
+func (r *router) Unpin(key string) {
+	r.pinsMu.Lock()
+	delete(r.pins, key)
+	r.pinsMu.Unlock()
+}
+
+// pinned returns the destination key is pinned to.
+func (r *router) pinned(key string) (string, bool) {
+	r.pinsMu.Lock()
+	defer r.pinsMu.Unlock()
+
+	dest, ok := r.pins[key]
+	return dest, ok
+}
+
+// unpinDest removes the pins to dest.
+func (r *router) unpinDest(dest string) {
+	r.pinsMu.Lock()
+	defer r.pinsMu.Unlock()
+
+	for key, pinned := range r.pins {
+		if pinned == dest {
+			delete(r.pins, key)
+		}
+	}
+}
+
+// pinFirst returns pinned followed by the other destinations of dests, at
+// most n destinations.
+func pinFirst(dests []string, pinned string, n int) []string {
+	result := []string{pinned}
+	for _, dest := range dests {
+		if dest != pinned && len(result) < n {
+			result = append(result, dest)
+		}
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+)
+
+func TestPin(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+
+	r.Pin("node1", "127.0.0.1:3002")
+	dest, err := r.Resolve("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", dest.Address)
+
+	_, err = r.GetClient("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3002"}, r.cache.keys())
+
+	r.Unpin("node1")
+	dest, err = r.Resolve("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", dest.Address)
+}
+
+func TestPinEndsWhenDestinationLeaves(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+
+	r.Pin("node1", "127.0.0.1:3002")
+	r.Pin("node3", "127.0.0.1:3004")
+	r.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3002",
+		Status:  swim.Leave,
+	})
+
+	dest, err := r.Resolve("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", dest.Address)
+
+	dest, err = r.Resolve("node3")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3004", dest.Address, "expected pins to other destinations to stay")
+}
+
+func TestPinFirst(t *testing.T) {
+	assert.Equal(t, []string{"c", "a"}, pinFirst([]string{"a", "b"}, "c", 2))
+	assert.Equal(t, []string{"b", "a"}, pinFirst([]string{"a", "b"}, "b", 2))
+	assert.Equal(t, []string{"b"}, pinFirst([]string{"a", "b"}, "b", 1))
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+// SimulatePlacement returns the keys every one of members would own if they
+// were the members of the ring, to evaluate the balance of adding or removing
+// nodes before doing it. Keys are placed by the lookup strategy of the
+// router, against a ring built like ringpop builds its ring, see
+// WithReplicaPoints, and mapped like WithKeyMapper maps them; the live ring,
+// pins and the policy of WithPolicy are not involved. Every member is in the
+// result, members that would own no key with no keys. The result is empty
+// when there are no members.
+func (r *router) SimulatePlacement(members []string, keys []string) map[string][]string {
+	placement := make(map[string][]string, len(members))
+	for _, member := range members {
+		placement[member] = []string{}
+	}
+	if len(members) == 0 {
+		return placement
+	}
+
+	var ring tokenRing
+	if r.lookupStrategy != RendezvousLookup && r.lookupStrategy != RangeLookup {
+		ring = newTokenRing(members, r.replicaPoints)
+	}
+	for _, key := range keys {
+		mapped := r.mapKey(key)
+
+		var owner string
+		switch r.lookupStrategy {
+		case RendezvousLookup:
+			owner = rankMembers(members, mapped, 1, r.weight)[0]
+		case RangeLookup:
+			owner = rangeOwners(members, r.rangeSplits, mapped, 1)[0]
+		default:
+			owner = ring.owner(keyHash(mapped))
+		}
+		placement[owner] = append(placement[owner], key)
+	}
+	return placement
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgryski/go-farm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/hashring"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+// newPlacementTestRouter creates a router that must not look at the live
+// ring.
+func newPlacementTestRouter(opts ...Option) *router {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	return newChannelTestRouter(rp, nil, opts...)
+}
+
+func placementKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	return keys
+}
+
+func TestSimulatePlacement(t *testing.T) {
+	r := newPlacementTestRouter()
+	members := []string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}
+	ring := hashring.New(farm.Fingerprint32, defaultReplicaPoints)
+	ring.AddRemoveServers(members, nil)
+
+	keys := placementKeys(1000)
+	placement := r.SimulatePlacement(members, keys)
+	assert.Len(t, placement, 3)
+
+	placed := 0
+	for member, owned := range placement {
+		for _, key := range owned {
+			owner, _ := ring.Lookup(key)
+			assert.Equal(t, owner, member, key)
+		}
+		placed += len(owned)
+	}
+	assert.Equal(t, len(keys), placed)
+}
+
+func TestSimulatePlacementRendezvous(t *testing.T) {
+	r := newPlacementTestRouter(WithLookupStrategy(RendezvousLookup))
+	members := []string{"127.0.0.1:3000", "127.0.0.1:3001"}
+
+	for member, owned := range r.SimulatePlacement(members, placementKeys(100)) {
+		for _, key := range owned {
+			assert.Equal(t, member, rankMembers(members, key, 1, r.weight)[0], key)
+		}
+	}
+}
+
+func TestSimulatePlacementMapsKeys(t *testing.T) {
+	prefix := func(key string) string { return key[:1] }
+	r := newPlacementTestRouter(WithKeyMapper(prefix))
+
+	placement := r.SimulatePlacement([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, []string{"a1", "a2", "a3"})
+	owners := 0
+	for _, owned := range placement {
+		if len(owned) > 0 {
+			owners++
+			assert.Equal(t, []string{"a1", "a2", "a3"}, owned)
+		}
+	}
+	assert.Equal(t, 1, owners, "expected keys with the same prefix on the same member")
+}
+
+func TestSimulatePlacementEmpty(t *testing.T) {
+	r := newPlacementTestRouter()
+
+	assert.Empty(t, r.SimulatePlacement(nil, placementKeys(10)))
+	assert.Equal(t, map[string][]string{"127.0.0.1:3000": {}}, r.SimulatePlacement([]string{"127.0.0.1:3000"}, nil))
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "sync/atomic"
+
+// A RingView is the read-only view of the ring a Policy selects destinations
+// from. Keys are resolved with the lookup strategy of the router, see
+// WithLookupStrategy.
+type RingView interface {
+	// Lookup returns the owner of key.
+	Lookup(key string) (string, error)
+
+	// LookupN returns the n nodes responsible for key, the owner first.
+	LookupN(key string, n int) ([]string, error)
+
+	// Members returns the reachable members of the ring.
+	Members() ([]string, error)
+
+	// Self returns the address of the local node.
+	Self() (string, error)
+
+	// Healthy returns whether the router considers dest able to serve
+	// requests: it was not last reported suspect, faulty or leaving, is not
+	// quarantined and its circuit is not open.
+	Healthy(dest string) bool
+
+	// ErrorRate returns the share of the recent calls to dest that failed
+	// with one of classes, or with any error when none is given, see
+	// WithErrorTracking.
+	ErrorRate(dest string, classes ...ErrorClass) float64
+
+	// DestinationStats returns the statistics of the latency of the calls
+	// to dest, see WithLatencyTracking.
+	DestinationStats(dest string) (DestinationStats, bool)
+}
+
+// A Policy selects the destination of a key, see WithPolicy.
+// SelectDestination is called on the path of every lookup and may be called
+// concurrently.
+type Policy interface {
+	SelectDestination(key string, ring RingView) (string, error)
+}
+
+// PolicyFunc adapts a function to a Policy.
+type PolicyFunc func(key string, ring RingView) (string, error)
+
+// SelectDestination calls f.
+func (f PolicyFunc) SelectDestination(key string, ring RingView) (string, error) {
+	return f(key, ring)
+}
+
+// PrimaryOwner is the Policy that routes every key to its owner, which is what
+// the router does without a policy.
+var PrimaryOwner Policy = PolicyFunc(func(key string, ring RingView) (string, error) {
+	return ring.Lookup(key)
+})
+
+// A LoadFunc returns the current load of member, in any unit as long as it is
+// the same for all members, eg. the number of calls in flight. It is called
+// on the path of lookups and must be fast.
+type LoadFunc func(member string) float64
+
+// LeastLoadedReplica is the Policy that routes a key to the least loaded, as
+// reported by load, of the healthy nodes among the n nodes responsible for
+// it. Ties go to the node that comes first, the owner when it is among them.
+// Keys of which no replica is healthy go to their owner.
+func LeastLoadedReplica(n int, load LoadFunc) Policy {
+	return PolicyFunc(func(key string, ring RingView) (string, error) {
+		dests, err := ring.LookupN(key, n)
+		if err != nil {
+			return "", err
+		}
+
+		var (
+			best     string
+			bestLoad float64
+		)
+		for _, dest := range dests {
+			if !ring.Healthy(dest) {
+				continue
+			}
+			if l := load(dest); best == "" || l < bestLoad {
+				best, bestLoad = dest, l
+			}
+		}
+		if best == "" {
+			return firstOrLookup(key, dests, ring)
+		}
+		return best, nil
+	})
+}
+
+// A ZoneFunc returns the zone, eg. the rack or the availability zone, of
+// member.
+type ZoneFunc func(member string) string
+
+// LocalityAware is the Policy that routes a key to the first healthy node, of
+// the n nodes responsible for it, that is in the zone of the local node as
+// reported by zone, and to the first healthy node of another zone when there
+// is none. Keys of which no replica is healthy go to their owner.
+func LocalityAware(n int, zone ZoneFunc) Policy {
+	return PolicyFunc(func(key string, ring RingView) (string, error) {
+		self, err := ring.Self()
+		if err != nil {
+			return "", err
+		}
+		dests, err := ring.LookupN(key, n)
+		if err != nil {
+			return "", err
+		}
+
+		local := zone(self)
+		var remote string
+		for _, dest := range dests {
+			if !ring.Healthy(dest) {
+				continue
+			}
+			if zone(dest) == local {
+				return dest, nil
+			}
+			if remote == "" {
+				remote = dest
+			}
+		}
+		if remote == "" {
+			return firstOrLookup(key, dests, ring)
+		}
+		return remote, nil
+	})
+}
+
+// FollowerReplica is the Policy that spreads the reads of a key over the
+// healthy followers among the n nodes responsible for it, the nodes after its
+// owner, in turn, so reads are taken off the owner while writes keep going to
+// it, see WithReadPolicy and GetWriteClient. Keys of which no follower is
+// healthy, or that have no follower, go to their owner.
+func FollowerReplica(n int) Policy {
+	var next uint32
+	return PolicyFunc(func(key string, ring RingView) (string, error) {
+		dests, err := ring.LookupN(key, n)
+		if err != nil {
+			return "", err
+		}
+
+		var followers []string
+		for i := 1; i < len(dests); i++ {
+			if ring.Healthy(dests[i]) {
+				followers = append(followers, dests[i])
+			}
+		}
+		if len(followers) == 0 {
+			return firstOrLookup(key, dests, ring)
+		}
+		i := atomic.AddUint32(&next, 1) - 1
+		return followers[i%uint32(len(followers))], nil
+	})
+}
+
+// firstOrLookup returns the first of dests, or the owner of key when dests
+// is empty.
+func firstOrLookup(key string, dests []string, ring RingView) (string, error) {
+	if len(dests) > 0 {
+		return dests[0], nil
+	}
+	return ring.Lookup(key)
+}
+
+// routerRingView is the RingView of a router.
+type routerRingView struct {
+	r *router
+}
+
+func (v routerRingView) Lookup(key string) (string, error) {
+	return v.r.resolveKey(key)
+}
+
+func (v routerRingView) LookupN(key string, n int) ([]string, error) {
+	return v.r.resolveKeyN(key, n)
+}
+
+func (v routerRingView) Members() ([]string, error) {
+	return v.r.ringpop.GetReachableMembers()
+}
+
+func (v routerRingView) Self() (string, error) {
+	return v.r.whoAmI()
+}
+
+func (v routerRingView) Healthy(dest string) bool {
+	return !v.r.unhealthy(dest) && !v.r.circuitOpen(dest)
+}
+
+func (v routerRingView) ErrorRate(dest string, classes ...ErrorClass) float64 {
+	return v.r.ErrorRate(dest, classes...)
+}
+
+func (v routerRingView) DestinationStats(dest string) (DestinationStats, bool) {
+	return v.r.DestinationStats(dest)
+}
+
+// selectDestination returns the destination of the mapped key, selected by
+// the policy of the router when there is one. With WithZoneRouting the policy
+// selects from the nodes in the zone of the local node, PrimaryOwner picking
+// the first of them.
+func (r *router) selectDestination(key string) (string, error) {
+	if r.zoneLabel != "" {
+		policy := r.policy
+		if policy == nil {
+			policy = PrimaryOwner
+		}
+		return policy.SelectDestination(key, zoneRingView{routerRingView{r}})
+	}
+	if r.policy == nil {
+		return r.resolveKey(key)
+	}
+	return r.policy.SelectDestination(key, routerRingView{r})
+}
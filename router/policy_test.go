@@ -0,0 +1,139 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+)
+
+// newPolicyTestRouter creates a router on 127.0.0.1:3000 on which "key" is
+// owned by 127.0.0.1:3001 and replicated to 127.0.0.1:3002 and
+// 127.0.0.1:3003. Remote clients are the address of their destination.
+func newPolicyTestRouter(t *testing.T, p Policy) *router {
+	rp := newTestRingpop(testLookups{
+		"key": "127.0.0.1:3001",
+	})
+	rp.On("Checksum").Return(uint32(1), nil)
+	rp.On("LookupN", "key", 3).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, nil)
+
+	return newRingpopTestRouter(t, rp, WithPolicy(p), WithRemoteDialer(destDialer))
+}
+
+func suspect(r *router, dest string) {
+	r.ReconcileChange(swim.Change{Address: dest, Status: swim.Suspect, Incarnation: 1})
+}
+
+func TestPrimaryOwner(t *testing.T) {
+	r := newPolicyTestRouter(t, PrimaryOwner)
+
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+}
+
+func TestLeastLoadedReplica(t *testing.T) {
+	loads := map[string]float64{
+		"127.0.0.1:3001": 10,
+		"127.0.0.1:3002": 1,
+		"127.0.0.1:3003": 5,
+	}
+	r := newPolicyTestRouter(t, LeastLoadedReplica(3, func(member string) float64 {
+		return loads[member]
+	}))
+
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+
+	suspect(r, "127.0.0.1:3002")
+	client, err = r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3003", client, "expected unhealthy replicas to be skipped")
+
+	suspect(r, "127.0.0.1:3001")
+	suspect(r, "127.0.0.1:3003")
+	client, err = r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected the owner when no replica is healthy")
+}
+
+func TestLocalityAware(t *testing.T) {
+	zones := map[string]string{
+		"127.0.0.1:3000": "a",
+		"127.0.0.1:3001": "b",
+		"127.0.0.1:3002": "b",
+		"127.0.0.1:3003": "a",
+	}
+	r := newPolicyTestRouter(t, LocalityAware(3, func(member string) string {
+		return zones[member]
+	}))
+
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3003", client, "expected the replica in the local zone")
+
+	dest, err := r.Resolve("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", dest.Address, "expected Resolve to report the owner")
+
+	suspect(r, "127.0.0.1:3003")
+	client, err = r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected the first healthy replica of another zone")
+}
+
+func TestPolicyErrors(t *testing.T) {
+	r := newPolicyTestRouter(t, PolicyFunc(func(key string, ring RingView) (string, error) {
+		return "", errors.New("no destination")
+	}))
+
+	_, err := r.GetClient("key")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+}
+
+func TestFollowerReplica(t *testing.T) {
+	r := newPolicyTestRouter(t, FollowerReplica(3))
+
+	var clients []interface{}
+	for i := 0; i < 4; i++ {
+		client, err := r.GetClient("key")
+		assert.NoError(t, err)
+		clients = append(clients, client)
+	}
+	assert.Equal(t, []interface{}{"127.0.0.1:3002", "127.0.0.1:3003", "127.0.0.1:3002", "127.0.0.1:3003"}, clients,
+		"expected the followers to take turns")
+
+	suspect(r, "127.0.0.1:3002")
+	for i := 0; i < 2; i++ {
+		client, err := r.GetClient("key")
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3003", client, "expected the healthy follower")
+	}
+
+	suspect(r, "127.0.0.1:3003")
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected the owner when no follower is healthy")
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// poolConnectTimeout bounds the time a Connector is given to open a
+// connection for a client of a pool.
+const poolConnectTimeout = time.Second
+
+// A PoolSizeFunc returns the number of clients the router keeps for the remote
+// destination dest, see WithClientPool. It is called when the client of dest
+// is created, so it can size the pools of hot destinations from their load,
+// eg. as reported by a LoadTable.
+type PoolSizeFunc func(dest string) int
+
+// A Connector is a Transport that can open additional connections to a
+// destination, which the clients of a pool spread their calls over, see
+// WithClientPool. Transports that are not Connectors make every client of a
+// pool from a Dial of its own.
+type Connector interface {
+	// Connect opens another connection to dest and returns it, so it is
+	// closed together with the pool it was opened for.
+	Connect(ctx context.Context, dest string) (io.Closer, error)
+}
+
+// Connect opens another connection to dest on the channel. TChannel spreads
+// the calls to a peer over all its active connections.
+func (t *TChannelTransport) Connect(ctx context.Context, dest string) (io.Closer, error) {
+	conn, err := t.Channel.Peers().GetOrAdd(dest).Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// makePool returns the clients of the pool of d, first being the client
+// created already, and the connections opened for them, or nil when d has no
+// pool. The clients and connections are closed when one of them cannot be
+// created.
+func (r *router) makePool(d Destination, first interface{}, calls *callTracker) ([]interface{}, []io.Closer, error) {
+	if r.poolSize == nil {
+		return nil, nil, nil
+	}
+	dest := d.Address
+	n := r.poolSize(dest)
+	if n <= 1 {
+		return nil, nil, nil
+	}
+
+	pool := make([]interface{}, 1, n)
+	pool[0] = first
+	var conns []io.Closer
+	for len(pool) < n {
+		conn, err := r.connect(dest)
+		if err != nil {
+			closePool(pool, conns)
+			return nil, nil, wrapError(ErrClientCreation, err)
+		}
+		if conn != nil {
+			conns = append(conns, conn)
+		}
+		client, err := r.makeRemoteClient(d, calls)
+		if err != nil {
+			closePool(pool, conns)
+			return nil, nil, err
+		}
+		pool = append(pool, client)
+	}
+	return pool, conns, nil
+}
+
+// connect opens another connection to dest when the transport is a
+// Connector, and returns it.
+func (r *router) connect(dest string) (io.Closer, error) {
+	c, ok := r.transport.(Connector)
+	if !ok {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), poolConnectTimeout)
+	defer cancel()
+	return c.Connect(ctx, r.dialAddress(dest))
+}
+
+// closePool closes the clients of pool that implement io.Closer, and the
+// connections opened for them.
+func closePool(pool []interface{}, conns []io.Closer) {
+	for _, client := range pool {
+		if closer, ok := client.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
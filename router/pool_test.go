@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// pooledConn is a connection of a poolTransport.
+type pooledConn struct {
+	dest   string
+	id     int
+	closed bool
+}
+
+func (c *pooledConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// poolTransport is a Connector of which every Dial returns a new pooledConn.
+// Every Connect opens a pooledConn too, kept in opened, and fails once
+// connectErr is set.
+type poolTransport struct {
+	sync.Mutex
+	conns      []*pooledConn
+	opened     []*pooledConn
+	connectErr error
+}
+
+func (t *poolTransport) Dial(dest string) (ClientConn, error) {
+	t.Lock()
+	defer t.Unlock()
+	conn := &pooledConn{dest: dest, id: len(t.conns)}
+	t.conns = append(t.conns, conn)
+	return conn, nil
+}
+
+func (t *poolTransport) Connect(ctx context.Context, dest string) (io.Closer, error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.connectErr != nil {
+		return nil, t.connectErr
+	}
+	conn := &pooledConn{dest: dest, id: len(t.opened)}
+	t.opened = append(t.opened, conn)
+	return conn, nil
+}
+
+// poolOf3001 gives 127.0.0.1:3001 a pool of three clients.
+func poolOf3001(dest string) int {
+	if dest == "127.0.0.1:3001" {
+		return 3
+	}
+	return 1
+}
+
+func TestClientPool(t *testing.T) {
+	transport := &poolTransport{}
+	r, _ := newThrottleTestRouter(t, transport, WithClientPool(poolOf3001))
+
+	var ids []int
+	for i := 0; i < 4; i++ {
+		client, err := r.GetClient("a")
+		assert.NoError(t, err)
+		ids = append(ids, client.(*pooledConn).id)
+	}
+	assert.Equal(t, []int{0, 1, 2, 0}, ids, "expected the clients of the pool in turn")
+	assert.Len(t, transport.opened, 2, "expected a connection for every client but the first")
+
+	client, err := r.GetClient("b")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, client.(*pooledConn).id)
+	client, err = r.GetClient("b")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, client.(*pooledConn).id, "expected a single client for other destinations")
+
+	client, err = r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	r.removeClient("127.0.0.1:3001")
+	for _, conn := range transport.conns[:3] {
+		assert.True(t, conn.closed, "expected all clients of the pool to be closed")
+	}
+	assert.False(t, transport.conns[3].closed)
+	for _, conn := range transport.opened {
+		assert.True(t, conn.closed, "expected the connections of the pool to be closed")
+	}
+}
+
+func TestClientPoolConnectFails(t *testing.T) {
+	transport := &poolTransport{connectErr: errors.New("connection refused")}
+	r, _ := newThrottleTestRouter(t, transport, WithClientPool(poolOf3001))
+
+	_, err := r.GetClient("a")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Len(t, transport.conns, 1)
+	assert.True(t, transport.conns[0].closed, "expected the clients created already to be closed")
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3001", "expected nothing to be cached")
+}
+
+func TestTChannelTransportConnect(t *testing.T) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+
+	ch, err := tchannel.NewChannel("client", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	transport := &TChannelTransport{Channel: ch}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	first, err := transport.Connect(ctx, server.PeerInfo().HostPort)
+	assert.NoError(t, err)
+	second, err := transport.Connect(ctx, server.PeerInfo().HostPort)
+	assert.NoError(t, err)
+
+	peer := ch.Peers().GetOrAdd(server.PeerInfo().HostPort)
+	_, outbound := peer.NumConnections()
+	assert.Equal(t, 2, outbound)
+
+	assert.NoError(t, first.Close())
+	assert.NoError(t, second.Close())
+	assert.False(t, first.(*tchannel.Connection).IsActive(), "expected the connection to be closed")
+	assert.False(t, second.(*tchannel.Connection).IsActive(), "expected the connection to be closed")
+}
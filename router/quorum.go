@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// A QuorumFunc makes a call through the client of one of the nodes
+// responsible for a key, eg. to write a replica. It should give up when ctx is
+// done.
+type QuorumFunc func(ctx context.Context, client interface{}) error
+
+// QuorumError is the error wrapped in an Error of kind ErrQuorumFailed when a
+// QuorumCall does not reach its quorum. Errors holds the error of every node
+// that failed, by address.
+type QuorumError struct {
+	Quorum    int
+	Successes int
+	Errors    map[string]error
+}
+
+func (e *QuorumError) Error() string {
+	dests := make([]string, 0, len(e.Errors))
+	for dest := range e.Errors {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+
+	errs := make([]string, len(dests))
+	for i, dest := range dests {
+		errs[i] = dest + ": " + e.Errors[dest].Error()
+	}
+	return fmt.Sprintf("%d of %d required calls succeeded: %s", e.Successes, e.Quorum, strings.Join(errs, ", "))
+}
+
+type quorumResult struct {
+	dest string
+	err  error
+}
+
+// QuorumCall calls fn concurrently with the clients of the n nodes
+// responsible for key, as resolved by ringpop's LookupN, and returns nil once
+// quorum of the calls succeeded. Each call is bounded by the timeout of
+// WithQuorumTimeout, if any. When too many calls failed for quorum to be
+// reached, or key has fewer than quorum nodes, it returns an Error of kind
+// ErrQuorumFailed wrapping a QuorumError. The calls still in flight when
+// QuorumCall returns are not cancelled, so the remaining nodes are written to
+// as well, unless ctx is done.
+func (r *router) QuorumCall(ctx context.Context, key string, n, quorum int, fn QuorumFunc) error {
+	if err := r.admit(key); err != nil {
+		return err
+	}
+	dests, err := r.lookupN(ctx, key, n)
+	if err != nil {
+		return err
+	}
+
+	qerr := &QuorumError{Quorum: quorum, Errors: make(map[string]error)}
+	if len(dests) < quorum {
+		r.statter.IncCounter("router.quorum.failed", nil, 1)
+		return wrapError(ErrQuorumFailed, qerr)
+	}
+
+	// buffered so the calls can finish after QuorumCall returned
+	results := make(chan quorumResult, len(dests))
+	for _, dest := range dests {
+		go func(dest string) {
+			results <- quorumResult{dest, r.quorumCall(ctx, dest, fn)}
+		}(dest)
+	}
+
+	for pending := len(dests); pending > 0; pending-- {
+		res := <-results
+		if res.err != nil {
+			qerr.Errors[res.dest] = res.err
+		} else {
+			qerr.Successes++
+		}
+
+		if qerr.Successes >= quorum {
+			return nil
+		}
+		if len(dests)-len(qerr.Errors) < quorum {
+			// the remaining calls cannot make up for the failures
+			break
+		}
+	}
+	r.statter.IncCounter("router.quorum.failed", nil, 1)
+	return wrapError(ErrQuorumFailed, qerr)
+}
+
+// quorumCall calls fn with the client of dest, within the timeout of
+// WithQuorumTimeout.
+func (r *router) quorumCall(ctx context.Context, dest string, fn QuorumFunc) error {
+	client, err := r.getClientForDest(dest)
+	if err != nil {
+		return err
+	}
+	if r.quorumTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.quorumTimeout)
+		defer cancel()
+	}
+	return fn(ctx, client)
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func newQuorumTestRouter(t *testing.T, opts ...Option) *router {
+	rp := newTestRingpop(nil)
+	rp.On("LookupN", "key", 3).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, nil)
+	rp.On("LookupN", "single", 3).Return([]string{"127.0.0.1:3001"}, nil)
+
+	opts = append([]Option{WithRemoteDialer(destDialer)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...)
+}
+
+// failing returns a QuorumFunc that fails the calls to the given clients.
+func failing(dests ...string) QuorumFunc {
+	return func(ctx context.Context, client interface{}) error {
+		for _, dest := range dests {
+			if client == dest {
+				return errors.New("write failed")
+			}
+		}
+		return nil
+	}
+}
+
+func TestQuorumCall(t *testing.T) {
+	r := newQuorumTestRouter(t)
+
+	var mu sync.Mutex
+	var called []interface{}
+	err := r.QuorumCall(context.Background(), "key", 3, 3, func(ctx context.Context, client interface{}) error {
+		mu.Lock()
+		called = append(called, client)
+		mu.Unlock()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, called, 3)
+
+	assert.NoError(t, r.QuorumCall(context.Background(), "key", 3, 2, failing("127.0.0.1:3002")))
+}
+
+func TestQuorumCallFails(t *testing.T) {
+	r := newQuorumTestRouter(t)
+
+	err := r.QuorumCall(context.Background(), "key", 3, 2, failing("127.0.0.1:3001", "127.0.0.1:3003"))
+	assert.Equal(t, ErrQuorumFailed, KindOf(err))
+	if assert.IsType(t, &Error{}, err) {
+		qerr := err.(*Error).Err.(*QuorumError)
+		assert.Equal(t, 2, qerr.Quorum)
+		assert.Len(t, qerr.Errors, 2)
+	}
+	// the call to 127.0.0.1:3002 might not have finished when QuorumCall
+	// gave up
+	assert.Contains(t, err.Error(), "of 2 required calls succeeded: 127.0.0.1:3001: write failed, 127.0.0.1:3003: write failed")
+}
+
+func TestQuorumCallTooFewNodes(t *testing.T) {
+	r := newQuorumTestRouter(t)
+
+	err := r.QuorumCall(context.Background(), "single", 3, 2, func(ctx context.Context, client interface{}) error {
+		t.Error("unexpected call")
+		return nil
+	})
+	assert.Equal(t, ErrQuorumFailed, KindOf(err))
+}
+
+func TestQuorumCallReturnsOnceQuorumReached(t *testing.T) {
+	r := newQuorumTestRouter(t)
+
+	slow := make(chan struct{})
+	defer close(slow)
+	err := r.QuorumCall(context.Background(), "key", 3, 2, func(ctx context.Context, client interface{}) error {
+		if client == "127.0.0.1:3003" {
+			<-slow
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestQuorumTimeout(t *testing.T) {
+	r := newQuorumTestRouter(t, WithQuorumTimeout(10*time.Millisecond))
+
+	err := r.QuorumCall(context.Background(), "key", 3, 3, func(ctx context.Context, client interface{}) error {
+		if client == "127.0.0.1:3003" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "2 of 3 required calls succeeded: 127.0.0.1:3003: context deadline exceeded")
+}
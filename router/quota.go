@@ -0,0 +1,168 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber-common/bark"
+)
+
+// A TenantFunc returns the tenant a key belongs to, see WithTenantQuotas.
+// Keys of the empty tenant are not limited.
+type TenantFunc func(key string) string
+
+// PrefixTenant returns the TenantFunc of keys prefixed with their tenant and
+// sep, eg. "acme/orders/42" with "/". Keys without sep have no tenant.
+func PrefixTenant(sep string) TenantFunc {
+	return func(key string) string {
+		i := strings.Index(key, sep)
+		if i < 0 {
+			return ""
+		}
+		return key[:i]
+	}
+}
+
+// A Quota is the rate, per second, at which the keys of a tenant may be
+// routed, and the number of keys that may be routed at once beyond it. A rate
+// of zero or less does not limit the tenant.
+type Quota struct {
+	Rate  float64
+	Burst int
+}
+
+// A QuotaFunc returns the quota of tenant, see WithTenantQuotas. It is called
+// when the first key of the tenant is routed, and again once the tenant was
+// idle for long enough to be forgotten.
+type QuotaFunc func(tenant string) Quota
+
+// tenantIdleTimeout is the time after which the bucket of a tenant of which no
+// key was routed is forgotten, provided it is full again.
+const tenantIdleTimeout = 10 * time.Minute
+
+// tokenBucket is the limiter of the quota of a tenant. Unlimited tenants have
+// a bucket with no rate, which always has a token.
+type tokenBucket struct {
+	mu      sync.Mutex
+	quota   Quota
+	tokens  float64
+	updated time.Time
+	used    time.Time
+}
+
+func newTokenBucket(quota Quota, now time.Time) *tokenBucket {
+	burst := quota.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	quota.Burst = burst
+	return &tokenBucket{quota: quota, tokens: float64(burst), updated: now, used: now}
+}
+
+// take takes a token from the bucket at now and returns whether there was
+// one left.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used = now
+	if b.quota.Rate <= 0 {
+		return true
+	}
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.quota.Rate
+		if max := float64(b.quota.Burst); b.tokens > max {
+			b.tokens = max
+		}
+		b.updated = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// idle returns whether the bucket was not used since tenantIdleTimeout before
+// now, and would be full again by now.
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	elapsed := now.Sub(b.used)
+	if elapsed < tenantIdleTimeout {
+		return false
+	}
+	return b.quota.Rate <= 0 || b.tokens+now.Sub(b.updated).Seconds()*b.quota.Rate >= float64(b.quota.Burst)
+}
+
+// bucketFor returns the token bucket of tenant. The buckets of idle tenants
+// are forgotten every tenantIdleTimeout, so tenants that come and go do not
+// accumulate.
+func (r *router) bucketFor(tenant string) *tokenBucket {
+	now := r.clock.Now()
+
+	r.bucketsMu.Lock()
+	defer r.bucketsMu.Unlock()
+
+	if now.Sub(r.bucketsSwept) >= tenantIdleTimeout {
+		for t, b := range r.buckets {
+			if b.idle(now) {
+				delete(r.buckets, t)
+			}
+		}
+		r.bucketsSwept = now
+	}
+
+	b, ok := r.buckets[tenant]
+	if !ok {
+		b = newTokenBucket(r.quota(tenant), now)
+		r.buckets[tenant] = b
+	}
+	return b
+}
+
+// allowTenant returns whether the quota of the tenant of key, when there is
+// one, allows routing key. Rejected keys are counted by the
+// router.tenant.rejected counter.
+func (r *router) allowTenant(key string) bool {
+	if r.tenant == nil {
+		return true
+	}
+	tenant := r.tenant(key)
+	if tenant == "" {
+		return true
+	}
+	if r.bucketFor(tenant).take(r.clock.Now()) {
+		return true
+	}
+
+	r.statter.IncCounter("router.tenant.rejected", nil, 1)
+	r.logger.WithFields(bark.Fields{
+		"key":    key,
+		"tenant": tenant,
+	}).Debug("router rejected key over the quota of its tenant")
+	return false
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestPrefixTenant(t *testing.T) {
+	tenant := PrefixTenant("/")
+	assert.Equal(t, "acme", tenant("acme/orders/42"))
+	assert.Equal(t, "", tenant("orders"))
+	assert.Equal(t, "", tenant("/orders"))
+}
+
+func TestTenantQuotas(t *testing.T) {
+	c := clock.NewMock()
+	stats := &mocks.StatsReporter{}
+	stats.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	stats.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+	stats.On("UpdateGauge", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	// the tenant of "local" and "remote" is their key
+	tenant := func(key string) string { return key }
+	quota := func(tenant string) Quota {
+		if tenant == "local" {
+			return Quota{}
+		}
+		return Quota{Rate: 2, Burst: 3}
+	}
+	r := newTestRouter(t, WithClock(c), WithStatsReporter(stats), WithTenantQuotas(tenant, quota))
+
+	for i := 0; i < 3; i++ {
+		_, err := r.GetClient("remote")
+		assert.NoError(t, err, "expected the burst to be allowed")
+	}
+	_, err := r.GetClient("remote")
+	assert.Equal(t, ErrQuotaExceeded, err)
+	stats.AssertCalled(t, "IncCounter", "router.tenant.rejected", bark.Tags(nil), int64(1))
+
+	// other tenants are not affected
+	for i := 0; i < 10; i++ {
+		_, err := r.GetClient("local")
+		assert.NoError(t, err, "expected tenants without a quota not to be limited")
+	}
+
+	// tokens refill at the rate of the quota
+	c.Add(500 * time.Millisecond)
+	_, err = r.GetClient("remote")
+	assert.NoError(t, err)
+	_, err = r.GetClient("remote")
+	assert.Equal(t, ErrQuotaExceeded, err)
+
+	c.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		_, err := r.GetClient("remote")
+		assert.NoError(t, err, "expected the tokens to be capped to the burst")
+	}
+	_, err = r.GetClient("remote")
+	assert.Equal(t, ErrQuotaExceeded, err)
+}
+
+func TestTenantQuotasRejectBeforeLookup(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	calls := 0
+	quota := func(tenant string) Quota {
+		calls++
+		return Quota{Rate: 1}
+	}
+	r := newRingpopTestRouter(t, rp, WithClock(clock.NewMock()), WithTenantQuotas(PrefixTenant("/"), quota))
+	rp.On("Lookup", "acme/1").Return("127.0.0.1:3000", nil)
+	rp.On("WhoAmI").Return("127.0.0.1:3000", nil)
+
+	assert.True(t, r.allowTenant("acme/1"))
+	assert.False(t, r.allowTenant("acme/2"))
+	assert.True(t, r.allowTenant("untenanted"))
+	_, err := r.GetClient("acme/3")
+	assert.Equal(t, ErrQuotaExceeded, err)
+	rp.AssertNotCalled(t, "Lookup", "acme/3")
+	assert.Equal(t, 1, calls, "expected the quota to be read once per tenant")
+}
+
+func TestTenantQuotasApplyToEveryPath(t *testing.T) {
+	c := clock.NewMock()
+	tenant := func(key string) string { return key }
+	quota := func(tenant string) Quota { return Quota{Rate: 1, Burst: 1} }
+	r := newTestRouter(t, WithClock(c), WithTenantQuotas(tenant, quota))
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+
+	_, err = r.GetClientN("remote", 2)
+	assert.Equal(t, ErrQuotaExceeded, err)
+	_, err = r.GetClients([]string{"remote"})
+	assert.Equal(t, ErrQuotaExceeded, err)
+	_, err = r.GetClientExcluding("remote", nil)
+	assert.Equal(t, ErrQuotaExceeded, err)
+	_, err = r.GetReadClient("remote")
+	assert.Equal(t, ErrQuotaExceeded, err)
+}
+
+func TestIdleTenantsAreForgotten(t *testing.T) {
+	c := clock.NewMock()
+	calls := 0
+	quota := func(tenant string) Quota {
+		calls++
+		if tenant == "unlimited" {
+			return Quota{}
+		}
+		return Quota{Rate: 1, Burst: 2}
+	}
+	r := newTestRouter(t, WithClock(c), WithTenantQuotas(func(key string) string { return key }, quota)).(*router)
+
+	for _, tenant := range []string{"a", "b", "unlimited"} {
+		assert.True(t, r.allowTenant(tenant))
+	}
+	assert.Len(t, r.buckets, 3, "expected unlimited tenants to have a bucket too")
+
+	// b stays busy
+	c.Add(tenantIdleTimeout - time.Second)
+	assert.True(t, r.allowTenant("b"))
+	c.Add(2 * time.Second)
+	assert.True(t, r.allowTenant("b"))
+	assert.Len(t, r.buckets, 1, "expected the idle tenants to be forgotten")
+	_, ok := r.buckets["b"]
+	assert.True(t, ok)
+
+	assert.True(t, r.allowTenant("a"))
+	assert.Equal(t, 4, calls, "expected the quota of a forgotten tenant to be read again")
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sort"
+)
+
+// rangeTable is the assignment of the key ranges to the reachable members:
+// owners[i] ranks the members for range i.
+type rangeTable struct {
+	owners [][]string
+}
+
+// newRangeTable assigns the ranges delimited by splits to members, see
+// rangeOwners.
+func newRangeTable(members, splits []string) *rangeTable {
+	owners := make([][]string, len(splits)+1)
+	for i := range owners {
+		owners[i] = rankMembers(members, rangeKey(splits, i), len(members), equalWeight)
+	}
+	return &rangeTable{owners: owners}
+}
+
+// rangeLookupN returns the owner of the key range of key and the n - 1
+// members ranked after it for that range, see RangeLookup. The assignment of
+// the ranges is kept until the checksum of the ring changes, so lookups do
+// not list and rank the members again, see memberSnapshot.
+func (r *router) rangeLookupN(key string, n int) ([]string, error) {
+	snapshot, err := r.memberSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshot.members) == 0 {
+		return nil, errNoMembers
+	}
+	ranked := snapshot.rangeTable(r.rangeSplits).owners[rangeIndex(r.rangeSplits, key)]
+	if n > len(ranked) {
+		n = len(ranked)
+	}
+	dests := make([]string, n)
+	copy(dests, ranked)
+	return dests, nil
+}
+
+// rangeOwners returns the member of members that owns the key range of key
+// and the n - 1 members ranked after it for that range. Every range delimited
+// by splits, which are sorted, is assigned by rendezvous hashing of its lower
+// bound, so a member joining only takes ranges from the others and a member
+// leaving only has its own ranges reassigned.
+func rangeOwners(members, splits []string, key string, n int) []string {
+	return rankMembers(members, rangeKey(splits, rangeIndex(splits, key)), n, equalWeight)
+}
+
+// rangeIndex returns the index of the range of key: range i holds the keys
+// from splits[i-1] included to splits[i] excluded.
+func rangeIndex(splits []string, key string) int {
+	return sort.Search(len(splits), func(i int) bool { return splits[i] > key })
+}
+
+// rangeKey returns the key range i is hashed by, its lower bound.
+func rangeKey(splits []string, i int) string {
+	if i == 0 {
+		return ""
+	}
+	return splits[i-1]
+}
+
+// equalWeight weighs all members the same.
+func equalWeight(string) float64 {
+	return 1
+}
+
+// sortedSplits returns the distinct splits, sorted.
+func sortedSplits(splits []string) []string {
+	sorted := make([]string, 0, len(splits))
+	seen := make(map[string]bool, len(splits))
+	for _, split := range splits {
+		if !seen[split] {
+			seen[split] = true
+			sorted = append(sorted, split)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRangeTestRouter(t *testing.T, members []string, opts ...Option) *router {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return(members, nil)
+	rp.On("Checksum").Return(uint32(1), nil)
+
+	opts = append([]Option{WithRemoteDialer(destDialer)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...)
+}
+
+func TestRangeLookup(t *testing.T) {
+	members := []string{"127.0.0.1:3002", "127.0.0.1:3001"}
+	r := newRangeTestRouter(t, members, WithKeyRanges("2016-03", "2016-01", "2016-02", "2016-02"))
+	assert.Equal(t, RangeLookup, r.lookupStrategy)
+	assert.Equal(t, []string{"2016-01", "2016-02", "2016-03"}, r.rangeSplits)
+
+	owners := map[string]string{
+		"2015-12-31": "127.0.0.1:3001",
+		"2016-01-01": "127.0.0.1:3001",
+		"2016-01-31": "127.0.0.1:3001",
+		"2016-02-01": "127.0.0.1:3001",
+		"2016-03-01": "127.0.0.1:3002",
+		"2017-01-01": "127.0.0.1:3002",
+	}
+	for key, owner := range owners {
+		dest, err := r.lookup(key)
+		assert.NoError(t, err)
+		assert.Equal(t, owner, dest, "unexpected owner of %s", key)
+	}
+
+	dests, err := r.resolveKeyN("2016-01-01", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002"}, dests, "expected the members ranked after the owner")
+	dests, err = r.resolveKeyN("2016-03-01", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3002", "127.0.0.1:3001"}, dests)
+}
+
+func TestRangeLookupChurn(t *testing.T) {
+	splits := []string{"b", "c", "d", "e", "f"}
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+
+	owners := func(members ...string) []string {
+		var owners []string
+		for _, key := range keys {
+			owners = append(owners, rangeOwners(members, splits, key, 1)[0])
+		}
+		return owners
+	}
+	assert.Equal(t, []string{"m1", "m1", "m1", "m1", "m1", "m1"}, owners("m1"))
+	assert.Equal(t, owners("m1", "m2", "m3"), owners("m3", "m1", "m2"), "expected the order of the members not to matter")
+
+	before := owners("m1", "m2", "m3")
+	left := owners("m1", "m3")
+	joined := owners("m1", "m2", "m3", "m4")
+	for i, key := range keys {
+		if before[i] != "m2" {
+			assert.Equal(t, before[i], left[i], "expected %s to stay when m2 leaves", key)
+		}
+		if joined[i] != "m4" {
+			assert.Equal(t, before[i], joined[i], "expected %s to stay or move to m4 when m4 joins", key)
+		}
+	}
+	assert.Contains(t, joined, "m4", "expected m4 to take ranges")
+}
+
+func TestRangeLookupKeepsAssignment(t *testing.T) {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+	rp.On("Checksum").Return(uint32(1), nil).Times(3)
+	rp.On("Checksum").Return(uint32(2), nil)
+	r := newRingpopTestRouter(t, rp, WithKeyRanges("m"))
+
+	for _, key := range []string{"a", "n"} {
+		_, err := r.rangeLookupN(key, 1)
+		assert.NoError(t, err)
+	}
+	rp.AssertNumberOfCalls(t, "GetReachableMembers", 1)
+
+	_, err := r.rangeLookupN("a", 1)
+	assert.NoError(t, err)
+	rp.AssertNumberOfCalls(t, "GetReachableMembers", 2)
+}
+
+func TestRangeLookupWithoutSplits(t *testing.T) {
+	r := newRangeTestRouter(t, []string{"127.0.0.1:3002", "127.0.0.1:3001"}, WithLookupStrategy(RangeLookup))
+	dest, err := r.lookup("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", dest, "expected a single range")
+
+	r = newRangeTestRouter(t, nil, WithKeyRanges("m"))
+	_, err = r.lookup("key")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+	assert.Equal(t, errNoMembers, err.(*Error).Err)
+}
+
+func TestRangeLookupPlacement(t *testing.T) {
+	r := newRangeTestRouter(t, nil, WithKeyRanges("m"))
+	placement := r.SimulatePlacement([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, []string{"a", "n", "b"})
+	assert.Equal(t, map[string][]string{
+		"127.0.0.1:3001": {"a", "n", "b"},
+		"127.0.0.1:3002": {},
+	}, placement)
+}
+
+func TestRangeLookupFilter(t *testing.T) {
+	members := []string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}
+	skip := func(m Member) bool { return m.Address != "127.0.0.1:3003" }
+	r := newRangeTestRouter(t, members, WithKeyRanges("b", "c"), WithMemberFilter(skip))
+
+	dest, err := r.lookup("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", dest, "expected the next member ranked for the range")
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+)
+
+// maxRawDepth is the maximum nesting of containers and structs rawStruct
+// copies before giving up.
+const maxRawDepth = 64
+
+var errRawDepth = errors.New("thrift struct is nested too deeply")
+
+// rawStruct is a Thrift struct of unknown type. Reading it keeps the binary
+// encoding of the struct, writing it reproduces the struct on the output
+// protocol. This allows requests and responses to be passed on without
+// knowing their generated types.
+type rawStruct struct {
+	data []byte
+}
+
+func (s *rawStruct) Read(p athrift.TProtocol) error {
+	buf := athrift.NewTMemoryBuffer()
+	if err := copyThriftValue(p, athrift.NewTBinaryProtocolTransport(buf), athrift.STRUCT, maxRawDepth); err != nil {
+		return err
+	}
+	s.data = buf.Bytes()
+	return nil
+}
+
+func (s *rawStruct) Write(p athrift.TProtocol) error {
+	return copyThriftValue(s.protocol(), p, athrift.STRUCT, maxRawDepth)
+}
+
+// Decode reads the struct into the generated struct v.
+func (s *rawStruct) Decode(v athrift.TStruct) error {
+	return v.Read(s.protocol())
+}
+
+// protocol returns a protocol from which the struct can be read.
+func (s *rawStruct) protocol() athrift.TProtocol {
+	buf := athrift.NewTMemoryBuffer()
+	buf.Write(s.data)
+	return athrift.NewTBinaryProtocolTransport(buf)
+}
+
+// copyThriftValue reads a value of type t from in and writes it to out.
+func copyThriftValue(in, out athrift.TProtocol, t athrift.TType, depth int) error {
+	if depth <= 0 {
+		return errRawDepth
+	}
+
+	switch t {
+	case athrift.BOOL:
+		v, err := in.ReadBool()
+		if err != nil {
+			return err
+		}
+		return out.WriteBool(v)
+	case athrift.BYTE:
+		v, err := in.ReadByte()
+		if err != nil {
+			return err
+		}
+		return out.WriteByte(v)
+	case athrift.I16:
+		v, err := in.ReadI16()
+		if err != nil {
+			return err
+		}
+		return out.WriteI16(v)
+	case athrift.I32:
+		v, err := in.ReadI32()
+		if err != nil {
+			return err
+		}
+		return out.WriteI32(v)
+	case athrift.I64:
+		v, err := in.ReadI64()
+		if err != nil {
+			return err
+		}
+		return out.WriteI64(v)
+	case athrift.DOUBLE:
+		v, err := in.ReadDouble()
+		if err != nil {
+			return err
+		}
+		return out.WriteDouble(v)
+	case athrift.STRING:
+		// binary and string share the wire type
+		v, err := in.ReadBinary()
+		if err != nil {
+			return err
+		}
+		return out.WriteBinary(v)
+	case athrift.STRUCT:
+		return copyThriftStruct(in, out, depth)
+	case athrift.MAP:
+		keyType, valueType, size, err := in.ReadMapBegin()
+		if err != nil {
+			return err
+		}
+		if err := out.WriteMapBegin(keyType, valueType, size); err != nil {
+			return err
+		}
+		for i := 0; i < size; i++ {
+			if err := copyThriftValue(in, out, keyType, depth-1); err != nil {
+				return err
+			}
+			if err := copyThriftValue(in, out, valueType, depth-1); err != nil {
+				return err
+			}
+		}
+		if err := in.ReadMapEnd(); err != nil {
+			return err
+		}
+		return out.WriteMapEnd()
+	case athrift.SET:
+		elemType, size, err := in.ReadSetBegin()
+		if err != nil {
+			return err
+		}
+		if err := out.WriteSetBegin(elemType, size); err != nil {
+			return err
+		}
+		if err := copyThriftElements(in, out, elemType, size, depth); err != nil {
+			return err
+		}
+		if err := in.ReadSetEnd(); err != nil {
+			return err
+		}
+		return out.WriteSetEnd()
+	case athrift.LIST:
+		elemType, size, err := in.ReadListBegin()
+		if err != nil {
+			return err
+		}
+		if err := out.WriteListBegin(elemType, size); err != nil {
+			return err
+		}
+		if err := copyThriftElements(in, out, elemType, size, depth); err != nil {
+			return err
+		}
+		if err := in.ReadListEnd(); err != nil {
+			return err
+		}
+		return out.WriteListEnd()
+	default:
+		return athrift.NewTProtocolExceptionWithType(athrift.INVALID_DATA, errors.New("unknown thrift type"))
+	}
+}
+
+func copyThriftElements(in, out athrift.TProtocol, elemType athrift.TType, size, depth int) error {
+	for i := 0; i < size; i++ {
+		if err := copyThriftValue(in, out, elemType, depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyThriftStruct(in, out athrift.TProtocol, depth int) error {
+	name, err := in.ReadStructBegin()
+	if err != nil {
+		return err
+	}
+	if err := out.WriteStructBegin(name); err != nil {
+		return err
+	}
+
+	for {
+		name, fieldType, id, err := in.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if fieldType == athrift.STOP {
+			break
+		}
+		if err := out.WriteFieldBegin(name, fieldType, id); err != nil {
+			return err
+		}
+		if err := copyThriftValue(in, out, fieldType, depth-1); err != nil {
+			return err
+		}
+		if err := in.ReadFieldEnd(); err != nil {
+			return err
+		}
+		if err := out.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+
+	if err := in.ReadStructEnd(); err != nil {
+		return err
+	}
+	if err := out.WriteFieldStop(); err != nil {
+		return err
+	}
+	return out.WriteStructEnd()
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/dgryski/go-farm"
+	"github.com/uber/ringpop-go"
+)
+
+// A LookupStrategy decides how the router resolves keys to members, see
+// WithLookupStrategy.
+type LookupStrategy int
+
+const (
+	// RingLookup resolves keys with ringpop's Lookup and LookupN, against its
+	// consistent hash ring. It is the default.
+	RingLookup LookupStrategy = iota
+
+	// RendezvousLookup resolves keys with rendezvous, or highest random
+	// weight, hashing over the reachable members of ringpop: the owner of a
+	// key is the member with the highest hash of the member and the key.
+	// When a member leaves only its keys move, and every member owns close
+	// to the same share of the keys regardless of the size of the cluster.
+	// Every lookup scores all members, so it suits small clusters.
+	RendezvousLookup
+
+	// RangeLookup resolves keys by their order instead of their hash: the
+	// key space is cut into contiguous ranges at the split keys of
+	// WithKeyRanges, so keys close to each other, eg. the points of a time
+	// series, are owned by the same member. Every range is assigned to the
+	// reachable members by rendezvous hashing of its lower bound: a member
+	// joining only takes ranges from the others and a member leaving only
+	// has its own ranges reassigned. The assignment is kept until the ring
+	// changes.
+	RangeLookup
+)
+
+var errNoMembers = errors.New("no reachable members")
+
+// resolveKey returns the owner of key as decided by the lookup strategy and
+// the member filter of the router.
+func (r *router) resolveKey(key string) (string, error) {
+	if r.memberFilter != nil {
+		dests, err := r.filteredLookupN(key, 1)
+		if err != nil {
+			return "", err
+		}
+		return dests[0], nil
+	}
+
+	var dests []string
+	var err error
+	switch r.lookupStrategy {
+	case RendezvousLookup:
+		dests, err = r.rendezvousLookupN(key, 1)
+	case RangeLookup:
+		dests, err = r.rangeLookupN(key, 1)
+	default:
+		return r.memoizedLookup(key)
+	}
+	if err != nil {
+		return "", err
+	}
+	return dests[0], nil
+}
+
+// resolveKeyN returns the n members responsible for key as decided by the
+// lookup strategy and the member filter of the router.
+func (r *router) resolveKeyN(key string, n int) ([]string, error) {
+	if r.memberFilter != nil {
+		return r.filteredLookupN(key, n)
+	}
+	switch r.lookupStrategy {
+	case RendezvousLookup:
+		return r.rendezvousLookupN(key, n)
+	case RangeLookup:
+		return r.rangeLookupN(key, n)
+	default:
+		return r.ringpop.LookupN(key, n)
+	}
+}
+
+// rendezvousLookupN returns the n members with the highest rendezvous score
+// for key, highest first.
+func (r *router) rendezvousLookupN(key string, n int) ([]string, error) {
+	return rendezvousRank(r.ringpop, key, n, r.weight)
+}
+
+// rendezvousRank returns the n reachable members of rp with the highest
+// rendezvous score for key, highest first, weighted by weight.
+func rendezvousRank(rp ringpop.Interface, key string, n int, weight func(member string) float64) ([]string, error) {
+	members, err := rp.GetReachableMembers()
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, errNoMembers
+	}
+	return rankMembers(members, key, n, weight), nil
+}
+
+// rankMembers returns the n of members with the highest rendezvous score for
+// key, highest first, weighted by weight.
+func rankMembers(members []string, key string, n int, weight func(member string) float64) []string {
+	scored := make(scoredMembers, len(members))
+	for i, member := range members {
+		scored[i] = scoredMember{member, rendezvousScore(member, key, weight(member))}
+	}
+	sort.Sort(scored)
+
+	if n > len(scored) {
+		n = len(scored)
+	}
+	dests := make([]string, n)
+	for i := range dests {
+		dests[i] = scored[i].member
+	}
+	return dests
+}
+
+// rendezvousScore returns the score of member for key. The hash of the
+// member and the key is mapped to u in (0, 1) and scored -weight / ln(u), so
+// the share of the keys a member owns is proportional to its weight. With
+// equal weights the members are ordered by hash.
+func rendezvousScore(member, key string, weight float64) float64 {
+	h := farm.Fingerprint64([]byte(member + "\x00" + key))
+	u := (float64(h) + 0.5) / (1 << 64)
+	return -weight / math.Log(u)
+}
+
+// weight returns the weight of member, see WithWeights and WithWeighting.
+func (r *router) weight(member string) float64 {
+	return positiveWeight(r.weights, member)
+}
+
+// labelWeight returns the weight of member held in its label named by
+// WithWeighting, or 0 when it has none or it is not a number. The labels of
+// the members of the ring are those of the snapshot of the members, see
+// memberSnapshot, and those of other members, eg. in SimulatePlacement, are
+// read every time.
+func (r *router) labelWeight(member string) float64 {
+	var labels map[string]string
+	if snapshot, err := r.memberSnapshot(); err == nil && snapshot.reachable[member] {
+		labels = snapshot.memberLabels(r, member)
+	} else {
+		labels, _ = r.memberLabels(member)
+	}
+	weight, err := strconv.ParseFloat(labels[r.weightLabel], 64)
+	if err != nil {
+		return 0
+	}
+	return weight
+}
+
+// positiveWeight returns the weight of member according to weights, or 1
+// when weights is nil or the weight is not positive.
+func positiveWeight(weights WeightFunc, member string) float64 {
+	if weights == nil {
+		return 1
+	}
+	if w := weights(member); w > 0 {
+		return w
+	}
+	return 1
+}
+
+type scoredMember struct {
+	member string
+	score  float64
+}
+
+// scoredMembers sorts members by decreasing score, and by address when
+// their scores are equal.
+type scoredMembers []scoredMember
+
+func (s scoredMembers) Len() int      { return len(s) }
+func (s scoredMembers) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s scoredMembers) Less(i, j int) bool {
+	if s[i].score != s[j].score {
+		return s[i].score > s[j].score
+	}
+	return s[i].member < s[j].member
+}
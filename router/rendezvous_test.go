@@ -0,0 +1,167 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+	"golang.org/x/net/context"
+)
+
+func newRendezvousTestRouter(t *testing.T, members ...string) *router {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return(members, nil)
+	rp.On("Checksum").Return(uint32(1), nil)
+
+	return newRingpopTestRouter(t, rp, WithLookupStrategy(RendezvousLookup), WithRemoteDialer(destDialer))
+}
+
+func TestRendezvousLookup(t *testing.T) {
+	members := []string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}
+	r := newRendezvousTestRouter(t, members...)
+
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		dest, err := r.lookup(key)
+		assert.NoError(t, err)
+		counts[dest]++
+		owners[key] = dest
+	}
+	for _, member := range members {
+		assert.InDelta(t, 1000, counts[member], 150, "expected %s to own about a third of the keys", member)
+	}
+
+	// only the keys of a removed member move
+	smaller := newRendezvousTestRouter(t, members[:2]...)
+	for key, owner := range owners {
+		dest, err := smaller.lookup(key)
+		assert.NoError(t, err)
+		if owner != members[2] {
+			assert.Equal(t, owner, dest, "expected %s not to move", key)
+		}
+	}
+}
+
+func TestRendezvousLookupN(t *testing.T) {
+	r := newRendezvousTestRouter(t, "127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003")
+
+	owner, err := r.lookup("key")
+	assert.NoError(t, err)
+
+	dests, err := r.lookupN(context.Background(), "key", 2)
+	assert.NoError(t, err)
+	assert.Len(t, dests, 2)
+	assert.Equal(t, owner, dests[0], "expected the owner first")
+	assert.NotEqual(t, dests[0], dests[1])
+
+	dests, err = r.lookupN(context.Background(), "key", 5)
+	assert.NoError(t, err)
+	assert.Len(t, dests, 3)
+}
+
+func TestRendezvousGetClient(t *testing.T) {
+	r := newRendezvousTestRouter(t, "127.0.0.1:3001", "127.0.0.1:3002")
+
+	dest, err := r.Resolve("key")
+	if assert.NoError(t, err) {
+		client, err := r.GetClient("key")
+		assert.NoError(t, err)
+		assert.Equal(t, dest.Address, client)
+	}
+}
+
+func TestRendezvousNoMembers(t *testing.T) {
+	r := newRendezvousTestRouter(t)
+
+	_, err := r.GetClient("key")
+	assert.EqualError(t, err, "no reachable members")
+}
+
+func TestRendezvousWeights(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, nil)
+
+	weights := map[string]float64{
+		"127.0.0.1:3001": 4,
+		"127.0.0.1:3002": 1,
+	}
+	r := New(rp, nil, nil, WithWeights(func(member string) float64 {
+		return weights[member]
+	})).(*router)
+	assert.Equal(t, RendezvousLookup, r.lookupStrategy)
+
+	counts := make(map[string]int)
+	for i := 0; i < 6000; i++ {
+		dest, err := r.lookup(fmt.Sprintf("key%d", i))
+		assert.NoError(t, err)
+		counts[dest]++
+	}
+	assert.InDelta(t, 4000, counts["127.0.0.1:3001"], 250)
+	assert.InDelta(t, 1000, counts["127.0.0.1:3002"], 150)
+	assert.InDelta(t, 1000, counts["127.0.0.1:3003"], 150, "expected members without weight to have weight 1")
+}
+
+func TestRendezvousWeighting(t *testing.T) {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, nil)
+	rp.On("Checksum").Return(uint32(1), nil)
+
+	labels := map[string]map[string]string{
+		"127.0.0.1:3001": {"weight": "4"},
+		"127.0.0.1:3002": {"weight": "invalid"},
+	}
+	reads := make(map[string]int)
+	r := newRingpopTestRouter(t, rp, WithWeighting("weight"), WithLabels(func(dest string) (map[string]string, error) {
+		reads[dest]++
+		return labels[dest], nil
+	}))
+	assert.Equal(t, RendezvousLookup, r.lookupStrategy)
+
+	counts := make(map[string]int)
+	for i := 0; i < 6000; i++ {
+		dest, err := r.lookup(fmt.Sprintf("key%d", i))
+		assert.NoError(t, err)
+		counts[dest]++
+	}
+	assert.InDelta(t, 4000, counts["127.0.0.1:3001"], 250)
+	assert.InDelta(t, 1000, counts["127.0.0.1:3002"], 150, "expected members with an invalid weight to have weight 1")
+	assert.InDelta(t, 1000, counts["127.0.0.1:3003"], 150, "expected members without weight to have weight 1")
+	assert.Equal(t, map[string]int{"127.0.0.1:3001": 1, "127.0.0.1:3002": 1, "127.0.0.1:3003": 1}, reads,
+		"expected the labels to be read once for the ring")
+}
+
+func TestWeightsKeepRangeLookup(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	weights := func(member string) float64 { return 2 }
+
+	r := newRingpopTestRouter(t, rp, WithKeyRanges("m"), WithWeights(weights))
+	assert.Equal(t, RangeLookup, r.lookupStrategy)
+	r = newRingpopTestRouter(t, rp, WithWeights(weights), WithKeyRanges("m"))
+	assert.Equal(t, RangeLookup, r.lookupStrategy, "expected the order of the options not to matter")
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"github.com/uber/ringpop-go/swim"
+	"golang.org/x/net/context"
+)
+
+// GetClientExcluding returns the client of the owner of key, unless the owner
+// is one of the excluded destinations, in which case the client of another
+// of the nodes responsible for key is returned. Replicas are resolved with
+// ringpop's LookupN, so the fallback is one of the len(exclude)+1 nodes
+// responsible for key. ErrNoDestination is returned when all of them are
+// excluded.
+func (r *router) GetClientExcluding(key string, exclude []string) (interface{}, error) {
+	excluded := func(dest string) bool {
+		for _, e := range exclude {
+			if e == dest {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := r.admit(key); err != nil {
+		return nil, err
+	}
+	dest, err := r.routeLookup(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	if !excluded(dest) {
+		return r.getClientForDest(dest)
+	}
+
+	client, _, err := r.replicaClient(context.Background(), key, len(exclude)+1, excluded, ErrNoDestination)
+	return client, err
+}
+
+// replicaClient returns the client of the first of the n nodes responsible
+// for key that is not skipped and whose client can be created without its
+// circuit being open. When there is none, err is returned.
+func (r *router) replicaClient(ctx context.Context, key string, n int, skip func(dest string) bool, err error) (interface{}, string, error) {
+	dests, lookupErr := r.lookupN(ctx, key, n)
+	if lookupErr != nil {
+		return nil, "", lookupErr
+	}
+
+	for _, dest := range dests {
+		if skip(dest) {
+			continue
+		}
+		client, clientErr := r.getClientForDestContext(ctx, dest)
+		if clientErr == ErrCircuitOpen {
+			continue
+		}
+		return client, dest, clientErr
+	}
+	return nil, "", err
+}
+
+// unhealthy returns whether the last change about dest reported it as not
+// alive, or quarantined its clients, see WithSuspectFallback.
+func (r *router) unhealthy(dest string) bool {
+	r.changesMu.Lock()
+	change, ok := r.lastChanges[dest]
+	quarantined := r.quarantine[dest]
+	r.changesMu.Unlock()
+
+	if quarantined {
+		return true
+	}
+	if !ok {
+		return false
+	}
+	switch change.Status {
+	case swim.Suspect, swim.Faulty, swim.Leave:
+		return true
+	}
+	return false
+}
+
+// fallbackReplicas returns the number of nodes responsible for a key the
+// router may route the key to, from its owner to the last replica a fallback
+// or the replicas of WithZoneRouting reach.
+func (r *router) fallbackReplicas() int {
+	n := 2 // the replica of drained owners
+	for _, fallback := range []int{r.suspectFallback, r.circuitFallback, r.deadlineFallback, r.zoneReplicas} {
+		if fallback > n {
+			n = fallback
+		}
+	}
+	return n
+}
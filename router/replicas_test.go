@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+// newReplicaTestRouter creates a router on which "key" is owned by
+// 127.0.0.1:3001 and replicated to 127.0.0.1:3002 and 127.0.0.1:3003.
+// Remote clients are the address of their destination.
+func newReplicaTestRouter(t *testing.T, opts ...Option) Router {
+	rp := newTestRingpop(testLookups{
+		"key": "127.0.0.1:3001",
+	})
+	rp.On("LookupN", "key", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+	rp.On("LookupN", "key", 3).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, nil)
+
+	return newRingpopTestRouter(t, rp, append(opts, WithRemoteDialer(destDialer))...)
+}
+
+func TestGetClientExcluding(t *testing.T) {
+	r := newReplicaTestRouter(t)
+
+	client, err := r.GetClientExcluding("key", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+
+	client, err = r.GetClientExcluding("key", []string{"127.0.0.1:3002"})
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected the owner when it is not excluded")
+
+	client, err = r.GetClientExcluding("key", []string{"127.0.0.1:3001"})
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+
+	client, err = r.GetClientExcluding("key", []string{"127.0.0.1:3001", "127.0.0.1:3002"})
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3003", client)
+
+	_, err = r.GetClientExcluding("key", []string{"127.0.0.1:3001", "127.0.0.1:3003"})
+	assert.NoError(t, err, "expected the second replica to be used")
+}
+
+func TestGetClientExcludingAll(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("Lookup", "key").Return("127.0.0.1:3001", nil)
+	rp.On("LookupN", "key", 2).Return([]string{"127.0.0.1:3001"}, nil)
+
+	_, err := New(rp, nil, nil).GetClientExcluding("key", []string{"127.0.0.1:3001"})
+	assert.Equal(t, ErrNoDestination, err)
+}
+
+func TestSuspectFallback(t *testing.T) {
+	r := newReplicaTestRouter(t, WithSuspectFallback(2))
+
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Suspect, Incarnation: 1})
+	client, err = r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+
+	// with all replicas unhealthy the owner is used
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Suspect, Incarnation: 1})
+	client, err = r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Alive, Incarnation: 2})
+	client, err = r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+}
+
+func TestNoSuspectFallbackByDefault(t *testing.T) {
+	r := newReplicaTestRouter(t)
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Suspect, Incarnation: 1})
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+}
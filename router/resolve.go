@@ -0,0 +1,158 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+
+	"golang.org/x/net/context"
+)
+
+// maxResolveAttempts is the number of times Resolve looks up a key while the
+// ring keeps changing before it gives up.
+const maxResolveAttempts = 3
+
+var errRingChanging = errors.New("ring changed during every attempt to resolve the key")
+
+// A Destination is the result of resolving a key against the ring.
+type Destination struct {
+	// Address is the address of the node owning the key.
+	Address string
+
+	// Local tells whether Address is the address of the local node.
+	Local bool
+
+	// Checksum is the checksum of the ring the key was resolved against. When
+	// ringpop's Checksum no longer returns it, the ring changed and the key
+	// might be owned by another node.
+	Checksum uint32
+
+	// Labels are the labels of the node at Address when the router has a
+	// LabelsFunc, see WithLabels. They are only set for the destinations
+	// passed to a ClientFactoryV2.
+	Labels map[string]string
+}
+
+// Resolve returns the destination of key, as returned by ringpop's Lookup,
+// together with the checksum of the ring it was resolved against. The checksum
+// is read before and after the lookup and the lookup is repeated when they
+// differ, so the destination belongs to the ring with the returned checksum.
+// When the ring changes during every attempt an Error of kind
+// ErrLookupFailed is returned.
+func (r *router) Resolve(key string) (Destination, error) {
+	for attempt := 0; attempt < maxResolveAttempts; attempt++ {
+		before, err := r.ringpop.Checksum()
+		if err != nil {
+			return Destination{}, wrapError(ErrLookupFailed, err)
+		}
+
+		dest, err := r.lookup(key)
+		if err != nil {
+			return Destination{}, err
+		}
+
+		after, err := r.ringpop.Checksum()
+		if err != nil {
+			return Destination{}, wrapError(ErrLookupFailed, err)
+		}
+
+		if before == after {
+			local, err := r.isSelf(dest)
+			if err != nil {
+				return Destination{}, err
+			}
+			return Destination{
+				Address:  dest,
+				Local:    local,
+				Checksum: after,
+			}, nil
+		}
+	}
+	return Destination{}, wrapError(ErrLookupFailed, errRingChanging)
+}
+
+// DestinationInfo describes the destination that serves a key, as returned by
+// GetClientWithInfo.
+type DestinationInfo struct {
+	// HostPort is the address of the destination.
+	HostPort string
+
+	// IsLocal tells whether HostPort is the address of the local node.
+	IsLocal bool
+
+	// ReplicaIndex is the position of the destination among the replicas of
+	// the key: 0 for its owner, and higher when the router fell back to
+	// another replica, eg. because the circuit of the owner is open, or the
+	// policy of WithPolicy picked one. It is -1 when the destination is not
+	// one of the replicas the router falls back to, eg. because the ring
+	// changed meanwhile.
+	ReplicaIndex int
+
+	// Checksum is the checksum of the ring when the key was resolved.
+	Checksum uint32
+}
+
+// GetClientWithInfo returns the client for key like GetClient, together with
+// the destination that serves it. The checksum of the ring is read before
+// key is resolved, so a ring that changed meanwhile can be detected by
+// comparing it to ringpop's Checksum.
+func (r *router) GetClientWithInfo(key string) (interface{}, DestinationInfo, error) {
+	checksum, err := r.ringpop.Checksum()
+	if err != nil {
+		return nil, DestinationInfo{}, wrapError(ErrLookupFailed, err)
+	}
+
+	rt, err := r.resolveRoute(context.Background(), key)
+	if err != nil {
+		return nil, DestinationInfo{}, err
+	}
+	local, err := r.isSelf(rt.dest)
+	if err != nil {
+		return nil, DestinationInfo{}, err
+	}
+	return rt.client, DestinationInfo{
+		HostPort:     rt.dest,
+		IsLocal:      local,
+		ReplicaIndex: r.replicaIndex(rt),
+		Checksum:     checksum,
+	}, nil
+}
+
+// replicaIndex returns the position of the destination of rt among the
+// replicas of its key the router falls back to, or -1 when it is not one of
+// them. The owner of rt is the owner of the key on the ring unless a policy
+// selected it, so only routes of routers with a policy, or that fell back to
+// another destination, look up the replicas.
+func (r *router) replicaIndex(rt route) int {
+	if rt.dest == rt.owner && r.policy == nil && r.zoneLabel == "" {
+		return 0
+	}
+	dests, err := r.resolveKeyN(r.mapKey(rt.key), r.fallbackReplicas())
+	if err != nil {
+		return -1
+	}
+	for i, dest := range dests {
+		if r.sameDest(dest, rt.dest) {
+			return i
+		}
+	}
+	return -1
+}
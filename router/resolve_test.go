@@ -0,0 +1,139 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestResolve(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp)
+	rp.On("Checksum").Return(uint32(42), nil)
+
+	dest, err := r.Resolve("local")
+	assert.NoError(t, err)
+	assert.Equal(t, Destination{Address: "127.0.0.1:3000", Local: true, Checksum: 42}, dest)
+
+	dest, err = r.Resolve("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, Destination{Address: "127.0.0.1:3001", Local: false, Checksum: 42}, dest)
+}
+
+func TestResolveRetriesWhenRingChanges(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp)
+	rp.On("Checksum").Return(uint32(1), nil).Once()
+	rp.On("Checksum").Return(uint32(2), nil)
+
+	dest, err := r.Resolve("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), dest.Checksum)
+	rp.AssertNumberOfCalls(t, "Lookup", 2)
+}
+
+func TestResolveGivesUpWhenRingKeepsChanging(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp)
+	for i := 0; i < 2*maxResolveAttempts; i++ {
+		rp.On("Checksum").Return(uint32(i), nil).Once()
+	}
+
+	_, err := r.Resolve("remote")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+	rp.AssertNumberOfCalls(t, "Lookup", maxResolveAttempts)
+}
+
+func TestResolveChecksumError(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp)
+	rp.On("Checksum").Return(uint32(0), errors.New("not bootstrapped"))
+
+	_, err := r.Resolve("remote")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+}
+
+func TestGetClientWithInfo(t *testing.T) {
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+	table := map[string]string{"a": "127.0.0.1:3000", "b": "127.0.0.1:3002"}
+	r := NewStatic("127.0.0.1:3000", table, "127.0.0.1:3001", cf, nil, WithSuspectFallback(2), WithRemoteDialer(func(dest string) (interface{}, error) {
+		return "client of " + dest, nil
+	})).(*router)
+	checksum, _ := r.ringpop.Checksum()
+
+	client, info, err := r.GetClientWithInfo("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+	assert.Equal(t, DestinationInfo{HostPort: "127.0.0.1:3000", IsLocal: true, Checksum: checksum}, info)
+
+	client, info, err = r.GetClientWithInfo("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "client of 127.0.0.1:3002", client)
+	assert.Equal(t, DestinationInfo{HostPort: "127.0.0.1:3002", Checksum: checksum}, info)
+
+	// keys of unhealthy owners are served by their next replica
+	r.changesMu.Lock()
+	r.lastChanges["127.0.0.1:3002"] = swim.Change{Address: "127.0.0.1:3002", Status: swim.Suspect}
+	r.changesMu.Unlock()
+	client, info, err = r.GetClientWithInfo("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+	assert.Equal(t, DestinationInfo{HostPort: "127.0.0.1:3000", IsLocal: true, ReplicaIndex: 1, Checksum: checksum}, info)
+}
+
+func TestGetClientWithInfoPolicy(t *testing.T) {
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+	table := map[string]string{"a": "127.0.0.1:3000", "b": "127.0.0.1:3002"}
+	r := NewStatic("127.0.0.1:3000", table, "127.0.0.1:3001", cf, nil, WithPolicy(FollowerReplica(2)), WithRemoteDialer(func(dest string) (interface{}, error) {
+		return "client of " + dest, nil
+	})).(*router)
+
+	replicas, err := r.resolveKeyN("b", 2)
+	assert.NoError(t, err)
+	_, info, err := r.GetClientWithInfo("b")
+	assert.NoError(t, err)
+	assert.Equal(t, replicas[1], info.HostPort)
+	assert.Equal(t, 1, info.ReplicaIndex, "expected the index of the replica the policy picked")
+}
+
+func TestGetClientWithInfoErrors(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("Checksum").Return(uint32(0), errors.New("not ready")).Once()
+	rp.On("Checksum").Return(uint32(1), nil)
+	rp.On("Lookup", "a").Return("", errors.New("no members"))
+	r := New(rp, &mocks.ClientFactory{}, nil)
+
+	_, _, err := r.GetClientWithInfo("a")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+
+	_, info, err := r.GetClientWithInfo("a")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+	assert.Equal(t, DestinationInfo{}, info)
+}
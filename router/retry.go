@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"net"
+	"time"
+
+	"github.com/uber/tchannel-go"
+)
+
+// A RetryPolicy configures how Dispatch retries calls that failed because
+// the destination could not be reached, see WithRetry.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a call is retried after the
+	// first attempt.
+	MaxRetries int
+
+	// Backoff is the time waited before the first retry. It doubles with
+	// every further retry, up to MaxBackoff, or maxRetryBackoff when
+	// MaxBackoff is not set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter randomly shortens every backoff by up to this fraction of it,
+	// so calls that failed together do not all retry at the same time: with
+	// 0.5 backoffs last between half and all of their value. The random
+	// source of the router is used, see WithRandSource.
+	Jitter float64
+
+	// Retryable decides whether a call that failed with err is retried. When
+	// nil, calls failing with a connection error are retried, see
+	// IsConnectionError.
+	Retryable func(err error) bool
+}
+
+// IsConnectionError returns whether err tells that the destination of a call
+// could not be reached, as opposed to the destination failing the call.
+func IsConnectionError(err error) bool {
+	switch err {
+	case nil:
+		return false
+	case tchannel.ErrConnectionClosed, tchannel.ErrConnectionNotReady:
+		return true
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	if _, ok := err.(tchannel.SystemError); ok {
+		switch tchannel.GetSystemErrorCode(err) {
+		case tchannel.ErrCodeNetwork, tchannel.ErrCodeDeclined:
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsConnectionError(err)
+}
+
+// maxRetryBackoff caps the backoff of the retry policies without MaxBackoff,
+// so doubling it cannot overflow time.Duration.
+const maxRetryBackoff = time.Minute
+
+// backoff returns the time to wait before the given retry, counting from 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = maxRetryBackoff
+	}
+	d := p.Backoff
+	for i := 1; i < retry && d > 0 && d < max; i++ {
+		if d > max/2 {
+			return max
+		}
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
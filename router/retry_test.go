@@ -0,0 +1,147 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"golang.org/x/net/context"
+)
+
+// newRetryTestRouter creates a router on which "moving" first resolves to
+// 127.0.0.1:3001 and then to 127.0.0.1:3002. Remote clients are the address
+// of their destination.
+func newRetryTestRouter(t *testing.T, policy RetryPolicy) (*router, *[]string) {
+	rp := newTestRingpop(nil)
+	rp.On("Lookup", "moving").Return("127.0.0.1:3001", nil).Once()
+	rp.On("Lookup", "moving").Return("127.0.0.1:3002", nil)
+
+	var dialed []string
+	dialer := func(dest string) (interface{}, error) {
+		dialed = append(dialed, dest)
+		return dest, nil
+	}
+	return newRingpopTestRouter(t, rp, WithRemoteDialer(dialer), WithRetry(policy)), &dialed
+}
+
+func TestDispatchRetriesOnNewOwner(t *testing.T) {
+	r, dialed := newRetryTestRouter(t, RetryPolicy{MaxRetries: 1})
+
+	var called []interface{}
+	err := r.Dispatch("moving", func(client interface{}) error {
+		called = append(called, client)
+		if client == "127.0.0.1:3001" {
+			return tchannel.ErrConnectionClosed
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"127.0.0.1:3001", "127.0.0.1:3002"}, called)
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002"}, *dialed)
+
+	_, cached := r.cache.get("127.0.0.1:3001")
+	assert.False(t, cached, "expected the client of the failed destination to be evicted")
+}
+
+func TestDispatchStopsAfterMaxRetries(t *testing.T) {
+	r, _ := newRetryTestRouter(t, RetryPolicy{MaxRetries: 2})
+
+	calls := 0
+	err := r.Dispatch("moving", func(client interface{}) error {
+		calls++
+		return tchannel.ErrConnectionClosed
+	})
+	assert.Equal(t, tchannel.ErrConnectionClosed, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestDispatchDoesNotRetryOtherErrors(t *testing.T) {
+	r, _ := newRetryTestRouter(t, RetryPolicy{MaxRetries: 2})
+
+	calls := 0
+	err := r.Dispatch("moving", func(client interface{}) error {
+		calls++
+		return errors.New("application error")
+	})
+	assert.EqualError(t, err, "application error")
+	assert.Equal(t, 1, calls)
+}
+
+func TestDispatchCustomRetryable(t *testing.T) {
+	errRetry := errors.New("retry me")
+	r, _ := newRetryTestRouter(t, RetryPolicy{
+		MaxRetries: 1,
+		Retryable:  func(err error) bool { return err == errRetry },
+	})
+
+	calls := 0
+	err := r.Dispatch("moving", func(client interface{}) error {
+		calls++
+		if calls == 1 {
+			return errRetry
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	assert.Equal(t, 10*time.Millisecond, p.backoff(1))
+	assert.Equal(t, 20*time.Millisecond, p.backoff(2))
+	assert.Equal(t, 40*time.Millisecond, p.backoff(3))
+	assert.Equal(t, 50*time.Millisecond, p.backoff(4))
+	assert.Equal(t, 50*time.Millisecond, p.backoff(40))
+
+	p = RetryPolicy{Backoff: time.Second}
+	assert.Equal(t, maxRetryBackoff, p.backoff(100), "expected the backoff to be capped without MaxBackoff")
+	p = RetryPolicy{Backoff: time.Second, MaxBackoff: time.Duration(1<<63 - 1)}
+	assert.True(t, p.backoff(100) > 0, "expected the backoff not to overflow")
+}
+
+func TestDispatchContextCancelsRetryWait(t *testing.T) {
+	r, _ := newRetryTestRouter(t, RetryPolicy{MaxRetries: 1, Backoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	calls := 0
+	err := r.DispatchContext(ctx, "moving", func(client interface{}) error {
+		calls++
+		return tchannel.ErrConnectionClosed
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, calls, "expected to give up while waiting for the retry")
+}
+
+func TestIsConnectionError(t *testing.T) {
+	assert.False(t, IsConnectionError(nil))
+	assert.True(t, IsConnectionError(tchannel.ErrConnectionClosed))
+	assert.True(t, IsConnectionError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.True(t, IsConnectionError(tchannel.NewSystemError(tchannel.ErrCodeNetwork, "reset")))
+	assert.False(t, IsConnectionError(tchannel.NewSystemError(tchannel.ErrCodeTimeout, "timeout")))
+	assert.False(t, IsConnectionError(errors.New("application error")))
+}
@@ -21,33 +21,451 @@
 package router
 
 import (
+	"io"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/benbjohnson/clock"
+	"github.com/uber-common/bark"
 	"github.com/uber/ringpop-go"
 	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/logging"
 	"github.com/uber/ringpop-go/swim"
 	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/hyperbahn"
 	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
 )
 
 type router struct {
 	ringpop ringpop.Interface
-	factory ClientFactory
+	factory ClientFactoryV2
 	channel *tchannel.Channel
 
-	rw          sync.RWMutex
-	clientCache map[string]interface{}
+	clock   clock.Clock
+	rand    *rand.Rand
+	statter bark.StatsReporter
+	logger  bark.Logger
+	stats   *routerStats
+
+	cache       *clientCache
+	cacheShards int
+	maxClients  int
+	idleTimeout time.Duration
+
+	maxInflightPerDest int
+	blockWhenBusy      bool
+
+	inflightMu sync.Mutex
+	inflight   map[string]chan struct{}
+
+	adaptive       *AdaptiveConcurrency
+	adaptiveLimits map[string]*adaptiveLimit
+
+	callLimit      int
+	callLimitQueue bool
+	calls          map[string]chan struct{}
+
+	sampler *decisionSampler
+
+	hotKeys []string
+
+	changesMu       sync.Mutex
+	lastChanges     map[string]swim.Change
+	quarantine      map[string]bool
+	statusPredicate StatusPredicate
+
+	// departed holds the last change about the members forgotten by
+	// ReconcileMembers, which older changes delivered late are compared with
+	departed map[string]swim.Change
+
+	stickyMu sync.Mutex
+	sticky   map[string]*stickySession
+
+	streamsMu sync.Mutex
+	streams   map[*streamClient]struct{}
+
+	watchesMu     sync.Mutex
+	watches       map[*keyWatch]struct{}
+	watchReplicas int
+
+	pinsMu sync.Mutex
+	pins   map[string]string
+
+	serviceScopedCache bool
+	service            string
+	serviceFunc        ServiceFunc
+
+	transport             Transport
+	channelProvider       ChannelProvider
+	clientOptionsProvider ClientOptionsProvider
+	addressTranslator     AddressTranslator
+	normalizer            Normalizer
+
+	breakerFailures int
+	breakerCooldown time.Duration
+	circuitFallback int
+	suspectFallback int
+	breakersMu      sync.Mutex
+	breakers        map[string]*circuitBreaker
+
+	retry       *RetryPolicy
+	retryBudget *retryBudget
+
+	deadlineRouting  bool
+	deadlineFallback int
+	latencyTracking  bool
+	latencyExport    bool
+	latenciesMu      sync.Mutex
+	latencies        map[string]*latencyStats
+
+	errorWindow  time.Duration
+	errorBudget  *errorBudget
+	errorStatsMu sync.Mutex
+	errorStats   map[string]*errorStats
+
+	// ringChecksum is the checksum of the ring the router last invalidated
+	// its state for, see invalidateRing.
+	ringChecksum uint32
+
+	// members is the snapshot of the members of the ring with the current
+	// checksum, see memberSnapshot
+	membersMu sync.Mutex
+	members   *memberSnapshot
+
+	keyMapper      KeyMapper
+	lookupStrategy LookupStrategy
+	memo           *lookupMemo
+	memberFilter   MemberFilter
+	policy         Policy
+	readPolicy     Policy
+	weights        WeightFunc
+	weightLabel    string
+	rangeSplits    []string
+	shadow         *shadow
+
+	validateMembers bool
+	destFallback    DestinationFallback
+
+	faults FaultConfig
+
+	factoryCtx      context.Context
+	factoryRecovery bool
+	factoryErrors   ErrorTranslator
+	tlsConfig       TLSConfigFunc
+
+	hotKeyStats *hotKeys
+	hotKeySplit HotKeySplitter
+
+	loadStats *loadStats
+
+	selfCache  bool
+	selfMu     sync.RWMutex
+	self       string
+	localAddrs map[string]bool
+
+	tracer   Tracer
+	auditLog *auditLog
+
+	interceptors    []Interceptor
+	checksumHeaders bool
+	callTimeouts    *CallTimeouts
+
+	state       *routerState
+	dispatchMu  sync.Mutex
+	dispatching int
+	drained     chan struct{}
+
+	loopback thrift.TChanServer
+
+	warmUpEnabled bool
+	warmUpNearest int
+	warmUpTimeout time.Duration
+
+	replicaPoints      int
+	ownershipMu        sync.Mutex
+	ownershipListeners []func(moved []KeyRange)
+	ring               tokenRing
+	ringTracked        bool
+	staleReadWindow    time.Duration
+	ownershipHistory   []ownershipChange
+
+	poolSize     PoolSizeFunc
+	labels       LabelsFunc
+	zoneLabel    string
+	zoneReplicas int
+
+	// selfZone is the zone of the local node once read, see localZone
+	zoneMu        sync.RWMutex
+	selfZone      string
+	selfZoneKnown bool
+
+	advertisement bool
+	uncachedLocal bool
+
+	broadcastParallelism int
+	quorumTimeout        time.Duration
+
+	clientErrsMu sync.Mutex
+	clientErrs   map[string]error
+
+	creationLimit int
+	creationWait  time.Duration
+	creationSlots chan struct{}
+
+	evictMu        sync.Mutex
+	evictListeners []func(dest string, client interface{})
+	evictionDrain  time.Duration
+
+	listenersMu sync.RWMutex
+	listeners   []events.EventListener
+
+	healthInterval time.Duration
+	healthTimeout  time.Duration
+	healthStop     chan struct{}
+
+	watchInterval time.Duration
+	watchStop     chan struct{}
+
+	labelInterval time.Duration
+	labelStop     chan struct{}
+
+	snapshotFile string
+
+	tenant       TenantFunc
+	quota        QuotaFunc
+	bucketsMu    sync.Mutex
+	buckets      map[string]*tokenBucket
+	bucketsSwept time.Time
 }
 
 // A Router creates instances of TChannel Thrift Clients via the help of the ClientFactory
 type Router interface {
+	Dispatcher
+
 	GetClient(key string) (interface{}, error)
+
+	// GetClientContext is like GetClient but returns early with the error of
+	// ctx when ctx is done before the client is available.
+	GetClientContext(ctx context.Context, key string) (interface{}, error)
+
+	// DispatchContext is like Dispatch but gives up with the error of ctx
+	// when ctx is done while a client is created or before a retry.
+	DispatchContext(ctx context.Context, key string, fn func(client interface{}) error) error
+
+	// GetClientKind is like GetClient but returns the client of the given
+	// kind, eg. "read" or "write", see KindClientFactory.
+	GetClientKind(key, kind string) (interface{}, error)
+
+	// GetClientWithInfo is like GetClient but also returns the destination
+	// that serves key, eg. for callers to log or meter which node served a
+	// request.
+	GetClientWithInfo(key string) (interface{}, DestinationInfo, error)
+
+	// GetShadowedClient is like GetClient but also returns, for a sample of
+	// the calls, the client of the destination of key according to the
+	// shadow resolver configured with WithShadow.
+	GetShadowedClient(key string) (ShadowedClient, error)
+
+	// GetReadClient is like GetClient but returns the client of the
+	// destination the read policy selects for key, see WithReadPolicy, or of
+	// the previous owner of key when its owner is unreachable and the key
+	// moved recently, see WithStaleReads. Use it for reads only.
+	GetReadClient(key string) (interface{}, error)
+
+	// GetWriteClient is like GetClient but always returns the client of the
+	// owner of key, ignoring the policy of WithPolicy. Use it for writes when
+	// reads are spread over replicas.
+	GetWriteClient(key string) (interface{}, error)
+
+	// GetClientN returns the clients for the n nodes responsible for key,
+	// the owner first, as resolved by ringpop's LookupN.
+	GetClientN(key string, n int) ([]interface{}, error)
+
+	// GetClients resolves many keys at once and returns the client of every
+	// destination together with the keys that resolved to it, keyed by
+	// destination, so calls can be batched per node.
+	GetClients(keys []string) (map[string]*ClientKeys, error)
+
+	// OwnersForKeyspace resolves every prefix of a keyspace and groups the
+	// prefixes by destination, see OwnersForKeyspace.
+	OwnersForKeyspace(prefixes []string) (map[string][]string, error)
+
+	// SimulatePlacement returns the keys every one of members would own if
+	// they were the members of the ring, without touching the live ring.
+	SimulatePlacement(members []string, keys []string) map[string][]string
+
+	// OwnerRanges returns the ranges of the hash space owned by each member
+	// of the ring, see OwnerRange.
+	OwnerRanges() ([]OwnerRange, error)
+
+	// ResolveAndWarm resolves keys and connects to their destinations in the
+	// background, the returned channel is closed when done.
+	ResolveAndWarm(keys []string) <-chan struct{}
+
+	// Drain stops routing keys to the local node ahead of a shutdown, the
+	// keys it owns are routed to the next node responsible for them.
+	Drain()
+
+	// Resolve returns the destination of key together with whether it is the
+	// local node and the checksum of the ring it was resolved against.
+	Resolve(key string) (Destination, error)
+
+	// GetClientExcluding returns the client of the owner of key, or of
+	// another node responsible for key when the owner is in exclude.
+	GetClientExcluding(key string, exclude []string) (interface{}, error)
+
+	// RunOnOwner runs local when the local node owns key and remote with the
+	// client of the owner otherwise, resolving key again when the owner
+	// cannot be reached, see RunOnOwner.
+	RunOnOwner(ctx context.Context, key string, local LocalFunc, remote RemoteFunc) error
+
+	// HedgedCall calls fn with the client of the owner of key and, when that
+	// call is slow, with the client of the second node responsible for key,
+	// returning the first success, see HedgedCall.
+	HedgedCall(ctx context.Context, key string, delay time.Duration, fn HedgedFunc) (interface{}, error)
+
+	// Pin routes key to dest instead of its owner until Unpin is called for
+	// key or dest leaves the ring.
+	Pin(key, dest string)
+
+	// Unpin routes key to its owner on the ring again.
+	Unpin(key string)
+
+	// GetStickyClient returns a handle that keeps returning the client of
+	// the node key resolved to on creation, see StickyClient.
+	GetStickyClient(key string) (StickyClient, error)
+
+	// GetStreamClient opens a stream to the node key resolves to and returns
+	// a handle that re-establishes it when ownership of key moves, see
+	// StreamClient.
+	GetStreamClient(key string, open StreamOpener, resume ResumeFunc) (StreamClient, error)
+
+	// WatchKey returns a channel that is sent the changes of the owner and
+	// the replica set of key, and the function that ends the watch, see
+	// ReplicaSetChange.
+	WatchKey(key string) (<-chan ReplicaSetChange, func())
+
+	// Stats returns the counters the router keeps about its behavior.
+	Stats() Stats
+
+	// RoutingTable returns a snapshot of the members the router routes to,
+	// see RoutingTable and DebugHandler.
+	RoutingTable() (RoutingTable, error)
+
+	// ReconcileChange applies a single membership change to the client
+	// cache. It is called for every change ringpop reports to the router and
+	// is exposed for testing and tooling.
+	ReconcileChange(change swim.Change)
+
+	// ReconcileMembers evicts, in one pass, the clients of all destinations
+	// that are no longer reachable members of the ring. It is called when
+	// ringpop completes a join, eg. after bootstrapping again, and is exposed
+	// for testing and tooling.
+	ReconcileMembers()
+
+	// InvalidateDestination evicts the client of dest, InvalidateAll all
+	// clients, and Refresh replaces the client of dest and opens its
+	// connection, see AdminHandler.
+	InvalidateDestination(dest string) bool
+	InvalidateAll() int
+	Refresh(dest string) error
+
+	// OnOwnershipChange registers fn to be called with the ranges of the ring
+	// that moved to another node every time ringpop's ring changes, so state
+	// can be handed off when the ring rebalances. The ring at the time of the
+	// first registration is the baseline for the first change, see KeyRange.
+	//
+	// Callbacks are called one at a time and in the order of the changes. They
+	// must not call OnOwnershipChange.
+	OnOwnershipChange(fn func(moved []KeyRange))
+
+	// KeyHash returns the hash of key on the ring, which tells whether it
+	// falls in a KeyRange, see KeyRange.ContainsHash.
+	KeyHash(key string) uint32
+
+	// OnEvict registers fn to be called with the destination and the client
+	// of every client that is evicted from the cache, see OnEvict.
+	OnEvict(fn func(dest string, client interface{}))
+
+	// RegisterListener adds a listener that is sent the events of the
+	// router, eg. a ClientCreatedEvent or an OwnerChangedEvent.
+	RegisterListener(l events.EventListener)
+
+	// RefreshLabels evicts the client of dest when the labels of the node
+	// changed since it was created, see WithLabels.
+	RefreshLabels(dest string) error
+
+	// ClientStates returns the state of the cached clients and DumpState
+	// writes it to w in a human readable form, for debugging.
+	ClientStates() []ClientState
+	DumpState(w io.Writer) error
+
+	// QuorumCall calls fn with the clients of the n nodes responsible for key
+	// and succeeds once quorum of the calls succeeded.
+	QuorumCall(ctx context.Context, key string, n, quorum int, fn QuorumFunc) error
+
+	// Broadcast calls fn concurrently with the client of every reachable
+	// member of the ring and returns the outcome for every member.
+	Broadcast(ctx context.Context, fn func(dest string, client interface{}) error) []Result
+
+	// AdvertisementHandler returns the hyperbahn.Handler that pauses the
+	// router while its channel is not advertised, see WithAdvertisement.
+	AdvertisementHandler() hyperbahn.Handler
+
+	// ErrorRate returns the share of the recent calls to dest that failed
+	// with one of classes, or with any error when none is given, see
+	// WithErrorTracking.
+	ErrorRate(dest string, classes ...ErrorClass) float64
+
+	// DestinationStats returns the statistics of the latency of the calls to
+	// dest, see WithLatencyTracking.
+	DestinationStats(dest string) (DestinationStats, bool)
+
+	// ExplainKey returns the route of key and its n replicas, see
+	// DebugHandler.
+	ExplainKey(key string, n int) (KeyRoute, error)
+
+	// LoadReport returns how the recently resolved keys and dispatched
+	// calls spread over the destinations, see WithLoadReport.
+	LoadReport() LoadReport
+
+	// Snapshot returns the view of the ring of the router and the
+	// destinations of its cached clients.
+	Snapshot() Snapshot
+
+	// WarmSnapshot creates the clients of the destinations of s and opens
+	// their connections in the background.
+	WarmSnapshot(s Snapshot) <-chan struct{}
+
+	// WaitUntilStable blocks until no change of the membership or the ring
+	// was observed for window, or ctx is done.
+	WaitUntilStable(ctx context.Context, window time.Duration) error
+
+	// Close stops the router, waiting until ctx is done for calls made
+	// through Dispatch to finish, and closes the cached clients.
+	Close(ctx context.Context) error
+}
+
+// routerState holds the state of the router that is accessed atomically.
+type routerState struct {
+	// changedAt is the time, in nanoseconds since the epoch, a change of the
+	// membership or the ring was last observed. It is the first field to
+	// guarantee 64-bit alignment for atomic operations on 32-bit platforms.
+	changedAt int64
+
+	closed   int32
+	draining int32
+	paused   int32
 }
 
 // A ClientFactory is able to provide an implementation of a TChan[Service]
 // interface that can dispatch calls to the actual implementation. This could be
 // both a local or a remote implementation of the interface based on the dest
-// provided
+// provided. Factories that can fail to create a client implement
+// ClientFactoryV2 instead.
 type ClientFactory interface {
 	GetLocalClient() interface{}
 	MakeRemoteClient(client thrift.TChanClient) interface{}
@@ -56,84 +474,657 @@ type ClientFactory interface {
 // New creates an instance that validates the Router interface. A Router
 // will be used to get implementations of service interfaces that implement a
 // distributed microservice.
-func New(rp ringpop.Interface, f ClientFactory, ch *tchannel.Channel) Router {
+//
+// The router routes over the ring of rp only and keeps a cache of its own, so
+// the routers of the rings of several ringpop namespaces can share ch, see
+// ringpop.Namespace.
+func New(rp ringpop.Interface, f ClientFactory, ch *tchannel.Channel, opts ...Option) Router {
+	r := newRouter(rp, factoryV1{f}, ch, opts...)
+	rp.RegisterListener(r)
+	r.start()
+	return r
+}
+
+// start starts the background work of the router enabled by its options.
+func (r *router) start() {
+	r.startHealthCheck()
+	r.startConnectionWatch()
+	r.startLabelRefresh()
+	r.loadSnapshot()
+}
+
+// newRouter creates a router that is not registered as a listener of rp.
+func newRouter(rp ringpop.Interface, f ClientFactoryV2, ch *tchannel.Channel, opts ...Option) *router {
 	r := &router{
 		ringpop:     rp,
 		factory:     f,
-		clientCache: make(map[string]interface{}),
+		cacheShards: defaultCacheShards,
 		channel:     ch,
+		clock:       clock.New(),
+		rand:        newRand(rand.NewSource(time.Now().UnixNano())),
+		statter:     noopStatsReporter{},
+		logger:      logging.Logger("router"),
+		stats:       &routerStats{},
+		inflight:    make(map[string]chan struct{}),
+		calls:       make(map[string]chan struct{}),
+		lastChanges: make(map[string]swim.Change),
+		quarantine:  make(map[string]bool),
+		departed:    make(map[string]swim.Change),
+		sticky:      make(map[string]*stickySession),
+		streams:     make(map[*streamClient]struct{}),
+		watches:     make(map[*keyWatch]struct{}),
+		pins:        make(map[string]string),
+		breakers:    make(map[string]*circuitBreaker),
+		latencies:   make(map[string]*latencyStats),
+		clientErrs:  make(map[string]error),
+		errorStats:  make(map[string]*errorStats),
+		buckets:     make(map[string]*tokenBucket),
+
+		replicaPoints: defaultReplicaPoints,
+		state:         &routerState{},
 	}
-	rp.RegisterListener(r)
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.weights == nil && r.weightLabel != "" {
+		r.weights = r.labelWeight
+	}
+	if r.weights != nil && r.lookupStrategy == RingLookup {
+		r.lookupStrategy = RendezvousLookup
+	}
+	if r.staleReadWindow > 0 {
+		r.trackRing()
+	}
+	if r.creationLimit > 0 {
+		r.creationSlots = make(chan struct{}, r.creationLimit)
+	}
+	if r.transport == nil && ch != nil {
+		r.transport = &TChannelTransport{
+			Channel:       ch,
+			Service:       r.serviceName(),
+			ClientOptions: r.clientOptionsProvider,
+		}
+	}
+	if r.transport == nil && r.channelProvider != nil {
+		r.transport = &lazyTransport{
+			provider:      r.channelProvider,
+			service:       r.serviceName(),
+			clientOptions: r.clientOptionsProvider,
+		}
+	}
+	r.cache = newClientCache(r.cacheShards)
 	return r
 }
 
 func (r *router) HandleEvent(event events.Event) {
+	if r.closed() {
+		return
+	}
+
 	switch event := event.(type) {
 	case swim.MemberlistChangesReceivedEvent:
+		r.recordMembershipChange()
 		for _, change := range event.Changes {
-			r.handleChange(change)
+			r.ReconcileChange(change)
+		}
+	case swim.JoinCompleteEvent:
+		r.forgetSelf()
+		r.ReconcileMembers()
+	case events.RingChangedEvent:
+		// the state of the router is invalidated by the RingChecksumEvent
+		// ringpop sends before every RingChangedEvent
+		r.recordMembershipChange()
+		r.reconcileOwnership()
+		r.reconcileStreams()
+		r.reconcileWatches()
+	case events.RingChecksumEvent:
+		// the checksum the state was last invalidated for is skipped, eg.
+		// when it is reported again
+		if event.NewChecksum != event.OldChecksum && atomic.SwapUint32(&r.ringChecksum, event.NewChecksum) != event.NewChecksum {
+			r.invalidateRing()
 		}
 	}
 }
 
-func (r *router) handleChange(change swim.Change) {
-	switch change.Status {
-	case swim.Faulty, swim.Leave:
+// ReconcileChange evicts the client of the destination the change is about
+// when that destination is no longer able to serve requests, as decided by
+// the StatusPredicate of the router, see WithStatusPredicate. Clients of other
+// destinations are never touched. After an eviction the owners of the keys
+// configured with WithHotKeys are resolved again and their clients created so
+// the first request for a hot key does not pay for the client creation.
+// Members that become alive are warmed up when enabled with WithWarmUp.
+//
+// Ringpop members are identified by their address, which a restarted member
+// reuses. A member that is reported alive with another incarnation than the
+// last change about it has restarted, or refuted a suspicion, so its client
+// is evicted and created again on demand rather than reusing connections to
+// the previous process.
+//
+// Ringpop delivers events on separate goroutines, so changes about the same
+// destination can arrive out of order. Changes are processed one at a time
+// and a change that is older than the last change applied for its
+// destination, as decided by swim.Change.Overrides, is ignored. This makes the
+// newest status win regardless of the order of delivery, including for
+// members the router forgot since they left, see ReconcileMembers.
+func (r *router) ReconcileChange(change swim.Change) {
+	change.Address = r.normalize(change.Address)
+
+	r.changesMu.Lock()
+	last, ok := r.lastChanges[change.Address]
+	if !ok {
+		last, ok = r.departed[change.Address]
+	}
+	if ok && !change.Overrides(last) {
+		r.changesMu.Unlock()
+		return
+	}
+	r.lastChanges[change.Address] = change
+	delete(r.departed, change.Address)
+
+	decision := r.decide(change)
+	evict := decision != KeepClient
+	join := !evict && change.Status == swim.Alive
+	if decision == QuarantineClient {
+		r.quarantine[change.Address] = true
+	} else {
+		delete(r.quarantine, change.Address)
+	}
+	if evict {
+		r.logger.WithFields(bark.Fields{
+			"member":     change.Address,
+			"status":     change.Status,
+			"quarantine": decision == QuarantineClient,
+		}).Debug("router evicting client of member")
+		r.removeClient(change.Address)
+		r.endStickySessions(change.Address)
+		r.unpinDest(change.Address)
+	}
+	if join && ok && change.Incarnation != last.Incarnation {
+		// the member restarted, or refuted a suspicion, and its connections
+		// might be bound to the previous process
+		r.logger.WithFields(bark.Fields{
+			"member":      change.Address,
+			"incarnation": change.Incarnation,
+		}).Debug("router evicting client of new incarnation of member")
 		r.removeClient(change.Address)
 	}
+	r.changesMu.Unlock()
+
+	if evict {
+		r.warmHotKeys(change.Address)
+	}
+	if join {
+		r.warmUp(change.Address)
+	}
+	if !evict {
+		// the labels may have changed with the membership of the member
+		r.refreshLabelsAsync(change.Address)
+	}
+}
+
+// warmHotKeys creates the clients for the current owners of the hot keys,
+// skipping keys that still resolve to the evicted destination because the
+// ring has not yet processed the change.
+func (r *router) warmHotKeys(evicted string) {
+	for _, key := range r.hotKeys {
+		dest, err := r.ringpop.Lookup(r.mapKey(key))
+		if err != nil || dest == evicted {
+			continue
+		}
+		r.getClientForDest(dest)
+	}
 }
 
 // Get the client for a certain destination from our internal cache, or
 // delegates the creation to the ClientFactory.
 func (r *router) GetClient(key string) (interface{}, error) {
-	dest, err := r.ringpop.Lookup(key)
+	if r.tracer != nil {
+		client, _, err := r.traceGetClient(context.Background(), key)
+		return client, err
+	}
+
+	client, _, err := r.getClient(key)
+	return client, err
+}
+
+// getClient returns the client for key together with the destination the key
+// resolved to.
+func (r *router) getClient(key string) (interface{}, string, error) {
+	client, dest, _, err := r.resolveClient(context.Background(), key)
+	return client, dest, err
+}
+
+// resolveClient returns the client for key, the destination the key resolved
+// to and whether the client came from the cache. With WithDeadlineRouting,
+// owners that cannot meet the deadline of ctx are skipped. The creation of a
+// client is given up when ctx is done, see createClient.
+func (r *router) resolveClient(ctx context.Context, key string) (client interface{}, dest string, hit bool, err error) {
+	rt, err := r.resolveRoute(ctx, key)
+	return rt.client, rt.dest, rt.hit, err
+}
+
+// A route is the outcome of resolving the client of a key.
+type route struct {
+	client interface{}
+	dest   string
+	hit    bool
+
+	// key is the key routed on and owner its destination on the ring, which
+	// dest differs from when the router fell back to another destination.
+	key   string
+	owner string
+}
+
+// resolveRoute resolves the client for key like resolveClient and returns
+// the route it took.
+func (r *router) resolveRoute(ctx context.Context, key string) (route, error) {
+	if err := r.admit(key); err != nil {
+		return route{}, err
+	}
+	return r.resolveAdmittedRoute(ctx, key)
+}
+
+// resolveAdmittedRoute resolves the route of key like resolveRoute, once the
+// router admitted key.
+func (r *router) resolveAdmittedRoute(ctx context.Context, key string) (route, error) {
+	key = r.routedKey(key)
+	dest, err := r.routeLookup(ctx, key)
+	if err != nil {
+		return route{}, err
+	}
+	r.recordKey(dest)
+	rt := route{key: key, owner: dest}
+
+	if r.sampler != nil {
+		r.sampler.observe(RouteInfo{
+			Key:         key,
+			Destination: dest,
+		})
+	}
+
+	if r.draining() {
+		rt.client, rt.dest, err = r.drainedClient(ctx, key, dest)
+		if rt.dest != "" || err != nil {
+			return rt, err
+		}
+	}
+
+	if r.suspectFallback > 1 && r.unhealthy(dest) {
+		rt.client, rt.dest, err = r.replicaClient(ctx, key, r.suspectFallback, r.unhealthy, nil)
+		if rt.dest != "" || err != nil {
+			return rt, err
+		}
+		// all replicas are unhealthy, try the owner anyway
+	}
+
+	if deadline := r.routingDeadline(ctx); !deadline.IsZero() && !r.meetsDeadline(dest, deadline) {
+		rt.client, rt.dest, err = r.deadlineClient(ctx, key, deadline)
+		return rt, err
+	}
+
+	rt.dest = dest
+	rt.client, rt.hit, err = r.getClientForDestHit(ctx, dest)
+	if err == ErrCircuitOpen && r.circuitFallback > 1 {
+		rt.hit = false
+		rt.client, rt.dest, err = r.getClientFallback(ctx, key)
+	}
+	return rt, err
+}
+
+// GetClientN gets the clients for the n destinations of key from our internal
+// cache, or delegates their creation to the ClientFactory.
+func (r *router) GetClientN(key string, n int) ([]interface{}, error) {
+	if err := r.admit(key); err != nil {
+		return nil, err
+	}
+	dests, err := r.lookupN(context.Background(), key, n)
 	if err != nil {
 		return nil, err
 	}
 
-	r.rw.RLock()
-	client, ok := r.clientCache[dest]
-	r.rw.RUnlock()
-	if ok {
-		return client, nil
+	clients := make([]interface{}, 0, len(dests))
+	for _, dest := range dests {
+		client, err := r.getClientForDest(dest)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (r *router) getClientForDest(dest string) (interface{}, error) {
+	return r.getClientForDestContext(context.Background(), dest)
+}
+
+// getClientForDestContext returns the client for dest, giving up its creation
+// when ctx is done, see createClient.
+func (r *router) getClientForDestContext(ctx context.Context, dest string) (interface{}, error) {
+	client, _, err := r.getClientForDestHit(ctx, dest)
+	return client, err
+}
+
+// getClientForDestHit returns the client for dest and whether it came from
+// the cache.
+func (r *router) getClientForDestHit(ctx context.Context, dest string) (interface{}, bool, error) {
+	if r.closed() {
+		return nil, false, ErrRouterClosed
 	}
 
-	// no match so far, get a complete lock for creation
-	r.rw.Lock()
-	defer r.rw.Unlock()
+	if r.circuitOpen(dest) {
+		return nil, false, ErrCircuitOpen
+	}
+
+	if r.quarantined(dest) {
+		return nil, false, ErrDestinationQuarantined
+	}
+
+	r.dropClient(dest)
+
+	cacheKey := r.cacheKey(dest)
+	now := r.clock.Now()
+
+	entry, ok := r.cache.get(cacheKey)
+	if ok && !r.expired(entry, now) {
+		entry.touch(now)
+		r.recordRoute(entry, true)
+		return entry.get(), true, nil
+	}
+
+	entry, cached, evicted, err := r.createClient(ctx, cacheKey, dest, now)
+	r.evict(evicted)
+	if err != nil {
+		return nil, false, err
+	}
+	r.recordRoute(entry, cached)
+	return entry.get(), cached, nil
+}
+
+// createClient creates and caches the client for dest unless another
+// goroutine did so already, which is reported by the returned cached flag. It
+// also returns the entries that were evicted from the cache to make room for
+// the new client.
+//
+// Concurrent calls for the same destination create a single client: the
+// first call creates it without holding the lock of the cache, the others
+// wait for its result. Calls whose ctx can be done give up with the error of
+// ctx when it is done before the client is created; the client is created
+// and cached anyway, on a goroutine of its own, for the next call.
+func (r *router) createClient(ctx context.Context, cacheKey, dest string, now time.Time) (entry *cacheEntry, cached bool, evicted []*cacheEntry, err error) {
+	shard := r.cache.shard(cacheKey)
+
+	shard.Lock()
+	// the router might have been closed, and its cache cleared, meanwhile
+	if r.closed() {
+		shard.Unlock()
+		return nil, false, nil, ErrRouterClosed
+	}
+
+	// double check it is not created between read and lock
+	entry, ok := shard.entries[cacheKey]
+	if ok && !r.expired(entry, now) {
+		shard.Unlock()
+		entry.touch(now)
+		return entry, true, nil, nil
+	}
+
+	if c, ok := shard.creating[cacheKey]; ok {
+		shard.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, false, nil, ctx.Err()
+		}
+		if c.err == nil && c.entry.uncacheable {
+			// the client must not be shared, create one of our own
+			entry, err := r.newEntry(dest, now)
+			return entry, false, nil, err
+		}
+		return c.entry, true, nil, c.err
+	}
 
-	// double check it is not created between read and complete lock
-	client, ok = r.clientCache[dest]
 	if ok {
-		return client, nil
+		// the cached client expired
+		r.cache.deleteLocked(shard, cacheKey)
+		evicted = append(evicted, entry)
+	}
+
+	c := &creation{done: make(chan struct{})}
+	shard.creating[cacheKey] = c
+	shard.Unlock()
+
+	if ctx.Done() == nil {
+		evicted = append(evicted, r.create(c, shard, cacheKey, dest, now)...)
+	} else {
+		go func() {
+			r.evict(r.create(c, shard, cacheKey, dest, now))
+		}()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, false, evicted, ctx.Err()
+		}
+	}
+	if c.err != nil {
+		return nil, false, evicted, c.err
+	}
+	return c.entry, false, evicted, nil
+}
+
+// create creates the client of c for dest, caches it under cacheKey unless it
+// must not be, and closes done of c. It returns the entries evicted from the
+// cache to make room for the client.
+func (r *router) create(c *creation, shard *cacheShard, cacheKey, dest string, now time.Time) []*cacheEntry {
+	created := false
+	defer func() {
+		if created {
+			return
+		}
+		// newEntry panicked: fail the waiting calls and let the next call
+		// create the client again before the panic goes on
+		v := recover()
+		c.err = wrapError(ErrClientCreation, &FactoryPanicError{Dest: dest, Value: v})
+		shard.Lock()
+		delete(shard.creating, cacheKey)
+		shard.Unlock()
+		close(c.done)
+		panic(v)
+	}()
+	c.entry, c.err = r.newEntry(dest, now)
+	created = true
+
+	shard.Lock()
+	delete(shard.creating, cacheKey)
+	store := c.err == nil && !c.entry.uncacheable && !c.discarded && !r.closed()
+	if store {
+		r.cache.storeLocked(shard, cacheKey, c.entry)
 	}
+	shard.Unlock()
+	close(c.done)
 
-	me, err := r.ringpop.WhoAmI()
+	if c.err != nil {
+		r.recordClientError(dest, c.err)
+		return nil
+	}
+	if store {
+		r.emit(ClientCreatedEvent{Destination: dest})
+		return r.sweep(cacheKey, now)
+	}
+	return nil
+}
+
+// newEntry creates the client for dest through the ClientFactory and the
+// Transport, and returns its cache entry.
+func (r *router) newEntry(dest string, now time.Time) (*cacheEntry, error) {
+	local, err := r.isSelf(dest)
 	if err != nil {
 		return nil, err
 	}
 
-	// use the ClientFactory to get the client
-	if dest == me {
-		client = r.factory.GetLocalClient()
+	var (
+		client interface{}
+		pool   []interface{}
+		conns  []io.Closer
+		calls  *callTracker
+		labels map[string]string
+	)
+	if local {
+		client, err = r.localClient(dest)
 	} else {
-		thriftClient := thrift.NewClient(
-			r.channel,
-			r.channel.ServiceName(),
-			&thrift.ClientOptions{
-				HostPort: dest,
-			},
-		)
-		client = r.factory.MakeRemoteClient(thriftClient)
+		release, throttled := r.acquireCreation()
+		if throttled != nil {
+			return nil, throttled
+		}
+		if r.evictionDrain > 0 {
+			calls = &callTracker{}
+		}
+		func() {
+			defer release()
+			labels, err = r.memberLabels(dest)
+			if err == nil {
+				d := Destination{Address: dest, Labels: labels}
+				client, err = r.makeRemoteClient(d, calls)
+				if err == nil {
+					pool, conns, err = r.makePool(d, client, calls)
+				}
+			}
+		}()
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// cache the client
-	r.clientCache[dest] = client
-	return client, nil
+	r.logger.WithFields(bark.Fields{
+		"dest":  dest,
+		"local": local,
+	}).Debug("router created client")
+
+	entry := newCacheEntry(client, local, now)
+	entry.owner = r
+	entry.dest = dest
+	entry.pool = pool
+	entry.conns = conns
+	entry.calls = calls
+	entry.labels = labels
+	entry.uncacheable = (local && r.uncachedLocal) || !cacheable(client)
+	return entry, nil
+}
+
+// makeRemoteClient creates the client for the remote destination d from the
+// connection the Transport dials, see ClientConn. Calls through the
+// connection are counted by calls unless it is nil.
+func (r *router) makeRemoteClient(d Destination, calls *callTracker) (interface{}, error) {
+	return r.makeRemoteClientWith(d, calls, r.newRemoteClient)
+}
+
+// makeRemoteClientWith is like makeRemoteClient but creates the client from
+// Thrift connections with create rather than with the factory's
+// MakeRemoteClient.
+func (r *router) makeRemoteClientWith(d Destination, calls *callTracker, create func(d Destination, client thrift.TChanClient) (interface{}, error)) (interface{}, error) {
+	dest := d.Address
+	if r.transport == nil {
+		return nil, wrapError(ErrClientCreation, errNoTransport)
+	}
+	conn, err := r.dial(d)
+	if err != nil {
+		return nil, wrapError(ErrClientCreation, err)
+	}
+	if codecClient, ok := conn.(CodecClient); ok {
+		return r.makeRemoteCodecClient(d, codecClient)
+	}
+	thriftClient, ok := conn.(thrift.TChanClient)
+	if !ok {
+		return conn, nil
+	}
+
+	if calls != nil {
+		thriftClient = &trackedClient{TChanClient: thriftClient, calls: calls}
+	}
+	if r.errorTracking() {
+		thriftClient = &classifyingClient{TChanClient: thriftClient, r: r, dest: dest}
+	}
+	if b := r.breakerFor(dest); b != nil {
+		thriftClient = &breakerClient{TChanClient: thriftClient, r: r, breaker: b}
+	}
+	if r.latencyTracked() {
+		thriftClient = &latencyClient{TChanClient: thriftClient, r: r, dest: dest}
+	}
+	if r.callLimit > 0 {
+		thriftClient = &limitedClient{TChanClient: thriftClient, r: r, slots: r.callSlots(dest)}
+	}
+	if interceptors := r.clientInterceptors(); len(interceptors) > 0 {
+		thriftClient = &interceptedClient{TChanClient: thriftClient, dest: dest, interceptors: interceptors}
+	}
+	client, err := create(d, thriftClient)
+	return client, wrapError(ErrClientCreation, err)
+}
+
+// clientInterceptors returns the interceptors of the remote clients, those of
+// WithInterceptors preceded by the ones of WithCallTimeouts and
+// WithChecksumHeaders when enabled.
+func (r *router) clientInterceptors() []Interceptor {
+	var builtin []Interceptor
+	if r.callTimeouts != nil {
+		builtin = append(builtin, r.callTimeout)
+	}
+	if r.checksumHeaders {
+		builtin = append(builtin, r.checksumHeader)
+	}
+	if len(builtin) == 0 {
+		return r.interceptors
+	}
+	return append(builtin, r.interceptors...)
+}
+
+// makeRemoteCodecClient creates the client for d from a connection of a
+// CodecTransport, see CodecClientFactory.
+func (r *router) makeRemoteCodecClient(d Destination, conn CodecClient) (interface{}, error) {
+	f, ok := r.factory.(CodecClientFactory)
+	if !ok {
+		return conn, nil
+	}
+	client, err := r.callFactory(d, func() (interface{}, error) {
+		return f.MakeRemoteCodecClient(d, conn)
+	})
+	return client, wrapError(ErrClientCreation, err)
+}
+
+// mapKey returns the key that is resolved against the ring for key, see
+// WithKeyMapper.
+func (r *router) mapKey(key string) string {
+	if r.keyMapper == nil {
+		return key
+	}
+	return r.keyMapper(key)
+}
+
+// serviceName returns the name of the service remote clients call.
+func (r *router) serviceName() string {
+	if r.service != "" {
+		return r.service
+	}
+	if r.channel == nil {
+		return ""
+	}
+	return r.channel.ServiceName()
+}
+
+// cacheKey returns the key under which the client for dest is cached. See
+// WithServiceScopedCache and WithNormalizer.
+func (r *router) cacheKey(dest string) string {
+	dest = r.normalize(dest)
+	if r.serviceScopedCache {
+		return r.serviceName() + "@" + dest
+	}
+	return dest
 }
 
 func (r *router) removeClient(hostport string) {
-	r.rw.Lock()
-	delete(r.clientCache, hostport)
-	r.rw.Unlock()
+	cacheKey := r.cacheKey(hostport)
+
+	entry, ok := r.cache.remove(cacheKey)
+	if ok {
+		r.logger.WithField("dest", hostport).Debug("router removed client from cache")
+		r.evict([]*cacheEntry{entry})
+	}
 }
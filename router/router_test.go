@@ -20,6 +20,8 @@ package router
 
 import (
 	"errors"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,6 +30,7 @@ import (
 	"github.com/uber/ringpop-go/swim"
 	"github.com/uber/ringpop-go/test/mocks"
 	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
 )
 
 type RouterTestSuite struct {
@@ -51,6 +54,8 @@ func (s *RouterTestSuite) SetupTest() {
 	s.ringpop.On("Lookup", "remote").Return("127.0.0.1:3001", nil)
 	s.ringpop.On("Lookup", "remote2").Return("127.0.0.1:3001", nil)
 	s.ringpop.On("Lookup", "error").Return("", errors.New("ringpop not ready"))
+	s.ringpop.On("LookupN", "replicated", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3000"}, nil)
+	s.ringpop.On("LookupN", "error", 2).Return([]string(nil), errors.New("ringpop not ready"))
 
 	ch, err := tchannel.NewChannel("remote", nil)
 	s.NoError(err)
@@ -217,6 +222,142 @@ func (s *RouterTestSuite) TestRingpopRouterNotRemoveClientOnSwimSuspectEvent() {
 	s.clientFactory.AssertNumberOfCalls(s.T(), "GetLocalClient", 1)
 }
 
+func (s *RouterTestSuite) TestReconcileChangeOnlyEvictsAffectedDestination() {
+	// populate cache for both destinations
+	_, err := s.router.GetClient("local")
+	s.NoError(err)
+	_, err = s.router.GetClient("remote")
+	s.NoError(err)
+
+	s.router.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Faulty,
+	})
+
+	_, err = s.router.GetClient("local")
+	s.NoError(err)
+	_, err = s.router.GetClient("remote")
+	s.NoError(err)
+	s.clientFactory.AssertNumberOfCalls(s.T(), "GetLocalClient", 1)
+	s.clientFactory.AssertNumberOfCalls(s.T(), "MakeRemoteClient", 2)
+}
+
+func (s *RouterTestSuite) TestReconcileChangeIgnoresAliveChange() {
+	_, err := s.router.GetClient("remote")
+	s.NoError(err)
+
+	s.router.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Alive,
+	})
+
+	_, err = s.router.GetClient("remote")
+	s.NoError(err)
+	s.clientFactory.AssertNumberOfCalls(s.T(), "MakeRemoteClient", 1)
+}
+
+func (s *RouterTestSuite) deliverConcurrently(changes []swim.Change) {
+	var wg sync.WaitGroup
+	for _, change := range changes {
+		wg.Add(1)
+		go func(change swim.Change) {
+			defer wg.Done()
+			s.internal.HandleEvent(swim.MemberlistChangesReceivedEvent{
+				Changes: []swim.Change{change},
+			})
+		}(change)
+	}
+	wg.Wait()
+}
+
+func (s *RouterTestSuite) TestReconcileChangeNewestStatusWinsAlive() {
+	dest := "127.0.0.1:3001"
+	for i := 0; i < 50; i++ {
+		_, err := s.router.GetClient("remote")
+		s.NoError(err)
+
+		base := int64(i * 10)
+		s.deliverConcurrently([]swim.Change{
+			{Address: dest, Status: swim.Leave, Incarnation: base + 1},
+			{Address: dest, Status: swim.Faulty, Incarnation: base + 2},
+			{Address: dest, Status: swim.Alive, Incarnation: base + 3},
+		})
+
+		// the client is evicted only if one of the older changes was applied
+		// before the newest one arrived, but afterwards it is never evicted
+		// again and the last applied change is the alive one
+		s.Equal(swim.Alive, s.internal.lastChanges[dest].Status)
+		s.Equal(base+3, s.internal.lastChanges[dest].Incarnation)
+	}
+
+	// an older leave after the final alive change does not evict
+	_, err := s.router.GetClient("remote")
+	s.NoError(err)
+	calls := len(s.clientFactory.Calls)
+	s.internal.ReconcileChange(swim.Change{Address: dest, Status: swim.Leave, Incarnation: 1})
+	_, err = s.router.GetClient("remote")
+	s.NoError(err)
+	s.Len(s.clientFactory.Calls, calls, "expected the client to stay cached")
+}
+
+func (s *RouterTestSuite) TestReconcileChangeNewestStatusWinsLeave() {
+	dest := "127.0.0.1:3001"
+	for i := 0; i < 50; i++ {
+		_, err := s.router.GetClient("remote")
+		s.NoError(err)
+
+		base := int64(i * 10)
+		s.deliverConcurrently([]swim.Change{
+			{Address: dest, Status: swim.Alive, Incarnation: base + 1},
+			{Address: dest, Status: swim.Suspect, Incarnation: base + 2},
+			{Address: dest, Status: swim.Leave, Incarnation: base + 3},
+		})
+
+		s.Equal(swim.Leave, s.internal.lastChanges[dest].Status)
+		_, cached := s.internal.cache.get(dest)
+		s.False(cached, "expected no client for a destination that left")
+	}
+}
+
+func (s *RouterTestSuite) TestGetClientN() {
+	clients, err := s.router.GetClientN("replicated", 2)
+	s.NoError(err)
+	s.Equal([]interface{}{"remote client", "local client"}, clients)
+}
+
+func (s *RouterTestSuite) TestGetClientNCached() {
+	_, err := s.router.GetClient("remote")
+	s.NoError(err)
+	_, err = s.router.GetClient("local")
+	s.NoError(err)
+
+	_, err = s.router.GetClientN("replicated", 2)
+	s.NoError(err)
+	s.clientFactory.AssertNumberOfCalls(s.T(), "GetLocalClient", 1)
+	s.clientFactory.AssertNumberOfCalls(s.T(), "MakeRemoteClient", 1)
+}
+
+func (s *RouterTestSuite) TestGetClientNForwardLookupError() {
+	_, err := s.router.GetClientN("error", 2)
+	s.EqualError(err, "ringpop not ready")
+}
+
+func (s *RouterTestSuite) TestGetClients() {
+	groups, err := s.router.GetClients([]string{"local", "remote", "local2", "remote2"})
+	s.NoError(err)
+	s.Equal(map[string]*ClientKeys{
+		"127.0.0.1:3000": {Client: "local client", Keys: []string{"local", "local2"}},
+		"127.0.0.1:3001": {Client: "remote client", Keys: []string{"remote", "remote2"}},
+	}, groups)
+	s.clientFactory.AssertNumberOfCalls(s.T(), "GetLocalClient", 1)
+	s.clientFactory.AssertNumberOfCalls(s.T(), "MakeRemoteClient", 1)
+}
+
+func (s *RouterTestSuite) TestGetClientsForwardLookupError() {
+	_, err := s.router.GetClients([]string{"local", "error"})
+	s.EqualError(err, "ringpop not ready")
+}
+
 func (s *RouterTestSuite) TestRingpopRouterGetClientForwardLookupError() {
 	_, err := s.router.GetClient("error")
 	s.EqualError(err, "ringpop not ready")
@@ -239,6 +380,228 @@ func TestRingpopRouterGetClientForwardWhoAmIError(t *testing.T) {
 	assert.EqualError(t, err, "ringpop not ready")
 }
 
+func TestReconcileChangeWarmsHotKeys(t *testing.T) {
+	cf := &mocks.ClientFactory{}
+	cf.On("MakeRemoteClient", mock.Anything).Return("remote client")
+
+	rp := newTestRingpop(testLookups{
+		"moved":         "127.0.0.1:3002",
+		"not-moved-yet": "127.0.0.1:3001",
+	})
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	r := New(rp, cf, ch, WithHotKeys("moved", "not-moved-yet"))
+	r.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Leave,
+	})
+	cf.AssertNumberOfCalls(t, "MakeRemoteClient", 1)
+
+	// the client for the new owner is already cached
+	_, err = r.GetClient("moved")
+	assert.NoError(t, err)
+	cf.AssertNumberOfCalls(t, "MakeRemoteClient", 1)
+}
+
+func TestServiceScopedCache(t *testing.T) {
+	r := newTestRouter(t, WithServiceScopedCache()).(*router)
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Contains(t, r.cache.keys(), "remote@127.0.0.1:3001")
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3001")
+
+	r.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Faulty,
+	})
+	assert.Empty(t, r.cache.keys())
+}
+
+func TestDestinationOnlyCacheByDefault(t *testing.T) {
+	r := newTestRouter(t).(*router)
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Contains(t, r.cache.keys(), "127.0.0.1:3001")
+}
+
+func TestRemoteDialer(t *testing.T) {
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+
+	rp := newTestRingpop(testLookups{
+		"unreachable": "127.0.0.1:3002",
+	})
+
+	var dialed []string
+	dialer := func(dest string) (interface{}, error) {
+		dialed = append(dialed, dest)
+		if dest == "127.0.0.1:3002" {
+			return nil, errors.New("connection refused")
+		}
+		return "dialed client", nil
+	}
+
+	r := New(rp, cf, nil, WithRemoteDialer(dialer))
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "dialed client", client)
+
+	client, err = r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	// failed dials are not cached
+	_, err = r.GetClient("unreachable")
+	assert.EqualError(t, err, "connection refused")
+	_, err = r.GetClient("unreachable")
+	assert.EqualError(t, err, "connection refused")
+
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3002"}, dialed)
+	cf.AssertNotCalled(t, "MakeRemoteClient", mock.Anything)
+}
+
+// testLookups are the keys the ringpop of newTestRingpop resolves, with the
+// destination each of them resolves to.
+type testLookups map[string]string
+
+// newTestRingpop creates a ringpop with the same setup as the RouterTestSuite
+// for use in plain tests: the local node is 127.0.0.1:3000, "local" resolves
+// to it, "remote" to 127.0.0.1:3001, "error" fails to resolve and the keys of
+// lookups resolve to their destination, taking precedence over the others.
+// Tests mock the other methods they need on the returned ringpop.
+func newTestRingpop(lookups testLookups) *mocks.Ringpop {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("WhoAmI").Return("127.0.0.1:3000", nil)
+	for key, dest := range lookups {
+		rp.On("Lookup", key).Return(dest, nil)
+	}
+	rp.On("Lookup", "local").Return("127.0.0.1:3000", nil)
+	rp.On("Lookup", "remote").Return("127.0.0.1:3001", nil)
+	rp.On("Lookup", "error").Return("", errors.New("ringpop not ready"))
+	return rp
+}
+
+// newTestClientFactory creates a client factory with the same setup as the
+// RouterTestSuite for use in plain tests.
+func newTestClientFactory() *mocks.ClientFactory {
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+	cf.On("MakeRemoteClient", mock.Anything).Return("remote client")
+	return cf
+}
+
+// destDialer is a RemoteDialer of which the clients are the address of their
+// destination.
+func destDialer(dest string) (interface{}, error) {
+	return dest, nil
+}
+
+// newTestRouter creates a router with the same ringpop and client factory
+// setup as the RouterTestSuite for use in plain tests.
+func newTestRouter(t *testing.T, opts ...Option) Router {
+	return newRingpopTestRouter(t, newTestRingpop(nil), opts...)
+}
+
+// newRingpopTestRouter is like newTestRouter on rp, usually a ringpop of
+// newTestRingpop with the lookups and methods of the test.
+func newRingpopTestRouter(t *testing.T, rp *mocks.Ringpop, opts ...Option) *router {
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	return newChannelTestRouter(rp, ch, opts...)
+}
+
+// newChannelTestRouter is like newRingpopTestRouter on the channel ch, which
+// is nil for routers that only call through a Transport or RemoteDialer.
+func newChannelTestRouter(rp *mocks.Ringpop, ch *tchannel.Channel, opts ...Option) *router {
+	return New(rp, newTestClientFactory(), ch, opts...).(*router)
+}
+
+// withFactory makes a router of newTestRouter create its clients with f
+// instead of a client factory of newTestClientFactory.
+func withFactory(f ClientFactory) Option {
+	return withFactoryV2(factoryV1{f})
+}
+
+// withFactoryV2 is withFactory for a ClientFactoryV2.
+func withFactoryV2(f ClientFactoryV2) Option {
+	return func(r *router) {
+		r.factory = f
+	}
+}
+
 func TestRouterTestSuite(t *testing.T) {
 	suite.Run(t, new(RouterTestSuite))
 }
+
+func TestKeyMapper(t *testing.T) {
+	sampler := &recordingSampler{}
+	mapper := func(key string) string {
+		return strings.SplitN(key, ":", 2)[0]
+	}
+	r := newTestRouter(t, WithKeyMapper(mapper), WithDecisionSampler(1, sampler))
+
+	client, err := r.GetClient("remote:entity:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote client", client)
+
+	client, err = r.GetClient("local:entity:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	assert.Equal(t, "remote:entity:1", sampler.observed[0].Key, "expected the sampler to see the unmapped key")
+}
+
+func TestLogger(t *testing.T) {
+	logger := &mocks.Logger{}
+	logger.On("WithFields", mock.Anything).Return(logger)
+	logger.On("WithField", mock.Anything, mock.Anything).Return(logger)
+	logger.On("Debug", mock.Anything).Return()
+
+	r := newTestRouter(t, WithLogger(logger))
+	r.GetClient("remote")
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Faulty})
+
+	logger.AssertCalled(t, "Debug", []interface{}{"router looked up key"})
+	logger.AssertCalled(t, "Debug", []interface{}{"router created client"})
+	logger.AssertCalled(t, "Debug", []interface{}{"router evicting client of member"})
+	logger.AssertCalled(t, "Debug", []interface{}{"router removed client from cache"})
+	logger.AssertCalled(t, "WithField", "dest", "127.0.0.1:3001")
+}
+
+func TestClientOptions(t *testing.T) {
+	var provided []string
+	provider := func(dest string) *thrift.ClientOptions {
+		provided = append(provided, dest)
+		if dest == "127.0.0.1:3001" {
+			return &thrift.ClientOptions{HostPort: "127.0.0.1:4001"}
+		}
+		return nil
+	}
+	r := newTestRouter(t, WithClientOptions(provider)).(*router)
+
+	_, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3001"}, provided)
+
+	assert.Equal(t, &thrift.ClientOptions{HostPort: "127.0.0.1:4001"}, hostPortOptions(r.clientOptionsProvider, "127.0.0.1:3001"))
+	assert.Equal(t, &thrift.ClientOptions{HostPort: "127.0.0.1:3002"}, hostPortOptions(r.clientOptionsProvider, "127.0.0.1:3002"))
+	assert.Equal(t, &thrift.ClientOptions{HostPort: "127.0.0.1:3002"}, hostPortOptions(newTestRouter(t).(*router).clientOptionsProvider, "127.0.0.1:3002"))
+}
+
+func TestSharedClientOptionsAreCopied(t *testing.T) {
+	shared := &thrift.ClientOptions{}
+	r := newTestRouter(t, WithClientOptions(func(dest string) *thrift.ClientOptions {
+		return shared
+	})).(*router)
+
+	assert.Equal(t, "127.0.0.1:3001", hostPortOptions(r.clientOptionsProvider, "127.0.0.1:3001").HostPort)
+	assert.Equal(t, "127.0.0.1:3002", hostPortOptions(r.clientOptionsProvider, "127.0.0.1:3002").HostPort)
+	assert.Equal(t, &thrift.ClientOptions{}, shared, "expected the options of the provider to be left alone")
+}
@@ -0,0 +1,116 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routerfx
+
+import (
+	"context"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/ringpop-go"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/tchannel-go"
+	"go.uber.org/fx"
+)
+
+// Module provides the Router constructed by New.
+var Module = fx.Module("router", fx.Provide(New))
+
+// Config configures the router provided by Module, typically loaded from the
+// configuration of the application. The zero Config uses the defaults of the
+// router package.
+type Config struct {
+	// Service is the TChannel service of the remote clients, see
+	// router.WithService.
+	Service string `yaml:"service"`
+
+	// HealthCheckInterval enables the health check of the remote clients
+	// with HealthCheckTimeout, see router.WithHealthCheck.
+	HealthCheckInterval time.Duration `yaml:"healthCheckInterval"`
+	HealthCheckTimeout  time.Duration `yaml:"healthCheckTimeout"`
+
+	// SnapshotFile is the file routing snapshots are kept in across
+	// restarts, see router.WithSnapshotFile.
+	SnapshotFile string `yaml:"snapshotFile"`
+
+	// StableWindow makes the application wait on start until the ring did
+	// not change for this long, see Router.WaitUntilStable.
+	StableWindow time.Duration `yaml:"stableWindow"`
+}
+
+// Params are the dependencies of the router provided by Module. All but
+// Ringpop and ClientFactory are optional.
+type Params struct {
+	fx.In
+
+	Lifecycle     fx.Lifecycle
+	Ringpop       ringpop.Interface
+	ClientFactory router.ClientFactory
+	Channel       *tchannel.Channel  `optional:"true"`
+	Config        Config             `optional:"true"`
+	Logger        bark.Logger        `optional:"true"`
+	Stats         bark.StatsReporter `optional:"true"`
+	Options       []router.Option    `group:"router.options"`
+}
+
+// New returns the router for the dependencies of p. The router waits until
+// the ring is stable when the application starts, if configured, and is
+// closed when the application stops.
+func New(p Params) router.Router {
+	r := router.New(p.Ringpop, p.ClientFactory, p.Channel, p.options()...)
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if p.Config.StableWindow <= 0 {
+				return nil
+			}
+			return r.WaitUntilStable(ctx, p.Config.StableWindow)
+		},
+		OnStop: func(ctx context.Context) error {
+			return r.Close(ctx)
+		},
+	})
+	return r
+}
+
+// options returns the router options of p, the ones of the value group
+// coming last so they override the ones of the Config.
+func (p Params) options() []router.Option {
+	var opts []router.Option
+	if p.Config.Service != "" {
+		opts = append(opts, router.WithService(p.Config.Service))
+	}
+	if p.Config.HealthCheckInterval > 0 {
+		opts = append(opts, router.WithHealthCheck(p.Config.HealthCheckInterval, p.Config.HealthCheckTimeout))
+	}
+	if p.Config.SnapshotFile != "" {
+		opts = append(opts, router.WithSnapshotFile(p.Config.SnapshotFile))
+	}
+	if p.Logger != nil {
+		opts = append(opts, router.WithLogger(p.Logger))
+	}
+	if p.Stats != nil {
+		opts = append(opts, router.WithStatsReporter(p.Stats))
+	}
+	return append(opts, p.Options...)
+}
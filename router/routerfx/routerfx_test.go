@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routerfx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/ringpop-go/test/mocks"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestModule(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("WhoAmI").Return("127.0.0.1:3000", nil)
+	rp.On("Lookup", "mapped").Return("127.0.0.1:3000", nil)
+
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+
+	mapper := func(key string) string { return "mapped" }
+
+	var r router.Router
+	app := fxtest.New(t,
+		fx.Provide(
+			func() ringpop.Interface { return rp },
+			func() router.ClientFactory { return cf },
+			fx.Annotate(
+				func() router.Option { return router.WithKeyMapper(mapper) },
+				fx.ResultTags(`group:"router.options"`),
+			),
+		),
+		fx.Supply(Config{Service: "kv"}),
+		Module,
+		fx.Populate(&r),
+	)
+	app.RequireStart()
+
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client, "expected the options of the group to be applied")
+
+	app.RequireStop()
+	_, err = r.GetClient("key")
+	assert.Equal(t, router.ErrRouterClosed, err, "expected the router to be closed when the application stops")
+}
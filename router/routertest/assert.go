@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routertest
+
+import (
+	"testing"
+
+	"github.com/uber/ringpop-go/router"
+)
+
+// AssertOwner fails t when key does not resolve to dest on r.
+func AssertOwner(t testing.TB, r router.Router, key, dest string) bool {
+	d, err := r.Resolve(key)
+	if err != nil {
+		t.Errorf("resolving %q failed: %v", key, err)
+		return false
+	}
+	if d.Address != dest {
+		t.Errorf("expected %q to be owned by %s, owned by %s", key, dest, d.Address)
+		return false
+	}
+	return true
+}
+
+// AssertRoutedTo fails t when the client r returns for key is not the client
+// of dest, as created by a RecordingClientFactory. Clients that are not a
+// *RemoteClient are taken to be the client of the local node.
+func AssertRoutedTo(t testing.TB, r router.Router, key, dest string) bool {
+	client, err := r.GetClient(key)
+	if err != nil {
+		t.Errorf("getting the client of %q failed: %v", key, err)
+		return false
+	}
+
+	routed := "the local node"
+	if remote, ok := client.(*RemoteClient); ok {
+		routed = remote.Dest
+	} else if me, err := r.Resolve(key); err == nil && me.Local {
+		routed = me.Address
+	}
+
+	if routed != dest {
+		t.Errorf("expected %q to be routed to %s, routed to %s", key, dest, routed)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routertest
+
+import (
+	"sync"
+
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// A RemoteClient is a client created by a RecordingClientFactory for a
+// remote destination.
+type RemoteClient struct {
+	thrift.TChanClient
+
+	// Dest is the address of the destination the client calls.
+	Dest string
+}
+
+// LocalClient is the client a RecordingClientFactory returns for the local
+// node when its Local field is not set.
+const LocalClient = "local client"
+
+// RecordingClientFactory is a router.ClientFactoryV2 that records the clients
+// it creates. Remote clients are a *RemoteClient, the local client is Local,
+// or LocalClient when Local is nil. Create the router with router.NewV2.
+type RecordingClientFactory struct {
+	// Local is the client returned for the local node.
+	Local interface{}
+
+	mu     sync.Mutex
+	local  int
+	remote []string
+}
+
+var _ router.ClientFactoryV2 = &RecordingClientFactory{}
+
+// GetLocalClient returns the local client.
+func (f *RecordingClientFactory) GetLocalClient() interface{} {
+	f.mu.Lock()
+	f.local++
+	f.mu.Unlock()
+
+	if f.Local == nil {
+		return LocalClient
+	}
+	return f.Local
+}
+
+// MakeRemoteClient returns a *RemoteClient for dest.
+func (f *RecordingClientFactory) MakeRemoteClient(dest router.Destination, client thrift.TChanClient) (interface{}, error) {
+	f.mu.Lock()
+	f.remote = append(f.remote, dest.Address)
+	f.mu.Unlock()
+
+	return &RemoteClient{TChanClient: client, Dest: dest.Address}, nil
+}
+
+// LocalCreated returns the number of times the local client was asked for.
+func (f *RecordingClientFactory) LocalCreated() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.local
+}
+
+// RemoteCreated returns the destinations of the remote clients created so
+// far, in order of creation.
+func (f *RecordingClientFactory) RemoteCreated() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.remote...)
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package routertest provides fakes for testing code built on the router
+// package without running ringpop or TChannel: a Ringpop of which the ring
+// and membership are scripted by the test, a RecordingClientFactory and
+// assertion helpers. The channel passed to the router is only used to build
+// the clients of remote destinations and does not need to listen:
+//
+//     ch, _ := tchannel.NewChannel("service", nil)
+//     rp := routertest.NewRingpop("127.0.0.1:3000", "127.0.0.1:3001")
+//     f := &routertest.RecordingClientFactory{}
+//     r := router.NewV2(rp, f, ch)
+//
+//     rp.Fail("127.0.0.1:3001")
+//     routertest.AssertOwner(t, r, "key", "127.0.0.1:3000")
+package routertest
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgryski/go-farm"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/forward"
+	"github.com/uber/ringpop-go/hashring"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/util"
+	"github.com/uber/tchannel-go"
+)
+
+// ErrNotSupported is returned by the methods of Ringpop that forward
+// requests, the fake does not forward.
+var ErrNotSupported = errors.New("not supported by the fake ringpop")
+
+// replicaPoints is the number of replica points of every member on the ring,
+// the same as ringpop's default.
+const replicaPoints = 100
+
+// Ringpop is a fake ringpop.Interface of which the members are set by the
+// test. Keys are resolved against a ring of the alive members built like
+// ringpop's, unless their owner is pinned with SetOwner. Membership changes
+// are delivered to the registered listeners as the events ringpop sends: a
+// swim.MemberlistChangesReceivedEvent followed, when the ring changed, by an
+// events.RingChecksumEvent and an events.RingChangedEvent. Unlike ringpop,
+// which delivers events asynchronously, the fake delivers them
+// synchronously, before the method making the change returns, so tests need
+// not wait for them.
+type Ringpop struct {
+	mu          sync.Mutex
+	me          string
+	ring        *hashring.HashRing
+	owners      map[string]string
+	incarnation map[string]int64
+	lookupErr   error
+	listeners   []events.EventListener
+	started     time.Time
+}
+
+// NewRingpop creates a fake ringpop for the local node me, of which me and
+// members are the alive members.
+func NewRingpop(me string, members ...string) *Ringpop {
+	rp := &Ringpop{
+		me:          me,
+		ring:        hashring.New(farm.Fingerprint32, replicaPoints),
+		owners:      make(map[string]string),
+		incarnation: make(map[string]int64),
+		started:     time.Now(),
+	}
+	rp.ring.AddRemoveServers(append([]string{me}, members...), nil)
+	return rp
+}
+
+// SetOwner pins the owner of key to dest regardless of the ring. An empty
+// dest resolves key against the ring again.
+func (rp *Ringpop) SetOwner(key, dest string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if dest == "" {
+		delete(rp.owners, key)
+		return
+	}
+	rp.owners[key] = dest
+}
+
+// FailLookups makes Lookup and LookupN fail with err, eg. to simulate a ring
+// that is not ready. A nil err makes them succeed again.
+func (rp *Ringpop) FailLookups(err error) {
+	rp.mu.Lock()
+	rp.lookupErr = err
+	rp.mu.Unlock()
+}
+
+// Join adds member to the ring and reports it alive.
+func (rp *Ringpop) Join(member string) {
+	rp.change(member, swim.Alive)
+}
+
+// Suspect reports member as suspect, it stays on the ring.
+func (rp *Ringpop) Suspect(member string) {
+	rp.change(member, swim.Suspect)
+}
+
+// Fail removes member from the ring and reports it faulty.
+func (rp *Ringpop) Fail(member string) {
+	rp.change(member, swim.Faulty)
+}
+
+// Leave removes member from the ring and reports it left.
+func (rp *Ringpop) Leave(member string) {
+	rp.change(member, swim.Leave)
+}
+
+// change applies the status of member to the ring and emits the events for
+// it. Every change has a higher incarnation than the previous change about
+// member, so it overrides it.
+func (rp *Ringpop) change(member, status string) {
+	rp.mu.Lock()
+	rp.incarnation[member]++
+	change := swim.Change{
+		Address:     member,
+		Incarnation: rp.incarnation[member],
+		Status:      status,
+		Timestamp:   util.Timestamp(time.Now()),
+	}
+
+	var ring events.RingChangedEvent
+	checksum := events.RingChecksumEvent{OldChecksum: rp.ring.Checksum()}
+	switch status {
+	case swim.Alive:
+		if rp.ring.AddServer(member) {
+			ring.ServersAdded = []string{member}
+		}
+	case swim.Faulty, swim.Leave:
+		if rp.ring.RemoveServer(member) {
+			ring.ServersRemoved = []string{member}
+		}
+	}
+	checksum.NewChecksum = rp.ring.Checksum()
+	rp.mu.Unlock()
+
+	rp.Emit(swim.MemberlistChangesReceivedEvent{Changes: []swim.Change{change}})
+	if len(ring.ServersAdded) > 0 || len(ring.ServersRemoved) > 0 {
+		rp.Emit(checksum)
+		rp.Emit(ring)
+	}
+}
+
+// Emit delivers event to all registered listeners.
+func (rp *Ringpop) Emit(event events.Event) {
+	rp.mu.Lock()
+	listeners := append([]events.EventListener(nil), rp.listeners...)
+	rp.mu.Unlock()
+
+	for _, l := range listeners {
+		l.HandleEvent(event)
+	}
+}
+
+// Destroy does nothing.
+func (rp *Ringpop) Destroy() {}
+
+// App returns "routertest".
+func (rp *Ringpop) App() string {
+	return "routertest"
+}
+
+// WhoAmI returns the address of the local node.
+func (rp *Ringpop) WhoAmI() (string, error) {
+	return rp.me, nil
+}
+
+// Uptime returns the time since the fake was created.
+func (rp *Ringpop) Uptime() (time.Duration, error) {
+	return time.Since(rp.started), nil
+}
+
+// RegisterListener registers l to receive the events emitted by the fake.
+func (rp *Ringpop) RegisterListener(l events.EventListener) {
+	rp.mu.Lock()
+	rp.listeners = append(rp.listeners, l)
+	rp.mu.Unlock()
+}
+
+// Bootstrap returns the alive members.
+func (rp *Ringpop) Bootstrap(opts *swim.BootstrapOptions) ([]string, error) {
+	return rp.ring.Servers(), nil
+}
+
+// Checksum returns the checksum of the ring.
+func (rp *Ringpop) Checksum() (uint32, error) {
+	return rp.ring.Checksum(), nil
+}
+
+// Lookup returns the owner of key.
+func (rp *Ringpop) Lookup(key string) (string, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.lookupErr != nil {
+		return "", rp.lookupErr
+	}
+	if dest, ok := rp.owners[key]; ok {
+		return dest, nil
+	}
+	dest, ok := rp.ring.Lookup(key)
+	if !ok {
+		return "", errors.New("no members on the ring")
+	}
+	return dest, nil
+}
+
+// LookupN returns the n members responsible for key, starting with the
+// owner pinned with SetOwner when there is one.
+func (rp *Ringpop) LookupN(key string, n int) ([]string, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.lookupErr != nil {
+		return nil, rp.lookupErr
+	}
+
+	dests := rp.ring.LookupN(key, n)
+	owner, ok := rp.owners[key]
+	if !ok {
+		return dests, nil
+	}
+
+	result := []string{owner}
+	for _, dest := range dests {
+		if dest != owner && len(result) < n {
+			result = append(result, dest)
+		}
+	}
+	return result, nil
+}
+
+// GetReachableMembers returns the alive members.
+func (rp *Ringpop) GetReachableMembers() ([]string, error) {
+	return rp.ring.Servers(), nil
+}
+
+// CountReachableMembers returns the number of alive members.
+func (rp *Ringpop) CountReachableMembers() (int, error) {
+	return rp.ring.ServerCount(), nil
+}
+
+// HandleOrForward fails with ErrNotSupported.
+func (rp *Ringpop) HandleOrForward(key string, request []byte, response *[]byte, service, endpoint string, format tchannel.Format, opts *forward.Options) (bool, error) {
+	return false, ErrNotSupported
+}
+
+// Forward fails with ErrNotSupported.
+func (rp *Ringpop) Forward(dest string, keys []string, request []byte, service, endpoint string, format tchannel.Format, opts *forward.Options) ([]byte, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routertest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/tchannel-go"
+)
+
+// recordingListener records the events it receives.
+type recordingListener struct {
+	events []events.Event
+}
+
+func (l *recordingListener) HandleEvent(event events.Event) {
+	l.events = append(l.events, event)
+}
+
+func newTestRouter(t *testing.T, rp *Ringpop) (router.Router, *RecordingClientFactory) {
+	ch, err := tchannel.NewChannel("service", nil)
+	assert.NoError(t, err)
+
+	f := &RecordingClientFactory{}
+	return router.NewV2(rp, f, ch), f
+}
+
+func TestRingpopLookup(t *testing.T) {
+	rp := NewRingpop("127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002")
+
+	dest, err := rp.Lookup("key")
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}, dest)
+
+	dests, err := rp.LookupN("key", 2)
+	assert.NoError(t, err)
+	assert.Len(t, dests, 2)
+
+	rp.SetOwner("key", "127.0.0.1:4000")
+	dest, _ = rp.Lookup("key")
+	assert.Equal(t, "127.0.0.1:4000", dest)
+	dests, _ = rp.LookupN("key", 2)
+	assert.Equal(t, "127.0.0.1:4000", dests[0])
+	assert.Len(t, dests, 2)
+
+	rp.FailLookups(errors.New("ring not ready"))
+	_, err = rp.Lookup("key")
+	assert.EqualError(t, err, "ring not ready")
+}
+
+func TestRingpopMembershipEvents(t *testing.T) {
+	rp := NewRingpop("127.0.0.1:3000")
+	l := &recordingListener{}
+	rp.RegisterListener(l)
+
+	rp.Join("127.0.0.1:3001")
+	rp.Suspect("127.0.0.1:3001")
+	rp.Fail("127.0.0.1:3001")
+
+	assert.Len(t, l.events, 7)
+	assert.Equal(t, swim.Alive, l.events[0].(swim.MemberlistChangesReceivedEvent).Changes[0].Status)
+	joined := l.events[1].(events.RingChecksumEvent)
+	assert.NotEqual(t, joined.OldChecksum, joined.NewChecksum)
+	assert.Equal(t, []string{"127.0.0.1:3001"}, l.events[2].(events.RingChangedEvent).ServersAdded)
+	assert.Equal(t, swim.Suspect, l.events[3].(swim.MemberlistChangesReceivedEvent).Changes[0].Status)
+	assert.Equal(t, swim.Faulty, l.events[4].(swim.MemberlistChangesReceivedEvent).Changes[0].Status)
+	assert.Equal(t, events.RingChecksumEvent{OldChecksum: joined.NewChecksum, NewChecksum: joined.OldChecksum}, l.events[5])
+	assert.Equal(t, []string{"127.0.0.1:3001"}, l.events[6].(events.RingChangedEvent).ServersRemoved)
+
+	count, _ := rp.CountReachableMembers()
+	assert.Equal(t, 1, count)
+}
+
+func TestRouterFailover(t *testing.T) {
+	rp := NewRingpop("127.0.0.1:3000", "127.0.0.1:3001")
+	rp.SetOwner("key", "127.0.0.1:3001")
+	r, f := newTestRouter(t, rp)
+
+	AssertOwner(t, r, "key", "127.0.0.1:3001")
+	AssertRoutedTo(t, r, "key", "127.0.0.1:3001")
+
+	rp.Fail("127.0.0.1:3001")
+	rp.SetOwner("key", "")
+	AssertOwner(t, r, "key", "127.0.0.1:3000")
+	AssertRoutedTo(t, r, "key", "127.0.0.1:3000")
+
+	assert.Equal(t, []string{"127.0.0.1:3001"}, f.RemoteCreated())
+	assert.Equal(t, 1, f.LocalCreated())
+}
+
+func TestAssertionsFail(t *testing.T) {
+	rp := NewRingpop("127.0.0.1:3000")
+	r, _ := newTestRouter(t, rp)
+
+	rt := &recordingT{TB: t}
+	assert.False(t, AssertOwner(rt, r, "key", "127.0.0.1:3001"))
+	assert.False(t, AssertRoutedTo(rt, r, "key", "127.0.0.1:3001"))
+	assert.Equal(t, []string{
+		`expected "key" to be owned by 127.0.0.1:3001, owned by 127.0.0.1:3000`,
+		`expected "key" to be routed to 127.0.0.1:3001, routed to 127.0.0.1:3000`,
+	}, rt.errors)
+}
+
+// recordingT records the errors of the assertions instead of failing the
+// test.
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// RouteInfo describes a single routing decision made by the router.
+type RouteInfo struct {
+	// Key is the key that was routed.
+	Key string
+
+	// Destination is the address of the node the key was routed to.
+	Destination string
+}
+
+// A Sampler receives a sample of the routing decisions made by a router. See
+// WithDecisionSampler. Observe is called synchronously on the path of
+// GetClient and may be called concurrently, implementations should be cheap
+// and thread safe.
+type Sampler interface {
+	Observe(info RouteInfo)
+}
+
+// periodSampler samples every period-th event, period being the inverse of
+// the fraction of the events sampled, rounded to the nearest integer. It is
+// shared by the decision sampler, the shadow calls and the audit log.
+type periodSampler struct {
+	// counter is the first field to guarantee 64-bit alignment for atomic
+	// operations on 32-bit platforms, the sampler is the first field of the
+	// structs embedding it for the same reason.
+	counter uint64
+	period  uint64
+}
+
+// newPeriodSampler returns the sampler of fraction, which must be positive.
+func newPeriodSampler(fraction float64) periodSampler {
+	period := uint64(1)
+	if fraction < 1 {
+		period = uint64(math.Floor(1/fraction + 0.5))
+	}
+	return periodSampler{period: period}
+}
+
+// sample returns whether the event is sampled.
+func (p *periodSampler) sample() bool {
+	return atomic.AddUint64(&p.counter, 1)%p.period == 0
+}
+
+// decisionSampler hands every period-th routing decision to a Sampler.
+type decisionSampler struct {
+	periodSampler
+	sampler Sampler
+}
+
+func newDecisionSampler(fraction float64, s Sampler) *decisionSampler {
+	if s == nil || fraction <= 0 {
+		return nil
+	}
+	return &decisionSampler{periodSampler: newPeriodSampler(fraction), sampler: s}
+}
+
+func (d *decisionSampler) observe(info RouteInfo) {
+	if d.sample() {
+		d.sampler.Observe(info)
+	}
+}
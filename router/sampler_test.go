@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSampler struct {
+	sync.Mutex
+	observed []RouteInfo
+}
+
+func (s *recordingSampler) Observe(info RouteInfo) {
+	s.Lock()
+	s.observed = append(s.observed, info)
+	s.Unlock()
+}
+
+func (s *recordingSampler) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.observed)
+}
+
+func TestDecisionSamplerObservesEveryDecision(t *testing.T) {
+	s := &recordingSampler{}
+	r := newTestRouter(t, WithDecisionSampler(1, s))
+
+	_, err := r.GetClient("local")
+	assert.NoError(t, err)
+	_, err = r.GetClient("remote")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []RouteInfo{
+		{Key: "local", Destination: "127.0.0.1:3000"},
+		{Key: "remote", Destination: "127.0.0.1:3001"},
+	}, s.observed)
+}
+
+func TestDecisionSamplerFraction(t *testing.T) {
+	s := &recordingSampler{}
+	r := newTestRouter(t, WithDecisionSampler(0.25, s))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.GetClient("remote")
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 25, s.count())
+}
+
+func TestDecisionSamplerSkipsLookupErrors(t *testing.T) {
+	s := &recordingSampler{}
+	r := newTestRouter(t, WithDecisionSampler(1, s))
+
+	_, err := r.GetClient("error")
+	assert.Error(t, err)
+	assert.Equal(t, 0, s.count())
+}
+
+func TestDecisionSamplerDisabled(t *testing.T) {
+	assert.Nil(t, newDecisionSampler(0, &recordingSampler{}))
+	assert.Nil(t, newDecisionSampler(0.5, nil))
+}
+
+func TestPeriodSampler(t *testing.T) {
+	for fraction, period := range map[float64]int{1: 1, 2: 1, 0.5: 2, 0.3: 3, 0.01: 100} {
+		s := newPeriodSampler(fraction)
+		sampled := 0
+		for i := 0; i < 300; i++ {
+			if s.sample() {
+				sampled++
+			}
+		}
+		assert.Equal(t, 300/period, sampled, "sampling %v", fraction)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+// whoAmI returns the address of the local node, as returned by ringpop's
+// WhoAmI or remembered from an earlier call when enabled with WithSelfCache.
+func (r *router) whoAmI() (string, error) {
+	if !r.selfCache {
+		return r.ringpop.WhoAmI()
+	}
+
+	r.selfMu.RLock()
+	me := r.self
+	r.selfMu.RUnlock()
+	if me != "" {
+		return me, nil
+	}
+
+	me, err := r.ringpop.WhoAmI()
+	if err != nil || me == "" {
+		return me, err
+	}
+	r.selfMu.Lock()
+	r.self = me
+	r.selfMu.Unlock()
+	return me, nil
+}
+
+// forgetSelf forgets the remembered address of the local node, which may
+// change when ringpop joins the ring again, and its zone.
+func (r *router) forgetSelf() {
+	r.selfMu.Lock()
+	r.self = ""
+	r.selfMu.Unlock()
+
+	r.zoneMu.Lock()
+	r.selfZone, r.selfZoneKnown = "", false
+	r.zoneMu.Unlock()
+}
+
+// isSelf returns whether dest is the local node. When the local node cannot
+// be looked up, dest is taken as local when it is one of the addresses set
+// with WithLocalAddresses, and as remote otherwise, rather than failing.
+func (r *router) isSelf(dest string) (bool, error) {
+	me, err := r.whoAmI()
+	if err == nil {
+		return r.sameDest(dest, me), nil
+	}
+	if r.localAddrs == nil {
+		return false, wrapError(ErrSelfLookupFailed, err)
+	}
+
+	r.statter.IncCounter("router.self.assumed", nil, 1)
+	r.logger.WithField("error", err).Warn("router assumed the local node")
+	return r.localAddrs[dest], nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func newSelfTestRouter(t *testing.T, whoAmIErr error, opts ...Option) (*router, *mocks.Ringpop) {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("WhoAmI").Return("127.0.0.1:3000", whoAmIErr)
+	rp.On("Lookup", "local").Return("127.0.0.1:3000", nil)
+	rp.On("Lookup", "remote").Return("127.0.0.1:3001", nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, nil)
+	rp.On("Checksum").Return(uint32(1), nil)
+
+	transport := &memoryTransport{conns: map[string]ClientConn{"127.0.0.1:3001": "remote client"}}
+	opts = append([]Option{withFactory(tchanClientFactory{}), WithTransport(transport)}, opts...)
+	return newChannelTestRouter(rp, nil, opts...), rp
+}
+
+func TestLocalAddresses(t *testing.T) {
+	r, _ := newSelfTestRouter(t, errors.New("not bootstrapped"), WithLocalAddresses("127.0.0.1:3000"))
+
+	client, err := r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote client", client)
+
+	client, err = r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	d, err := r.Resolve("local")
+	assert.NoError(t, err)
+	assert.True(t, d.Local)
+}
+
+func TestWhoAmIFailure(t *testing.T) {
+	r, _ := newSelfTestRouter(t, errors.New("not bootstrapped"))
+
+	_, err := r.GetClient("remote")
+	assert.Equal(t, ErrSelfLookupFailed, KindOf(err))
+}
+
+func TestSelfCache(t *testing.T) {
+	r, rp := newSelfTestRouter(t, nil, WithSelfCache())
+
+	for i := 0; i < 3; i++ {
+		me, err := r.whoAmI()
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3000", me)
+	}
+	rp.AssertNumberOfCalls(t, "WhoAmI", 1)
+
+	// the address is looked up again after a join
+	r.HandleEvent(swim.JoinCompleteEvent{})
+	_, err := r.whoAmI()
+	assert.NoError(t, err)
+	rp.AssertNumberOfCalls(t, "WhoAmI", 2)
+}
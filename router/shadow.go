@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "github.com/uber/ringpop-go"
+
+// A ShadowResolver resolves keys against a placement scheme that is validated
+// through shadow routing, see WithShadow.
+type ShadowResolver func(key string) (string, error)
+
+// ShadowRing is a ShadowResolver that resolves keys against the ring of rp,
+// eg. a ringpop instance of the cluster keys are migrated to.
+func ShadowRing(rp ringpop.Interface) ShadowResolver {
+	return rp.Lookup
+}
+
+// ShadowRendezvous is a ShadowResolver that resolves keys with rendezvous
+// hashing over the reachable members of rp, weighted by weights when it is
+// not nil, see RendezvousLookup and WithWeights.
+func ShadowRendezvous(rp ringpop.Interface, weights WeightFunc) ShadowResolver {
+	return func(key string) (string, error) {
+		dests, err := rendezvousRank(rp, key, 1, func(member string) float64 {
+			return positiveWeight(weights, member)
+		})
+		if err != nil {
+			return "", err
+		}
+		return dests[0], nil
+	}
+}
+
+// A ShadowedClient is the client of the owner of a key together with, for a
+// sample of the keys, the client of the destination the key resolves to with
+// the shadow resolver.
+type ShadowedClient struct {
+	Client      interface{}
+	Destination string
+
+	// Shadow is the client of ShadowDestination, or nil when the call was not
+	// sampled or the shadow client could not be created.
+	Shadow            interface{}
+	ShadowDestination string
+}
+
+// shadow samples every period-th call of GetShadowedClient.
+type shadow struct {
+	periodSampler
+	resolve ShadowResolver
+}
+
+func newShadow(fraction float64, resolve ShadowResolver) *shadow {
+	if resolve == nil || fraction <= 0 {
+		return nil
+	}
+	return &shadow{periodSampler: newPeriodSampler(fraction), resolve: resolve}
+}
+
+// GetShadowedClient returns the client of the owner of key like GetClient
+// and, for the fraction of the calls configured with WithShadow, the client
+// of the destination the shadow resolver places key on, so the application
+// can mirror the call to validate the placement. Failures to resolve or
+// create the shadow client do not fail the call, they leave Shadow nil.
+func (r *router) GetShadowedClient(key string) (ShadowedClient, error) {
+	client, dest, err := r.getClient(key)
+	if err != nil {
+		return ShadowedClient{}, err
+	}
+
+	sc := ShadowedClient{Client: client, Destination: dest}
+	if r.shadow == nil || !r.shadow.sample() {
+		return sc, nil
+	}
+
+	r.statter.IncCounter("router.shadow", nil, 1)
+	shadowDest, err := r.shadow.resolve(r.mapKey(key))
+	if err != nil {
+		r.statter.IncCounter("router.shadow.error", nil, 1)
+		return sc, nil
+	}
+	if shadowDest != dest {
+		r.statter.IncCounter("router.shadow.mismatch", nil, 1)
+	}
+
+	shadowClient, err := r.getClientForDest(shadowDest)
+	if err != nil {
+		r.statter.IncCounter("router.shadow.error", nil, 1)
+		return sc, nil
+	}
+	sc.Shadow = shadowClient
+	sc.ShadowDestination = shadowDest
+	return sc, nil
+}
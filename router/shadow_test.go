@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestGetShadowedClient(t *testing.T) {
+	resolve := func(key string) (string, error) {
+		if key == "node2" {
+			return "", errors.New("shadow ring not ready")
+		}
+		return "127.0.0.1:3004", nil
+	}
+	r, _, _ := newCacheTestRouter(t, WithShadow(1, resolve))
+
+	sc, err := r.GetShadowedClient("node1")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", sc.Destination)
+	assert.NotNil(t, sc.Client)
+	assert.Equal(t, "127.0.0.1:3004", sc.ShadowDestination)
+	assert.NotNil(t, sc.Shadow)
+	assert.True(t, sc.Client != sc.Shadow, "expected the shadow to be the client of another destination")
+
+	sc, err = r.GetShadowedClient("node2")
+	assert.NoError(t, err, "expected shadow failures not to fail the call")
+	assert.NotNil(t, sc.Client)
+	assert.Nil(t, sc.Shadow)
+}
+
+func TestGetShadowedClientSamples(t *testing.T) {
+	resolve := func(key string) (string, error) {
+		return "127.0.0.1:3004", nil
+	}
+	r, _, _ := newCacheTestRouter(t, WithShadow(0.25, resolve))
+
+	shadowed := 0
+	for i := 0; i < 8; i++ {
+		sc, err := r.GetShadowedClient("node1")
+		assert.NoError(t, err)
+		if sc.Shadow != nil {
+			shadowed++
+		}
+	}
+	assert.Equal(t, 2, shadowed)
+
+	// without shadow no call is shadowed
+	r, _, _ = newCacheTestRouter(t)
+	sc, err := r.GetShadowedClient("node1")
+	assert.NoError(t, err)
+	assert.Nil(t, sc.Shadow)
+}
+
+func TestShadowResolvers(t *testing.T) {
+	rp := &mocks.Ringpop{}
+	rp.On("Lookup", "key").Return("127.0.0.1:4001", nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:4001", "127.0.0.1:4002"}, nil)
+
+	dest, err := ShadowRing(rp)("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:4001", dest)
+
+	dest, err = ShadowRendezvous(rp, nil)("key")
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"127.0.0.1:4001", "127.0.0.1:4002"}, dest)
+
+	// a member with all the weight owns every key
+	dest, err = ShadowRendezvous(rp, func(member string) float64 {
+		if member == "127.0.0.1:4002" {
+			return 1e9
+		}
+		return 1
+	})("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:4002", dest)
+}
+
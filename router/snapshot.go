@@ -0,0 +1,201 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber-common/bark"
+)
+
+// A Snapshot is the view of the ring and the destinations a router was
+// routing to at some point, which a restarted node can connect to before
+// ringpop is bootstrapped, see WithSnapshotFile.
+type Snapshot struct {
+	// Self is the address of the local node.
+	Self string `json:"self"`
+
+	// Checksum is the checksum of the ring.
+	Checksum uint32 `json:"checksum"`
+
+	// Members are the reachable members of the ring, sorted. They can seed
+	// the bootstrap hosts of ringpop.
+	Members []string `json:"members"`
+
+	// Destinations are the remote destinations the router had clients for,
+	// sorted.
+	Destinations []string `json:"destinations"`
+
+	// Taken is the time the snapshot was taken.
+	Taken time.Time `json:"taken"`
+}
+
+// Snapshot returns the current view of the ring of the router and the
+// destinations of its cached remote clients. Fields that cannot be read from
+// ringpop are left empty.
+func (r *router) Snapshot() Snapshot {
+	s := Snapshot{Taken: r.clock.Now()}
+	s.Self, _ = r.whoAmI()
+	s.Checksum, _ = r.ringpop.Checksum()
+	if members, err := r.ringpop.GetReachableMembers(); err == nil {
+		s.Members = append([]string(nil), members...)
+		sort.Strings(s.Members)
+	}
+
+	// the cache is shared with the other routers of a MultiRouter, whose
+	// clients are cached under a prefix of their own
+	prefix := r.cacheKey("")
+	for _, cacheKey := range r.cache.keys() {
+		if !strings.HasPrefix(cacheKey, prefix) {
+			continue
+		}
+		if entry, ok := r.cache.get(cacheKey); ok && !entry.local {
+			s.Destinations = append(s.Destinations, strings.TrimPrefix(cacheKey, prefix))
+		}
+	}
+	sort.Strings(s.Destinations)
+	return s
+}
+
+// WarmSnapshot creates the clients of the destinations of s, other than the
+// local node, and opens their connections in the background, like
+// ResolveAndWarm. The returned channel is closed once all destinations are
+// warm.
+func (r *router) WarmSnapshot(s Snapshot) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		timeout := r.warmUpTimeout
+		if timeout <= 0 {
+			timeout = defaultWarmUpTimeout
+		}
+
+		var wg sync.WaitGroup
+		for _, dest := range s.Destinations {
+			if dest == s.Self {
+				continue
+			}
+			wg.Add(1)
+			go func(dest string) {
+				defer wg.Done()
+				r.warmDest(dest, timeout)
+			}(dest)
+		}
+		wg.Wait()
+	}()
+	return done
+}
+
+// ReadSnapshotFile reads the snapshot written to path by WriteSnapshotFile.
+func ReadSnapshotFile(path string) (Snapshot, error) {
+	var s Snapshot
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(b, &s)
+	return s, err
+}
+
+// WriteSnapshotFile writes s to path. The snapshot is written to a temporary
+// file that replaces path, so a crash while writing leaves the previous
+// snapshot in place.
+func WriteSnapshotFile(path string, s Snapshot) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// snapshotPath returns the snapshot file of the router, which the routers of
+// a MultiRouter suffix with their service.
+func (r *router) snapshotPath() string {
+	if r.serviceScopedCache {
+		return r.snapshotFile + "." + r.serviceName()
+	}
+	return r.snapshotFile
+}
+
+// loadSnapshot warms the destinations of the snapshot file of the router,
+// when there is one, see WithSnapshotFile. A missing file is not an error.
+func (r *router) loadSnapshot() {
+	if r.snapshotFile == "" {
+		return
+	}
+
+	s, err := ReadSnapshotFile(r.snapshotPath())
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		r.statter.IncCounter("router.snapshot.error", nil, 1)
+		r.logger.WithFields(bark.Fields{
+			"file":  r.snapshotPath(),
+			"error": err,
+		}).Warn("router failed to read snapshot")
+		return
+	}
+	r.statter.IncCounter("router.snapshot.loaded", nil, 1)
+	r.WarmSnapshot(s)
+}
+
+// saveSnapshot writes the snapshot of the router to its snapshot file, when
+// there is one, see WithSnapshotFile.
+func (r *router) saveSnapshot() {
+	if r.snapshotFile == "" {
+		return
+	}
+
+	if err := WriteSnapshotFile(r.snapshotPath(), r.Snapshot()); err != nil {
+		r.statter.IncCounter("router.snapshot.error", nil, 1)
+		r.logger.WithFields(bark.Fields{
+			"file":  r.snapshotPath(),
+			"error": err,
+		}).Warn("router failed to write snapshot")
+	}
+}
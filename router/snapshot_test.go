@@ -0,0 +1,139 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func newSnapshotTestRouter(t *testing.T, transport Transport, opts ...Option) *router {
+	rp := newTestRingpop(testLookups{
+		"thrift": "127.0.0.1:3001",
+		"raw":    "127.0.0.1:3002",
+	})
+	rp.On("Checksum").Return(uint32(42), nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3002", "127.0.0.1:3000", "127.0.0.1:3001"}, nil)
+	opts = append([]Option{withFactory(tchanClientFactory{}), WithTransport(transport)}, opts...)
+	return newChannelTestRouter(rp, nil, opts...)
+}
+
+func newSnapshotTransport() *memoryTransport {
+	return &memoryTransport{conns: map[string]ClientConn{
+		"127.0.0.1:3001": "thrift client",
+		"127.0.0.1:3002": "raw client",
+	}}
+}
+
+func TestSnapshot(t *testing.T) {
+	r := newSnapshotTestRouter(t, newSnapshotTransport())
+	for _, key := range []string{"raw", "local", "thrift"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+
+	s := r.Snapshot()
+	assert.Equal(t, "127.0.0.1:3000", s.Self)
+	assert.Equal(t, uint32(42), s.Checksum)
+	assert.Equal(t, []string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}, s.Members)
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002"}, s.Destinations, "expected the remote destinations")
+}
+
+func TestSnapshotFileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	s := Snapshot{
+		Self:         "127.0.0.1:3000",
+		Checksum:     7,
+		Members:      []string{"127.0.0.1:3000", "127.0.0.1:3001"},
+		Destinations: []string{"127.0.0.1:3001"},
+		Taken:        time.Unix(1458000000, 0).UTC(),
+	}
+	assert.NoError(t, WriteSnapshotFile(path, s))
+	read, err := ReadSnapshotFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, s, read)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "expected no temporary file to be left")
+
+	_, err = ReadSnapshotFile(filepath.Join(dir, "missing.json"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWithSnapshotFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+
+	// a missing file leaves the router cold
+	r := newSnapshotTestRouter(t, newSnapshotTransport(), WithSnapshotFile(path))
+	_, err = r.GetClient("thrift")
+	assert.NoError(t, err)
+	_, err = r.GetClient("raw")
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close(context.Background()))
+
+	// the restarted router warms the destinations of the previous run
+	transport := newSnapshotTransport()
+	r = newSnapshotTestRouter(t, transport, WithSnapshotFile(path))
+	defer r.Close(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for r.cache.len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	keys := r.cache.keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002"}, keys, "expected the previous peers to be warmed")
+
+	transport.Lock()
+	pinged := append([]string(nil), transport.pinged...)
+	transport.Unlock()
+	sort.Strings(pinged)
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002"}, pinged, "expected connections to be opened")
+}
+
+func TestWithSnapshotFileCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+
+	r := newSnapshotTestRouter(t, newSnapshotTransport(), WithSnapshotFile(path))
+	assert.Equal(t, 0, r.cache.len(), "expected a corrupt snapshot to be ignored")
+	assert.NoError(t, r.Close(context.Background()))
+
+	_, err = ReadSnapshotFile(path)
+	assert.NoError(t, err, "expected the snapshot to be written again on close")
+}
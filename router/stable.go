@@ -0,0 +1,60 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// recordMembershipChange records that a change of the membership or of the
+// ring was observed, for WaitUntilStable.
+func (r *router) recordMembershipChange() {
+	atomic.StoreInt64(&r.state.changedAt, r.clock.Now().UnixNano())
+}
+
+// WaitUntilStable blocks until the router observed no change of the
+// membership or of the ring for window, so bootstrap code can start serving
+// once the ring converged instead of racing the first lookups. When no change
+// was observed yet the window starts with the call. It returns the error of
+// ctx when ctx is done first.
+func (r *router) WaitUntilStable(ctx context.Context, window time.Duration) error {
+	start := r.clock.Now()
+	for {
+		last := start
+		if changedAt := atomic.LoadInt64(&r.state.changedAt); changedAt != 0 {
+			last = time.Unix(0, changedAt)
+		}
+
+		quiet := r.clock.Now().Sub(last)
+		if quiet >= window {
+			return nil
+		}
+
+		select {
+		case <-r.clock.After(window - quiet):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
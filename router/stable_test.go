@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+	"golang.org/x/net/context"
+)
+
+func TestWaitUntilStable(t *testing.T) {
+	r := newTestRouter(t).(*router)
+	c := clock.NewMock()
+	r.clock = c
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.WaitUntilStable(context.Background(), 10*time.Second)
+	}()
+
+	for i := 0; ; i++ {
+		// a change halfway restarts the window
+		if i == 5 {
+			r.HandleEvent(swim.MemberlistChangesReceivedEvent{})
+		}
+		c.Add(time.Second)
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+			assert.True(t, i >= 14, "expected to wait for a quiet window after the last change")
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestWaitUntilStableAlreadyStable(t *testing.T) {
+	r := newTestRouter(t).(*router)
+	c := clock.NewMock()
+	r.clock = c
+	c.Add(time.Minute)
+	r.HandleEvent(swim.MemberlistChangesReceivedEvent{})
+	c.Add(time.Minute)
+
+	assert.NoError(t, r.WaitUntilStable(context.Background(), time.Second))
+}
+
+func TestWaitUntilStableContextDone(t *testing.T) {
+	r := newTestRouter(t).(*router)
+	r.clock = clock.NewMock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, r.WaitUntilStable(ctx, time.Second))
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ownershipChange is a change of the ring recorded for stale reads.
+type ownershipChange struct {
+	at    time.Time
+	moved []KeyRange
+}
+
+// recordOwnership records the ranges that moved on a change of the ring and
+// forgets the changes older than the stale read window. ownershipMu must be
+// held.
+func (r *router) recordOwnership(moved []KeyRange) {
+	if r.staleReadWindow <= 0 {
+		return
+	}
+
+	now := r.clock.Now()
+	history := r.ownershipHistory[:0]
+	for _, change := range r.ownershipHistory {
+		if now.Sub(change.at) <= r.staleReadWindow {
+			history = append(history, change)
+		}
+	}
+	r.ownershipHistory = append(history, ownershipChange{at: now, moved: moved})
+}
+
+// previousOwner returns the node that owned key before it moved to owner
+// within the stale read window.
+func (r *router) previousOwner(key, owner string) (string, bool) {
+	h := keyHash(r.mapKey(key))
+	now := r.clock.Now()
+
+	r.ownershipMu.Lock()
+	defer r.ownershipMu.Unlock()
+
+	// the newest change that moved the key to its owner tells where it was
+	for i := len(r.ownershipHistory) - 1; i >= 0; i-- {
+		change := r.ownershipHistory[i]
+		if now.Sub(change.at) > r.staleReadWindow {
+			break
+		}
+		for _, kr := range change.moved {
+			if kr.To == owner && kr.From != "" && inRange(kr.Start, kr.End, h) {
+				return kr.From, true
+			}
+		}
+	}
+	return "", false
+}
+
+// GetReadClient returns the client of the destination the read policy
+// configured with WithReadPolicy selects for key. When the policy fails, key
+// is pinned or there is no read policy, it returns the client of the owner of
+// key like GetClient. When stale reads are enabled with WithStaleReads and
+// the owner is unreachable, it returns the client of the node that owned key
+// before it moved to the owner within the stale read window instead, provided
+// that node is healthy.
+// Stale reads are counted by the router.read.stale counter. Otherwise the
+// result of GetClient is returned, including its error.
+func (r *router) GetReadClient(key string) (interface{}, error) {
+	if err := r.admit(key); err != nil {
+		return nil, err
+	}
+	if client, ok := r.readClient(key); ok {
+		return client, nil
+	}
+
+	rt, err := r.resolveAdmittedRoute(context.Background(), key)
+	client, dest := rt.client, rt.dest
+	if r.staleReadWindow <= 0 || dest == "" {
+		return client, err
+	}
+	if err == nil && !r.unhealthy(dest) {
+		return client, nil
+	}
+
+	previous, ok := r.previousOwner(key, dest)
+	if !ok || r.unhealthy(previous) {
+		return client, err
+	}
+	stale, staleErr := r.getClientForDest(previous)
+	if staleErr != nil {
+		return client, err
+	}
+
+	r.statter.IncCounter("router.read.stale", nil, 1)
+	return stale, nil
+}
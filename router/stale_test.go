@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/swim"
+)
+
+// movedKey returns a key that is owned by from on a ring of from only, and
+// by to once to joins.
+func movedKey(t *testing.T, from, to string) string {
+	before := newTokenRing([]string{from}, defaultReplicaPoints)
+	after := newTokenRing([]string{from, to}, defaultReplicaPoints)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		h := keyHash(key)
+		if before.owner(h) == from && after.owner(h) == to {
+			return key
+		}
+	}
+	t.Fatal("no key moved")
+	return ""
+}
+
+// newStaleReadTestRouter creates a router on which key moved from
+// 127.0.0.1:3001 to 127.0.0.1:3002 on the last ring change, an hour after
+// the router was created with the mocked clock. Remote clients are the
+// address of their destination.
+func newStaleReadTestRouter(t *testing.T, opts ...Option) (*router, string, *clock.Mock) {
+	const from, to = "127.0.0.1:3001", "127.0.0.1:3002"
+	key := movedKey(t, from, to)
+
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return([]string{from}, nil).Once()
+	rp.On("GetReachableMembers").Return([]string{from, to}, nil)
+	rp.On("Lookup", key).Return(to, nil)
+
+	c := clock.NewMock()
+	c.Add(time.Hour)
+	opts = append([]Option{WithClock(c)}, opts...)
+	r := newRingpopTestRouter(t, rp, append(opts, WithRemoteDialer(destDialer))...)
+
+	r.HandleEvent(events.RingChangedEvent{})
+	return r, key, c
+}
+
+func TestGetReadClient(t *testing.T) {
+	r, key, c := newStaleReadTestRouter(t, WithStaleReads(time.Minute))
+
+	client, err := r.GetReadClient(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client, "expected the owner while it is reachable")
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Suspect, Incarnation: 1})
+	client, err = r.GetReadClient(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client, "expected the previous owner while the owner is unreachable")
+
+	client, err = r.GetClient(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client, "expected GetClient to ignore stale reads")
+
+	// the previous owner is forgotten after the window
+	c.Add(2 * time.Minute)
+	client, err = r.GetReadClient(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+}
+
+func TestGetReadClientPreviousOwnerUnhealthy(t *testing.T) {
+	r, key, _ := newStaleReadTestRouter(t, WithStaleReads(time.Minute), WithStatusPredicate(func(swim.Change) EvictionDecision {
+		return QuarantineClient
+	}))
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Faulty, Incarnation: 1})
+	client, err := r.GetReadClient(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3001", Status: swim.Faulty, Incarnation: 1})
+	_, err = r.GetReadClient(key)
+	assert.Equal(t, ErrDestinationQuarantined, err, "expected the error of the owner when the previous owner is unhealthy too")
+}
+
+func TestGetReadClientDisabled(t *testing.T) {
+	r, key, _ := newStaleReadTestRouter(t)
+	assert.Empty(t, r.ownershipHistory)
+
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3002", Status: swim.Suspect, Incarnation: 1})
+	client, err := r.GetReadClient(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+}
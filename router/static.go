@@ -0,0 +1,168 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgryski/go-farm"
+	"github.com/uber/ringpop-go/events"
+	"github.com/uber/ringpop-go/forward"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/tchannel-go"
+)
+
+// localOnlyAddress is the address of the single node of a local only router.
+const localOnlyAddress = "local"
+
+// errStaticForward is returned by the static ring for requests it would have
+// to forward, static routers have no ringpop to forward with.
+var errStaticForward = errors.New("static ring does not forward requests")
+
+// NewStatic creates a Router that routes keys with a fixed table instead of
+// ringpop, for deployments with a known set of nodes, integration tests and
+// local development: the keys of table are routed to their destination and
+// all other keys to fallback. Keys routed to self, the address of the local
+// node, get the local client of f. The nodes of the table are always
+// reachable, so the membership never changes and nothing is rebalanced. See
+// New for a description of the other arguments.
+func NewStatic(self string, table map[string]string, fallback string, f ClientFactory, ch *tchannel.Channel, opts ...Option) Router {
+	return New(newStaticRing(self, table, fallback), f, ch, opts...)
+}
+
+// NewLocalOnly creates a Router for single-node deployments that routes every
+// key to the local client of f.
+func NewLocalOnly(f ClientFactory, opts ...Option) Router {
+	return NewStatic(localOnlyAddress, nil, localOnlyAddress, f, nil, opts...)
+}
+
+// staticRing is the ringpop.Interface of the routers of NewStatic.
+type staticRing struct {
+	self     string
+	table    map[string]string
+	fallback string
+	members  []string
+	checksum uint32
+	started  time.Time
+}
+
+func newStaticRing(self string, table map[string]string, fallback string) *staticRing {
+	s := &staticRing{
+		self:     self,
+		table:    make(map[string]string, len(table)),
+		fallback: fallback,
+		started:  time.Now(),
+	}
+
+	seen := map[string]bool{self: true, fallback: true}
+	for key, dest := range table {
+		s.table[key] = dest
+		seen[dest] = true
+	}
+	for member := range seen {
+		s.members = append(s.members, member)
+	}
+	sort.Strings(s.members)
+	s.checksum = farm.Fingerprint32([]byte(strings.Join(s.members, ";")))
+	return s
+}
+
+// Destroy does nothing.
+func (s *staticRing) Destroy() {}
+
+// App returns "static".
+func (s *staticRing) App() string {
+	return "static"
+}
+
+// WhoAmI returns the address of the local node.
+func (s *staticRing) WhoAmI() (string, error) {
+	return s.self, nil
+}
+
+// Uptime returns the time since the ring was created.
+func (s *staticRing) Uptime() (time.Duration, error) {
+	return time.Since(s.started), nil
+}
+
+// RegisterListener does nothing, the ring never changes.
+func (s *staticRing) RegisterListener(l events.EventListener) {}
+
+// Bootstrap returns the members.
+func (s *staticRing) Bootstrap(opts *swim.BootstrapOptions) ([]string, error) {
+	return s.members, nil
+}
+
+// Checksum returns the checksum of the members.
+func (s *staticRing) Checksum() (uint32, error) {
+	return s.checksum, nil
+}
+
+// Lookup returns the destination of key in the table, or the fallback.
+func (s *staticRing) Lookup(key string) (string, error) {
+	if dest, ok := s.table[key]; ok {
+		return dest, nil
+	}
+	return s.fallback, nil
+}
+
+// LookupN returns the destination of key followed by the other members, in
+// the order of their address.
+func (s *staticRing) LookupN(key string, n int) ([]string, error) {
+	owner, _ := s.Lookup(key)
+	dests := []string{owner}
+	for _, member := range s.members {
+		if len(dests) >= n {
+			break
+		}
+		if member != owner {
+			dests = append(dests, member)
+		}
+	}
+	return dests, nil
+}
+
+// GetReachableMembers returns the members.
+func (s *staticRing) GetReachableMembers() ([]string, error) {
+	return s.members, nil
+}
+
+// CountReachableMembers returns the number of members.
+func (s *staticRing) CountReachableMembers() (int, error) {
+	return len(s.members), nil
+}
+
+// HandleOrForward returns whether key is routed to the local node, requests
+// for other nodes fail.
+func (s *staticRing) HandleOrForward(key string, request []byte, response *[]byte, service, endpoint string, format tchannel.Format, opts *forward.Options) (bool, error) {
+	if dest, _ := s.Lookup(key); dest == s.self {
+		return true, nil
+	}
+	return false, errStaticForward
+}
+
+// Forward fails, there is no ringpop to forward with.
+func (s *staticRing) Forward(dest string, keys []string, request []byte, service, endpoint string, format tchannel.Format, opts *forward.Options) ([]byte, error) {
+	return nil, errStaticForward
+}
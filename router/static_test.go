@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestStaticRouter(t *testing.T) {
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+	cf.On("MakeRemoteClient", mock.Anything).Return("remote client")
+
+	table := map[string]string{"a": "127.0.0.1:3000", "b": "127.0.0.1:3002"}
+	r := NewStatic("127.0.0.1:3000", table, "127.0.0.1:3001", cf, nil, WithRemoteDialer(func(dest string) (interface{}, error) {
+		return "client of " + dest, nil
+	}))
+
+	client, err := r.GetClient("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	client, err = r.GetClient("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "client of 127.0.0.1:3002", client)
+
+	client, err = r.GetClient("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, "client of 127.0.0.1:3001", client, "expected keys outside the table to go to the fallback")
+
+	table["a"] = "127.0.0.1:3002"
+	d, err := r.Resolve("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3000", d.Address, "expected the table to be copied")
+
+	clients, err := r.GetClientN("b", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"client of 127.0.0.1:3002", "local client"}, clients)
+}
+
+func TestStaticRing(t *testing.T) {
+	s := newStaticRing("127.0.0.1:3000", map[string]string{"b": "127.0.0.1:3002"}, "127.0.0.1:3001")
+
+	members, err := s.GetReachableMembers()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}, members)
+
+	dests, err := s.LookupN("b", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3002", "127.0.0.1:3000", "127.0.0.1:3001"}, dests)
+
+	handle, err := s.HandleOrForward("local", nil, nil, "", "", "", nil)
+	assert.False(t, handle)
+	assert.Equal(t, errStaticForward, err)
+
+	same := newStaticRing("127.0.0.1:3000", map[string]string{"c": "127.0.0.1:3002"}, "127.0.0.1:3001")
+	c1, _ := s.Checksum()
+	c2, _ := same.Checksum()
+	assert.Equal(t, c1, c2, "expected the checksum to depend on the members only")
+}
+
+func TestLocalOnlyRouter(t *testing.T) {
+	cf := &mocks.ClientFactory{}
+	cf.On("GetLocalClient").Return("local client")
+	r := NewLocalOnly(cf)
+
+	for _, key := range []string{"a", "b", ""} {
+		client, err := r.GetClient(key)
+		assert.NoError(t, err)
+		assert.Equal(t, "local client", client)
+	}
+	table, err := r.RoutingTable()
+	assert.NoError(t, err)
+	assert.Equal(t, []MemberRoute{{Address: localOnlyAddress, Local: true, Status: "alive", CachedClients: 1}}, table.Members)
+}
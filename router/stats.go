@@ -0,0 +1,250 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-common/bark"
+	"github.com/uber/ringpop-go/logging"
+	"golang.org/x/net/context"
+)
+
+// Stats contains the counters a router keeps about its behavior since it was
+// created.
+type Stats struct {
+	// Lookups is the number of keys resolved against the ring and
+	// LookupErrors the number of those resolutions that failed.
+	Lookups      int64
+	LookupErrors int64
+
+	// LookupTime is the total time spent resolving keys. Divide by Lookups
+	// for the mean lookup latency.
+	LookupTime time.Duration
+
+	// CacheHits and CacheMisses count the clients that were, or were not,
+	// found in the client cache.
+	CacheHits   int64
+	CacheMisses int64
+
+	// LocalRoutes and RemoteRoutes count the clients returned for the local
+	// node and for remote nodes.
+	LocalRoutes  int64
+	RemoteRoutes int64
+
+	// Evictions is the number of clients evicted from the client cache.
+	Evictions int64
+
+	// ConcurrencyLimits are the current limits of the destinations called
+	// through Dispatch or RunOnOwner, when WithAdaptiveConcurrency is used.
+	ConcurrencyLimits map[string]int `json:",omitempty"`
+}
+
+// routerStats holds the counters behind Stats. It is allocated separately
+// from the router to guarantee 64-bit alignment for atomic operations on
+// 32-bit platforms.
+type routerStats struct {
+	lookups      int64
+	lookupErrors int64
+	lookupTime   int64
+	cacheHits    int64
+	cacheMisses  int64
+	localRoutes  int64
+	remoteRoutes int64
+	evictions    int64
+
+	// cached is the number of clients of the router in the cache.
+	cached int64
+}
+
+func (s *routerStats) evicted(n int) {
+	atomic.AddInt64(&s.evictions, int64(n))
+}
+
+// Stats returns a snapshot of the counters of the router.
+func (r *router) Stats() Stats {
+	s := r.stats
+	return Stats{
+		Lookups:      atomic.LoadInt64(&s.lookups),
+		LookupErrors: atomic.LoadInt64(&s.lookupErrors),
+		LookupTime:   time.Duration(atomic.LoadInt64(&s.lookupTime)),
+		CacheHits:    atomic.LoadInt64(&s.cacheHits),
+		CacheMisses:  atomic.LoadInt64(&s.cacheMisses),
+		LocalRoutes:  atomic.LoadInt64(&s.localRoutes),
+		RemoteRoutes: atomic.LoadInt64(&s.remoteRoutes),
+		Evictions:    atomic.LoadInt64(&s.evictions),
+
+		ConcurrencyLimits: r.concurrencyLimits(),
+	}
+}
+
+// lookup resolves key to its owner with the lookup strategy of the router and
+// records the lookup stats and the audit log. Keys pinned with Pin resolve to
+// their pinned destination without a lookup. The policy of WithPolicy is not
+// involved, so every node agrees on the owner of a key, see routeLookup.
+func (r *router) lookup(key string) (string, error) {
+	return r.lookupWith(context.Background(), key, r.resolveKey)
+}
+
+// routeLookup resolves key like lookup, to the destination the policy of the
+// router selects for it. It is only used to route calls, never to decide
+// which node owns a key.
+func (r *router) routeLookup(ctx context.Context, key string) (string, error) {
+	return r.lookupWith(ctx, key, r.selectDestination)
+}
+
+// lookupWith resolves key with selectDest, see lookup. It gives up with the
+// error of ctx when ctx is done before the key is resolved.
+func (r *router) lookupWith(ctx context.Context, key string, selectDest func(key string) (string, error)) (string, error) {
+	if dest, ok := r.pinned(key); ok {
+		r.audit(key, dest)
+		return dest, nil
+	}
+
+	start := r.clock.Now()
+	mapped := r.mapKey(key)
+	var dest string
+	err := r.delayLookup(ctx)
+	if err == nil {
+		err = whileNotDone(ctx, func() (err error) {
+			dest, err = selectDest(mapped)
+			if err == nil {
+				dest, err = r.checkDestination(mapped, dest, selectDest)
+			}
+			return err
+		})
+	}
+	if err != nil && err == ctx.Err() {
+		return "", err
+	}
+	if err == nil {
+		// the state the router keeps by destination, from the cache to the
+		// circuit breakers, is keyed by the normalized address
+		dest = r.normalize(r.misroute(dest))
+	}
+	r.recordLookup(r.clock.Now().Sub(start), err)
+	// the fields of the message are only built when it is logged, which keeps
+	// lookups free of allocations
+	if logging.Enabled(r.logger, logging.Debug) {
+		r.logger.WithFields(bark.Fields{
+			"key":   key,
+			"dest":  dest,
+			"error": err,
+		}).Debug("router looked up key")
+	}
+	if err == nil {
+		r.audit(key, dest)
+	} else {
+		r.emit(LookupFailedEvent{Key: key, Error: err})
+	}
+	return dest, wrapError(ErrLookupFailed, err)
+}
+
+// lookupN resolves the n destinations of key with the lookup strategy of the
+// router and records the lookup stats. The destination of a key pinned with
+// Pin comes first. It gives up with the error of ctx when ctx is done before
+// the key is resolved.
+func (r *router) lookupN(ctx context.Context, key string, n int) ([]string, error) {
+	start := r.clock.Now()
+	var dests []string
+	err := r.delayLookup(ctx)
+	if err == nil {
+		err = whileNotDone(ctx, func() (err error) {
+			dests, err = r.resolveKeyN(r.mapKey(key), n)
+			if err == nil {
+				dests, err = r.checkDestinations(dests)
+			}
+			return err
+		})
+	}
+	if err != nil && err == ctx.Err() {
+		return nil, err
+	}
+	if pinned, ok := r.pinned(key); ok && err == nil {
+		dests = pinFirst(dests, pinned, n)
+	}
+	if err == nil {
+		dests = r.normalizeAll(dests)
+	}
+	r.recordLookup(r.clock.Now().Sub(start), err)
+	if logging.Enabled(r.logger, logging.Debug) {
+		r.logger.WithFields(bark.Fields{
+			"key":   key,
+			"dests": dests,
+			"error": err,
+		}).Debug("router looked up key replicas")
+	}
+	if err != nil {
+		r.emit(LookupFailedEvent{Key: key, Error: err})
+	}
+	return dests, wrapError(ErrLookupFailed, err)
+}
+
+func (r *router) recordLookup(duration time.Duration, err error) {
+	atomic.AddInt64(&r.stats.lookups, 1)
+	atomic.AddInt64(&r.stats.lookupTime, int64(duration))
+	r.statter.RecordTimer("router.lookup", nil, duration)
+
+	if err != nil {
+		atomic.AddInt64(&r.stats.lookupErrors, 1)
+		r.statter.IncCounter("router.lookup.error", nil, 1)
+	}
+}
+
+// recordRoute records the stats for a client returned for a destination,
+// hit tells whether the client came from the cache.
+func (r *router) recordRoute(entry *cacheEntry, hit bool) {
+	if hit {
+		atomic.AddInt64(&entry.hits, 1)
+		atomic.AddInt64(&r.stats.cacheHits, 1)
+		r.statter.IncCounter("router.cache.hit", nil, 1)
+	} else {
+		atomic.AddInt64(&r.stats.cacheMisses, 1)
+		r.statter.IncCounter("router.cache.miss", nil, 1)
+	}
+
+	if entry.local {
+		atomic.AddInt64(&r.stats.localRoutes, 1)
+		r.statter.IncCounter("router.route.local", nil, 1)
+	} else {
+		atomic.AddInt64(&r.stats.remoteRoutes, 1)
+		r.statter.IncCounter("router.route.remote", nil, 1)
+	}
+	r.recordZone(entry)
+}
+
+// ExpvarStats returns an expvar.Var rendering the stats of r as JSON, for use
+// with expvar.Publish:
+//
+//     expvar.Publish("router", router.ExpvarStats(r))
+func ExpvarStats(r Router) expvar.Var {
+	return expvar.Func(func() interface{} {
+		return r.Stats()
+	})
+}
+
+type noopStatsReporter struct{}
+
+func (noopStatsReporter) IncCounter(name string, tags bark.Tags, value int64)      {}
+func (noopStatsReporter) UpdateGauge(name string, tags bark.Tags, value int64)     {}
+func (noopStatsReporter) RecordTimer(name string, tags bark.Tags, d time.Duration) {}
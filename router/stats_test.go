@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestStats(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, key := range []string{"local", "remote", "remote", "error"} {
+		r.GetClient(key)
+	}
+	r.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Faulty,
+	})
+
+	stats := r.Stats()
+	assert.Equal(t, int64(4), stats.Lookups)
+	assert.Equal(t, int64(1), stats.LookupErrors)
+	assert.Equal(t, int64(1), stats.CacheHits)
+	assert.Equal(t, int64(2), stats.CacheMisses)
+	assert.Equal(t, int64(1), stats.LocalRoutes)
+	assert.Equal(t, int64(2), stats.RemoteRoutes)
+	assert.Equal(t, int64(1), stats.Evictions)
+}
+
+func TestStatsReporter(t *testing.T) {
+	statter := &mocks.StatsReporter{}
+	statter.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	statter.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	r := newTestRouter(t, WithStatsReporter(statter))
+	r.GetClient("remote")
+	r.GetClient("remote")
+
+	statter.AssertCalled(t, "RecordTimer", "router.lookup", mock.Anything, mock.Anything)
+	statter.AssertCalled(t, "IncCounter", "router.cache.miss", mock.Anything, int64(1))
+	statter.AssertCalled(t, "IncCounter", "router.cache.hit", mock.Anything, int64(1))
+	statter.AssertCalled(t, "IncCounter", "router.route.remote", mock.Anything, int64(1))
+	statter.AssertNotCalled(t, "IncCounter", "router.route.local", mock.Anything, mock.Anything)
+}
+
+func TestExpvarStats(t *testing.T) {
+	r := newTestRouter(t)
+	r.GetClient("local")
+
+	var stats Stats
+	err := json.Unmarshal([]byte(ExpvarStats(r).String()), &stats)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.LocalRoutes)
+}
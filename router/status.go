@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "github.com/uber/ringpop-go/swim"
+
+// An EvictionDecision tells the router what to do with the clients of the
+// member a membership change is about.
+type EvictionDecision int
+
+const (
+	// KeepClient keeps the cached clients of the member.
+	KeepClient EvictionDecision = iota
+
+	// EvictClient evicts the cached clients of the member. New clients are
+	// created on demand.
+	EvictClient
+
+	// QuarantineClient evicts the cached clients of the member and makes
+	// calls for new clients for it fail with ErrDestinationQuarantined until
+	// a later change about the member is decided otherwise.
+	QuarantineClient
+)
+
+// A StatusPredicate decides what to do with the clients of the member a
+// membership change is about, see WithStatusPredicate.
+type StatusPredicate func(change swim.Change) EvictionDecision
+
+// DefaultStatusPredicate evicts the clients of members that are faulty or
+// left the ring and keeps all others.
+func DefaultStatusPredicate(change swim.Change) EvictionDecision {
+	switch change.Status {
+	case swim.Faulty, swim.Leave:
+		return EvictClient
+	}
+	return KeepClient
+}
+
+// decide returns the decision of the status predicate of the router for
+// change.
+func (r *router) decide(change swim.Change) EvictionDecision {
+	if r.statusPredicate == nil {
+		return DefaultStatusPredicate(change)
+	}
+	return r.statusPredicate(change)
+}
+
+// quarantined returns whether the clients of dest are quarantined.
+func (r *router) quarantined(dest string) bool {
+	r.changesMu.Lock()
+	defer r.changesMu.Unlock()
+	return r.quarantine[dest]
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+)
+
+func TestDefaultStatusPredicate(t *testing.T) {
+	cases := map[string]EvictionDecision{
+		swim.Alive:   KeepClient,
+		swim.Suspect: KeepClient,
+		swim.Faulty:  EvictClient,
+		swim.Leave:   EvictClient,
+	}
+	for status, decision := range cases {
+		assert.Equal(t, decision, DefaultStatusPredicate(swim.Change{Status: status}), status)
+	}
+}
+
+func TestStatusPredicateEvictsOnSuspect(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t, WithStatusPredicate(func(change swim.Change) EvictionDecision {
+		if change.Status == swim.Suspect {
+			return EvictClient
+		}
+		return DefaultStatusPredicate(change)
+	}))
+
+	client, err := r.GetClient("node1")
+	assert.NoError(t, err)
+
+	r.ReconcileChange(swim.Change{
+		Address:     "127.0.0.1:3001",
+		Status:      swim.Suspect,
+		Incarnation: 1,
+	})
+	assert.True(t, client.(*closingClient).isClosed())
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3001")
+
+	// evicted clients are created again on demand
+	_, err = r.GetClient("node1")
+	assert.NoError(t, err)
+}
+
+func TestStatusPredicateQuarantine(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t, WithStatusPredicate(func(change swim.Change) EvictionDecision {
+		if change.Status == swim.Suspect {
+			return QuarantineClient
+		}
+		return DefaultStatusPredicate(change)
+	}))
+
+	client, err := r.GetClient("node1")
+	assert.NoError(t, err)
+
+	r.ReconcileChange(swim.Change{
+		Address:     "127.0.0.1:3001",
+		Status:      swim.Suspect,
+		Incarnation: 1,
+	})
+	assert.True(t, client.(*closingClient).isClosed())
+
+	_, err = r.GetClient("node1")
+	assert.Equal(t, ErrDestinationQuarantined, err)
+
+	// other destinations are not affected
+	_, err = r.GetClient("node2")
+	assert.NoError(t, err)
+
+	r.ReconcileChange(swim.Change{
+		Address:     "127.0.0.1:3001",
+		Status:      swim.Alive,
+		Incarnation: 2,
+	})
+	_, err = r.GetClient("node1")
+	assert.NoError(t, err, "expected the quarantine to end with the next change")
+}
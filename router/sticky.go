@@ -0,0 +1,134 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "sync"
+
+// A StickyClient is a handle to the client of the node a key resolved to when
+// the handle was created. It keeps returning the client of that node, even
+// when ownership of the key moves to another node, until it is released.
+//
+// When the pinned node is declared faulty or leaves the ring the handle can no
+// longer be used: Client returns ErrStickyDestinationGone and the session
+// should be restarted with a new call to GetStickyClient, which resolves the
+// key again.
+type StickyClient interface {
+	// Client returns the client of the pinned destination. The client is
+	// taken from the cache of the router on every call, so a client the
+	// cache closed and evicted, eg. as idle or after a health check failed,
+	// is created again rather than returned closed.
+	Client() (interface{}, error)
+
+	// Destination returns the address of the pinned destination.
+	Destination() string
+
+	// Release ends the session of this handle. Once all handles for a key
+	// are released, new sessions for the key are routed according to the
+	// ring again. Release is safe to call more than once.
+	Release()
+}
+
+// stickySession is shared by all handles for the same key. Its fields are
+// protected by the stickyMu lock of the router.
+type stickySession struct {
+	dest string
+	refs int
+	gone bool
+}
+
+type stickyClient struct {
+	r       *router
+	key     string
+	session *stickySession
+	release sync.Once
+}
+
+// GetStickyClient returns a handle to the client of the node key resolves to.
+// While a handle for key is held, new handles for the same key are pinned to
+// the same node.
+func (r *router) GetStickyClient(key string) (StickyClient, error) {
+	r.stickyMu.Lock()
+	session, ok := r.sticky[key]
+	if ok {
+		session.refs++
+		r.stickyMu.Unlock()
+		return &stickyClient{r: r, key: key, session: session}, nil
+	}
+	r.stickyMu.Unlock()
+
+	_, dest, err := r.getClient(key)
+	if err != nil {
+		return nil, err
+	}
+
+	r.stickyMu.Lock()
+	defer r.stickyMu.Unlock()
+
+	// another session for the key might have been started while the lock
+	// was not held
+	session, ok = r.sticky[key]
+	if !ok {
+		session = &stickySession{dest: dest}
+		r.sticky[key] = session
+	}
+	session.refs++
+
+	return &stickyClient{r: r, key: key, session: session}, nil
+}
+
+// endStickySessions marks all sticky sessions pinned to dest as gone and
+// forgets about them so new sessions for their keys are resolved again.
+func (r *router) endStickySessions(dest string) {
+	r.stickyMu.Lock()
+	for key, session := range r.sticky {
+		if session.dest == dest {
+			session.gone = true
+			delete(r.sticky, key)
+		}
+	}
+	r.stickyMu.Unlock()
+}
+
+func (s *stickyClient) Client() (interface{}, error) {
+	s.r.stickyMu.Lock()
+	gone := s.session.gone
+	s.r.stickyMu.Unlock()
+
+	if gone {
+		return nil, ErrStickyDestinationGone
+	}
+	return s.r.getClientForDest(s.session.dest)
+}
+
+func (s *stickyClient) Destination() string {
+	return s.session.dest
+}
+
+func (s *stickyClient) Release() {
+	s.release.Do(func() {
+		s.r.stickyMu.Lock()
+		s.session.refs--
+		if s.session.refs <= 0 && s.r.sticky[s.key] == s.session {
+			delete(s.r.sticky, s.key)
+		}
+		s.r.stickyMu.Unlock()
+	})
+}
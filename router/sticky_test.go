@@ -0,0 +1,126 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/swim"
+)
+
+// newMovingKeyRouter returns a router on which the key "moving" is owned by
+// 127.0.0.1:3001 for the first lookup and by 127.0.0.1:3002 afterwards.
+func newMovingKeyRouter(t *testing.T) *router {
+	rp := newTestRingpop(nil)
+	rp.On("Lookup", "moving").Return("127.0.0.1:3001", nil).Once()
+	rp.On("Lookup", "moving").Return("127.0.0.1:3002", nil)
+	return newRingpopTestRouter(t, rp)
+}
+
+func TestStickyClientIgnoresOwnershipChanges(t *testing.T) {
+	r := newMovingKeyRouter(t)
+
+	first, err := r.GetStickyClient("moving")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", first.Destination())
+
+	// normal routing follows the ring
+	_, dest, err := r.getClient("moving")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", dest)
+
+	// new sessions stay on the pinned node while a handle is held
+	second, err := r.GetStickyClient("moving")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", second.Destination())
+
+	client, err := first.Client()
+	assert.NoError(t, err)
+	assert.Equal(t, "remote client", client)
+
+	first.Release()
+	second.Release()
+
+	// all handles are released, new sessions follow the ring again
+	third, err := r.GetStickyClient("moving")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", third.Destination())
+}
+
+func TestStickyClientPinnedDestinationLeaves(t *testing.T) {
+	r := newMovingKeyRouter(t)
+
+	sticky, err := r.GetStickyClient("moving")
+	assert.NoError(t, err)
+
+	r.ReconcileChange(swim.Change{
+		Address: "127.0.0.1:3001",
+		Status:  swim.Leave,
+	})
+
+	_, err = sticky.Client()
+	assert.Equal(t, ErrStickyDestinationGone, err)
+
+	// a new session is resolved against the ring
+	sticky, err = r.GetStickyClient("moving")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", sticky.Destination())
+}
+
+func TestStickyClientReleaseIsIdempotent(t *testing.T) {
+	r := newMovingKeyRouter(t)
+
+	first, err := r.GetStickyClient("moving")
+	assert.NoError(t, err)
+	second, err := r.GetStickyClient("moving")
+	assert.NoError(t, err)
+
+	// releasing the same handle twice does not end the other session
+	first.Release()
+	first.Release()
+
+	third, err := r.GetStickyClient("moving")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", third.Destination())
+
+	second.Release()
+	third.Release()
+	assert.Empty(t, r.sticky)
+}
+
+func TestStickyClientPinnedClientEvicted(t *testing.T) {
+	r, _, _ := newCacheTestRouter(t)
+
+	sticky, err := r.GetStickyClient("node1")
+	assert.NoError(t, err)
+	first, err := sticky.Client()
+	assert.NoError(t, err)
+
+	// the cache closes and evicts the client the session started with
+	assert.True(t, r.InvalidateDestination("127.0.0.1:3001"))
+	assert.True(t, first.(*closingClient).isClosed())
+
+	client, err := sticky.Client()
+	assert.NoError(t, err)
+	assert.False(t, client.(*closingClient).isClosed(), "expected the client of the pinned destination to be created again")
+	assert.Equal(t, "127.0.0.1:3001", sticky.Destination())
+}
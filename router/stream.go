@@ -0,0 +1,228 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+
+	"github.com/uber-common/bark"
+	"golang.org/x/net/context"
+)
+
+// A Stream is a long lived call made over the client of a node, eg. a
+// TChannel call whose arguments are streamed.
+type Stream interface {
+	Close() error
+}
+
+// A StreamOpener opens a stream over client, the client of the node a key
+// resolves to.
+type StreamOpener func(client interface{}) (Stream, error)
+
+// A ResumeFunc is called with the stream of key newly opened to its new owner
+// to, before the stream to its previous owner from is closed, so it can
+// resume where the previous stream stopped, eg. by sending the offset of the
+// last message that was acknowledged. When it returns an error the new stream
+// is closed and the previous one is kept.
+type ResumeFunc func(key, from, to string, stream Stream) error
+
+// A StreamClient is a handle to a stream of a key. When ownership of the key
+// moves to another node, a stream to the new owner is opened, resumed and
+// takes the place of the stream to the previous owner, which is closed.
+//
+// The stream is re-established whenever ringpop's ring changes. When opening
+// or resuming the stream to the new owner fails, counted by the
+// router.stream.resume.failed counter, the stream to the previous owner is
+// kept until the next change of the ring.
+type StreamClient interface {
+	// Stream returns the current stream of the key.
+	Stream() Stream
+
+	// Destination returns the address of the node the current stream is
+	// open to.
+	Destination() string
+
+	// Close closes the current stream and stops re-establishing it. Close is
+	// safe to call more than once.
+	Close() error
+}
+
+type streamClient struct {
+	r      *router
+	key    string
+	open   StreamOpener
+	resume ResumeFunc
+
+	// moveMu serializes the moves of the stream, mu protects the fields
+	// below it
+	moveMu sync.Mutex
+	mu     sync.Mutex
+	dest   string
+	stream Stream
+	closed bool
+}
+
+// GetStreamClient opens a stream with open over the client of the node key
+// resolves to and returns a handle to it that re-establishes the stream
+// against the new owner of key when ownership moves, see StreamClient. resume
+// may be nil when streams need no resumption.
+func (r *router) GetStreamClient(key string, open StreamOpener, resume ResumeFunc) (StreamClient, error) {
+	client, dest, err := r.getClient(key)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := open(client)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &streamClient{
+		r:      r,
+		key:    key,
+		open:   open,
+		resume: resume,
+		dest:   dest,
+		stream: stream,
+	}
+
+	r.streamsMu.Lock()
+	defer r.streamsMu.Unlock()
+
+	if r.closed() {
+		stream.Close()
+		return nil, ErrRouterClosed
+	}
+	r.streams[s] = struct{}{}
+	return s, nil
+}
+
+// reconcileStreams re-establishes the streams of which the key moved to
+// another node, each on a goroutine of its own so a slow node does not hold
+// up the others or the handling of ringpop's events.
+func (r *router) reconcileStreams() {
+	r.streamsMu.Lock()
+	for s := range r.streams {
+		go s.reconcile()
+	}
+	r.streamsMu.Unlock()
+}
+
+// closeStreams closes all streams, when the router is closed.
+func (r *router) closeStreams() {
+	r.streamsMu.Lock()
+	streams := r.streams
+	r.streams = make(map[*streamClient]struct{})
+	r.streamsMu.Unlock()
+
+	for s := range streams {
+		s.Close()
+	}
+}
+
+// reconcile moves the stream to the node its key resolves to, when that is
+// not the node the stream is open to.
+func (s *streamClient) reconcile() {
+	s.moveMu.Lock()
+	defer s.moveMu.Unlock()
+
+	s.mu.Lock()
+	from, closed := s.dest, s.closed
+	s.mu.Unlock()
+	if closed {
+		return
+	}
+
+	to, err := s.r.routeLookup(context.Background(), s.key)
+	if err != nil || to == from {
+		return
+	}
+
+	stream, err := s.openTo(from, to)
+	if err != nil {
+		s.r.statter.IncCounter("router.stream.resume.failed", nil, 1)
+		s.r.logger.WithFields(bark.Fields{
+			"key":   s.key,
+			"from":  from,
+			"to":    to,
+			"error": err,
+		}).Warn("router failed to re-establish stream")
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		stream.Close()
+		return
+	}
+	previous := s.stream
+	s.dest, s.stream = to, stream
+	s.mu.Unlock()
+
+	previous.Close()
+	s.r.statter.IncCounter("router.stream.resumed", nil, 1)
+}
+
+// openTo opens and resumes the stream to the new owner to of the key.
+func (s *streamClient) openTo(from, to string) (Stream, error) {
+	client, err := s.r.getClientForDest(to)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := s.open(client)
+	if err != nil {
+		return nil, err
+	}
+	if s.resume != nil {
+		if err := s.resume(s.key, from, to, stream); err != nil {
+			stream.Close()
+			return nil, err
+		}
+	}
+	return stream, nil
+}
+
+func (s *streamClient) Stream() Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream
+}
+
+func (s *streamClient) Destination() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dest
+}
+
+func (s *streamClient) Close() error {
+	s.r.streamsMu.Lock()
+	delete(s.r.streams, s)
+	s.r.streamsMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.stream.Close()
+}
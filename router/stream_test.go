@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/events"
+	"golang.org/x/net/context"
+)
+
+// fakeStream is a Stream opened over the client of its destination, closed
+// receives once it is closed.
+type fakeStream struct {
+	dest   string
+	closed chan struct{}
+}
+
+func (s *fakeStream) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func openFakeStream(client interface{}) (Stream, error) {
+	return &fakeStream{dest: client.(string), closed: make(chan struct{})}, nil
+}
+
+// newStreamTestRouter creates a router on which "key" is owned by
+// 127.0.0.1:3001 and then by the owners that follow. Remote clients are the
+// address of their destination.
+func newStreamTestRouter(t *testing.T, owners ...string) *router {
+	rp := newTestRingpop(nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001", "127.0.0.1:3002"}, nil)
+	for _, owner := range append([]string{"127.0.0.1:3001"}, owners...) {
+		rp.On("Lookup", "key").Return(owner, nil).Once()
+	}
+
+	return newRingpopTestRouter(t, rp, WithRemoteDialer(destDialer))
+}
+
+func TestStreamClientMoves(t *testing.T) {
+	r := newStreamTestRouter(t, "127.0.0.1:3002")
+
+	resumed := make(chan string, 1)
+	resume := func(key, from, to string, stream Stream) error {
+		assert.Equal(t, "key", key)
+		assert.Equal(t, "127.0.0.1:3001", from)
+		assert.Equal(t, "127.0.0.1:3002", stream.(*fakeStream).dest)
+		resumed <- to
+		return nil
+	}
+	s, err := r.GetStreamClient("key", openFakeStream, resume)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", s.Destination())
+	first := s.Stream().(*fakeStream)
+	assert.Equal(t, "127.0.0.1:3001", first.dest)
+
+	r.HandleEvent(events.RingChangedEvent{})
+	assert.Equal(t, "127.0.0.1:3002", <-resumed)
+	<-first.closed
+	assert.Equal(t, "127.0.0.1:3002", s.Destination())
+	assert.Equal(t, "127.0.0.1:3002", s.Stream().(*fakeStream).dest)
+
+	second := s.Stream().(*fakeStream)
+	assert.NoError(t, s.Close())
+	<-second.closed
+	assert.NoError(t, s.Close(), "expected Close to be safe to call again")
+}
+
+func TestStreamClientResumeFails(t *testing.T) {
+	r := newStreamTestRouter(t, "127.0.0.1:3002")
+
+	rejected := make(chan *fakeStream, 1)
+	resume := func(key, from, to string, stream Stream) error {
+		rejected <- stream.(*fakeStream)
+		return errors.New("cannot resume")
+	}
+	s, err := r.GetStreamClient("key", openFakeStream, resume)
+	assert.NoError(t, err)
+
+	r.HandleEvent(events.RingChangedEvent{})
+	<-(<-rejected).closed
+	assert.Equal(t, "127.0.0.1:3001", s.Destination(), "expected the previous stream to be kept")
+	assert.Equal(t, "127.0.0.1:3001", s.Stream().(*fakeStream).dest)
+}
+
+func TestStreamClientOpenFails(t *testing.T) {
+	r := newStreamTestRouter(t)
+
+	_, err := r.GetStreamClient("key", func(client interface{}) (Stream, error) {
+		return nil, errors.New("cannot open")
+	}, nil)
+	assert.EqualError(t, err, "cannot open")
+	assert.Empty(t, r.streams)
+}
+
+func TestCloseClosesStreams(t *testing.T) {
+	r := newStreamTestRouter(t, "127.0.0.1:3001")
+
+	s, err := r.GetStreamClient("key", openFakeStream, nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Close(context.Background()))
+	<-s.Stream().(*fakeStream).closed
+
+	_, err = r.GetStreamClient("key", openFakeStream, nil)
+	assert.Equal(t, ErrRouterClosed, err)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+// noRelease is the release function of a creation that is not limited.
+func noRelease() {}
+
+// acquireCreation takes one of the slots of the remote client creations,
+// waiting for one to free up for the wait configured with WithCreationLimit.
+// It returns the function that releases the slot, or ErrCreationThrottled.
+func (r *router) acquireCreation() (func(), error) {
+	if r.creationSlots == nil {
+		return noRelease, nil
+	}
+
+	release := func() { <-r.creationSlots }
+	select {
+	case r.creationSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if r.creationWait > 0 {
+		select {
+		case r.creationSlots <- struct{}{}:
+			return release, nil
+		case <-r.clock.After(r.creationWait):
+		}
+	}
+	r.statter.IncCounter("router.client.throttled", nil, 1)
+	return nil, ErrCreationThrottled
+}
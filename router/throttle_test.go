@@ -0,0 +1,124 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingTransport is a Transport of which every Dial blocks until release
+// is closed. The connections are the address of their destination.
+type blockingTransport struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (t *blockingTransport) Dial(dest string) (ClientConn, error) {
+	t.started <- struct{}{}
+	<-t.release
+	return dest, nil
+}
+
+// newThrottleTestRouter creates a router on which "a" is owned by
+// 127.0.0.1:3001, "b" by 127.0.0.1:3002 and "local" by the local node, and
+// of which the remote clients are created through transport.
+func newThrottleTestRouter(t *testing.T, transport Transport, opts ...Option) (*router, *clock.Mock) {
+	rp := newTestRingpop(testLookups{
+		"a": "127.0.0.1:3001",
+		"b": "127.0.0.1:3002",
+	})
+
+	c := clock.NewMock()
+	opts = append([]Option{WithClock(c)}, opts...)
+	return newRingpopTestRouter(t, rp, append(opts, WithTransport(transport))...), c
+}
+
+// createInBackground gets the client of key on another goroutine, the
+// returned channel receives its error.
+func createInBackground(r *router, key string) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r.GetClient(key)
+		errs <- err
+	}()
+	return errs
+}
+
+func TestCreationLimit(t *testing.T) {
+	transport := &blockingTransport{started: make(chan struct{}, 2), release: make(chan struct{})}
+	r, _ := newThrottleTestRouter(t, transport, WithCreationLimit(1, 0))
+
+	first := createInBackground(r, "a")
+	<-transport.started
+
+	_, err := r.GetClient("b")
+	assert.Equal(t, ErrCreationThrottled, err)
+	assert.NotContains(t, r.cache.keys(), "127.0.0.1:3002", "expected nothing to be cached")
+
+	client, err := r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client, "expected local clients not to be limited")
+
+	close(transport.release)
+	assert.NoError(t, <-first)
+	client, err = r.GetClient("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+}
+
+func TestCreationLimitQueues(t *testing.T) {
+	transport := &blockingTransport{started: make(chan struct{}, 2), release: make(chan struct{})}
+	r, c := newThrottleTestRouter(t, transport, WithCreationLimit(1, time.Minute))
+
+	first := createInBackground(r, "a")
+	<-transport.started
+	second := createInBackground(r, "b")
+
+	// the second creation takes the slot once the first one finished
+	close(transport.release)
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-second)
+	<-transport.started
+
+	// and times out while the slot is taken
+	transport.release = make(chan struct{})
+	r.removeClient("127.0.0.1:3001")
+	r.removeClient("127.0.0.1:3002")
+	first = createInBackground(r, "a")
+	<-transport.started
+	second = createInBackground(r, "b")
+	for i := 0; i < 1000 && len(second) == 0; i++ {
+		c.Add(time.Minute)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, ErrCreationThrottled, <-second)
+	close(transport.release)
+	assert.NoError(t, <-first)
+}
+
+func TestCreationLimitDisabled(t *testing.T) {
+	r, _ := newThrottleTestRouter(t, &memoryTransport{})
+	assert.Nil(t, r.creationSlots)
+}
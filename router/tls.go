@@ -0,0 +1,217 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// errTLSUnsupported is the cause of the ErrClientCreation errors of
+	// routers configured with WithTLS whose Transport is not a TLSTransport.
+	// TChannel channels dial plain TCP connections.
+	errTLSUnsupported = errors.New("transport does not support TLS")
+
+	// errNoIdentity is the cause of the ErrClientCreation errors returned for
+	// members without the identity label of an IdentityTLS.
+	errNoIdentity = errors.New("member has no identity label")
+)
+
+// A TLSTransport is a Transport that can dial remote destinations over TLS,
+// see WithTLS.
+type TLSTransport interface {
+	Transport
+
+	// DialTLS returns the connection to the remote destination dest, secured
+	// with config.
+	DialTLS(dest string, config *tls.Config) (ClientConn, error)
+}
+
+// TLSDialer is a TLSTransport that dials TCP connections to remote
+// destinations, secured with TLS when the router is configured with WithTLS,
+// and creates the client of the destination on the connection with
+// NewClient, eg. a Thrift client over a framed transport or a gRPC client
+// connection.
+type TLSDialer struct {
+	// NewClient returns the client of dest that calls it over conn. The
+	// connection is closed when NewClient fails; otherwise it is owned by the
+	// client, which should implement io.Closer so the connection is closed
+	// when the client is evicted.
+	NewClient func(dest string, conn net.Conn) (ClientConn, error)
+
+	// Timeout bounds the connection and its TLS handshake, no timeout when
+	// zero.
+	Timeout time.Duration
+}
+
+// Dial returns the client of dest over a plain TCP connection.
+func (d *TLSDialer) Dial(dest string) (ClientConn, error) {
+	conn, err := net.DialTimeout("tcp", dest, d.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return d.newClient(dest, conn)
+}
+
+// DialTLS returns the client of dest over a TCP connection secured with
+// config, once the TLS handshake completed.
+func (d *TLSDialer) DialTLS(dest string, config *tls.Config) (ClientConn, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: d.Timeout}, "tcp", dest, config)
+	if err != nil {
+		return nil, err
+	}
+	return d.newClient(dest, conn)
+}
+
+func (d *TLSDialer) newClient(dest string, conn net.Conn) (ClientConn, error) {
+	client, err := d.NewClient(dest, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// A TLSConfigFunc returns the TLS configuration to dial the member at dest
+// with, see WithTLS. It is called for every client the router creates, so it
+// picks up rotated certificates. Errors are returned from GetClient as an
+// Error of kind ErrClientCreation.
+type TLSConfigFunc func(dest Destination) (*tls.Config, error)
+
+// dial returns the connection of the transport of the router to d, over TLS
+// when enabled with WithTLS.
+func (r *router) dial(d Destination) (ClientConn, error) {
+	addr := r.dialAddress(d.Address)
+	if r.tlsConfig == nil {
+		return r.transport.Dial(addr)
+	}
+
+	// never fall back to plain connections
+	t, ok := r.transport.(TLSTransport)
+	if !ok {
+		return nil, errTLSUnsupported
+	}
+	config, err := r.tlsConfig(d)
+	if err != nil {
+		return nil, err
+	}
+	return t.DialTLS(addr, config)
+}
+
+// IdentityTLS returns a TLSConfigFunc for mutual TLS presenting the current
+// certificate of certs and verifying that members present a certificate,
+// signed by roots, for their identity: the value of the label of the member,
+// eg. the name of the service it runs as, see WithLabels. Members without the
+// label are not dialed. The certificate is taken from certs at every
+// handshake, so a rotated certificate is presented on the next connection.
+func IdentityTLS(label string, certs *CertReloader, roots *x509.CertPool) TLSConfigFunc {
+	return func(dest Destination) (*tls.Config, error) {
+		identity := dest.Labels[label]
+		if identity == "" {
+			return nil, errNoIdentity
+		}
+		return &tls.Config{
+			GetClientCertificate: certs.GetClientCertificate,
+			RootCAs:              roots,
+			ServerName:           identity,
+		}, nil
+	}
+}
+
+// A CertReloader loads a certificate and its key from files and loads them
+// again when the files change, so the certificate can be rotated without a
+// restart. The files are checked at most once per interval.
+type CertReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+
+	mu        sync.Mutex
+	cert      tls.Certificate
+	modTime   time.Time
+	loaded    bool
+	checkedAt time.Time
+}
+
+// NewCertReloader returns a CertReloader for the PEM encoded certificate and
+// key files, after loading them once.
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if _, err := c.Certificate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Certificate returns the current certificate. The last certificate loaded
+// is returned while the files fail to load.
+func (c *CertReloader) Certificate() (tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.loaded && now.Sub(c.checkedAt) < c.interval {
+		return c.cert, nil
+	}
+	c.checkedAt = now
+
+	modTime, err := c.lastModified()
+	if err == nil && (!c.loaded || modTime.After(c.modTime)) {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(c.certFile, c.keyFile); err == nil {
+			c.cert, c.modTime, c.loaded = cert, modTime, true
+		}
+	}
+	if !c.loaded {
+		return tls.Certificate{}, err
+	}
+	return c.cert, nil
+}
+
+// GetClientCertificate returns the current certificate, it is a
+// tls.Config.GetClientCertificate.
+func (c *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := c.Certificate()
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// lastModified returns the time the files of c were last modified.
+func (c *CertReloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tlsTransport is a memoryTransport that records the TLS configurations it
+// dials with.
+type tlsTransport struct {
+	memoryTransport
+	configs []*tls.Config
+}
+
+func (t *tlsTransport) DialTLS(dest string, config *tls.Config) (ClientConn, error) {
+	t.Lock()
+	t.configs = append(t.configs, config)
+	t.Unlock()
+	return t.Dial(dest)
+}
+
+// writeTestCert writes a self-signed certificate for name and its key to
+// name.crt and name.key in dir.
+func writeTestCert(t *testing.T, dir, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600))
+}
+
+func commonName(t *testing.T, cert tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestTLSUnsupported(t *testing.T) {
+	transport := &memoryTransport{conns: map[string]ClientConn{"127.0.0.1:3001": "raw client"}}
+	config := func(dest Destination) (*tls.Config, error) {
+		return &tls.Config{}, nil
+	}
+	r := newTransportTestRouter(t, nil, WithTransport(transport), WithTLS(config))
+
+	_, err := r.GetClient("thrift")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Equal(t, errTLSUnsupported, err.(*Error).Err)
+	assert.Empty(t, transport.dialed, "expected no plain connection to be dialed")
+}
+
+func TestIdentityTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestCert(t, dir, "client")
+
+	certs, err := NewCertReloader(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	identities := func(dest string) (map[string]string, error) {
+		if dest == "127.0.0.1:3001" {
+			return map[string]string{"identity": "storage"}, nil
+		}
+		return nil, nil
+	}
+
+	transport := &tlsTransport{memoryTransport: memoryTransport{conns: map[string]ClientConn{
+		"127.0.0.1:3001": "thrift client",
+		"127.0.0.1:3002": "raw client",
+	}}}
+	roots := x509.NewCertPool()
+	r := newTransportTestRouter(t, nil, WithTransport(transport), WithLabels(identities),
+		WithTLS(IdentityTLS("identity", certs, roots)))
+
+	client, err := r.GetClient("thrift")
+	assert.NoError(t, err)
+	assert.Equal(t, "thrift client", client)
+	if assert.Len(t, transport.configs, 1) {
+		config := transport.configs[0]
+		assert.Equal(t, "storage", config.ServerName, "expected the member to be verified for its identity")
+		assert.True(t, config.RootCAs == roots)
+		cert, err := config.GetClientCertificate(&tls.CertificateRequestInfo{})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "client", commonName(t, *cert))
+		}
+	}
+
+	_, err = r.GetClient("raw")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Equal(t, errNoIdentity, err.(*Error).Err)
+}
+
+func TestTLSDialer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeTestCert(t, dir, "client")
+	writeTestCert(t, dir, "storage")
+
+	server, err := tls.LoadX509KeyPair(filepath.Join(dir, "storage.crt"), filepath.Join(dir, "storage.key"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer l.Close()
+
+	peers := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			peers <- ""
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if tlsConn.Handshake() != nil || len(tlsConn.ConnectionState().PeerCertificates) == 0 {
+			peers <- ""
+			return
+		}
+		peers <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}()
+
+	certs, err := NewCertReloader(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), time.Minute)
+	if !assert.NoError(t, err) {
+		return
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(mustReadFile(t, filepath.Join(dir, "storage.crt")))
+	config, err := IdentityTLS("identity", certs, roots)(Destination{Labels: map[string]string{"identity": "storage"}})
+	assert.NoError(t, err)
+
+	var dialed net.Conn
+	d := &TLSDialer{
+		NewClient: func(dest string, conn net.Conn) (ClientConn, error) {
+			dialed = conn
+			return conn, nil
+		},
+		Timeout: time.Second,
+	}
+	client, err := d.DialTLS(l.Addr().String(), config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dialed.Close()
+	assert.True(t, client == ClientConn(dialed))
+	_, ok := dialed.(*tls.Conn)
+	assert.True(t, ok, "expected a TLS connection")
+	assert.Equal(t, "client", <-peers, "expected the certificate of the reloader to be presented")
+
+	// the connection is closed when no client is created on it
+	d.NewClient = func(dest string, conn net.Conn) (ClientConn, error) {
+		dialed = conn
+		return nil, errors.New("no client")
+	}
+	_, err = d.Dial(l.Addr().String())
+	assert.EqualError(t, err, "no client")
+	_, err = dialed.Write([]byte("x"))
+	assert.Error(t, err, "expected the connection to be closed")
+}
+
+func mustReadFile(t *testing.T, name string) []byte {
+	b, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "router-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "node.crt"), filepath.Join(dir, "node.key")
+	_, err = NewCertReloader(certFile, keyFile, 0)
+	assert.Error(t, err, "expected missing files to fail")
+
+	writeTestCert(t, dir, "node")
+	certs, err := NewCertReloader(certFile, keyFile, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// rotate the certificate
+	writeTestCert(t, dir, "rotated")
+	assert.NoError(t, os.Rename(filepath.Join(dir, "rotated.crt"), certFile))
+	assert.NoError(t, os.Rename(filepath.Join(dir, "rotated.key"), keyFile))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, later, later))
+
+	cert, err := certs.Certificate()
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", commonName(t, cert))
+
+	// the last certificate is kept while the files are missing
+	assert.NoError(t, os.Remove(certFile))
+	cert, err = certs.Certificate()
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", commonName(t, cert))
+}
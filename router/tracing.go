@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"github.com/dgryski/go-farm"
+	"golang.org/x/net/context"
+)
+
+// A Tracer starts the spans with which the router traces the resolution of
+// keys and the forwarding of calls. It allows plugging in OpenTracing or
+// OpenTelemetry through a small adapter, without the router depending on
+// either.
+type Tracer interface {
+	// StartSpan starts a span for operation as a child of the span in ctx,
+	// if any, and returns a context holding the new span.
+	StartSpan(ctx context.Context, operation string) (context.Context, Span)
+}
+
+// A Span is a single traced operation.
+type Span interface {
+	// SetTag sets an attribute of the span.
+	SetTag(key string, value interface{})
+
+	// Inject writes the span context into the headers of an outgoing call,
+	// so the receiving node can continue the trace.
+	Inject(headers map[string]string)
+
+	// Finish ends the span.
+	Finish()
+}
+
+// The tags set on the spans of the router.
+const (
+	TagKeyHash     = "router.key.hash"
+	TagDestination = "router.destination"
+	TagCacheHit    = "router.cache.hit"
+	TagForwarded   = "router.forwarded"
+	TagError       = "error"
+)
+
+// keyHash returns the hash of key, as it is used to place key on the ring.
+func keyHash(key string) uint32 {
+	return farm.Fingerprint32([]byte(key))
+}
+
+// traceGetClient resolves the client for key in a span started from ctx. The
+// client is resolved with the context of the span, so the work it involves
+// is parented to the span.
+func (r *router) traceGetClient(ctx context.Context, key string) (interface{}, string, error) {
+	ctx, span := r.tracer.StartSpan(ctx, "router.GetClient")
+	defer span.Finish()
+
+	span.SetTag(TagKeyHash, keyHash(r.mapKey(key)))
+	client, dest, hit, err := r.resolveClient(ctx, key)
+	if err != nil {
+		span.SetTag(TagError, err.Error())
+		return nil, "", err
+	}
+	span.SetTag(TagDestination, dest)
+	span.SetTag(TagCacheHit, hit)
+	return client, dest, nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/thrift/pingpong"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+type parentKey struct{}
+
+type recordingSpan struct {
+	sync.Mutex
+	operation string
+	parent    *recordingSpan
+	tags      map[string]interface{}
+	finished  bool
+	injected  bool
+}
+
+func (s *recordingSpan) SetTag(key string, value interface{}) {
+	s.Lock()
+	s.tags[key] = value
+	s.Unlock()
+}
+
+func (s *recordingSpan) Inject(headers map[string]string) {
+	s.Lock()
+	s.injected = true
+	s.Unlock()
+	headers["trace-operation"] = s.operation
+}
+
+func (s *recordingSpan) Finish() {
+	s.Lock()
+	s.finished = true
+	s.Unlock()
+}
+
+type recordingTracer struct {
+	sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, operation string) (context.Context, Span) {
+	parent, _ := ctx.Value(parentKey{}).(*recordingSpan)
+	span := &recordingSpan{operation: operation, parent: parent, tags: make(map[string]interface{})}
+
+	t.Lock()
+	t.spans = append(t.spans, span)
+	t.Unlock()
+	return context.WithValue(ctx, parentKey{}, span), span
+}
+
+func (t *recordingTracer) span(i int) *recordingSpan {
+	t.Lock()
+	defer t.Unlock()
+	return t.spans[i]
+}
+
+func TestTraceGetClient(t *testing.T) {
+	tracer := &recordingTracer{}
+	r := newTestRouter(t, WithTracer(tracer))
+
+	r.GetClient("remote")
+	r.GetClient("remote")
+	r.GetClient("error")
+
+	miss, hit, failed := tracer.span(0), tracer.span(1), tracer.span(2)
+	assert.Equal(t, "router.GetClient", miss.operation)
+	assert.True(t, miss.finished)
+	assert.Nil(t, miss.parent)
+	assert.Equal(t, keyHash("remote"), miss.tags[TagKeyHash])
+	assert.Equal(t, "127.0.0.1:3001", miss.tags[TagDestination])
+	assert.Equal(t, false, miss.tags[TagCacheHit])
+	assert.Equal(t, true, hit.tags[TagCacheHit])
+	assert.Equal(t, "ringpop not ready", failed.tags[TagError])
+}
+
+func TestTraceGetClientContext(t *testing.T) {
+	tracer := &recordingTracer{}
+	r := newTestRouter(t, WithTracer(tracer))
+
+	ctx, parent := tracer.StartSpan(context.Background(), "request")
+	_, err := r.GetClientContext(ctx, "local")
+	assert.NoError(t, err)
+
+	span := tracer.span(1)
+	assert.Equal(t, parent, span.parent)
+	assert.Equal(t, "127.0.0.1:3000", span.tags[TagDestination])
+}
+
+func TestTraceForward(t *testing.T) {
+	nodes := newForwardingNodes(t, 2)
+	defer closeForwardingNodes(nodes)
+
+	tracer := &recordingTracer{}
+	fs := NewForwardingServer(nodes[0].ringpop, nodes[0].channel, pingpong.NewTChanPingPongServer(nodes[0].handler), pingKey, WithForwardingTracer(tracer))
+
+	ctx, cancel := thrift.NewContext(time.Second)
+	defer cancel()
+
+	// calls the server of node 0 directly, which forwards to node 1
+	client := pingpong.NewTChanPingPongClient(&loopbackClient{server: fs})
+	_, err := client.Ping(ctx, &pingpong.Ping{Key: "1"})
+	assert.NoError(t, err)
+
+	span := tracer.span(0)
+	assert.Equal(t, "router.Forward", span.operation)
+	assert.Equal(t, nodes[1].channel.PeerInfo().HostPort, span.tags[TagDestination])
+	assert.Equal(t, keyHash("1"), span.tags[TagKeyHash])
+	assert.True(t, span.finished)
+	assert.True(t, span.injected, "expected the span to be injected into the forwarded call")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&nodes[1].handler.calls))
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// errNoTransport is the cause of the ErrClientCreation errors returned for
+// remote destinations of a router that has neither a channel nor a Transport.
+var errNoTransport = errors.New("no transport to reach remote destinations")
+
+// A Transport connects the router to remote destinations. The router uses a
+// TChannelTransport on the channel it is created with unless another Transport
+// is configured with WithTransport, which allows remote calls to be made over
+// gRPC, HTTP/2 or, in tests, in memory, without a TChannel channel.
+type Transport interface {
+	// Dial returns the connection to the remote destination dest. It is
+	// called once for every client the router creates for dest. An error is
+	// returned from GetClient as an Error of kind ErrClientCreation and
+	// nothing is cached.
+	Dial(dest string) (ClientConn, error)
+}
+
+// A ClientConn is a connection to a remote destination returned by a
+// Transport. A connection that implements thrift.TChanClient is covered by
+// the circuit breaker, the call limit and the interceptors of the router and
+// handed to the ClientFactory to create the client of the destination. A
+// CodecClient is handed to the factory when it is a CodecClientFactory. Any
+// other connection is the client of the destination itself. If the client
+// implements io.Closer it is closed when it is evicted from the cache.
+type ClientConn interface{}
+
+// A Pinger is a Transport that can check whether a destination is reachable
+// without making a call. The health check and the warm up of destinations
+// only ping through transports that implement Pinger, see WithHealthCheck and
+// WithWarmUp.
+type Pinger interface {
+	Ping(ctx context.Context, dest string) error
+}
+
+// An AddressTranslator returns the address remote clients dial to reach the
+// member of the ring at memberAddress, eg. the address a node advertises
+// behind a NAT or a Kubernetes service, see WithAddressTranslator.
+type AddressTranslator func(memberAddress string) (dialAddress string)
+
+// dialAddress returns the address the Transport dials to reach member.
+// Everything else, the cache, the membership changes and the stats, refers
+// to members by their address in the ring.
+func (r *router) dialAddress(member string) string {
+	if r.addressTranslator == nil {
+		return member
+	}
+	return r.addressTranslator(member)
+}
+
+// TChannelTransport is the Transport that makes Thrift calls to remote
+// destinations over a TChannel channel.
+type TChannelTransport struct {
+	// Channel is the channel the calls are made on.
+	Channel *tchannel.Channel
+
+	// Service is the name of the service that is called, the service of
+	// Channel when empty.
+	Service string
+
+	// ClientOptions returns the options of the client for a destination,
+	// see WithClientOptions. Nil makes the clients only set the HostPort.
+	ClientOptions ClientOptionsProvider
+}
+
+// Dial returns a thrift.TChanClient that calls dest.
+func (t *TChannelTransport) Dial(dest string) (ClientConn, error) {
+	service := t.Service
+	if service == "" {
+		service = t.Channel.ServiceName()
+	}
+	return thrift.NewClient(t.Channel, service, hostPortOptions(t.ClientOptions, dest)), nil
+}
+
+// Ping pings dest over the channel.
+func (t *TChannelTransport) Ping(ctx context.Context, dest string) error {
+	return t.Channel.Ping(ctx, dest)
+}
+
+// Dial calls d, which makes every RemoteDialer a Transport.
+func (d RemoteDialer) Dial(dest string) (ClientConn, error) {
+	return d(dest)
+}
+
+// hostPortOptions returns a copy of the options returned by p for dest, with
+// the HostPort set to dest when p sets none. The options of p are copied so a
+// provider may return the same options for every destination.
+func hostPortOptions(p ClientOptionsProvider, dest string) *thrift.ClientOptions {
+	var opts thrift.ClientOptions
+	if p != nil {
+		if provided := p(dest); provided != nil {
+			opts = *provided
+		}
+	}
+	if opts.HostPort == "" {
+		opts.HostPort = dest
+	}
+	return &opts
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+	"golang.org/x/net/context"
+)
+
+// memoryTransport is an in-memory Transport that dials the connections of
+// conns and records the destinations it dials and pings.
+type memoryTransport struct {
+	sync.Mutex
+	conns   map[string]ClientConn
+	dialed  []string
+	pinged  []string
+	pingErr error
+	closed  []string
+}
+
+func (t *memoryTransport) Dial(dest string) (ClientConn, error) {
+	t.Lock()
+	defer t.Unlock()
+	t.dialed = append(t.dialed, dest)
+	conn, ok := t.conns[dest]
+	if !ok {
+		return nil, errors.New("unknown destination")
+	}
+	return conn, nil
+}
+
+func (t *memoryTransport) Ping(ctx context.Context, dest string) error {
+	t.Lock()
+	defer t.Unlock()
+	t.pinged = append(t.pinged, dest)
+	return t.pingErr
+}
+
+func (t *memoryTransport) CloseConnections(dest string) error {
+	t.Lock()
+	defer t.Unlock()
+	t.closed = append(t.closed, dest)
+	return nil
+}
+
+func newTransportTestRouter(t *testing.T, ch *tchannel.Channel, opts ...Option) *router {
+	rp := newTestRingpop(testLookups{
+		"thrift":  "127.0.0.1:3001",
+		"raw":     "127.0.0.1:3002",
+		"unknown": "127.0.0.1:3003",
+	})
+	return newChannelTestRouter(rp, ch, append([]Option{withFactory(tchanClientFactory{})}, opts...)...)
+}
+
+func TestTransportConnections(t *testing.T) {
+	conn := &stubTChanClient{}
+	transport := &memoryTransport{conns: map[string]ClientConn{
+		"127.0.0.1:3001": conn,
+		"127.0.0.1:3002": "raw client",
+	}}
+	r := newTransportTestRouter(t, nil, WithTransport(transport))
+
+	// thrift connections are handed to the ClientFactory
+	client, err := r.GetClient("thrift")
+	assert.NoError(t, err)
+	assert.True(t, client == thrift.TChanClient(conn), "expected the connection to be passed to the factory")
+
+	// other connections are the client
+	client, err = r.GetClient("raw")
+	assert.NoError(t, err)
+	assert.Equal(t, "raw client", client)
+
+	client, err = r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+
+	_, err = r.GetClient("unknown")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, transport.dialed)
+}
+
+func TestTransportConnectionsAreWrapped(t *testing.T) {
+	conn := &stubTChanClient{err: errors.New("connection reset")}
+	transport := &memoryTransport{conns: map[string]ClientConn{"127.0.0.1:3001": conn}}
+	r := newTransportTestRouter(t, nil, WithTransport(transport), WithCircuitBreaker(1, time.Minute))
+
+	client, err := r.GetClient("thrift")
+	assert.NoError(t, err)
+	_, ok := client.(*breakerClient)
+	assert.True(t, ok, "expected the connection to be covered by the circuit breaker")
+}
+
+func TestNoTransport(t *testing.T) {
+	r := newTransportTestRouter(t, nil)
+	assert.Nil(t, r.transport)
+
+	_, err := r.GetClient("thrift")
+	assert.Equal(t, ErrClientCreation, KindOf(err))
+	assert.Equal(t, errNoTransport, err.(*Error).Err)
+
+	client, err := r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+}
+
+func TestTChannelTransportIsTheDefault(t *testing.T) {
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	r := newTransportTestRouter(t, ch)
+	transport, ok := r.transport.(*TChannelTransport)
+	if assert.True(t, ok, "expected a TChannelTransport") {
+		assert.True(t, transport.Channel == ch)
+		assert.Equal(t, "remote", transport.Service)
+	}
+
+	client, err := r.GetClient("thrift")
+	assert.NoError(t, err)
+	_, ok = client.(thrift.TChanClient)
+	assert.True(t, ok, "expected a TChannel client")
+}
+
+func TestWithService(t *testing.T) {
+	ch, err := tchannel.NewChannel("api", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	r := newTransportTestRouter(t, ch, WithService("geo-sharded-storage"))
+	transport, ok := r.transport.(*TChannelTransport)
+	if assert.True(t, ok, "expected a TChannelTransport") {
+		assert.Equal(t, "geo-sharded-storage", transport.Service)
+	}
+
+	_, err = r.GetClient("thrift")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3001"}, r.cache.keys(), "expected clients to be cached per destination")
+}
+
+func TestTChannelTransport(t *testing.T) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+
+	ch, err := tchannel.NewChannel("client", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	transport := &TChannelTransport{Channel: ch}
+	conn, err := transport.Dial(server.PeerInfo().HostPort)
+	assert.NoError(t, err)
+	_, ok := conn.(thrift.TChanClient)
+	assert.True(t, ok, "expected a TChannel client")
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	assert.NoError(t, transport.Ping(ctx, server.PeerInfo().HostPort))
+}
+
+func TestHealthCheckPingsThroughTransport(t *testing.T) {
+	transport := &memoryTransport{
+		conns:   map[string]ClientConn{"127.0.0.1:3002": "raw client"},
+		pingErr: errors.New("unreachable"),
+	}
+	r := newTransportTestRouter(t, nil, WithTransport(transport), WithHealthCheck(time.Minute, 0))
+	defer r.Close(context.Background())
+	assert.NotNil(t, r.healthStop)
+
+	_, err := r.GetClient("raw")
+	assert.NoError(t, err)
+
+	r.healthCheck()
+	assert.Equal(t, []string{"127.0.0.1:3002"}, transport.pinged)
+	assert.Equal(t, 0, r.cache.len(), "expected the client of the unreachable destination to be evicted")
+}
+
+func TestWithAddressTranslator(t *testing.T) {
+	transport := &memoryTransport{conns: map[string]ClientConn{
+		"10.0.0.2:4002": "raw client",
+	}}
+	translate := func(member string) string {
+		return map[string]string{"127.0.0.1:3002": "10.0.0.2:4002"}[member]
+	}
+	r := newTransportTestRouter(t, nil, WithTransport(transport), WithAddressTranslator(translate))
+	defer r.Close(context.Background())
+
+	client, err := r.GetClient("raw")
+	assert.NoError(t, err)
+	assert.Equal(t, "raw client", client)
+	assert.Equal(t, []string{"10.0.0.2:4002"}, transport.dialed, "expected the translated address to be dialed")
+	assert.Equal(t, []string{"127.0.0.1:3002"}, r.cache.keys(), "expected the client to be cached by member address")
+
+	r.healthCheck()
+	assert.Equal(t, []string{"10.0.0.2:4002"}, transport.pinged)
+	assert.Equal(t, 1, r.cache.len())
+}
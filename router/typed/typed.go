@@ -0,0 +1,128 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package typed
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/uber/ringpop-go"
+	"github.com/uber/ringpop-go/router"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+// A ClientFactory is the type safe version of router.ClientFactory. Both the
+// local and the remote clients are of type T, which is typically the
+// TChan[Service] interface generated by thrift-gen.
+type ClientFactory[T any] interface {
+	GetLocalClient() T
+	MakeRemoteClient(client thrift.TChanClient) T
+}
+
+// A Router is the type safe version of router.Router.
+type Router[T any] interface {
+	GetClient(key string) (T, error)
+	GetClientN(key string, n int) ([]T, error)
+	Dispatch(key string, fn func(client T) error) error
+
+	// Untyped returns the underlying router for the functionality that is
+	// not wrapped by this package.
+	Untyped() router.Router
+}
+
+// New creates a Router of which the clients are created by f. See
+// router.New for a description of the arguments.
+func New[T any](rp ringpop.Interface, f ClientFactory[T], ch *tchannel.Channel, opts ...router.Option) Router[T] {
+	return &typedRouter[T]{
+		r: router.New(rp, factory[T]{f}, ch, opts...),
+	}
+}
+
+// factory adapts a typed ClientFactory to a router.ClientFactory.
+type factory[T any] struct {
+	f ClientFactory[T]
+}
+
+func (f factory[T]) GetLocalClient() interface{} {
+	return f.f.GetLocalClient()
+}
+
+func (f factory[T]) MakeRemoteClient(client thrift.TChanClient) interface{} {
+	return f.f.MakeRemoteClient(client)
+}
+
+type typedRouter[T any] struct {
+	r router.Router
+}
+
+// cast converts a client created by the typed factory back to T. A nil
+// client, eg. one the factory returned as a nil interface, is the zero value
+// of T; clients of another type, eg. ones replaced by an option of the
+// router, fail with an error naming their type.
+func cast[T any](client interface{}) (T, error) {
+	typed, ok := client.(T)
+	if !ok && client != nil {
+		return typed, fmt.Errorf("typed: client of type %T is not a %v", client, reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return typed, nil
+}
+
+func (t *typedRouter[T]) GetClient(key string) (T, error) {
+	client, err := t.r.GetClient(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return cast[T](client)
+}
+
+func (t *typedRouter[T]) GetClientN(key string, n int) ([]T, error) {
+	clients, err := t.r.GetClientN(key, n)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make([]T, len(clients))
+	for i, client := range clients {
+		if typed[i], err = cast[T](client); err != nil {
+			return nil, err
+		}
+	}
+	return typed, nil
+}
+
+func (t *typedRouter[T]) Dispatch(key string, fn func(client T) error) error {
+	return t.r.Dispatch(key, func(client interface{}) error {
+		typed, err := cast[T](client)
+		if err != nil {
+			return err
+		}
+		return fn(typed)
+	})
+}
+
+func (t *typedRouter[T]) Untyped() router.Router {
+	return t.r
+}
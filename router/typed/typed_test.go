@@ -0,0 +1,121 @@
+//go:build go1.18
+// +build go1.18
+
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package typed
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/tchannel-go"
+	"github.com/uber/tchannel-go/thrift"
+)
+
+type echoClient interface {
+	Echo() string
+}
+
+type echo string
+
+func (e echo) Echo() string { return string(e) }
+
+type echoFactory struct{}
+
+func (echoFactory) GetLocalClient() echoClient {
+	return echo("local")
+}
+
+func (echoFactory) MakeRemoteClient(client thrift.TChanClient) echoClient {
+	return echo("remote")
+}
+
+func newTestRouter(t *testing.T) Router[echoClient] {
+	rp := &mocks.Ringpop{}
+	rp.On("RegisterListener", mock.Anything).Return()
+	rp.On("WhoAmI").Return("127.0.0.1:3000", nil)
+	rp.On("Lookup", "local").Return("127.0.0.1:3000", nil)
+	rp.On("Lookup", "remote").Return("127.0.0.1:3001", nil)
+	rp.On("Lookup", "error").Return("", errors.New("ringpop not ready"))
+	rp.On("LookupN", "replicated", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3000"}, nil)
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+
+	return New[echoClient](rp, echoFactory{}, ch)
+}
+
+func TestGetClient(t *testing.T) {
+	r := newTestRouter(t)
+
+	client, err := r.GetClient("local")
+	assert.NoError(t, err)
+	assert.Equal(t, "local", client.Echo())
+
+	client, err = r.GetClient("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote", client.Echo())
+}
+
+func TestGetClientError(t *testing.T) {
+	r := newTestRouter(t)
+
+	client, err := r.GetClient("error")
+	assert.EqualError(t, err, "ringpop not ready")
+	assert.Nil(t, client)
+}
+
+func TestGetClientN(t *testing.T) {
+	r := newTestRouter(t)
+
+	clients, err := r.GetClientN("replicated", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []echoClient{echo("remote"), echo("local")}, clients)
+}
+
+func TestDispatch(t *testing.T) {
+	r := newTestRouter(t)
+
+	var got string
+	err := r.Dispatch("remote", func(client echoClient) error {
+		got = client.Echo()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "remote", got)
+}
+
+func TestCast(t *testing.T) {
+	client, err := cast[echoClient](echo("remote"))
+	assert.NoError(t, err)
+	assert.Equal(t, echo("remote"), client)
+
+	client, err = cast[echoClient](nil)
+	assert.NoError(t, err, "expected nil clients to be the zero value")
+	assert.Nil(t, client)
+
+	_, err = cast[echoClient]("not an echo client")
+	assert.EqualError(t, err, "typed: client of type string is not a typed.echoClient")
+}
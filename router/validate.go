@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"time"
+
+	"github.com/uber-common/bark"
+)
+
+// DestinationFallback tells what the router does when ringpop resolves a key
+// to an invalid destination, see WithDestinationValidation.
+type DestinationFallback int
+
+const (
+	// FailInvalid fails the lookup with an error of kind ErrLookupFailed
+	// whose underlying error is ErrInvalidDestination.
+	FailInvalid DestinationFallback = iota
+
+	// RetryInvalid looks the key up again, in case the ring settled in the
+	// meantime, and fails like FailInvalid when the destination is still
+	// invalid.
+	RetryInvalid
+
+	// RouteInvalidToSelf routes the key to the local node.
+	RouteInvalidToSelf
+)
+
+// invalidLookupRetries is the number of times a key that resolved to an
+// invalid destination is looked up again with RetryInvalid, waiting
+// invalidLookupBackoff before every retry for the ring to settle.
+const (
+	invalidLookupRetries = 2
+	invalidLookupBackoff = 10 * time.Millisecond
+)
+
+// checkDestination returns dest when it is a valid destination for key, or
+// otherwise the destination the fallback of the router decides on. Keys are
+// looked up again with selectDest. Every invalid destination is counted, but
+// a lookup is only logged once, when its fallback applies.
+func (r *router) checkDestination(key, dest string, selectDest func(key string) (string, error)) (string, error) {
+	retries := 0
+	if r.destFallback == RetryInvalid {
+		retries = invalidLookupRetries
+	}
+
+	for i := 0; !r.validDestination(dest); i++ {
+		r.statter.IncCounter("router.lookup.invalid", nil, 1)
+		if i < retries {
+			r.clock.Sleep(invalidLookupBackoff)
+			var err error
+			if dest, err = selectDest(key); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		r.logger.WithFields(bark.Fields{
+			"dest":    dest,
+			"retries": i,
+		}).Warn("router looked up an invalid destination")
+		if r.destFallback == RouteInvalidToSelf {
+			return r.whoAmI()
+		}
+		return "", ErrInvalidDestination
+	}
+	return dest, nil
+}
+
+// checkDestinations returns the valid destinations of dests, and
+// ErrInvalidDestination when none is.
+func (r *router) checkDestinations(dests []string) ([]string, error) {
+	valid := make([]string, 0, len(dests))
+	for _, dest := range dests {
+		if r.validDestination(dest) {
+			valid = append(valid, dest)
+		} else {
+			r.statter.IncCounter("router.lookup.invalid", nil, 1)
+		}
+	}
+	if len(valid) == 0 && len(dests) > 0 {
+		return nil, ErrInvalidDestination
+	}
+	return valid, nil
+}
+
+// validDestination returns whether dest is not empty and, when enabled with
+// WithDestinationValidation, a reachable member of the ring, as listed in the
+// snapshot of its members, see memberSnapshot. Destinations are taken as valid
+// when the members cannot be listed.
+func (r *router) validDestination(dest string) bool {
+	if dest == "" {
+		return false
+	}
+	if !r.validateMembers {
+		return true
+	}
+	snapshot, err := r.memberSnapshot()
+	if err != nil {
+		return true
+	}
+	return snapshot.reachable[dest]
+}
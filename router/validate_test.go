@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/mocks"
+	"golang.org/x/net/context"
+)
+
+func newValidationTestRouter(t *testing.T, opts ...Option) (*router, *mocks.Ringpop) {
+	rp := newTestRingpop(testLookups{
+		"empty": "",
+		"gone":  "127.0.0.1:3009",
+	})
+	rp.On("LookupN", "gone", 2).Return([]string{"127.0.0.1:3009", "127.0.0.1:3001"}, nil)
+	rp.On("GetReachableMembers").Return([]string{"127.0.0.1:3000", "127.0.0.1:3001"}, nil)
+	rp.On("Checksum").Return(uint32(1), nil)
+	return newChannelTestRouter(rp, nil, append([]Option{withFactory(tchanClientFactory{})}, opts...)...), rp
+}
+
+func TestEmptyDestination(t *testing.T) {
+	r, _ := newValidationTestRouter(t)
+
+	_, err := r.GetClient("empty")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+	assert.Equal(t, ErrInvalidDestination, err.(*Error).Err)
+	assert.Equal(t, 0, r.cache.len(), "expected no client for an empty address")
+
+	// destinations are not checked against the members by default
+	dest, err := r.lookup("gone")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3009", dest)
+}
+
+func TestDestinationValidation(t *testing.T) {
+	r, rp := newValidationTestRouter(t, WithDestinationValidation(FailInvalid))
+
+	_, err := r.lookup("gone")
+	assert.Equal(t, ErrLookupFailed, KindOf(err))
+	assert.Equal(t, ErrInvalidDestination, err.(*Error).Err)
+
+	dest, err := r.lookup("remote")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", dest)
+
+	dests, err := r.lookupN(context.Background(), "gone", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:3001"}, dests, "expected the invalid replicas to be left out")
+	rp.AssertNumberOfCalls(t, "GetReachableMembers", 1)
+}
+
+func TestDestinationValidationRetry(t *testing.T) {
+	r, rp := newValidationTestRouter(t, WithDestinationValidation(RetryInvalid))
+
+	_, err := r.lookup("empty")
+	assert.Equal(t, ErrInvalidDestination, err.(*Error).Err)
+	rp.AssertNumberOfCalls(t, "Lookup", 1+invalidLookupRetries)
+}
+
+func TestDestinationValidationRouteToSelf(t *testing.T) {
+	r, _ := newValidationTestRouter(t, WithDestinationValidation(RouteInvalidToSelf))
+
+	dest, err := r.lookup("empty")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3000", dest)
+
+	client, err := r.GetClient("gone")
+	assert.NoError(t, err)
+	assert.Equal(t, "local client", client)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel-go"
+)
+
+// warmUp creates the client for dest, which just joined the ring, and opens
+// its TChannel connection when warm-up is enabled and dest is one of the
+// members to warm up, see WithWarmUp.
+func (r *router) warmUp(dest string) {
+	if !r.warmUpEnabled {
+		return
+	}
+
+	me, err := r.whoAmI()
+	if err != nil || r.sameDest(dest, me) || !r.warmUpCandidate(me, dest) {
+		return
+	}
+
+	r.warmDest(dest, r.warmUpTimeout)
+}
+
+// warmDest creates the client for dest and opens its connection with a ping,
+// waiting at most timeout for the connection.
+func (r *router) warmDest(dest string, timeout time.Duration) {
+	if _, err := r.getClientForDest(dest); err != nil {
+		r.statter.IncCounter("router.warmup.error", nil, 1)
+		return
+	}
+
+	// connections of transports that cannot ping are managed by the transport
+	if p, ok := r.transport.(Pinger); ok {
+		ctx, cancel := tchannel.NewContext(timeout)
+		err := p.Ping(ctx, r.dialAddress(dest))
+		cancel()
+		if err != nil {
+			r.statter.IncCounter("router.warmup.error", nil, 1)
+			return
+		}
+	}
+	r.statter.IncCounter("router.warmup", nil, 1)
+}
+
+// ResolveAndWarm resolves keys and, in the background, creates the clients
+// of their remote destinations and opens their connections without
+// making calls, eg. before a scheduled burst of calls. Every destination is
+// warmed once, concurrently with the others. The returned channel is closed
+// once all destinations are warm; failures are counted by the
+// router.warmup.error counter and leave the destination to be connected on
+// its first call.
+func (r *router) ResolveAndWarm(keys []string) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		me, err := r.whoAmI()
+		if err != nil {
+			r.statter.IncCounter("router.warmup.error", nil, 1)
+			return
+		}
+
+		timeout := r.warmUpTimeout
+		if timeout <= 0 {
+			timeout = defaultWarmUpTimeout
+		}
+
+		warmed := make(map[string]bool)
+		var wg sync.WaitGroup
+		for _, key := range keys {
+			dest, err := r.lookup(key)
+			if err != nil {
+				r.statter.IncCounter("router.warmup.error", nil, 1)
+				continue
+			}
+			if r.sameDest(dest, me) || warmed[dest] {
+				continue
+			}
+			warmed[dest] = true
+
+			wg.Add(1)
+			go func(dest string) {
+				defer wg.Done()
+				r.warmDest(dest, timeout)
+			}(dest)
+		}
+		wg.Wait()
+	}()
+	return done
+}
+
+// warmUpCandidate returns whether dest is to be warmed up, which holds for
+// every member unless warm-up is limited to the members nearest to the local
+// node me.
+func (r *router) warmUpCandidate(me, dest string) bool {
+	if r.warmUpNearest <= 0 {
+		return true
+	}
+
+	// the local node is part of the result
+	nearest, err := r.ringpop.LookupN(me, r.warmUpNearest+1)
+	if err != nil {
+		return false
+	}
+	for _, member := range nearest {
+		if r.sameDest(member, dest) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultWarmUpTimeout bounds the time spent connecting to a member during
+// warm-up when no timeout is configured.
+const defaultWarmUpTimeout = time.Second
@@ -0,0 +1,130 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/swim"
+	"github.com/uber/ringpop-go/test/mocks"
+	"github.com/uber/tchannel-go"
+)
+
+func newWarmUpTestRouter(t *testing.T, opts ...Option) (Router, *[]string) {
+	rp := newTestRingpop(nil)
+	rp.On("LookupN", "127.0.0.1:3000", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3000"}, nil)
+
+	var dialed []string
+	dialer := func(dest string) (interface{}, error) {
+		dialed = append(dialed, dest)
+		return dest, nil
+	}
+	return newRingpopTestRouter(t, rp, append(opts, WithRemoteDialer(dialer))...), &dialed
+}
+
+func alive(r Router, address string) {
+	r.ReconcileChange(swim.Change{Address: address, Status: swim.Alive, Incarnation: 1})
+}
+
+func TestWarmUpDisabledByDefault(t *testing.T) {
+	r, dialed := newWarmUpTestRouter(t)
+	alive(r, "127.0.0.1:3001")
+	assert.Empty(t, *dialed)
+}
+
+func TestWarmUpAllMembers(t *testing.T) {
+	r, dialed := newWarmUpTestRouter(t, WithWarmUp(0, 0))
+	alive(r, "127.0.0.1:3000")
+	alive(r, "127.0.0.1:3001")
+	alive(r, "127.0.0.1:3002")
+	r.ReconcileChange(swim.Change{Address: "127.0.0.1:3003", Status: swim.Suspect, Incarnation: 1})
+
+	assert.Equal(t, []string{"127.0.0.1:3001", "127.0.0.1:3002"}, *dialed)
+}
+
+func TestWarmUpNearestMembers(t *testing.T) {
+	r, dialed := newWarmUpTestRouter(t, WithWarmUp(1, 0))
+	alive(r, "127.0.0.1:3001")
+	alive(r, "127.0.0.1:3002")
+
+	assert.Equal(t, []string{"127.0.0.1:3001"}, *dialed)
+}
+
+func TestWarmUpConnects(t *testing.T) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	cf := &mocks.ClientFactory{}
+	cf.On("MakeRemoteClient", mock.Anything).Return("remote client")
+
+	rp := newTestRingpop(nil)
+
+	statter := &mocks.StatsReporter{}
+	statter.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	r := New(rp, cf, ch, WithWarmUp(0, time.Second), WithStatsReporter(statter))
+	alive(r, server.PeerInfo().HostPort)
+
+	cf.AssertNumberOfCalls(t, "MakeRemoteClient", 1)
+	statter.AssertCalled(t, "IncCounter", "router.warmup", mock.Anything, int64(1))
+	statter.AssertNotCalled(t, "IncCounter", "router.warmup.error", mock.Anything, mock.Anything)
+}
+
+func TestResolveAndWarm(t *testing.T) {
+	server, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+
+	ch, err := tchannel.NewChannel("remote", nil)
+	assert.NoError(t, err)
+	defer ch.Close()
+
+	cf := &mocks.ClientFactory{}
+	cf.On("MakeRemoteClient", mock.Anything).Return("remote client")
+
+	rp := newTestRingpop(testLookups{
+		"unreachable": "127.0.0.1:1",
+	})
+	rp.On("Lookup", "a").Return(server.PeerInfo().HostPort, nil)
+	rp.On("Lookup", "b").Return(server.PeerInfo().HostPort, nil)
+
+	statter := &mocks.StatsReporter{}
+	statter.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	statter.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	r := New(rp, cf, ch, WithStatsReporter(statter)).(*router)
+	<-r.ResolveAndWarm([]string{"local", "a", "b", "unreachable"})
+
+	assert.Len(t, r.cache.keys(), 2, "expected the clients of both remote destinations")
+	cf.AssertNumberOfCalls(t, "MakeRemoteClient", 2)
+	statter.AssertCalled(t, "IncCounter", "router.warmup", mock.Anything, int64(1))
+	statter.AssertCalled(t, "IncCounter", "router.warmup.error", mock.Anything, int64(1))
+}
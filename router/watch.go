@@ -0,0 +1,186 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "sync"
+
+// A ReplicaSetChange is sent by WatchKey when the owner or the replica set of
+// a key changed. Replicas are the nodes responsible for the key in order of
+// preference, the first being its owner, see WithWatchReplicas. The previous
+// owner and replicas are empty when the key could not be resolved before.
+type ReplicaSetChange struct {
+	Key string
+
+	Owner, PreviousOwner       string
+	Replicas, PreviousReplicas []string
+}
+
+// keyWatch is a watch of WatchKey. mu serializes the evaluations of the
+// replica set and the sends on ch, which has room for a single change.
+type keyWatch struct {
+	key string
+
+	mu       sync.Mutex
+	replicas []string
+	ch       chan ReplicaSetChange
+	closed   bool
+}
+
+// WatchKey returns a channel that is sent a ReplicaSetChange every time the
+// ring changes the owner or the replica set of key, and the function that
+// ends the watch and closes the channel. The replica set of key when WatchKey
+// is called is the baseline for the first change. Changes are not queued: when
+// the last change was not received yet it is replaced by one from its
+// previous replica set to the current one. Watches end when the router is
+// closed.
+func (r *router) WatchKey(key string) (<-chan ReplicaSetChange, func()) {
+	w := &keyWatch{
+		key: key,
+		ch:  make(chan ReplicaSetChange, 1),
+	}
+	w.replicas, _ = r.watchedReplicas(key)
+
+	r.watchesMu.Lock()
+	if r.closed() {
+		r.watchesMu.Unlock()
+		close(w.ch)
+		return w.ch, func() {}
+	}
+	r.watches[w] = struct{}{}
+	r.watchesMu.Unlock()
+
+	return w.ch, func() {
+		r.watchesMu.Lock()
+		delete(r.watches, w)
+		r.watchesMu.Unlock()
+		w.close()
+	}
+}
+
+// watchedReplicas returns the replica set of key on the ring, see
+// WithWatchReplicas. Unlike the lookups that route calls it does not apply
+// pins, nor records stats, audit records or LookupFailedEvents, so watches do
+// not add to them on every ring change.
+func (r *router) watchedReplicas(key string) ([]string, error) {
+	mapped := r.mapKey(key)
+	if r.watchReplicas > 1 {
+		return r.resolveKeyN(mapped, r.watchReplicas)
+	}
+	dest, err := r.resolveKey(mapped)
+	if err != nil {
+		return nil, err
+	}
+	return []string{dest}, nil
+}
+
+// reconcileWatches resolves the replica set of every watched key again and
+// notifies the watches of which it changed.
+func (r *router) reconcileWatches() {
+	r.watchesMu.Lock()
+	watches := make([]*keyWatch, 0, len(r.watches))
+	for w := range r.watches {
+		watches = append(watches, w)
+	}
+	r.watchesMu.Unlock()
+
+	for _, w := range watches {
+		replicas, err := r.watchedReplicas(w.key)
+		if err != nil {
+			r.logger.WithField("key", w.key).Debug("router failed to resolve watched key")
+			continue
+		}
+		if w.update(replicas) {
+			r.statter.IncCounter("router.watch.changed", nil, 1)
+		}
+	}
+}
+
+// closeWatches ends all watches, when the router is closed.
+func (r *router) closeWatches() {
+	r.watchesMu.Lock()
+	watches := r.watches
+	r.watches = make(map[*keyWatch]struct{})
+	r.watchesMu.Unlock()
+
+	for w := range watches {
+		w.close()
+	}
+}
+
+// update records replicas as the replica set of the key and sends the change
+// when it differs from the previous one, which it returns.
+func (w *keyWatch) update(replicas []string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || equalStrings(w.replicas, replicas) {
+		return false
+	}
+	change := ReplicaSetChange{
+		Key:              w.key,
+		Owner:            firstReplica(replicas),
+		PreviousOwner:    firstReplica(w.replicas),
+		Replicas:         replicas,
+		PreviousReplicas: w.replicas,
+	}
+	w.replicas = replicas
+
+	// replace the change that was not received yet
+	select {
+	case pending := <-w.ch:
+		change.PreviousOwner, change.PreviousReplicas = pending.PreviousOwner, pending.PreviousReplicas
+	default:
+	}
+	if equalStrings(change.PreviousReplicas, replicas) {
+		return true
+	}
+	w.ch <- change
+	return true
+}
+
+func (w *keyWatch) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.ch)
+	}
+}
+
+func firstReplica(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/events"
+	"golang.org/x/net/context"
+)
+
+func TestWatchKey(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp)
+	rp.On("Lookup", "k").Return("127.0.0.1:3001", nil).Twice()
+	rp.On("Lookup", "k").Return("127.0.0.1:3002", nil)
+
+	changes, cancel := r.WatchKey("k")
+
+	// the ring changed without moving k
+	r.HandleEvent(events.RingChangedEvent{})
+	assert.Len(t, changes, 0)
+
+	r.HandleEvent(events.RingChangedEvent{})
+	assert.Equal(t, ReplicaSetChange{
+		Key:              "k",
+		Owner:            "127.0.0.1:3002",
+		PreviousOwner:    "127.0.0.1:3001",
+		Replicas:         []string{"127.0.0.1:3002"},
+		PreviousReplicas: []string{"127.0.0.1:3001"},
+	}, <-changes)
+
+	assert.Equal(t, int64(0), r.Stats().Lookups, "expected watches not to count as lookups")
+
+	cancel()
+	_, ok := <-changes
+	assert.False(t, ok, "expected the channel to be closed")
+	assert.Empty(t, r.watches)
+	cancel()
+}
+
+func TestWatchKeyIgnoresPins(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp)
+	rp.On("Lookup", "k").Return("127.0.0.1:3001", nil)
+
+	changes, cancel := r.WatchKey("k")
+	defer cancel()
+
+	r.Pin("k", "127.0.0.1:3005")
+	r.HandleEvent(events.RingChangedEvent{})
+	assert.Len(t, changes, 0, "expected the replica set on the ring")
+}
+
+func TestWatchKeyReplacesPendingChanges(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp, WithWatchReplicas(2))
+	rp.On("LookupN", "k", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, nil).Once()
+	rp.On("LookupN", "k", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3003"}, nil).Once()
+	rp.On("LookupN", "k", 2).Return([]string{"127.0.0.1:3004", "127.0.0.1:3001"}, nil).Once()
+	rp.On("LookupN", "k", 2).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002"}, nil).Once()
+	rp.On("LookupN", "k", 2).Return([]string{"127.0.0.1:3004", "127.0.0.1:3001"}, nil).Once()
+
+	changes, cancel := r.WatchKey("k")
+	defer cancel()
+
+	r.HandleEvent(events.RingChangedEvent{})
+	r.HandleEvent(events.RingChangedEvent{})
+	assert.Equal(t, ReplicaSetChange{
+		Key:              "k",
+		Owner:            "127.0.0.1:3004",
+		PreviousOwner:    "127.0.0.1:3001",
+		Replicas:         []string{"127.0.0.1:3004", "127.0.0.1:3001"},
+		PreviousReplicas: []string{"127.0.0.1:3001", "127.0.0.1:3002"},
+	}, <-changes, "expected the pending change to be replaced")
+
+	// changes back to the replica set last received leave nothing to send
+	r.HandleEvent(events.RingChangedEvent{})
+	r.HandleEvent(events.RingChangedEvent{})
+	assert.Len(t, changes, 0)
+}
+
+func TestCloseEndsWatches(t *testing.T) {
+	rp := newTestRingpop(nil)
+	r := newRingpopTestRouter(t, rp)
+	rp.On("Lookup", "k").Return("127.0.0.1:3001", nil)
+
+	changes, _ := r.WatchKey("k")
+	assert.NoError(t, r.Close(context.Background()))
+	_, ok := <-changes
+	assert.False(t, ok, "expected the channel to be closed")
+
+	changes, _ = r.WatchKey("k")
+	_, ok = <-changes
+	assert.False(t, ok, "expected watches of a closed router to end")
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import "golang.org/x/net/context"
+
+// GetWriteClient returns the client of the owner of key, the primary of its
+// replicas, regardless of the policy of WithPolicy and of the fallbacks of
+// GetClient, so writes stay single-homed while reads are spread with
+// GetReadClient, eg. over the followers of FollowerReplica. Keys pinned with
+// Pin go to their pinned destination.
+func (r *router) GetWriteClient(key string) (interface{}, error) {
+	if err := r.admit(key); err != nil {
+		return nil, err
+	}
+
+	dests, err := r.lookupN(context.Background(), key, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(dests) == 0 {
+		return nil, wrapError(ErrLookupFailed, errNoMembers)
+	}
+	return r.getClientForDest(dests[0])
+}
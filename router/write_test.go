@@ -0,0 +1,60 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+func TestGetWriteClient(t *testing.T) {
+	r := newPolicyTestRouter(t, nil)
+	r.readPolicy = FollowerReplica(3)
+	r.ringpop.(*mocks.Ringpop).On("LookupN", "key", 1).Return([]string{"127.0.0.1:3001"}, nil)
+
+	read, err := r.GetReadClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", read, "expected reads to go to a follower")
+
+	write, err := r.GetWriteClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", write, "expected writes to go to the owner")
+}
+
+func TestGetWriteClientIgnoresPolicy(t *testing.T) {
+	r := newPolicyTestRouter(t, FollowerReplica(3))
+	r.ringpop.(*mocks.Ringpop).On("LookupN", "key", 1).Return([]string{"127.0.0.1:3001"}, nil)
+
+	client, err := r.GetClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client)
+
+	client, err = r.GetWriteClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3001", client)
+
+	r.Pin("key", "127.0.0.1:3003")
+	client, err = r.GetWriteClient("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3003", client, "expected pinned keys to go to their pin")
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+// zoneOf returns the zone of member, the value of its label named by
+// WithZoneRouting, or the empty string when it has none.
+func (r *router) zoneOf(member string) string {
+	labels, _ := r.memberLabels(member)
+	return labels[r.zoneLabel]
+}
+
+// localZone returns the zone of the local node. It is read once, as long as
+// the labels of the local node can be read, and kept until the address of
+// the local node is forgotten, see forgetSelf.
+func (r *router) localZone() (string, error) {
+	r.zoneMu.RLock()
+	zone, known := r.selfZone, r.selfZoneKnown
+	r.zoneMu.RUnlock()
+	if known {
+		return zone, nil
+	}
+
+	me, err := r.whoAmI()
+	if err != nil {
+		return "", err
+	}
+	labels, err := r.memberLabels(me)
+	if err != nil {
+		return "", err
+	}
+	zone = labels[r.zoneLabel]
+
+	r.zoneMu.Lock()
+	r.selfZone, r.selfZoneKnown = zone, true
+	r.zoneMu.Unlock()
+	return zone, nil
+}
+
+// zoneRingView is the RingView policies select from with WithZoneRouting:
+// the nodes responsible for a key are, among the first zoneReplicas of them,
+// the healthy nodes in the zone of the local node or, when there are none,
+// the healthy nodes of the other zones. Keys of which no node is healthy keep
+// all of their nodes.
+type zoneRingView struct {
+	routerRingView
+}
+
+func (v zoneRingView) Lookup(key string) (string, error) {
+	dests, err := v.LookupN(key, 1)
+	if err != nil {
+		return "", err
+	}
+	return firstOrLookup(key, dests, v.routerRingView)
+}
+
+func (v zoneRingView) LookupN(key string, n int) ([]string, error) {
+	replicas := v.r.zoneReplicas
+	if replicas < n {
+		replicas = n
+	}
+	dests, err := v.routerRingView.LookupN(key, replicas)
+	if err != nil {
+		return nil, err
+	}
+	local, err := v.r.localZone()
+	if err != nil {
+		return nil, err
+	}
+
+	var near, far []string
+	for _, dest := range dests {
+		if !v.Healthy(dest) {
+			continue
+		}
+		if v.r.zoneOf(dest) == local {
+			near = append(near, dest)
+		} else {
+			far = append(far, dest)
+		}
+	}
+	switch {
+	case len(near) > 0:
+		dests = near
+	case len(far) > 0:
+		dests = far
+	}
+	if len(dests) > n {
+		dests = dests[:n]
+	}
+	return dests, nil
+}
+
+// recordZone counts the client returned for a remote destination as a route
+// within the zone of the local node or across zones, see WithZoneRouting.
+func (r *router) recordZone(entry *cacheEntry) {
+	if r.zoneLabel == "" || entry.local {
+		return
+	}
+	local, err := r.localZone()
+	if err != nil {
+		return
+	}
+	if zone := entry.labels[r.zoneLabel]; zone != "" && zone == local {
+		r.statter.IncCounter("router.route.zone.local", nil, 1)
+	} else {
+		r.statter.IncCounter("router.route.zone.cross", nil, 1)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/uber/ringpop-go/test/mocks"
+)
+
+var memberZones = map[string]string{
+	"127.0.0.1:3000": "us-east-1a",
+	"127.0.0.1:3001": "us-east-1b",
+	"127.0.0.1:3002": "us-east-1a",
+	"127.0.0.1:3003": "us-east-1b",
+	"127.0.0.1:3004": "us-east-1a",
+}
+
+func zoneLabels(dest string) (map[string]string, error) {
+	return map[string]string{"zone": memberZones[dest]}, nil
+}
+
+func newZoneTestRouter(t *testing.T, statter *mocks.StatsReporter, opts ...Option) *router {
+	rp := newTestRingpop(nil)
+	rp.On("LookupN", "near", 3).Return([]string{"127.0.0.1:3001", "127.0.0.1:3002", "127.0.0.1:3003"}, nil)
+	rp.On("LookupN", "far", 3).Return([]string{"127.0.0.1:3003", "127.0.0.1:3001"}, nil)
+	rp.On("LookupN", "spread", 3).Return([]string{"127.0.0.1:3002", "127.0.0.1:3001", "127.0.0.1:3004"}, nil)
+
+	opts = append([]Option{WithRemoteDialer(destDialer), WithLabels(zoneLabels),
+		WithZoneRouting(3, "zone"), WithStatsReporter(statter)}, opts...)
+	return newRingpopTestRouter(t, rp, opts...)
+}
+
+func TestZoneRouting(t *testing.T) {
+	statter := &mocks.StatsReporter{}
+	statter.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	statter.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+	r := newZoneTestRouter(t, statter)
+
+	client, err := r.GetClient("near")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3002", client, "expected the replica in the zone of the local node")
+	statter.AssertCalled(t, "IncCounter", "router.route.zone.local", mock.Anything, int64(1))
+	statter.AssertNotCalled(t, "IncCounter", "router.route.zone.cross", mock.Anything, mock.Anything)
+
+	client, err = r.GetClient("far")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:3003", client, "expected to fall back to another zone")
+	statter.AssertCalled(t, "IncCounter", "router.route.zone.cross", mock.Anything, int64(1))
+}
+
+func TestZoneRoutingComposesPolicy(t *testing.T) {
+	statter := &mocks.StatsReporter{}
+	statter.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	statter.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+	loads := map[string]float64{"127.0.0.1:3001": 0, "127.0.0.1:3002": 5, "127.0.0.1:3004": 1}
+	load := func(member string) float64 { return loads[member] }
+
+	// the policy selects among the replicas in the zone whatever the order
+	// of the options
+	for _, r := range []*router{
+		newZoneTestRouter(t, statter, WithPolicy(LeastLoadedReplica(3, load))),
+		newZoneTestRouter(t, statter, WithPolicy(LeastLoadedReplica(3, load)), WithZoneRouting(3, "zone")),
+	} {
+		client, err := r.GetClient("spread")
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3004", client, "expected the least loaded replica in the zone")
+	}
+}
+
+func TestZoneRoutingReadsLocalZoneOnce(t *testing.T) {
+	statter := &mocks.StatsReporter{}
+	statter.On("IncCounter", mock.Anything, mock.Anything, mock.Anything).Return()
+	statter.On("RecordTimer", mock.Anything, mock.Anything, mock.Anything).Return()
+	var selfReads int
+	labels := func(dest string) (map[string]string, error) {
+		if dest == "127.0.0.1:3000" {
+			selfReads++
+		}
+		return zoneLabels(dest)
+	}
+	r := newZoneTestRouter(t, statter, WithLabels(labels))
+
+	for _, key := range []string{"near", "far", "near"} {
+		_, err := r.GetClient(key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, selfReads, "expected the zone of the local node to be read once")
+
+	r.forgetSelf()
+	_, err := r.GetClient("far")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, selfReads, "expected the zone to be read again with the address of the local node")
+}
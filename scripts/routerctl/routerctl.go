@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command routerctl asks the DebugHandler of a running router where keys go:
+// the hash of every key, the member owning it, its replicas and whether the
+// router has a cached client to the owner.
+//
+//	routerctl -addr 10.0.0.1:8080 -n 3 user:42 user:43
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/uber/ringpop-go/router"
+)
+
+var (
+	addr     = flag.String("addr", "127.0.0.1:8080", "hostport of the HTTP server of the router")
+	path     = flag.String("path", "/debug/router", "path the DebugHandler of the router is registered on")
+	replicas = flag.Int("n", 1, "number of replicas to look up for every key")
+	timeout  = flag.Duration("timeout", 5*time.Second, "timeout of every request")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: routerctl [flags] key...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tHASH\tOWNER\tLOCAL\tCACHED\tREPLICAS")
+	for _, key := range flag.Args() {
+		route, err := explain(client, key)
+		if err != nil {
+			log.Fatalf("explaining %q: %v", key, err)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%t\t%t\t%s\n", route.Key, route.Hash, route.Destination,
+			route.Local, route.Cached, strings.Join(route.Replicas, ","))
+	}
+	tw.Flush()
+}
+
+// explain returns the route of key from the DebugHandler.
+func explain(client *http.Client, key string) (router.KeyRoute, error) {
+	query := url.Values{"key": {key}, "n": {strconv.Itoa(*replicas)}}
+	u := url.URL{Scheme: "http", Host: *addr, Path: *path, RawQuery: query.Encode()}
+
+	var route router.KeyRoute
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return route, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return route, fmt.Errorf("%s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&route)
+	return route, err
+}
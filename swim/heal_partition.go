@@ -71,7 +71,7 @@ func nodesThatNeedToReincarnate(MA, MB []Change) (changesForA, changesForB []Cha
 
 		// If a node would be overwritten and would stop being pingable, it is
 		// not suited for merging.
-		if b.isPingable() && a.overrides(b) && !a.isPingable() {
+		if b.isPingable() && a.Overrides(b) && !a.isPingable() {
 			changesForB = append(changesForB, Change{
 				Address:     a.Address,
 				Incarnation: a.Incarnation,
@@ -79,7 +79,7 @@ func nodesThatNeedToReincarnate(MA, MB []Change) (changesForA, changesForB []Cha
 			})
 		}
 
-		if a.isPingable() && b.overrides(a) && !b.isPingable() {
+		if a.isPingable() && b.Overrides(a) && !b.isPingable() {
 			changesForA = append(changesForA, Change{
 				Address:     b.Address,
 				Incarnation: b.Incarnation,
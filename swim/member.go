@@ -175,7 +175,9 @@ func (c Change) incarnation() int64 {
 	return c.Incarnation
 }
 
-func (c Change) overrides(c2 Change) bool {
+// Overrides returns whether the change c is newer than the change c2 about
+// the same member and should therefore take precedence over it.
+func (c Change) Overrides(c2 Change) bool {
 	if c.Incarnation > c2.Incarnation {
 		return true
 	}